@@ -3,21 +3,33 @@ package main
 import (
 	"context"
 	"flag"
+	"fmt"
+	"io/ioutil"
 	"os"
+	"strings"
+	"time"
 
 	// Import all Kubernetes client auth plugins (e.g. Azure, GCP, OIDC, etc.)
 	_ "k8s.io/client-go/plugin/pkg/client/auth"
 
 	"github.com/isaaguilar/terraform-operator/pkg/apis"
+	tfv1alpha2 "github.com/isaaguilar/terraform-operator/pkg/apis/tf/v1alpha2"
 	"github.com/isaaguilar/terraform-operator/pkg/controllers"
+	"github.com/isaaguilar/terraform-operator/pkg/gitclient"
+	"github.com/isaaguilar/terraform-operator/pkg/gitwebhook"
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/client-go/kubernetes"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/healthz"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
 )
 
 var (
@@ -36,8 +48,33 @@ func main() {
 	var metricsAddr string
 	var enableLeaderElection bool
 	var probeAddr string
+	var gitWebhookAddr string
+	var enableWebhooks bool
+	var configFile string
+	var watchNamespaces string
+	var selector string
+	var maxConcurrentReconciles int
+	var sourceFetchWorkers int
+	var gitCacheDir string
+	var gitCacheSize string
 	flag.StringVar(&metricsAddr, "metrics-bind-address", ":8080", "The address the metric endpoint binds to.")
 	flag.StringVar(&probeAddr, "health-probe-bind-address", ":8081", "The address the probe endpoint binds to.")
+	flag.StringVar(&gitWebhookAddr, "git-webhook-bind-address", "", "The address the git push webhook endpoint binds to. "+
+		"The endpoint is disabled when empty. The shared secret is read from the TFO_GIT_WEBHOOK_SECRET env var.")
+	flag.BoolVar(&enableWebhooks, "enable-webhooks", false, "Serve the conversion and admission webhooks on port 9443. "+
+		"The serving certs are read from /tmp/k8s-webhook-server/serving-certs.")
+	flag.StringVar(&configFile, "config", "", "The path of the operator config file, eg a mounted ConfigMap. "+
+		"The file is reloaded when it changes.")
+	flag.StringVar(&watchNamespaces, "watch-namespaces", "", "A comma separated list of the namespaces the operator watches. "+
+		"All namespaces are watched when empty.")
+	flag.StringVar(&selector, "selector", "", "A label selector, eg \"team=a\", that limits the Terraform and TerraformSet "+
+		"resources the operator reconciles. All resources are reconciled when empty.")
+	flag.IntVar(&maxConcurrentReconciles, "max-concurrent-reconciles", 1, "The number of Terraform resources that are reconciled at once.")
+	flag.IntVar(&sourceFetchWorkers, "source-fetch-workers", 4, "The number of Terraform resources whose sources are downloaded at once.")
+	flag.StringVar(&gitCacheDir, "git-cache-dir", "", "The directory where git repos are mirrored so that downloading them "+
+		"again only fetches new commits. A mirror fetches all the branches and tags of the repo with their full history. "+
+		"Repos are cloned every time when empty.")
+	flag.StringVar(&gitCacheSize, "git-cache-size", "2Gi", "The disk space the git mirrors can take before the least recently used ones are removed.")
 	flag.BoolVar(&enableLeaderElection, "leader-elect", false,
 		"Enable leader election for controller manager. "+
 			"Enabling this will ensure there is only one active controller manager.")
@@ -49,28 +86,172 @@ func main() {
 
 	ctrl.SetLogger(zap.New(zap.UseFlagOptions(&opts)))
 
-	mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), ctrl.Options{
+	var labelSelector labels.Selector
+	if selector != "" {
+		var err error
+		labelSelector, err = labels.Parse(selector)
+		if err != nil {
+			setupLog.Error(err, "unable to parse selector")
+			os.Exit(1)
+		}
+	}
+
+	options := ctrl.Options{
 		Scheme:                 scheme,
 		MetricsBindAddress:     metricsAddr,
 		Port:                   9443,
 		HealthProbeBindAddress: probeAddr,
 		LeaderElection:         enableLeaderElection,
 		LeaderElectionID:       "050c8fba.isaaguilar.com",
-	})
+		// Secrets are read directly from the api so the operator only needs
+		// "get" on them and never lists or watches secrets
+		ClientDisableCacheFor: []client.Object{&corev1.Secret{}},
+	}
+	namespaces := []string{}
+	for _, ns := range strings.Split(watchNamespaces, ",") {
+		if ns = strings.TrimSpace(ns); ns != "" {
+			namespaces = append(namespaces, ns)
+		}
+	}
+	if len(namespaces) == 1 {
+		options.Namespace = namespaces[0]
+	} else if len(namespaces) > 1 {
+		options.NewCache = cache.MultiNamespacedCacheBuilder(namespaces)
+	}
+	if len(namespaces) > 0 {
+		setupLog.Info(fmt.Sprintf("Watching namespaces %s", strings.Join(namespaces, ", ")))
+	}
+
+	mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), options)
 	if err != nil {
 		setupLog.Error(err, "unable to start manager")
 		os.Exit(1)
 	}
 
-	if err = (&controllers.ReconcileTerraform{
-		Client:   mgr.GetClient(),
-		Log:      ctrl.Log.WithName("terraform_controller"),
-		Recorder: mgr.GetEventRecorderFor("terraform-controller"),
-		Scheme:   mgr.GetScheme(),
-	}).SetupWithManager(mgr); err != nil {
+	operatorConfig := controllers.DefaultOperatorConfig()
+	if configFile != "" {
+		data, err := ioutil.ReadFile(configFile)
+		if err != nil {
+			setupLog.Error(err, "unable to read operator config")
+			os.Exit(1)
+		}
+		operatorConfig, err = controllers.ParseOperatorConfig(data)
+		if err != nil {
+			setupLog.Error(err, "unable to load operator config")
+			os.Exit(1)
+		}
+	}
+	configStore := controllers.NewOperatorConfigStore(operatorConfig)
+	if configFile != "" {
+		err = mgr.Add(controllers.OperatorConfigWatcher{
+			Path:     configFile,
+			Interval: 10 * time.Second,
+			Store:    configStore,
+			Log:      ctrl.Log.WithName("operator_config"),
+		})
+		if err != nil {
+			setupLog.Error(err, "unable to watch operator config")
+			os.Exit(1)
+		}
+	}
+
+	// Downloads of a previous process that was stopped are never cleaned up
+	if err := controllers.RemoveStaleRepoDirs(); err != nil {
+		setupLog.Error(err, "unable to remove stale downloads")
+	}
+	var gitMirrors *gitclient.MirrorCache
+	if gitCacheDir != "" {
+		size, err := resource.ParseQuantity(gitCacheSize)
+		if err != nil {
+			setupLog.Error(err, "unable to parse git-cache-size")
+			os.Exit(1)
+		}
+		gitMirrors, err = gitclient.NewMirrorCache(gitCacheDir, size.Value())
+		if err != nil {
+			setupLog.Error(err, "unable to create git cache")
+			os.Exit(1)
+		}
+	}
+
+	reconciler := &controllers.ReconcileTerraform{
+		Client:                  mgr.GetClient(),
+		Log:                     ctrl.Log.WithName("terraform_controller"),
+		Recorder:                mgr.GetEventRecorderFor("terraform-controller"),
+		Scheme:                  mgr.GetScheme(),
+		Clientset:               kubernetes.NewForConfigOrDie(mgr.GetConfig()),
+		Config:                  configStore,
+		Selector:                labelSelector,
+		MaxConcurrentReconciles: maxConcurrentReconciles,
+		SourceFetchWorkers:      sourceFetchWorkers,
+		GitMirrors:              gitMirrors,
+	}
+	if err = reconciler.SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "Cluster")
 		os.Exit(1)
 	}
+
+	if err = (&controllers.ReconcileTerraformSet{
+		Client:     mgr.GetClient(),
+		Log:        ctrl.Log.WithName("terraformset_controller"),
+		Recorder:   mgr.GetEventRecorderFor("terraformset-controller"),
+		Scheme:     mgr.GetScheme(),
+		Selector:   labelSelector,
+		GitMirrors: gitMirrors,
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "TerraformSet")
+		os.Exit(1)
+	}
+
+	if enableWebhooks {
+		// Serves the /convert endpoint for the crd's conversion webhook
+		if err = ctrl.NewWebhookManagedBy(mgr).For(&tfv1alpha2.Terraform{}).Complete(); err != nil {
+			setupLog.Error(err, "unable to create conversion webhook")
+			os.Exit(1)
+		}
+		mgr.GetWebhookServer().Register(controllers.ValidatingWebhookPath, &webhook.Admission{
+			Handler: &controllers.TerraformValidator{},
+		})
+		mgr.GetWebhookServer().Register(controllers.MutatingWebhookPath, &webhook.Admission{
+			Handler: &controllers.TerraformDefaulter{Config: configStore, Client: mgr.GetClient()},
+		})
+		mgr.GetWebhookServer().Register(controllers.DefaultsValidatingWebhookPath, &webhook.Admission{
+			Handler: &controllers.TerraformDefaultsValidator{Client: mgr.GetClient()},
+		})
+	}
+
+	// The migration rewrites every tf resource of the cluster. An operator
+	// that only sees some of them can not mark the migration as done.
+	if len(namespaces) == 0 && labelSelector == nil {
+		err = mgr.Add(controllers.StorageVersionMigrator{
+			Client: mgr.GetClient(),
+			Reader: mgr.GetAPIReader(),
+			Log:    ctrl.Log.WithName("storage_migration"),
+		})
+		if err != nil {
+			setupLog.Error(err, "unable to set up storage version migration")
+			os.Exit(1)
+		}
+	}
+
+	if gitWebhookAddr != "" {
+		secret := os.Getenv("TFO_GIT_WEBHOOK_SECRET")
+		if secret == "" {
+			setupLog.Error(fmt.Errorf("TFO_GIT_WEBHOOK_SECRET is not set"), "unable to set up git webhook")
+			os.Exit(1)
+		}
+		err = mgr.Add(gitwebhook.Server{
+			Addr: gitWebhookAddr,
+			Handler: gitwebhook.Handler{
+				Secret: []byte(secret),
+				OnPush: reconciler.EnqueueGitPush,
+				Log:    ctrl.Log.WithName("git_webhook"),
+			},
+		})
+		if err != nil {
+			setupLog.Error(err, "unable to set up git webhook")
+			os.Exit(1)
+		}
+	}
 	// +kubebuilder:scaffold:builder
 	cache := mgr.GetCache()
 	if err := cache.IndexField(context.TODO(), &corev1.Pod{}, "metadata.generateName", func(obj client.Object) []string {
@@ -0,0 +1,153 @@
+package v1alpha1
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/isaaguilar/terraform-operator/pkg/apis/tf/v1alpha2"
+	"sigs.k8s.io/controller-runtime/pkg/conversion"
+)
+
+// conversionDataAnnotation holds the v1alpha2 spec of a resource that was
+// converted to v1alpha1 so that fields v1alpha1 can not express, eg multiple
+// hooks per stage, are not lost when the resource is converted back.
+const conversionDataAnnotation = "tf.isaaguilar.com/conversion-data"
+
+// scriptHook pairs a v1alpha1 script field with the hook it converts to
+type scriptHook struct {
+	stage  v1alpha2.PodType
+	when   v1alpha2.HookWhen
+	script *string
+}
+
+// scriptHooks lists the script fields in the order hooks are converted
+func scriptHooks(spec *TerraformSpec) []scriptHook {
+	return []scriptHook{
+		{v1alpha2.PodInit, v1alpha2.HookPre, &spec.PreInitScript},
+		{v1alpha2.PodInit, v1alpha2.HookPost, &spec.PostInitScript},
+		{v1alpha2.PodPlan, v1alpha2.HookPre, &spec.PrePlanScript},
+		{v1alpha2.PodPlan, v1alpha2.HookPost, &spec.PostPlanScript},
+		{v1alpha2.PodApply, v1alpha2.HookPre, &spec.PreApplyScript},
+		{v1alpha2.PodApply, v1alpha2.HookPost, &spec.PostApplyScript},
+		{v1alpha2.PodInitDelete, v1alpha2.HookPre, &spec.PreInitDeleteScript},
+		{v1alpha2.PodInitDelete, v1alpha2.HookPost, &spec.PostInitDeleteScript},
+		{v1alpha2.PodPlanDelete, v1alpha2.HookPre, &spec.PrePlanDeleteScript},
+		{v1alpha2.PodPlanDelete, v1alpha2.HookPost, &spec.PostPlanDeleteScript},
+		{v1alpha2.PodApplyDelete, v1alpha2.HookPre, &spec.PreApplyDeleteScript},
+		{v1alpha2.PodApplyDelete, v1alpha2.HookPost, &spec.PostApplyDeleteScript},
+	}
+}
+
+// convertJSON copies the fields both versions have in common
+func convertJSON(src, dst interface{}) error {
+	b, err := json.Marshal(src)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, dst)
+}
+
+// ConvertTo converts this Terraform to the hub version (v1alpha2). The script
+// fields become hooks.
+func (src *Terraform) ConvertTo(dstRaw conversion.Hub) error {
+	dst := dstRaw.(*v1alpha2.Terraform)
+	dst.ObjectMeta = src.ObjectMeta
+	if err := convertJSON(src.Spec, &dst.Spec); err != nil {
+		return fmt.Errorf("unable to convert spec: %v", err)
+	}
+	if err := convertJSON(src.Status, &dst.Status); err != nil {
+		return fmt.Errorf("unable to convert status: %v", err)
+	}
+
+	// Hooks that v1alpha1 could not express are restored from the annotation
+	var restored v1alpha2.TerraformSpec
+	if data, found := src.Annotations[conversionDataAnnotation]; found {
+		if err := json.Unmarshal([]byte(data), &restored); err != nil {
+			return fmt.Errorf("unable to read %s annotation: %v", conversionDataAnnotation, err)
+		}
+		dst.Annotations = map[string]string{}
+		for k, v := range src.Annotations {
+			if k != conversionDataAnnotation {
+				dst.Annotations[k] = v
+			}
+		}
+		if len(dst.Annotations) == 0 {
+			dst.Annotations = nil
+		}
+	}
+
+	dst.Spec.Hooks = nil
+	for _, sh := range scriptHooks(&src.Spec) {
+		if *sh.script != "" {
+			dst.Spec.Hooks = append(dst.Spec.Hooks, v1alpha2.Hook{
+				Stage:  sh.stage,
+				When:   sh.when,
+				Script: *sh.script,
+			})
+		}
+		for i, hook := range restored.Hooks {
+			if hook.Stage == sh.stage && hook.When == sh.when && !isScriptHook(restored.Hooks, i) {
+				dst.Spec.Hooks = append(dst.Spec.Hooks, hook)
+			}
+		}
+	}
+	return nil
+}
+
+// ConvertFrom converts from the hub version (v1alpha2) to this version. The
+// first plain script hook of each stage becomes the script field. The full
+// spec is kept in an annotation when there are hooks that do not fit.
+func (dst *Terraform) ConvertFrom(srcRaw conversion.Hub) error {
+	src := srcRaw.(*v1alpha2.Terraform)
+	dst.ObjectMeta = src.ObjectMeta
+	if err := convertJSON(src.Spec, &dst.Spec); err != nil {
+		return fmt.Errorf("unable to convert spec: %v", err)
+	}
+	if err := convertJSON(src.Status, &dst.Status); err != nil {
+		return fmt.Errorf("unable to convert status: %v", err)
+	}
+
+	lossy := false
+	for i, hook := range src.Spec.Hooks {
+		if !isScriptHook(src.Spec.Hooks, i) {
+			lossy = true
+			continue
+		}
+		for _, sh := range scriptHooks(&dst.Spec) {
+			if sh.stage == hook.Stage && sh.when == hook.When {
+				*sh.script = hook.Script
+			}
+		}
+	}
+	if !lossy {
+		return nil
+	}
+
+	data, err := json.Marshal(src.Spec)
+	if err != nil {
+		return fmt.Errorf("unable to write %s annotation: %v", conversionDataAnnotation, err)
+	}
+	annotations := map[string]string{}
+	for k, v := range src.Annotations {
+		annotations[k] = v
+	}
+	annotations[conversionDataAnnotation] = string(data)
+	dst.Annotations = annotations
+	return nil
+}
+
+// isScriptHook returns true when the hook at index i can be stored in a
+// v1alpha1 script field. That is the first hook of its stage, and it is an
+// inline script that runs in the scriptRunner image.
+func isScriptHook(hooks []v1alpha2.Hook, i int) bool {
+	hook := hooks[i]
+	if hook.Script == "" || hook.ConfigMapRef != nil || hook.Image != "" {
+		return false
+	}
+	for _, h := range hooks[:i] {
+		if h.Stage == hook.Stage && h.When == hook.When {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,106 @@
+package v1alpha1
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/isaaguilar/terraform-operator/pkg/apis/tf/v1alpha2"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestConvertTo(t *testing.T) {
+	src := &Terraform{
+		ObjectMeta: metav1.ObjectMeta{Name: "tf", Namespace: "default"},
+		Spec: TerraformSpec{
+			TerraformVersion: "1.0.2",
+			TerraformModule:  &SrcOpts{Address: "https://github.com/example/infra.git"},
+			PreInitScript:    "echo preinit",
+			PostApplyScript:  "echo postapply",
+		},
+		Status: TerraformStatus{Phase: PhaseRunning},
+	}
+	dst := &v1alpha2.Terraform{}
+	if err := src.ConvertTo(dst); err != nil {
+		t.Fatal(err)
+	}
+	want := []v1alpha2.Hook{
+		{Stage: v1alpha2.PodInit, When: v1alpha2.HookPre, Script: "echo preinit"},
+		{Stage: v1alpha2.PodApply, When: v1alpha2.HookPost, Script: "echo postapply"},
+	}
+	if !reflect.DeepEqual(dst.Spec.Hooks, want) {
+		t.Errorf("hooks = %+v, want %+v", dst.Spec.Hooks, want)
+	}
+	if dst.Spec.TerraformVersion != "1.0.2" || dst.Spec.TerraformModule.Address != src.Spec.TerraformModule.Address {
+		t.Errorf("spec was not copied: %+v", dst.Spec)
+	}
+	if dst.Status.Phase != v1alpha2.PhaseRunning {
+		t.Errorf("phase = %q, want %q", dst.Status.Phase, v1alpha2.PhaseRunning)
+	}
+}
+
+func TestConvertRoundTrip(t *testing.T) {
+	hooks := []v1alpha2.Hook{
+		{Stage: v1alpha2.PodInit, When: v1alpha2.HookPre, Script: "echo one"},
+		{Stage: v1alpha2.PodInit, When: v1alpha2.HookPre, Script: "echo two"},
+		{Stage: v1alpha2.PodPlan, When: v1alpha2.HookPost, Image: "alpine:3", Script: "echo plan"},
+		{Stage: v1alpha2.PodApply, When: v1alpha2.HookPre, ConfigMapRef: &corev1.ConfigMapKeySelector{
+			LocalObjectReference: corev1.LocalObjectReference{Name: "scripts"},
+			Key:                  "apply.sh",
+		}},
+		{Stage: v1alpha2.PodApply, When: v1alpha2.HookPre, Script: "echo apply"},
+	}
+	hub := &v1alpha2.Terraform{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "tf",
+			Annotations: map[string]string{"keep": "me"},
+		},
+		Spec: v1alpha2.TerraformSpec{Hooks: hooks},
+	}
+
+	spoke := &Terraform{}
+	if err := spoke.ConvertFrom(hub); err != nil {
+		t.Fatal(err)
+	}
+	if spoke.Spec.PreInitScript != "echo one" {
+		t.Errorf("preInitScript = %q, want %q", spoke.Spec.PreInitScript, "echo one")
+	}
+	if spoke.Spec.PostPlanScript != "" || spoke.Spec.PreApplyScript != "" {
+		t.Errorf("hooks with an image or configMapRef should not be scripts: %+v", spoke.Spec)
+	}
+	if _, found := spoke.Annotations[conversionDataAnnotation]; !found {
+		t.Fatal("expected the conversion data annotation")
+	}
+	if _, found := hub.Annotations[conversionDataAnnotation]; found {
+		t.Fatal("the hub's annotations should not be modified")
+	}
+
+	back := &v1alpha2.Terraform{}
+	if err := spoke.ConvertTo(back); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(back.Spec.Hooks, hooks) {
+		t.Errorf("hooks = %+v, want %+v", back.Spec.Hooks, hooks)
+	}
+	if !reflect.DeepEqual(back.Annotations, map[string]string{"keep": "me"}) {
+		t.Errorf("annotations = %v", back.Annotations)
+	}
+}
+
+func TestConvertFromWithoutLoss(t *testing.T) {
+	hub := &v1alpha2.Terraform{
+		Spec: v1alpha2.TerraformSpec{Hooks: []v1alpha2.Hook{
+			{Stage: v1alpha2.PodApplyDelete, When: v1alpha2.HookPre, Script: "echo destroy"},
+		}},
+	}
+	spoke := &Terraform{}
+	if err := spoke.ConvertFrom(hub); err != nil {
+		t.Fatal(err)
+	}
+	if spoke.Spec.PreApplyDeleteScript != "echo destroy" {
+		t.Errorf("preApplyDeleteScript = %q, want %q", spoke.Spec.PreApplyDeleteScript, "echo destroy")
+	}
+	if len(spoke.Annotations) != 0 {
+		t.Errorf("annotations = %v, want none", spoke.Annotations)
+	}
+}
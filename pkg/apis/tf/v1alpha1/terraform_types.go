@@ -53,7 +53,8 @@ type TerraformSpec struct {
 	SetupRunnerPullPolicy     corev1.PullPolicy `json:"setupRunnerPullPolicy,omitempty"`
 
 	// TerraformModule is the terraform module scm address. Currently supports
-	// git protocol over SSH or HTTPS
+	// git protocol over SSH or HTTPS. The files of a small module can be
+	// defined inline instead.
 	TerraformModule *SrcOpts `json:"terraformModule"`
 
 	Sources []*SrcOpts      `json:"sources,omitempty"`
@@ -134,15 +135,76 @@ type TerraformSpec struct {
 	// Enterprise Github servers running on a private network.
 	SSHTunnel *ProxyOpts `json:"sshTunnel,omitempty"`
 
+	// SSHTunnels are named tunnels that sources and SCMAuthMethods select
+	// with their `sshTunnel`. Downloads that do not select one use
+	// SSHTunnel.
+	SSHTunnels []ProxyOpts `json:"sshTunnels,omitempty"`
+
+	// HTTPProxy configures the runner pods to reach https git hosts and
+	// module registries through a proxy, eg during `terraform init`.
+	HTTPProxy *HTTPProxyOpts `json:"httpProxy,omitempty"`
+
 	// SCMAuthMethods define multiple SCMs that require tokens/keys
 	SCMAuthMethods []SCMAuthMethod `json:"scmAuthMethods,omitempty"`
+
+	// Notifications are http endpoints that get a json payload POSTed to them
+	// when the terraform run reaches certain stages. This is useful for
+	// sending run updates to chat tools instead of having to watch events.
+	Notifications []Notification `json:"notifications,omitempty"`
+
+	// Priority orders the runs waiting for the operator's concurrency limits.
+	// Runs with a higher priority start first. Defaults to 0.
+	Priority int32 `json:"priority,omitempty"`
 }
 
+// Notification configures an http endpoint that is notified of run events
+type Notification struct {
+	// URL is the http(s) endpoint the payload is POSTed to
+	URL string `json:"url"`
+
+	// SigningSecretRef is an optional secret used to sign the request body
+	// with HMAC-SHA256. The signature is sent in the "X-TFO-Signature" header
+	// as "sha256=<hex digest>". The Key defaults to `token`.
+	SigningSecretRef *TokenSecretRef `json:"signingSecretRef,omitempty"`
+
+	// Template is an optional go text/template used to render the request
+	// body. The template is executed with the notification payload, eg
+	// `{"text": "{{ .Name }} {{ .Event }}"}`. When omitted, the payload is
+	// sent as json.
+	Template string `json:"template,omitempty"`
+
+	// Events filters the events sent to this endpoint. Defaults to all events.
+	Events []NotificationEvent `json:"events,omitempty"`
+}
+
+// NotificationEvent is the type of event that triggers a notification
+type NotificationEvent string
+
+const (
+	// NotifyRunStarted is sent when the init pod of a run is created
+	NotifyRunStarted NotificationEvent = "run-started"
+	// NotifyPlanReady is sent when the plan pod completes successfully
+	NotifyPlanReady NotificationEvent = "plan-ready"
+	// NotifyApplySucceeded is sent when the apply pod completes successfully
+	NotifyApplySucceeded NotificationEvent = "apply-succeeded"
+	// NotifyApplyFailed is sent when the apply pod fails
+	NotifyApplyFailed NotificationEvent = "apply-failed"
+	// NotifyDriftDetected is sent when a plan for a generation that has
+	// already been applied reports changes
+	NotifyDriftDetected NotificationEvent = "drift-detected"
+)
+
 // SCMAuthMethod definition of SCMs that require tokens/keys
 type SCMAuthMethod struct {
 	Host string `json:"host"`
 	// SCM define the SCM for a host which is defined at a higher-level
 	Git *GitSCM `json:"git,omitempty"`
+	// KnownHosts verifies the ssh host key of the host. Any host key is
+	// accepted when omitted.
+	KnownHosts *KnownHosts `json:"knownHosts,omitempty"`
+	// SSHTunnel is the name of the spec's sshTunnels entry that the host is
+	// reached through. The spec's sshTunnel is used when omitted.
+	SSHTunnel string `json:"sshTunnel,omitempty"`
 }
 
 // GitSCM define the auth methods of git
@@ -157,12 +219,33 @@ type GitSSH struct {
 	SSHKeySecretRef *SSHKeySecretRef `json:"sshKeySecretRef"`
 }
 
-// GitHTTPS configures the setup for git over https using tokens. Proxy is not
-// supported in the terraform job pod at this moment
-// TODO HTTPS Proxy support
+// GitHTTPS configures the setup for git over https using tokens
 type GitHTTPS struct {
-	RequireProxy   bool            `json:"requireProxy,omitempty"`
-	TokenSecretRef *TokenSecretRef `json:"tokenSecretRef"`
+	// RequireProxy clones the host's repos through the spec.sshTunnel. The
+	// runner pods reach the host through a SOCKS5 proxy over the tunnel.
+	RequireProxy bool `json:"requireProxy,omitempty"`
+	// TokenSecretRef is the secret with a static token. Only one of
+	// TokenSecretRef or GitHubApp can be set.
+	TokenSecretRef *TokenSecretRef `json:"tokenSecretRef,omitempty"`
+	// GitHubApp authenticates with the short-lived installation tokens of a
+	// GitHub App instead of a static token
+	GitHubApp *GitHubApp `json:"githubApp,omitempty"`
+}
+
+// GitHubApp configures the GitHub App installation the operator mints
+// installation tokens for. The tokens are refreshed before they expire.
+type GitHubApp struct {
+	// AppID is the ID of the GitHub App
+	AppID int64 `json:"appID"`
+	// InstallationID is the ID of the app's installation on the organization
+	// or user that owns the repos
+	InstallationID int64 `json:"installationID"`
+	// PrivateKeySecretRef is the secret with the app's PEM private key. The
+	// default key is `private-key.pem`
+	PrivateKeySecretRef *TokenSecretRef `json:"privateKeySecretRef"`
+	// APIURL is the api of a GitHub Enterprise server, eg
+	// https://github.example.com/api/v3. Defaults to https://api.github.com
+	APIURL string `json:"apiURL,omitempty"`
 }
 
 // +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
@@ -178,7 +261,8 @@ type TerraformList struct {
 // exported to a different git repo. The main use-case for this would be to
 // allow terraform execution outside of the terraform-operator for any reason
 type ExportRepo struct {
-	// Address is the git repo to save to. At this time, only SSH is allowed
+	// Address is the git repo to save to. Https addresses push with the token
+	// of the host's SCMAuthMethod.
 	Address string `json:"address"`
 
 	// TFVarsFile is the full path relative to the root of the repo
@@ -186,6 +270,57 @@ type ExportRepo struct {
 
 	// ConfFile is the full path relative to the root of the repo
 	ConfFile string `json:"confFile,omitempty"`
+
+	// Branch is the branch the export is pushed to. Defaults to the ref of
+	// the address or `master`. With a PullRequest, the branch is recreated
+	// from the base branch on every export and defaults to
+	// `terraform-operator/<name>`.
+	Branch string `json:"branch,omitempty"`
+
+	// CommitAuthor is the author of the export commits. Defaults to
+	// `devops-automation <devops-automation@example.com>`.
+	CommitAuthor *CommitAuthor `json:"commitAuthor,omitempty"`
+
+	// CommitMessage is an optional go text/template of the commit message.
+	// The template is executed with the `.Name`, `.Namespace`, `.Generation`
+	// and `.Files` of the export.
+	CommitMessage string `json:"commitMessage,omitempty"`
+
+	// PullRequest opens a pull request from the Branch instead of pushing to
+	// the base branch, eg when the base branch is protected
+	PullRequest *ExportPullRequest `json:"pullRequest,omitempty"`
+}
+
+// CommitAuthor is the author of a commit. The name and the email are go
+// text/templates executed like the commit message.
+type CommitAuthor struct {
+	Name  string `json:"name,omitempty"`
+	Email string `json:"email,omitempty"`
+}
+
+// ExportPullRequest opens a pull request, a merge request in GitLab, through
+// the api of the export repo's host. An open pull request from the branch is
+// updated instead.
+type ExportPullRequest struct {
+	// Provider is the api of the host, one of `github`, `gitlab` or `gitea`
+	Provider string `json:"provider"`
+
+	// APIURL is the url of the api. Defaults to api.github.com for
+	// github.com and to the provider's api on the host otherwise.
+	APIURL string `json:"apiURL,omitempty"`
+
+	// BaseBranch is the branch the pull request merges into. Defaults to the
+	// ref of the address or `master`.
+	BaseBranch string `json:"baseBranch,omitempty"`
+
+	// Title and Body are optional go text/templates executed like the commit
+	// message. The body defaults to the commit message.
+	Title string `json:"title,omitempty"`
+	Body  string `json:"body,omitempty"`
+
+	// TokenSecretRef is the token of the api. Defaults to the https token of
+	// the host's SCMAuthMethod.
+	TokenSecretRef *TokenSecretRef `json:"tokenSecretRef,omitempty"`
 }
 
 // ReconcileTerraformDeployment is used to configure auto watching the resources
@@ -208,7 +343,17 @@ type Source struct {
 
 // ConfigMapOpts used to define the configmap and relevant data keys
 type ConfigMapOpts struct {
-	Name string   `json:"name"`
+	// Name of the ConfigMap in the resource's namespace
+	Name string `json:"name"`
+	// Keys to read from the ConfigMap. All keys are read when omitted.
+	Keys []string `json:"keys,omitempty"`
+}
+
+// SecretOpts used to define the secret and relevant data keys
+type SecretOpts struct {
+	// Name of the Secret in the resource's namespace
+	Name string `json:"name"`
+	// Keys to read from the Secret. All keys are read when omitted.
 	Keys []string `json:"keys,omitempty"`
 }
 
@@ -221,18 +366,101 @@ type SrcOpts struct {
 	// When downloading `tfvars`, the double slash `//` syntax is used to
 	// define dir or tfvar files. This can be used multiple times for
 	// multiple items.
-	Address string `json:"address"`
+	Address string `json:"address,omitempty"`
+
+	// ConfigMap reads the keys of a ConfigMap instead of downloading an
+	// address. Keys ending in `.tfvars` are merged into the tfvars and the
+	// other keys are copied into the module like files. Only used by sources.
+	ConfigMap *ConfigMapOpts `json:"configMap,omitempty"`
+
+	// Secret reads the keys of a Secret the same way as ConfigMap. Only used
+	// by sources.
+	Secret *SecretOpts `json:"secret,omitempty"`
+
+	// Inline is a map of filenames to the HCL of the files of the module. It
+	// is used instead of an address for small modules that are not worth a
+	// repo. Only used by the terraformModule.
+	Inline map[string]string `json:"inline,omitempty"`
 
 	// Extras will allow for giving the controller specific instructions for
 	// fetching files from the address.
 	Extras []string `json:"extras,omitempty"`
+
+	// PollInterval is how often the controller resolves the ref of the
+	// address, eg "5m". When the resolved commit changes, a new run is
+	// started. Only used by the terraformModule. Polling is disabled when
+	// omitted.
+	PollInterval *metav1.Duration `json:"pollInterval,omitempty"`
+
+	// SSHTunnel is the name of the spec's sshTunnels entry the address is
+	// downloaded through. It takes precedence over the sshTunnel of the
+	// address's SCMAuthMethod.
+	SSHTunnel string `json:"sshTunnel,omitempty"`
 }
 
 // ProxyOpts configures ssh tunnel/socks5 for downloading ssh/https resources
 type ProxyOpts struct {
+	// Name of the tunnel in sshTunnels. Not used by the spec's sshTunnel.
+	Name            string          `json:"name,omitempty"`
 	Host            string          `json:"host,omitempty"`
 	User            string          `json:"user,omitempty"`
 	SSHKeySecretRef SSHKeySecretRef `json:"sshKeySecretRef"`
+	// KnownHosts verifies the ssh host key of the proxy. Any host key is
+	// accepted when omitted.
+	KnownHosts *KnownHosts `json:"knownHosts,omitempty"`
+	// JumpHosts are the ssh servers the proxy is reached through, in order,
+	// like ssh's ProxyJump
+	JumpHosts []JumpHost `json:"jumpHosts,omitempty"`
+}
+
+// JumpHost is an ssh server on the way to a proxy
+type JumpHost struct {
+	Host            string          `json:"host"`
+	User            string          `json:"user,omitempty"`
+	SSHKeySecretRef SSHKeySecretRef `json:"sshKeySecretRef"`
+	// KnownHosts verifies the ssh host key of the jump host. Any host key is
+	// accepted when omitted.
+	KnownHosts *KnownHosts `json:"knownHosts,omitempty"`
+}
+
+// HTTPProxyOpts are the proxy settings of the runner pods. They are set as the
+// standard HTTPS_PROXY, HTTP_PROXY and NO_PROXY environment variables.
+type HTTPProxyOpts struct {
+	// HTTPSProxy is the url of the proxy for https requests, eg
+	// http://proxy.example.com:3128
+	HTTPSProxy string `json:"httpsProxy,omitempty"`
+	// HTTPProxy is the url of the proxy for plain http requests
+	HTTPProxy string `json:"httpProxy,omitempty"`
+	// NoProxy is a comma separated list of hosts and domains that are not
+	// proxied. Localhost and the cluster's service domains are always added.
+	NoProxy string `json:"noProxy,omitempty"`
+	// SSHTunnel sends https requests through a SOCKS5 proxy over the
+	// spec.sshTunnel instead. The runners start the proxy before they run.
+	// Only one of HTTPSProxy or SSHTunnel can be set.
+	SSHTunnel bool `json:"sshTunnel,omitempty"`
+}
+
+// KnownHosts defines where the known_hosts data used to verify ssh host keys
+// is stored. Only one of SecretRef or ConfigMapRef can be set.
+type KnownHosts struct {
+	// SecretRef is the secret with the known_hosts data
+	SecretRef *KnownHostsRef `json:"secretRef,omitempty"`
+	// ConfigMapRef is the configmap with the known_hosts data
+	ConfigMapRef *KnownHostsRef `json:"configMapRef,omitempty"`
+	// Strict rejects hosts that are not in the known_hosts data. Otherwise,
+	// only a host with a key that does not match is rejected.
+	Strict bool `json:"strict,omitempty"`
+}
+
+// KnownHostsRef defines the secret or configmap key with known_hosts data
+type KnownHostsRef struct {
+	// Name of the secret or configmap
+	Name string `json:"name"`
+	// Namespace of the secret or configmap; Default is the namespace of the
+	// terraform resource
+	Namespace string `json:"namespace,omitempty"`
+	// Key in the secret or configmap. Default to `known_hosts`
+	Key string `json:"key,omitempty"`
 }
 
 // SSHKeySecretRef defines the secret where the SSH key (for the proxy, git, etc) is stored
@@ -340,6 +568,14 @@ type TerraformStatus struct {
 	Phase                   StatusPhase `json:"phase"`
 	LastCompletedGeneration int64       `json:"lastCompletedGeneration"`
 	Stages                  []Stage     `json:"stages"`
+
+	// ModuleCommit is the commit of the terraformModule resolved when
+	// `spec.terraformModule.pollInterval` is set
+	ModuleCommit string `json:"moduleCommit,omitempty"`
+
+	// SourcesChecksum is the checksum of the data read from the ConfigMap and
+	// Secret sources. A new run starts when it changes.
+	SourcesChecksum string `json:"sourcesChecksum,omitempty"`
 }
 
 type Stage struct {
@@ -22,6 +22,7 @@ package v1alpha1
 
 import (
 	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	runtime "k8s.io/apimachinery/pkg/runtime"
 )
 
@@ -41,6 +42,22 @@ func (in *AWSCredentials) DeepCopy() *AWSCredentials {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CommitAuthor) DeepCopyInto(out *CommitAuthor) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CommitAuthor.
+func (in *CommitAuthor) DeepCopy() *CommitAuthor {
+	if in == nil {
+		return nil
+	}
+	out := new(CommitAuthor)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *ConfigMapOpts) DeepCopyInto(out *ConfigMapOpts) {
 	*out = *in
@@ -87,9 +104,40 @@ func (in *Credentials) DeepCopy() *Credentials {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ExportPullRequest) DeepCopyInto(out *ExportPullRequest) {
+	*out = *in
+	if in.TokenSecretRef != nil {
+		in, out := &in.TokenSecretRef, &out.TokenSecretRef
+		*out = new(TokenSecretRef)
+		**out = **in
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ExportPullRequest.
+func (in *ExportPullRequest) DeepCopy() *ExportPullRequest {
+	if in == nil {
+		return nil
+	}
+	out := new(ExportPullRequest)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *ExportRepo) DeepCopyInto(out *ExportRepo) {
 	*out = *in
+	if in.CommitAuthor != nil {
+		in, out := &in.CommitAuthor, &out.CommitAuthor
+		*out = new(CommitAuthor)
+		**out = **in
+	}
+	if in.PullRequest != nil {
+		in, out := &in.PullRequest, &out.PullRequest
+		*out = new(ExportPullRequest)
+		(*in).DeepCopyInto(*out)
+	}
 	return
 }
 
@@ -111,6 +159,11 @@ func (in *GitHTTPS) DeepCopyInto(out *GitHTTPS) {
 		*out = new(TokenSecretRef)
 		**out = **in
 	}
+	if in.GitHubApp != nil {
+		in, out := &in.GitHubApp, &out.GitHubApp
+		*out = new(GitHubApp)
+		(*in).DeepCopyInto(*out)
+	}
 	return
 }
 
@@ -124,6 +177,27 @@ func (in *GitHTTPS) DeepCopy() *GitHTTPS {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *GitHubApp) DeepCopyInto(out *GitHubApp) {
+	*out = *in
+	if in.PrivateKeySecretRef != nil {
+		in, out := &in.PrivateKeySecretRef, &out.PrivateKeySecretRef
+		*out = new(TokenSecretRef)
+		**out = **in
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new GitHubApp.
+func (in *GitHubApp) DeepCopy() *GitHubApp {
+	if in == nil {
+		return nil
+	}
+	out := new(GitHubApp)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *GitSCM) DeepCopyInto(out *GitSCM) {
 	*out = *in
@@ -171,6 +245,22 @@ func (in *GitSSH) DeepCopy() *GitSSH {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *HTTPProxyOpts) DeepCopyInto(out *HTTPProxyOpts) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new HTTPProxyOpts.
+func (in *HTTPProxyOpts) DeepCopy() *HTTPProxyOpts {
+	if in == nil {
+		return nil
+	}
+	out := new(HTTPProxyOpts)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *Inline) DeepCopyInto(out *Inline) {
 	*out = *in
@@ -194,10 +284,112 @@ func (in *Inline) DeepCopy() *Inline {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *JumpHost) DeepCopyInto(out *JumpHost) {
+	*out = *in
+	out.SSHKeySecretRef = in.SSHKeySecretRef
+	if in.KnownHosts != nil {
+		in, out := &in.KnownHosts, &out.KnownHosts
+		*out = new(KnownHosts)
+		(*in).DeepCopyInto(*out)
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new JumpHost.
+func (in *JumpHost) DeepCopy() *JumpHost {
+	if in == nil {
+		return nil
+	}
+	out := new(JumpHost)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *KnownHosts) DeepCopyInto(out *KnownHosts) {
+	*out = *in
+	if in.SecretRef != nil {
+		in, out := &in.SecretRef, &out.SecretRef
+		*out = new(KnownHostsRef)
+		**out = **in
+	}
+	if in.ConfigMapRef != nil {
+		in, out := &in.ConfigMapRef, &out.ConfigMapRef
+		*out = new(KnownHostsRef)
+		**out = **in
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KnownHosts.
+func (in *KnownHosts) DeepCopy() *KnownHosts {
+	if in == nil {
+		return nil
+	}
+	out := new(KnownHosts)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *KnownHostsRef) DeepCopyInto(out *KnownHostsRef) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KnownHostsRef.
+func (in *KnownHostsRef) DeepCopy() *KnownHostsRef {
+	if in == nil {
+		return nil
+	}
+	out := new(KnownHostsRef)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *Notification) DeepCopyInto(out *Notification) {
+	*out = *in
+	if in.SigningSecretRef != nil {
+		in, out := &in.SigningSecretRef, &out.SigningSecretRef
+		*out = new(TokenSecretRef)
+		**out = **in
+	}
+	if in.Events != nil {
+		in, out := &in.Events, &out.Events
+		*out = make([]NotificationEvent, len(*in))
+		copy(*out, *in)
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Notification.
+func (in *Notification) DeepCopy() *Notification {
+	if in == nil {
+		return nil
+	}
+	out := new(Notification)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *ProxyOpts) DeepCopyInto(out *ProxyOpts) {
 	*out = *in
 	out.SSHKeySecretRef = in.SSHKeySecretRef
+	if in.KnownHosts != nil {
+		in, out := &in.KnownHosts, &out.KnownHosts
+		*out = new(KnownHosts)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.JumpHosts != nil {
+		in, out := &in.JumpHosts, &out.JumpHosts
+		*out = make([]JumpHost, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
 	return
 }
 
@@ -235,6 +427,11 @@ func (in *SCMAuthMethod) DeepCopyInto(out *SCMAuthMethod) {
 		*out = new(GitSCM)
 		(*in).DeepCopyInto(*out)
 	}
+	if in.KnownHosts != nil {
+		in, out := &in.KnownHosts, &out.KnownHosts
+		*out = new(KnownHosts)
+		(*in).DeepCopyInto(*out)
+	}
 	return
 }
 
@@ -280,6 +477,27 @@ func (in *SecretNameRef) DeepCopy() *SecretNameRef {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SecretOpts) DeepCopyInto(out *SecretOpts) {
+	*out = *in
+	if in.Keys != nil {
+		in, out := &in.Keys, &out.Keys
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SecretOpts.
+func (in *SecretOpts) DeepCopy() *SecretOpts {
+	if in == nil {
+		return nil
+	}
+	out := new(SecretOpts)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *Source) DeepCopyInto(out *Source) {
 	*out = *in
@@ -309,11 +527,33 @@ func (in *Source) DeepCopy() *Source {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *SrcOpts) DeepCopyInto(out *SrcOpts) {
 	*out = *in
+	if in.ConfigMap != nil {
+		in, out := &in.ConfigMap, &out.ConfigMap
+		*out = new(ConfigMapOpts)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Secret != nil {
+		in, out := &in.Secret, &out.Secret
+		*out = new(SecretOpts)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Inline != nil {
+		in, out := &in.Inline, &out.Inline
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
 	if in.Extras != nil {
 		in, out := &in.Extras, &out.Extras
 		*out = make([]string, len(*in))
 		copy(*out, *in)
 	}
+	if in.PollInterval != nil {
+		in, out := &in.PollInterval, &out.PollInterval
+		*out = new(metav1.Duration)
+		**out = **in
+	}
 	return
 }
 
@@ -327,13 +567,31 @@ func (in *SrcOpts) DeepCopy() *SrcOpts {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *Stage) DeepCopyInto(out *Stage) {
+	*out = *in
+	in.StartTime.DeepCopyInto(&out.StartTime)
+	in.StopTime.DeepCopyInto(&out.StopTime)
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Stage.
+func (in *Stage) DeepCopy() *Stage {
+	if in == nil {
+		return nil
+	}
+	out := new(Stage)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *Terraform) DeepCopyInto(out *Terraform) {
 	*out = *in
 	out.TypeMeta = in.TypeMeta
 	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
 	in.Spec.DeepCopyInto(&out.Spec)
-	out.Status = in.Status
+	in.Status.DeepCopyInto(&out.Status)
 	return
 }
 
@@ -429,11 +687,23 @@ func (in *TerraformSpec) DeepCopyInto(out *TerraformSpec) {
 	if in.ExportRepo != nil {
 		in, out := &in.ExportRepo, &out.ExportRepo
 		*out = new(ExportRepo)
-		**out = **in
+		(*in).DeepCopyInto(*out)
 	}
 	if in.SSHTunnel != nil {
 		in, out := &in.SSHTunnel, &out.SSHTunnel
 		*out = new(ProxyOpts)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.SSHTunnels != nil {
+		in, out := &in.SSHTunnels, &out.SSHTunnels
+		*out = make([]ProxyOpts, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.HTTPProxy != nil {
+		in, out := &in.HTTPProxy, &out.HTTPProxy
+		*out = new(HTTPProxyOpts)
 		**out = **in
 	}
 	if in.SCMAuthMethods != nil {
@@ -443,6 +713,13 @@ func (in *TerraformSpec) DeepCopyInto(out *TerraformSpec) {
 			(*in)[i].DeepCopyInto(&(*out)[i])
 		}
 	}
+	if in.Notifications != nil {
+		in, out := &in.Notifications, &out.Notifications
+		*out = make([]Notification, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
 	return
 }
 
@@ -459,6 +736,13 @@ func (in *TerraformSpec) DeepCopy() *TerraformSpec {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *TerraformStatus) DeepCopyInto(out *TerraformStatus) {
 	*out = *in
+	if in.Stages != nil {
+		in, out := &in.Stages, &out.Stages
+		*out = make([]Stage, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
 	return
 }
 
@@ -148,7 +148,7 @@ func schema_pkg_apis_tf_v1alpha1_TerraformSpec(ref common.ReferenceCallback) com
 					},
 					"terraformModule": {
 						SchemaProps: spec.SchemaProps{
-							Description: "TerraformModule is the terraform module scm address. Currently supports git protocol over SSH or HTTPS",
+							Description: "TerraformModule is the terraform module scm address. Currently supports git protocol over SSH or HTTPS. The files of a small module can be defined inline instead.",
 							Ref:         ref("github.com/isaaguilar/terraform-operator/pkg/apis/tf/v1alpha1.SrcOpts"),
 						},
 					},
@@ -325,6 +325,26 @@ func schema_pkg_apis_tf_v1alpha1_TerraformSpec(ref common.ReferenceCallback) com
 							Ref:         ref("github.com/isaaguilar/terraform-operator/pkg/apis/tf/v1alpha1.ProxyOpts"),
 						},
 					},
+					"sshTunnels": {
+						SchemaProps: spec.SchemaProps{
+							Description: "SSHTunnels are named tunnels that sources and SCMAuthMethods select with their `sshTunnel`. Downloads that do not select one use SSHTunnel.",
+							Type:        []string{"array"},
+							Items: &spec.SchemaOrArray{
+								Schema: &spec.Schema{
+									SchemaProps: spec.SchemaProps{
+										Default: map[string]interface{}{},
+										Ref:     ref("github.com/isaaguilar/terraform-operator/pkg/apis/tf/v1alpha1.ProxyOpts"),
+									},
+								},
+							},
+						},
+					},
+					"httpProxy": {
+						SchemaProps: spec.SchemaProps{
+							Description: "HTTPProxy configures the runner pods to reach https git hosts and module registries through a proxy, eg during `terraform init`.",
+							Ref:         ref("github.com/isaaguilar/terraform-operator/pkg/apis/tf/v1alpha1.HTTPProxyOpts"),
+						},
+					},
 					"scmAuthMethods": {
 						SchemaProps: spec.SchemaProps{
 							Description: "SCMAuthMethods define multiple SCMs that require tokens/keys",
@@ -339,12 +359,33 @@ func schema_pkg_apis_tf_v1alpha1_TerraformSpec(ref common.ReferenceCallback) com
 							},
 						},
 					},
+					"notifications": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Notifications are http endpoints that get a json payload POSTed to them when the terraform run reaches certain stages. This is useful for sending run updates to chat tools instead of having to watch events.",
+							Type:        []string{"array"},
+							Items: &spec.SchemaOrArray{
+								Schema: &spec.Schema{
+									SchemaProps: spec.SchemaProps{
+										Default: map[string]interface{}{},
+										Ref:     ref("github.com/isaaguilar/terraform-operator/pkg/apis/tf/v1alpha1.Notification"),
+									},
+								},
+							},
+						},
+					},
+					"priority": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Priority orders the runs waiting for the operator's concurrency limits. Runs with a higher priority start first. Defaults to 0.",
+							Type:        []string{"integer"},
+							Format:      "int32",
+						},
+					},
 				},
 				Required: []string{"terraformModule"},
 			},
 		},
 		Dependencies: []string{
-			"github.com/isaaguilar/terraform-operator/pkg/apis/tf/v1alpha1.Credentials", "github.com/isaaguilar/terraform-operator/pkg/apis/tf/v1alpha1.ExportRepo", "github.com/isaaguilar/terraform-operator/pkg/apis/tf/v1alpha1.ProxyOpts", "github.com/isaaguilar/terraform-operator/pkg/apis/tf/v1alpha1.ReconcileTerraformDeployment", "github.com/isaaguilar/terraform-operator/pkg/apis/tf/v1alpha1.SCMAuthMethod", "github.com/isaaguilar/terraform-operator/pkg/apis/tf/v1alpha1.SrcOpts", "k8s.io/api/core/v1.EnvVar"},
+			"github.com/isaaguilar/terraform-operator/pkg/apis/tf/v1alpha1.Credentials", "github.com/isaaguilar/terraform-operator/pkg/apis/tf/v1alpha1.ExportRepo", "github.com/isaaguilar/terraform-operator/pkg/apis/tf/v1alpha1.HTTPProxyOpts", "github.com/isaaguilar/terraform-operator/pkg/apis/tf/v1alpha1.Notification", "github.com/isaaguilar/terraform-operator/pkg/apis/tf/v1alpha1.ProxyOpts", "github.com/isaaguilar/terraform-operator/pkg/apis/tf/v1alpha1.ReconcileTerraformDeployment", "github.com/isaaguilar/terraform-operator/pkg/apis/tf/v1alpha1.SCMAuthMethod", "github.com/isaaguilar/terraform-operator/pkg/apis/tf/v1alpha1.SrcOpts", "k8s.io/api/core/v1.EnvVar"},
 	}
 }
 
@@ -390,6 +431,20 @@ func schema_pkg_apis_tf_v1alpha1_TerraformStatus(ref common.ReferenceCallback) c
 							},
 						},
 					},
+					"moduleCommit": {
+						SchemaProps: spec.SchemaProps{
+							Description: "ModuleCommit is the commit of the terraformModule resolved when `spec.terraformModule.pollInterval` is set",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"sourcesChecksum": {
+						SchemaProps: spec.SchemaProps{
+							Description: "SourcesChecksum is the checksum of the data read from the ConfigMap and Secret sources. A new run starts when it changes.",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
 				},
 				Required: []string{"podNamePrefix", "phase", "lastCompletedGeneration", "stages"},
 			},
@@ -0,0 +1,4 @@
+// Package v1alpha2 contains API Schema definitions for the tf v1alpha2 API group
+// +k8s:deepcopy-gen=package,register
+// +groupName=tf.isaaguilar.com
+package v1alpha2
@@ -0,0 +1,4 @@
+package v1alpha2
+
+// Hub marks v1alpha2 as the version other versions convert to and from
+func (*Terraform) Hub() {}
@@ -0,0 +1,679 @@
+package v1alpha2
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// EDIT THIS FILE!  THIS IS SCAFFOLDING FOR YOU TO OWN!
+// NOTE: json tags are required.  Any new fields you add must have json tags for the fields to be serialized.
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+// +genclient
+// Terraform is the Schema for the terraforms API
+// +kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp"
+// +k8s:openapi-gen=true
+// +kubebuilder:subresource:status
+// +kubebuilder:resource:path=terraforms,shortName=tf
+// +kubebuilder:singular=terraform
+// +kubebuilder:storageversion
+type Terraform struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   TerraformSpec   `json:"spec,omitempty"`
+	Status TerraformStatus `json:"status,omitempty"`
+}
+
+// TerraformSpec defines the desired state of Terraform
+// +k8s:openapi-gen=true
+type TerraformSpec struct {
+	// INSERT ADDITIONAL SPEC FIELDS - desired state of cluster
+	// Important: Run "operator-sdk generate k8s" to regenerate code after modifying this file
+	// Add custom validation using kubebuilder tags: https://book-v1.book.kubebuilder.io/beyond_basics/generating_crd.html
+
+	// TerraformVersion helps the operator decide which image tag to pull for
+	// the terraform runner. Defaults to "0.11.14"
+	TerraformVersion    string `json:"terraformVersion,omitempty"`
+	ScriptRunnerVersion string `json:"scriptRunnerVersion,omitempty"`
+	SetupRunnerVersion  string `json:"setupRunnerVersion,omitempty"`
+
+	// TerraformRunner gives the user the ability to inject their own container
+	// image to execute terraform. This is very helpful for users who need to
+	// have a certain toolset installed on their images, or who can't pull
+	// public images, such as the default image "isaaguilar/tfops".
+	TerraformRunner string `json:"terraformRunner,omitempty"`
+	ScriptRunner    string `json:"scriptRunner,omitempty"`
+	SetupRunner     string `json:"setupRunner,omitempty"`
+
+	// TerraformRunnerPullPolicy describes a policy for if/when to pull the
+	// TerraformRunner image. Acceptable values are "Always", "Never", or
+	// "IfNotPresent".
+	TerraformRunnerPullPolicy corev1.PullPolicy `json:"terraformRunnerPullPolicy,omitempty"`
+	ScriptRunnerPullPolicy    corev1.PullPolicy `json:"scriptRunnerPullPolicy,omitempty"`
+	SetupRunnerPullPolicy     corev1.PullPolicy `json:"setupRunnerPullPolicy,omitempty"`
+
+	// TerraformModule is the terraform module scm address. Currently supports
+	// git protocol over SSH or HTTPS. The files of a small module can be
+	// defined inline instead.
+	TerraformModule *SrcOpts `json:"terraformModule"`
+
+	Sources []*SrcOpts      `json:"sources,omitempty"`
+	Env     []corev1.EnvVar `json:"env,omitempty"`
+
+	// ServiceAccount use a specific kubernetes ServiceAccount for running the create + destroy pods.
+	// If not specified we create a new ServiceAccount per Terraform
+	ServiceAccount string `json:"serviceAccount,omitempty"`
+
+	// Credentials is an array of credentials generally used for Terraform
+	// providers
+	Credentials []Credentials `json:"credentials,omitempty"`
+
+	// ApplyOnCreate is used to apply any planned changes when the resource is
+	// first created. Omitting this or setting it to false will resort to
+	// on demand apply. Defaults to false.
+	ApplyOnCreate bool `json:"applyOnCreate,omitempty"`
+
+	// ApplyOnUpdate is used to apply any planned changes when the resource is
+	// updated. Omitting this or setting it to false will resort to
+	// on demand apply. Defaults to false.
+	ApplyOnUpdate bool `json:"applyOnUpdate,omitempty"`
+
+	// ApplyOnDelete is used to apply the destroy plan when the terraform
+	// resource is being deleted. Omitting this or setting it to false will
+	// require "on-demand" apply. Defaults to false.
+	ApplyOnDelete bool `json:"applyOnDelete,omitempty"`
+
+	// IgnoreDelete will bypass the finalization process and remove the tf
+	// resource without running any delete jobs.
+	IgnoreDelete bool `json:"ignoreDelete,omitempty"`
+
+	// Reconcile are the settings used for auto-reconciliation
+	Reconcile *ReconcileTerraformDeployment `json:"reconcile,omitempty"`
+
+	// CustomBackend will allow the user to configure the backend of their
+	// choice. If this is omitted, the default consul template will be used.
+	CustomBackend string `json:"customBackend,omitempty"`
+
+	// ExportRepo allows the user to define
+	ExportRepo *ExportRepo `json:"exportRepo,omitempty"`
+
+	// Hooks are scripts that run before or after the terraform commands of a
+	// stage. A stage can have any number of hooks, which run in the order they
+	// are listed. The pods will have already set up cloudProfile (eg cloud
+	// credentials) so the scripts can make use of it.
+	Hooks []Hook `json:"hooks,omitempty"`
+
+	// SSHTunnel can be defined for pulling from scm sources that cannot be
+	// accessed by the network the operator/runner runs in. An example is
+	// Enterprise Github servers running on a private network.
+	SSHTunnel *ProxyOpts `json:"sshTunnel,omitempty"`
+
+	// SSHTunnels are named tunnels that sources and SCMAuthMethods select
+	// with their `sshTunnel`. Downloads that do not select one use
+	// SSHTunnel.
+	SSHTunnels []ProxyOpts `json:"sshTunnels,omitempty"`
+
+	// HTTPProxy configures the runner pods to reach https git hosts and
+	// module registries through a proxy, eg during `terraform init`.
+	HTTPProxy *HTTPProxyOpts `json:"httpProxy,omitempty"`
+
+	// SCMAuthMethods define multiple SCMs that require tokens/keys
+	SCMAuthMethods []SCMAuthMethod `json:"scmAuthMethods,omitempty"`
+
+	// Notifications are http endpoints that get a json payload POSTed to them
+	// when the terraform run reaches certain stages. This is useful for
+	// sending run updates to chat tools instead of having to watch events.
+	Notifications []Notification `json:"notifications,omitempty"`
+
+	// Priority orders the runs waiting for the operator's concurrency limits.
+	// Runs with a higher priority start first. Defaults to 0.
+	Priority int32 `json:"priority,omitempty"`
+}
+
+// Hook is a script that runs before or after a stage
+type Hook struct {
+	// Stage is the terraform stage the hook runs with. One of "init", "plan",
+	// "apply", "init-delete", "plan-delete" or "apply-delete".
+	// +kubebuilder:validation:Enum=init;plan;apply;init-delete;plan-delete;apply-delete
+	Stage PodType `json:"stage"`
+
+	// When is either "pre" to run the hook before the stage's terraform
+	// command or "post" to run it after the command succeeded.
+	// +kubebuilder:validation:Enum=pre;post
+	When HookWhen `json:"when"`
+
+	// Script is the content of the script. Either script or configMapRef must
+	// be set.
+	Script string `json:"script,omitempty"`
+
+	// ConfigMapRef selects a configmap key that holds the script
+	ConfigMapRef *corev1.ConfigMapKeySelector `json:"configMapRef,omitempty"`
+
+	// Image runs the hook in a custom image instead of the scriptRunner. The
+	// image must have "/bin/sh".
+	Image string `json:"image,omitempty"`
+}
+
+// HookWhen is when the hook runs relative to its stage
+type HookWhen string
+
+const (
+	// HookPre runs before the stage's terraform command
+	HookPre HookWhen = "pre"
+	// HookPost runs after the stage's terraform command succeeded
+	HookPost HookWhen = "post"
+)
+
+// Notification configures an http endpoint that is notified of run events
+type Notification struct {
+	// URL is the http(s) endpoint the payload is POSTed to
+	URL string `json:"url"`
+
+	// SigningSecretRef is an optional secret used to sign the request body
+	// with HMAC-SHA256. The signature is sent in the "X-TFO-Signature" header
+	// as "sha256=<hex digest>". The Key defaults to `token`.
+	SigningSecretRef *TokenSecretRef `json:"signingSecretRef,omitempty"`
+
+	// Template is an optional go text/template used to render the request
+	// body. The template is executed with the notification payload, eg
+	// `{"text": "{{ .Name }} {{ .Event }}"}`. When omitted, the payload is
+	// sent as json.
+	Template string `json:"template,omitempty"`
+
+	// Events filters the events sent to this endpoint. Defaults to all events.
+	Events []NotificationEvent `json:"events,omitempty"`
+}
+
+// NotificationEvent is the type of event that triggers a notification
+type NotificationEvent string
+
+const (
+	// NotifyRunStarted is sent when the init pod of a run is created
+	NotifyRunStarted NotificationEvent = "run-started"
+	// NotifyPlanReady is sent when the plan pod completes successfully
+	NotifyPlanReady NotificationEvent = "plan-ready"
+	// NotifyApplySucceeded is sent when the apply pod completes successfully
+	NotifyApplySucceeded NotificationEvent = "apply-succeeded"
+	// NotifyApplyFailed is sent when the apply pod fails
+	NotifyApplyFailed NotificationEvent = "apply-failed"
+	// NotifyDriftDetected is sent when a plan for a generation that has
+	// already been applied reports changes
+	NotifyDriftDetected NotificationEvent = "drift-detected"
+)
+
+// SCMAuthMethod definition of SCMs that require tokens/keys
+type SCMAuthMethod struct {
+	Host string `json:"host"`
+	// SCM define the SCM for a host which is defined at a higher-level
+	Git *GitSCM `json:"git,omitempty"`
+	// KnownHosts verifies the ssh host key of the host. Any host key is
+	// accepted when omitted.
+	KnownHosts *KnownHosts `json:"knownHosts,omitempty"`
+	// SSHTunnel is the name of the spec's sshTunnels entry that the host is
+	// reached through. The spec's sshTunnel is used when omitted.
+	SSHTunnel string `json:"sshTunnel,omitempty"`
+}
+
+// GitSCM define the auth methods of git
+type GitSCM struct {
+	SSH   *GitSSH   `json:"ssh,omitempty"`
+	HTTPS *GitHTTPS `json:"https,omitempty"`
+}
+
+// GitSSH configurs the setup for git over ssh with optional proxy
+type GitSSH struct {
+	RequireProxy    bool             `json:"requireProxy,omitempty"`
+	SSHKeySecretRef *SSHKeySecretRef `json:"sshKeySecretRef"`
+}
+
+// GitHTTPS configures the setup for git over https using tokens
+type GitHTTPS struct {
+	// RequireProxy clones the host's repos through the spec.sshTunnel. The
+	// runner pods reach the host through a SOCKS5 proxy over the tunnel.
+	RequireProxy bool `json:"requireProxy,omitempty"`
+	// TokenSecretRef is the secret with a static token. Only one of
+	// TokenSecretRef or GitHubApp can be set.
+	TokenSecretRef *TokenSecretRef `json:"tokenSecretRef,omitempty"`
+	// GitHubApp authenticates with the short-lived installation tokens of a
+	// GitHub App instead of a static token
+	GitHubApp *GitHubApp `json:"githubApp,omitempty"`
+}
+
+// GitHubApp configures the GitHub App installation the operator mints
+// installation tokens for. The tokens are refreshed before they expire.
+type GitHubApp struct {
+	// AppID is the ID of the GitHub App
+	AppID int64 `json:"appID"`
+	// InstallationID is the ID of the app's installation on the organization
+	// or user that owns the repos
+	InstallationID int64 `json:"installationID"`
+	// PrivateKeySecretRef is the secret with the app's PEM private key. The
+	// default key is `private-key.pem`
+	PrivateKeySecretRef *TokenSecretRef `json:"privateKeySecretRef"`
+	// APIURL is the api of a GitHub Enterprise server, eg
+	// https://github.example.com/api/v3. Defaults to https://api.github.com
+	APIURL string `json:"apiURL,omitempty"`
+}
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// TerraformList contains a list of Terraform
+type TerraformList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []Terraform `json:"items"`
+}
+
+// ExportRepo is used to allow the tfvars passed into the job to also be
+// exported to a different git repo. The main use-case for this would be to
+// allow terraform execution outside of the terraform-operator for any reason
+type ExportRepo struct {
+	// Address is the git repo to save to. Https addresses push with the token
+	// of the host's SCMAuthMethod.
+	Address string `json:"address"`
+
+	// TFVarsFile is the full path relative to the root of the repo
+	TFVarsFile string `json:"tfvarsFile"`
+
+	// ConfFile is the full path relative to the root of the repo
+	ConfFile string `json:"confFile,omitempty"`
+
+	// Branch is the branch the export is pushed to. Defaults to the ref of
+	// the address or `master`. With a PullRequest, the branch is recreated
+	// from the base branch on every export and defaults to
+	// `terraform-operator/<name>`.
+	Branch string `json:"branch,omitempty"`
+
+	// CommitAuthor is the author of the export commits. Defaults to
+	// `devops-automation <devops-automation@example.com>`.
+	CommitAuthor *CommitAuthor `json:"commitAuthor,omitempty"`
+
+	// CommitMessage is an optional go text/template of the commit message.
+	// The template is executed with the `.Name`, `.Namespace`, `.Generation`
+	// and `.Files` of the export.
+	CommitMessage string `json:"commitMessage,omitempty"`
+
+	// PullRequest opens a pull request from the Branch instead of pushing to
+	// the base branch, eg when the base branch is protected
+	PullRequest *ExportPullRequest `json:"pullRequest,omitempty"`
+}
+
+// CommitAuthor is the author of a commit. The name and the email are go
+// text/templates executed like the commit message.
+type CommitAuthor struct {
+	Name  string `json:"name,omitempty"`
+	Email string `json:"email,omitempty"`
+}
+
+// ExportPullRequest opens a pull request, a merge request in GitLab, through
+// the api of the export repo's host. An open pull request from the branch is
+// updated instead.
+type ExportPullRequest struct {
+	// Provider is the api of the host, one of `github`, `gitlab` or `gitea`
+	Provider string `json:"provider"`
+
+	// APIURL is the url of the api. Defaults to api.github.com for
+	// github.com and to the provider's api on the host otherwise.
+	APIURL string `json:"apiURL,omitempty"`
+
+	// BaseBranch is the branch the pull request merges into. Defaults to the
+	// ref of the address or `master`.
+	BaseBranch string `json:"baseBranch,omitempty"`
+
+	// Title and Body are optional go text/templates executed like the commit
+	// message. The body defaults to the commit message.
+	Title string `json:"title,omitempty"`
+	Body  string `json:"body,omitempty"`
+
+	// TokenSecretRef is the token of the api. Defaults to the https token of
+	// the host's SCMAuthMethod.
+	TokenSecretRef *TokenSecretRef `json:"tokenSecretRef,omitempty"`
+}
+
+// ReconcileTerraformDeployment is used to configure auto watching the resources
+// created by terraform and re-applying them automatically if they are not
+// in-sync with the terraform state.
+type ReconcileTerraformDeployment struct {
+	// Enable used to turn on the auto reconciliation of tfstate to actual
+	// provisions. Default to false
+	Enable bool `json:"enable"`
+	// SyncPeriod can be used to set a custom time to check actual provisions
+	// to tfstate. Defaults to 60 minutes
+	SyncPeriod int64 `json:"syncPeriod,omitempty"`
+}
+
+// Source is used to describe details of where to find configs
+type Source struct {
+	Source    *SrcOpts       `json:"source,omitempty"`
+	ConfigMap *ConfigMapOpts `json:"configMap,omitempty"`
+}
+
+// ConfigMapOpts used to define the configmap and relevant data keys
+type ConfigMapOpts struct {
+	// Name of the ConfigMap in the resource's namespace
+	Name string `json:"name"`
+	// Keys to read from the ConfigMap. All keys are read when omitted.
+	Keys []string `json:"keys,omitempty"`
+}
+
+// SecretOpts used to define the secret and relevant data keys
+type SecretOpts struct {
+	// Name of the Secret in the resource's namespace
+	Name string `json:"name"`
+	// Keys to read from the Secret. All keys are read when omitted.
+	Keys []string `json:"keys,omitempty"`
+}
+
+// SrcOpts defines a terraform source location (eg git::SSH or git::HTTPS)
+type SrcOpts struct {
+
+	// Address defines the source address of the tf resources. This this var
+	// will try to accept any format defined in
+	// https://www.terraform.io/docs/modules/sources.html
+	// When downloading `tfvars`, the double slash `//` syntax is used to
+	// define dir or tfvar files. This can be used multiple times for
+	// multiple items.
+	Address string `json:"address,omitempty"`
+
+	// ConfigMap reads the keys of a ConfigMap instead of downloading an
+	// address. Keys ending in `.tfvars` are merged into the tfvars and the
+	// other keys are copied into the module like files. Only used by sources.
+	ConfigMap *ConfigMapOpts `json:"configMap,omitempty"`
+
+	// Secret reads the keys of a Secret the same way as ConfigMap. Only used
+	// by sources.
+	Secret *SecretOpts `json:"secret,omitempty"`
+
+	// Inline is a map of filenames to the HCL of the files of the module. It
+	// is used instead of an address for small modules that are not worth a
+	// repo. Only used by the terraformModule.
+	Inline map[string]string `json:"inline,omitempty"`
+
+	// Extras will allow for giving the controller specific instructions for
+	// fetching files from the address.
+	Extras []string `json:"extras,omitempty"`
+
+	// PollInterval is how often the controller resolves the ref of the
+	// address, eg "5m". When the resolved commit changes, a new run is
+	// started. Only used by the terraformModule. Polling is disabled when
+	// omitted.
+	PollInterval *metav1.Duration `json:"pollInterval,omitempty"`
+
+	// SSHTunnel is the name of the spec's sshTunnels entry the address is
+	// downloaded through. It takes precedence over the sshTunnel of the
+	// address's SCMAuthMethod.
+	SSHTunnel string `json:"sshTunnel,omitempty"`
+}
+
+// ProxyOpts configures ssh tunnel/socks5 for downloading ssh/https resources
+type ProxyOpts struct {
+	// Name of the tunnel in sshTunnels. Not used by the spec's sshTunnel.
+	Name            string          `json:"name,omitempty"`
+	Host            string          `json:"host,omitempty"`
+	User            string          `json:"user,omitempty"`
+	SSHKeySecretRef SSHKeySecretRef `json:"sshKeySecretRef"`
+	// KnownHosts verifies the ssh host key of the proxy. Any host key is
+	// accepted when omitted.
+	KnownHosts *KnownHosts `json:"knownHosts,omitempty"`
+	// JumpHosts are the ssh servers the proxy is reached through, in order,
+	// like ssh's ProxyJump
+	JumpHosts []JumpHost `json:"jumpHosts,omitempty"`
+}
+
+// JumpHost is an ssh server on the way to a proxy
+type JumpHost struct {
+	Host            string          `json:"host"`
+	User            string          `json:"user,omitempty"`
+	SSHKeySecretRef SSHKeySecretRef `json:"sshKeySecretRef"`
+	// KnownHosts verifies the ssh host key of the jump host. Any host key is
+	// accepted when omitted.
+	KnownHosts *KnownHosts `json:"knownHosts,omitempty"`
+}
+
+// HTTPProxyOpts are the proxy settings of the runner pods. They are set as the
+// standard HTTPS_PROXY, HTTP_PROXY and NO_PROXY environment variables.
+type HTTPProxyOpts struct {
+	// HTTPSProxy is the url of the proxy for https requests, eg
+	// http://proxy.example.com:3128
+	HTTPSProxy string `json:"httpsProxy,omitempty"`
+	// HTTPProxy is the url of the proxy for plain http requests
+	HTTPProxy string `json:"httpProxy,omitempty"`
+	// NoProxy is a comma separated list of hosts and domains that are not
+	// proxied. Localhost and the cluster's service domains are always added.
+	NoProxy string `json:"noProxy,omitempty"`
+	// SSHTunnel sends https requests through a SOCKS5 proxy over the
+	// spec.sshTunnel instead. The runners start the proxy before they run.
+	// Only one of HTTPSProxy or SSHTunnel can be set.
+	SSHTunnel bool `json:"sshTunnel,omitempty"`
+}
+
+// KnownHosts defines where the known_hosts data used to verify ssh host keys
+// is stored. Only one of SecretRef or ConfigMapRef can be set.
+type KnownHosts struct {
+	// SecretRef is the secret with the known_hosts data
+	SecretRef *KnownHostsRef `json:"secretRef,omitempty"`
+	// ConfigMapRef is the configmap with the known_hosts data
+	ConfigMapRef *KnownHostsRef `json:"configMapRef,omitempty"`
+	// Strict rejects hosts that are not in the known_hosts data. Otherwise,
+	// only a host with a key that does not match is rejected.
+	Strict bool `json:"strict,omitempty"`
+}
+
+// KnownHostsRef defines the secret or configmap key with known_hosts data
+type KnownHostsRef struct {
+	// Name of the secret or configmap
+	Name string `json:"name"`
+	// Namespace of the secret or configmap; Default is the namespace of the
+	// terraform resource
+	Namespace string `json:"namespace,omitempty"`
+	// Key in the secret or configmap. Default to `known_hosts`
+	Key string `json:"key,omitempty"`
+}
+
+// SSHKeySecretRef defines the secret where the SSH key (for the proxy, git, etc) is stored
+type SSHKeySecretRef struct {
+	// Name the secret name that has the SSH key
+	Name string `json:"name"`
+	// Namespace of the secret; Default is the namespace of the terraform resource
+	Namespace string `json:"namespace,omitempty"`
+	// Key in the secret ref. Default to `id_rsa`
+	Key string `json:"key,omitempty"`
+}
+
+// TokenSecretRef defines the token or password that can be used to log into a system (eg git)
+type TokenSecretRef struct {
+	// Name the secret name that has the token or password
+	Name string `json:"name"`
+	// Namespace of the secret; Default is the namespace of the terraform resource
+	Namespace string `json:"namespace,omitempty"`
+	// Key in the secret ref. Default to `token`
+	Key string `json:"key,omitempty"`
+}
+
+// Credentials are used for adding credentials for terraform providers.
+// For example, in AWS, the AWS Terraform Provider uses the default credential chain
+// of the AWS SDK, one of which are environment variables (eg AWS_ACCESS_KEY_ID/AWS_SECRET_ACCESS_KEY)
+type Credentials struct {
+	// SecretNameRef will load environment variables into the terraform runner
+	// from a kubernetes secret
+	SecretNameRef SecretNameRef `json:"secretNameRef,omitempty"`
+	// AWSCredentials contains the different methods to load AWS credentials
+	// for the Terraform AWS Provider. If using AWS_ACCESS_KEY_ID and/or environment
+	// variables for credentials, use fromEnvs.
+	AWSCredentials AWSCredentials `json:"aws,omitempty"`
+
+	// ServiceAccountAnnotations allows the service account to be annotated with
+	// cloud IAM roles such as Workload Identity on GCP
+	ServiceAccountAnnotations map[string]string `json:"serviceAccountAnnotations,omitempty"`
+
+	// TODO Add other commonly used cloud providers to this list
+}
+
+// AWSCredentials provides a few different k8s-specific methods of adding
+// crednetials to pods. This includes KIAM and IRSA.
+//
+// To use environment variables, use a secretNameRef instead.
+type AWSCredentials struct {
+	// IRSA requires the irsa role-arn as the string input. This will create a
+	// serice account named tf-<resource-name>. In order for the pod to be able to
+	// use this role, the "Trusted Entity" of the IAM role must allow this
+	// serice account name and namespace.
+	//
+	// Using a TrustEntity policy that includes "StringEquals" setting it as the serivce account name
+	// is the most secure way to use IRSA.
+	//
+	// However, for a reusable policy consider "StringLike" with a few wildcards to make
+	// the irsa role usable by pods created by terraform-operator. The example below is
+	// pretty liberal, but will work for any pod created by the terraform-operator.
+	//
+	// {
+	//   "Version": "2012-10-17",
+	//   "Statement": [
+	//     {
+	//       "Effect": "Allow",
+	//       "Principal": {
+	//         "Federated": "${OIDC_ARN}"
+	//       },
+	//       "Action": "sts:AssumeRoleWithWebIdentity",
+	//       "Condition": {
+	//         "StringLike": {
+	//           "${OIDC_URL}:sub": "system:serviceaccount:*:tf-*"
+	//         }
+	//       }
+	//     }
+	//   ]
+	// }
+	IRSA string `json:"irsa,omitempty"`
+
+	// KIAM requires the kiam role-name as the string input. This will add the
+	// correct annotation to the terraform execution pod
+	KIAM string `json:"kiam,omitempty"`
+}
+
+// SecretNameRef is the name of the kubernetes secret to use
+type SecretNameRef struct {
+	// Name of the secret
+	Name string `json:"name"`
+	// Namespace of the secret; Defaults to namespace of the tf resource
+	Namespace string `json:"namespace,omitempty"`
+	// Key of the secret
+	Key string `json:"key,omitempty"`
+}
+
+// Inline definitions of configmaps
+type Inline struct {
+	ConfigMapFiles map[string]string `json:"scripts"`
+}
+
+// TerraformStatus defines the observed state of Terraform
+// +k8s:openapi-gen=true
+type TerraformStatus struct {
+	// INSERT ADDITIONAL STATUS FIELD - define observed state of cluster
+	// Important: Run "operator-sdk generate k8s" to regenerate code after modifying this file
+	// Add custom validation using kubebuilder tags: https://book-v1.book.kubebuilder.io/beyond_basics/generating_crd.html
+	PodNamePrefix           string      `json:"podNamePrefix"`
+	Phase                   StatusPhase `json:"phase"`
+	LastCompletedGeneration int64       `json:"lastCompletedGeneration"`
+	Stages                  []Stage     `json:"stages"`
+
+	// ModuleCommit is the commit of the terraformModule resolved when
+	// `spec.terraformModule.pollInterval` is set
+	ModuleCommit string `json:"moduleCommit,omitempty"`
+
+	// SourcesChecksum is the checksum of the data read from the ConfigMap and
+	// Secret sources. A new run starts when it changes.
+	SourcesChecksum string `json:"sourcesChecksum,omitempty"`
+
+	// MergedDefaults shows the values the spec got from the namespace's
+	// TerraformDefaults. It is empty when the namespace has none.
+	MergedDefaults *MergedDefaults `json:"mergedDefaults,omitempty"`
+
+	// QueuePosition is the position of the current stage in the run queue
+	// while it waits for the operator's concurrency limits, starting at 1. It
+	// is 0 when the stage is not queued.
+	QueuePosition int `json:"queuePosition,omitempty"`
+}
+
+// MergedDefaults is the result of merging a TerraformDefaults into the spec
+type MergedDefaults struct {
+	// Name of the TerraformDefaults
+	Name string `json:"name"`
+
+	// Spec are the merged values of the fields TerraformDefaults supplies
+	Spec TerraformDefaultsSpec `json:"spec"`
+}
+
+type Stage struct {
+	Generation int64      `json:"generation"`
+	State      StageState `json:"state"`
+	PodType    PodType    `json:"podType"`
+
+	// Interruptible is set to false when the pod should not be terminated
+	// such as when doing a terraform apply
+	Interruptible Interruptible `json:"interruptible"`
+	Reason        string        `json:"reason"`
+	StartTime     metav1.Time   `json:"startTime,omitempty"`
+	StopTime      metav1.Time   `json:"stopTime,omitempty"`
+}
+
+type StatusPhase string
+
+const (
+	PhaseInitializing StatusPhase = "initializing"
+	PhaseCompleted    StatusPhase = "completed"
+	PhaseRunning      StatusPhase = "running"
+	PhaseInitDelete   StatusPhase = "initializing-delete"
+	PhaseDeleting     StatusPhase = "deleting"
+	PhaseDeleted      StatusPhase = "deleted"
+)
+
+type PodType string
+
+const (
+	PodPreInitDelete   PodType = "init0-delete"
+	PodInitDelete      PodType = "init-delete"
+	PodPostInitDelete  PodType = "init1-delete"
+	PodPrePlanDelete   PodType = "plan0-delete"
+	PodPlanDelete      PodType = "plan-delete"
+	PodPostPlanDelete  PodType = "plan1-delete"
+	PodPreApplyDelete  PodType = "apply0-delete"
+	PodApplyDelete     PodType = "apply-delete"
+	PodPostApplyDelete PodType = "post-delete"
+
+	PodPreInit   PodType = "init0"
+	PodInit      PodType = "init"
+	PodPostInit  PodType = "init1"
+	PodPrePlan   PodType = "plan0"
+	PodPlan      PodType = "plan"
+	PodPostPlan  PodType = "plan1"
+	PodPreApply  PodType = "apply0"
+	PodApply     PodType = "apply"
+	PodPostApply PodType = "post"
+	PodNil       PodType = ""
+)
+
+type StageState string
+
+const (
+	StateInitializing StageState = "initializing"
+	StateQueued       StageState = "queued"
+	// StateFetchingSources is the state of a stage whose sources are
+	// downloaded in the background before its pod is created
+	StateFetchingSources StageState = "fetching-sources"
+	StateComplete        StageState = "complete"
+	StateFailed          StageState = "failed"
+	StateInProgress      StageState = "in-progress"
+	StateUnknown         StageState = "unknown"
+)
+
+type Interruptible bool
+
+const (
+	CanNotBeInterrupt Interruptible = false
+	CanBeInterrupt    Interruptible = true
+)
+
+func init() {
+	SchemeBuilder.Register(&Terraform{}, &TerraformList{})
+}
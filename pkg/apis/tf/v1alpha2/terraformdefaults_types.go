@@ -0,0 +1,70 @@
+package v1alpha2
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+// +genclient
+// TerraformDefaults supplies defaults that are merged into every Terraform
+// resource in its namespace. A namespace has at most one TerraformDefaults.
+// +kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp"
+// +k8s:openapi-gen=true
+// +kubebuilder:resource:path=terraformdefaults,shortName=tfdefaults,singular=terraformdefault
+type TerraformDefaults struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec TerraformDefaultsSpec `json:"spec,omitempty"`
+}
+
+// TerraformDefaultsSpec are the fields a Terraform resource gets from the
+// TerraformDefaults of its namespace. Values set on the Terraform resource
+// take precedence.
+// +k8s:openapi-gen=true
+type TerraformDefaultsSpec struct {
+	// Credentials are added before the credentials of the Terraform resource
+	Credentials []Credentials `json:"credentials,omitempty"`
+
+	// Env is merged by name with the env of the Terraform resource
+	Env []corev1.EnvVar `json:"env,omitempty"`
+
+	// SCMAuthMethods are merged by host with the scmAuthMethods of the
+	// Terraform resource
+	SCMAuthMethods []SCMAuthMethod `json:"scmAuthMethods,omitempty"`
+
+	// SSHTunnel is used when the Terraform resource does not define one
+	SSHTunnel *ProxyOpts `json:"sshTunnel,omitempty"`
+
+	// HTTPProxy is used when the Terraform resource does not define one
+	HTTPProxy *HTTPProxyOpts `json:"httpProxy,omitempty"`
+
+	// CustomBackend is used when the Terraform resource does not define one
+	CustomBackend string `json:"customBackend,omitempty"`
+
+	// The runner images are used when the Terraform resource does not define
+	// them
+	TerraformVersion          string            `json:"terraformVersion,omitempty"`
+	TerraformRunner           string            `json:"terraformRunner,omitempty"`
+	TerraformRunnerPullPolicy corev1.PullPolicy `json:"terraformRunnerPullPolicy,omitempty"`
+	ScriptRunner              string            `json:"scriptRunner,omitempty"`
+	ScriptRunnerPullPolicy    corev1.PullPolicy `json:"scriptRunnerPullPolicy,omitempty"`
+	ScriptRunnerVersion       string            `json:"scriptRunnerVersion,omitempty"`
+	SetupRunner               string            `json:"setupRunner,omitempty"`
+	SetupRunnerPullPolicy     corev1.PullPolicy `json:"setupRunnerPullPolicy,omitempty"`
+	SetupRunnerVersion        string            `json:"setupRunnerVersion,omitempty"`
+}
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// TerraformDefaultsList contains a list of TerraformDefaults
+type TerraformDefaultsList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []TerraformDefaults `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&TerraformDefaults{}, &TerraformDefaultsList{})
+}
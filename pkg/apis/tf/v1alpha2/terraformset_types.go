@@ -0,0 +1,126 @@
+package v1alpha2
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+// +genclient
+// TerraformSet generates Terraform resources from a template. Each set of
+// parameters from the generators creates one Terraform resource.
+// +kubebuilder:printcolumn:name="Resources",type="integer",JSONPath=".status.count"
+// +kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp"
+// +k8s:openapi-gen=true
+// +kubebuilder:subresource:status
+// +kubebuilder:resource:path=terraformsets,shortName=tfset,singular=terraformset
+type TerraformSet struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   TerraformSetSpec   `json:"spec,omitempty"`
+	Status TerraformSetStatus `json:"status,omitempty"`
+}
+
+// TerraformSetSpec defines the generators and the template of the Terraform
+// resources
+// +k8s:openapi-gen=true
+type TerraformSetSpec struct {
+	// Generators produce the parameters of the Terraform resources. The
+	// parameters of all generators are combined into one list.
+	Generators []TerraformSetGenerator `json:"generators"`
+
+	// Template is the Terraform resource that is created for each set of
+	// parameters. Parameters are referenced in string fields as
+	// "{{ name }}", eg `name: "vpc-{{ region }}"`.
+	Template TerraformSetTemplate `json:"template"`
+
+	// PreserveResourcesOnDeletion keeps the Terraform resources when the
+	// TerraformSet is deleted. Otherwise, they are deleted with the set.
+	PreserveResourcesOnDeletion bool `json:"preserveResourcesOnDeletion,omitempty"`
+}
+
+// TerraformSetGenerator is one of list, matrix or git
+type TerraformSetGenerator struct {
+	List   *ListGenerator   `json:"list,omitempty"`
+	Matrix *MatrixGenerator `json:"matrix,omitempty"`
+	Git    *GitGenerator    `json:"git,omitempty"`
+}
+
+// ListGenerator generates one set of parameters per element
+type ListGenerator struct {
+	Elements []map[string]string `json:"elements"`
+}
+
+// MatrixGenerator generates a set of parameters for every combination of the
+// dimensions' values, eg every region for every environment
+type MatrixGenerator struct {
+	Dimensions []MatrixDimension `json:"dimensions"`
+}
+
+// MatrixDimension is a parameter and the values it takes
+type MatrixDimension struct {
+	Name   string   `json:"name"`
+	Values []string `json:"values"`
+}
+
+// GitGenerator generates a set of parameters per directory of a git repo. The
+// parameters are "path", the directory relative to the repo's root, and
+// "path.basename", the directory's name.
+type GitGenerator struct {
+	// Address is the git repo, eg "https://github.com/example/infra.git?ref=main".
+	// The repo is downloaded with the template's scmAuthMethods and sshTunnel.
+	Address string `json:"address"`
+
+	// Directories are path patterns, eg "stacks/*". Directories matching an
+	// exclude pattern are skipped.
+	Directories []GitDirectory `json:"directories"`
+
+	// PollInterval is how often the repo is checked for directory changes.
+	// Defaults to 3m.
+	PollInterval *metav1.Duration `json:"pollInterval,omitempty"`
+}
+
+// GitDirectory is a path pattern that selects directories of the repo
+type GitDirectory struct {
+	Path    string `json:"path"`
+	Exclude bool   `json:"exclude,omitempty"`
+}
+
+// TerraformSetTemplate is the metadata and spec of the generated resources
+type TerraformSetTemplate struct {
+	Metadata TerraformSetTemplateMeta `json:"metadata"`
+	Spec     TerraformSpec            `json:"spec"`
+}
+
+// TerraformSetTemplateMeta is the metadata of the generated resources
+type TerraformSetTemplateMeta struct {
+	// Name must be unique for every set of parameters
+	Name        string            `json:"name"`
+	Labels      map[string]string `json:"labels,omitempty"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+// TerraformSetStatus is the observed state of the TerraformSet
+type TerraformSetStatus struct {
+	// Resources are the names of the generated Terraform resources
+	Resources []string `json:"resources,omitempty"`
+
+	// Count is the number of generated Terraform resources
+	Count int `json:"count"`
+
+	// Error is the last error generating the resources
+	Error string `json:"error,omitempty"`
+}
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// TerraformSetList contains a list of TerraformSet
+type TerraformSetList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []TerraformSet `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&TerraformSet{}, &TerraformSetList{})
+}
@@ -0,0 +1,168 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	tfv1alpha2 "github.com/isaaguilar/terraform-operator/pkg/apis/tf/v1alpha2"
+	"github.com/isaaguilar/terraform-operator/pkg/utils"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// reasonsForRerun are the stage reasons that start a new run of a generation
+// that already ran. The run's resources are recreated the same way as when
+// the generation changes.
+var reasonsForRerun = []string{
+	"MODULE_COMMIT_CHANGE",
+	"GIT_PUSH",
+	"SOURCES_CHANGE",
+}
+
+// isNewRunReason returns true when the stage reason is the start of a run
+// where the configmap, secret, etc need to be (re)created
+func isNewRunReason(reason string) bool {
+	return reason == "GENERATION_CHANGE" || utils.ListContainsStr(reasonsForRerun, reason)
+}
+
+// runDataChanged returns true when the current stage (re)creates the run's
+// configmap, secret, etc
+func runDataChanged(tf *tfv1alpha2.Terraform) bool {
+	reason := tf.Status.Stages[len(tf.Status.Stages)-1].Reason
+	return isNewRunReason(reason) || reason == "TF_RESOURCE_CREATED"
+}
+
+// runIsStarting returns true when the stage is the first of a run and its pod
+// was not created yet
+func runIsStarting(stage tfv1alpha2.Stage) bool {
+	if stage.PodType != tfv1alpha2.PodInit {
+		return false
+	}
+	switch stage.State {
+	case tfv1alpha2.StateInitializing, tfv1alpha2.StateQueued, tfv1alpha2.StateFetchingSources:
+		return true
+	}
+	return false
+}
+
+// pollTimes keeps track of when a key was last polled
+type pollTimes struct {
+	mu    sync.Mutex
+	times map[string]time.Time
+}
+
+// due returns true when the key was not polled within the interval and marks
+// the key as polled
+func (p *pollTimes) due(key string, interval time.Duration) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if last, found := p.times[key]; found && time.Since(last) < interval {
+		return false
+	}
+	p.times[key] = time.Now()
+	return true
+}
+
+// modulePollInterval returns the terraformModule's pollInterval or 0 when
+// polling is disabled
+func modulePollInterval(tf *tfv1alpha2.Terraform) time.Duration {
+	if tf.Spec.TerraformModule == nil || tf.Spec.TerraformModule.PollInterval == nil {
+		return 0
+	}
+	// Only git modules have commits to poll
+	if len(tf.Spec.TerraformModule.Inline) > 0 || isGetterAddress(tf.Spec.TerraformModule.Address) {
+		return 0
+	}
+	return tf.Spec.TerraformModule.PollInterval.Duration
+}
+
+// checkModuleCommit resolves the terraformModule's ref when the pollInterval
+// is due. The commit is only recorded in the status when it is the first one
+// or when a run is about to start. Otherwise, a commit change starts a new
+// run. Returns true when the status was modified and needs to be updated.
+func (r *ReconcileTerraform) checkModuleCommit(ctx context.Context, tf *tfv1alpha2.Terraform) (bool, error) {
+	interval := modulePollInterval(tf)
+	if interval <= 0 {
+		return false, nil
+	}
+
+	n := len(tf.Status.Stages)
+	currentStage := tf.Status.Stages[n-1]
+	if currentStage.Interruptible == tfv1alpha2.CanNotBeInterrupt && currentStage.State == tfv1alpha2.StateInProgress {
+		// Wait for the stage to finish. The check happens on the next
+		// reconcile.
+		return false, nil
+	}
+
+	// A run that is about to start always resolves the commit so that a
+	// changed address, eg a different branch, is picked up by the run.
+	startingRun := runIsStarting(currentStage)
+	key := types.NamespacedName{Name: tf.Name, Namespace: tf.Namespace}.String()
+	if r.modulePolls == nil || !r.modulePolls.due(key, interval) && tf.Status.ModuleCommit != "" && !startingRun {
+		return false, nil
+	}
+
+	stackRepoAccessOptions, err := newGitRepoAccessOptionsFromSpec(tf, tf.Spec.TerraformModule.Address, []string{})
+	if err != nil {
+		return false, fmt.Errorf("Error in newGitRepoAccessOptionsFromSpec: %v", err)
+	}
+	defer os.RemoveAll(stackRepoAccessOptions.Directory)
+	stackRepoAccessOptions.sshTunnelName = tf.Spec.TerraformModule.SSHTunnel
+
+	err = stackRepoAccessOptions.getParsedAddress()
+	if err != nil {
+		return false, fmt.Errorf("Error in parsing address: %v", err)
+	}
+
+	commit, err := stackRepoAccessOptions.resolveCommit(ctx, r.Client, tf.Namespace)
+	if err != nil {
+		return false, fmt.Errorf("Error resolving terraformModule commit: %v", err)
+	}
+
+	if tf.Status.ModuleCommit == commit {
+		return false, nil
+	}
+	if tf.Status.ModuleCommit == "" || startingRun {
+		tf.Status.ModuleCommit = commit
+		return true, nil
+	}
+
+	r.Recorder.Event(tf, "Normal", "ModuleCommitChanged", fmt.Sprintf("TerraformModule moved from %s to %s", tf.Status.ModuleCommit, commit))
+	tf.Status.ModuleCommit = commit
+	err = r.startNewRun(ctx, tf, "MODULE_COMMIT_CHANGE")
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// startNewRun adds the first stage of a new run for the current generation.
+// Pods left from the previous run of the generation, for instance failed
+// pods, are removed first so they do not get mistaken for pods of the new
+// run.
+func (r *ReconcileTerraform) startNewRun(ctx context.Context, tf *tfv1alpha2.Terraform, reason string) error {
+	pods := &corev1.PodList{}
+	err := r.Client.List(ctx, pods, client.InNamespace(tf.Namespace), client.MatchingLabels{
+		"tfGeneration": fmt.Sprintf("%d", tf.Generation),
+	})
+	if err != nil {
+		return fmt.Errorf("unable to list pods: %v", err)
+	}
+	for i := range pods.Items {
+		if !strings.HasPrefix(pods.Items[i].Name, tf.Status.PodNamePrefix+"-") {
+			continue
+		}
+		err := r.Client.Delete(ctx, &pods.Items[i], client.PropagationPolicy("Background"))
+		if err != nil {
+			return fmt.Errorf("unable to delete pod '%s': %v", pods.Items[i].Name, err)
+		}
+	}
+
+	addNewStage(tf, tfv1alpha2.PodInit, reason, tfv1alpha2.CanBeInterrupt, tfv1alpha2.StateInitializing)
+	return nil
+}
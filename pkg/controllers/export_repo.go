@@ -0,0 +1,148 @@
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/go-logr/logr"
+	tfv1alpha2 "github.com/isaaguilar/terraform-operator/pkg/apis/tf/v1alpha2"
+	"github.com/isaaguilar/terraform-operator/pkg/gitclient"
+	"github.com/isaaguilar/terraform-operator/pkg/pullrequest"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// exportTemplateData is what the commit message, author and pull request
+// templates of an export are executed with
+type exportTemplateData struct {
+	Name       string
+	Namespace  string
+	Generation int64
+	Files      []string
+}
+
+// renderExportTemplate executes the template, or returns the fallback when
+// the template is empty
+func renderExportTemplate(name, tmpl, fallback string, data exportTemplateData) (string, error) {
+	if tmpl == "" {
+		return fallback, nil
+	}
+	t, err := template.New(name).Parse(tmpl)
+	if err != nil {
+		return "", fmt.Errorf("unable to parse %s template: %v", name, err)
+	}
+	var b bytes.Buffer
+	err = t.Execute(&b, data)
+	if err != nil {
+		return "", fmt.Errorf("unable to execute %s template: %v", name, err)
+	}
+	return b.String(), nil
+}
+
+// exportBranches returns the branch the export is based on and the branch it
+// is pushed to. Without a pull request both are the same branch.
+func exportBranches(tf *tfv1alpha2.Terraform, ref string) (string, string) {
+	e := tf.Spec.ExportRepo
+	base := ref
+	if base == "" {
+		base = "master"
+	}
+	if e.PullRequest == nil {
+		if e.Branch != "" {
+			base = e.Branch
+		}
+		return base, base
+	}
+	if e.PullRequest.BaseBranch != "" {
+		base = e.PullRequest.BaseBranch
+	}
+	head := e.Branch
+	if head == "" {
+		head = "terraform-operator/" + tf.Name
+	}
+	return base, head
+}
+
+// exportCommit renders the commit message and author of the export
+func exportCommit(e *tfv1alpha2.ExportRepo, data exportTemplateData) (string, string, string, error) {
+	message, err := renderExportTemplate("commitMessage", e.CommitMessage,
+		fmt.Sprintf("automatic update via terraform-operator\nupdates to:\n%s", strings.Join(data.Files, "\n")), data)
+	if err != nil {
+		return "", "", "", err
+	}
+	author := tfv1alpha2.CommitAuthor{}
+	if e.CommitAuthor != nil {
+		author = *e.CommitAuthor
+	}
+	name, err := renderExportTemplate("commitAuthor.name", author.Name, gitclient.DefaultAuthorName, data)
+	if err != nil {
+		return "", "", "", err
+	}
+	email, err := renderExportTemplate("commitAuthor.email", author.Email, gitclient.DefaultAuthorEmail, data)
+	if err != nil {
+		return "", "", "", err
+	}
+	return message, name, email, nil
+}
+
+// openPullRequest opens the export's pull request from head into base. The
+// api is reached through the export's sshTunnel when there is one.
+func (d GitRepoAccessOptions) openPullRequest(ctx context.Context, k8sclient client.Client, e *tfv1alpha2.ExportRepo, namespace, head, base, message string, data exportTemplateData, reqLogger logr.Logger) (string, error) {
+	pr := e.PullRequest
+	title, err := renderExportTemplate("pullRequest.title", pr.Title,
+		fmt.Sprintf("Update the tfvars of %s/%s", data.Namespace, data.Name), data)
+	if err != nil {
+		return "", err
+	}
+	body, err := renderExportTemplate("pullRequest.body", pr.Body, message, data)
+	if err != nil {
+		return "", err
+	}
+
+	var token string
+	if pr.TokenSecretRef != nil {
+		key := pr.TokenSecretRef.Key
+		if key == "" {
+			key = "token"
+		}
+		ns := pr.TokenSecretRef.Namespace
+		if ns == "" {
+			ns = namespace
+		}
+		token, err = loadPassword(ctx, k8sclient, key, pr.TokenSecretRef.Name, ns)
+	} else {
+		_, token, err = d.getGitToken(ctx, k8sclient, namespace, "https", reqLogger)
+	}
+	if err != nil {
+		return "", fmt.Errorf("unable to get the pull request api token: %v", err)
+	}
+
+	httpClient := &http.Client{Timeout: 30 * time.Second}
+	chain := d.proxyChain
+	if d.tunnel != nil {
+		chain = d.tunnel.chain
+	}
+	if chain != nil {
+		httpClient.Transport = &http.Transport{
+			DialContext: func(ctx context.Context, network, address string) (net.Conn, error) {
+				return chain.Dial(network, address)
+			},
+		}
+	}
+	api, err := pullrequest.New(pr.Provider, d.ParsedAddress.host, pr.APIURL, token, httpClient)
+	if err != nil {
+		return "", err
+	}
+	return api.Open(ctx, pullrequest.Request{
+		Repo:  strings.TrimSuffix(strings.Trim(d.uri, "/"), ".git"),
+		Head:  head,
+		Base:  base,
+		Title: title,
+		Body:  body,
+	})
+}
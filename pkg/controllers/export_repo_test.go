@@ -0,0 +1,76 @@
+package controllers
+
+import (
+	tfv1alpha2 "github.com/isaaguilar/terraform-operator/pkg/apis/tf/v1alpha2"
+	"github.com/isaaguilar/terraform-operator/pkg/gitclient"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+var _ = Describe("Export repo", func() {
+
+	newTerraform := func() *tfv1alpha2.Terraform {
+		return &tfv1alpha2.Terraform{
+			ObjectMeta: metav1.ObjectMeta{Name: "vpc", Namespace: "infra", Generation: 3},
+			Spec: tfv1alpha2.TerraformSpec{
+				ExportRepo: &tfv1alpha2.ExportRepo{
+					Address:    "https://github.com/org/tfvars.git",
+					TFVarsFile: "vpc.tfvars",
+				},
+			},
+		}
+	}
+
+	It("Should push to the branch of the address or master", func() {
+		tf := newTerraform()
+		base, head := exportBranches(tf, "")
+		Expect(base).To(Equal("master"))
+		Expect(head).To(Equal("master"))
+
+		base, head = exportBranches(tf, "main")
+		Expect(base).To(Equal("main"))
+		Expect(head).To(Equal("main"))
+
+		tf.Spec.ExportRepo.Branch = "exports"
+		base, head = exportBranches(tf, "main")
+		Expect(base).To(Equal("exports"))
+		Expect(head).To(Equal("exports"))
+	})
+
+	It("Should push to its own branch for a pull request", func() {
+		tf := newTerraform()
+		tf.Spec.ExportRepo.PullRequest = &tfv1alpha2.ExportPullRequest{Provider: "gitea"}
+		base, head := exportBranches(tf, "main")
+		Expect(base).To(Equal("main"))
+		Expect(head).To(Equal("terraform-operator/vpc"))
+
+		tf.Spec.ExportRepo.Branch = "update-vpc"
+		tf.Spec.ExportRepo.PullRequest.BaseBranch = "release"
+		base, head = exportBranches(tf, "main")
+		Expect(base).To(Equal("release"))
+		Expect(head).To(Equal("update-vpc"))
+	})
+
+	It("Should render the commit templates", func() {
+		e := newTerraform().Spec.ExportRepo
+		data := exportTemplateData{Name: "vpc", Namespace: "infra", Generation: 3, Files: []string{"vpc.tfvars", "vpc.conf"}}
+		message, name, email, err := exportCommit(e, data)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(message).To(Equal("automatic update via terraform-operator\nupdates to:\nvpc.tfvars\nvpc.conf"))
+		Expect(name).To(Equal(gitclient.DefaultAuthorName))
+		Expect(email).To(Equal(gitclient.DefaultAuthorEmail))
+
+		e.CommitMessage = "Update {{ .Namespace }}/{{ .Name }} generation {{ .Generation }}"
+		e.CommitAuthor = &tfv1alpha2.CommitAuthor{Name: "tfo-{{ .Namespace }}", Email: "tfo@example.com"}
+		message, name, email, err = exportCommit(e, data)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(message).To(Equal("Update infra/vpc generation 3"))
+		Expect(name).To(Equal("tfo-infra"))
+		Expect(email).To(Equal("tfo@example.com"))
+
+		e.CommitMessage = "{{ .Missing }}"
+		_, _, _, err = exportCommit(e, data)
+		Expect(err).To(HaveOccurred())
+	})
+})
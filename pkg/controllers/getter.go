@@ -0,0 +1,367 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	getter "github.com/hashicorp/go-getter"
+	tfv1alpha2 "github.com/isaaguilar/terraform-operator/pkg/apis/tf/v1alpha2"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// forcedGetterRegexp matches the getter forced by an address, eg "s3::"
+var forcedGetterRegexp = regexp.MustCompile(`^([A-Za-z0-9]+)::(.+)$`)
+
+// getterDownloadDir is where a go-getter address is downloaded to in the
+// download's directory
+const getterDownloadDir = "tfo-download"
+
+// forcedGetter splits the forced getter off the address
+func forcedGetter(address string) (string, string) {
+	if m := forcedGetterRegexp.FindStringSubmatch(address); m != nil {
+		return m[1], m[2]
+	}
+	return "", address
+}
+
+// isGetterAddress returns true when the address is downloaded with go-getter
+// instead of git. These are addresses that force a getter other than git::,
+// eg s3:: or http::, file:// paths and http(s) urls of archives, like
+// module.tar.gz or ?archive=zip. Other http(s) urls are git repos.
+func isGetterAddress(address string) bool {
+	forced, src := forcedGetter(address)
+	if forced != "" {
+		return forced != "git"
+	}
+	src, _ = getter.SourceDirSubdir(src)
+	u, err := url.Parse(src)
+	if err != nil {
+		return false
+	}
+	switch u.Scheme {
+	case "file":
+		return true
+	case "http", "https":
+		if u.Query().Get("archive") != "" {
+			return true
+		}
+		for ext := range getter.Decompressors {
+			if strings.HasSuffix(u.Path, "."+ext) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// validateGetterAddress checks that go-getter can download the address and
+// that the download stays out of the operator. Local paths would be read
+// from the operator's filesystem, and http(s) urls could reach the cloud's
+// metadata api or the services of the cluster.
+func validateGetterAddress(address string) error {
+	getters := sourceGetters()
+	forced, _ := forcedGetter(address)
+	if _, found := getters[forced]; forced != "" && !found {
+		return fmt.Errorf("unsupported getter '%s::'", forced)
+	}
+	detected, err := getter.Detect(address, "", getter.Detectors)
+	if err != nil {
+		return err
+	}
+	forced, src := forcedGetter(detected)
+	src, _ = getter.SourceDirSubdir(src)
+	u, err := url.Parse(src)
+	if err != nil {
+		return fmt.Errorf("unable to parse '%s': %v", address, err)
+	}
+	if forced == "" {
+		forced = u.Scheme
+	}
+	switch forced {
+	case "file":
+		return fmt.Errorf("local paths are not supported")
+	case "http", "https":
+		if strings.HasSuffix(u.Path, "/") {
+			// The directory of an http url redirects to any getter with
+			// X-Terraform-Get
+			return fmt.Errorf("http(s) directories are not supported, use a file or an archive")
+		}
+		return validateGetterHost(u.Hostname(), false)
+	case "s3":
+		return validateGetterHost(u.Hostname(), true)
+	}
+	if _, found := getters[forced]; !found {
+		return fmt.Errorf("unsupported getter '%s'", forced)
+	}
+	return nil
+}
+
+// blockedGetterIP returns true when a download may not connect to the ip.
+// Loopback and link local addresses, like the metadata api at
+// 169.254.169.254, are never allowed. Unless private is true, the private
+// ranges that pods and services of the cluster use are not allowed either.
+func blockedGetterIP(ip net.IP, private bool) bool {
+	if ip.IsLoopback() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() || ip.IsUnspecified() {
+		return true
+	}
+	return !private && (ip.IsPrivate() || sharedAddressSpace.Contains(ip))
+}
+
+// sharedAddressSpace is 100.64.0.0/10, which some CNIs use for pods
+var sharedAddressSpace = &net.IPNet{IP: net.IPv4(100, 64, 0, 0), Mask: net.CIDRMask(10, 32)}
+
+// getterBlockedIP is what the downloads check the ips with. Tests replace it
+// to download from a local server.
+var getterBlockedIP = blockedGetterIP
+
+// validateGetterHost checks the host of a download. Names are resolved when
+// the download connects, so only the names that always point into the
+// cluster are refused here.
+func validateGetterHost(host string, private bool) error {
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+	if host == "" {
+		return fmt.Errorf("the address has no host")
+	}
+	if ip := net.ParseIP(host); ip != nil {
+		if getterBlockedIP(ip, private) {
+			return fmt.Errorf("downloads from '%s' are not allowed", host)
+		}
+		return nil
+	}
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return fmt.Errorf("downloads from '%s' are not allowed", host)
+	}
+	if private {
+		return nil
+	}
+	// Names without a dot resolve to the services of the namespace
+	if !strings.Contains(host, ".") || strings.HasSuffix(host, ".svc") || strings.HasSuffix(host, ".cluster.local") || strings.HasSuffix(host, ".internal") {
+		return fmt.Errorf("downloads from '%s' are not allowed, it is internal to the cluster", host)
+	}
+	return nil
+}
+
+// resolveGetterHost checks the ips the host resolves to
+func resolveGetterHost(ctx context.Context, host string, private bool) ([]net.IPAddr, error) {
+	if err := validateGetterHost(host, private); err != nil {
+		return nil, err
+	}
+	ips, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	for _, ip := range ips {
+		if getterBlockedIP(ip.IP, private) {
+			return nil, fmt.Errorf("downloads from '%s' are not allowed, it resolves to %s", host, ip.IP)
+		}
+	}
+	return ips, nil
+}
+
+// publicDialer connects http downloads to the ip it checked so that a name
+// can not be pointed at the cluster after the check. A proxy from the
+// operator's environment connects to the host itself, so only the host's
+// name is checked for proxied requests.
+type publicDialer struct {
+	dialer  net.Dialer
+	proxies sync.Map
+}
+
+func (p *publicDialer) proxy(req *http.Request) (*url.URL, error) {
+	u, err := http.ProxyFromEnvironment(req)
+	if err != nil || u == nil {
+		return u, err
+	}
+	err = validateGetterHost(req.URL.Hostname(), false)
+	if err != nil {
+		return nil, err
+	}
+	p.proxies.Store(u.Hostname(), true)
+	return u, nil
+}
+
+func (p *publicDialer) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
+	if _, found := p.proxies.Load(host); found {
+		return p.dialer.DialContext(ctx, network, address)
+	}
+	ips, err := resolveGetterHost(ctx, host, false)
+	if err != nil {
+		return nil, err
+	}
+	return p.dialer.DialContext(ctx, network, net.JoinHostPort(ips[0].IP.String(), port))
+}
+
+// httpFileGetter downloads http(s) files and archives. Directories are
+// refused since their X-Terraform-Get header can point the download at any
+// getter, including local paths.
+type httpFileGetter struct {
+	*getter.HttpGetter
+}
+
+func (httpFileGetter) Get(string, *url.URL) error {
+	return fmt.Errorf("http(s) directories are not supported, use a file or an archive")
+}
+
+// sourceGetters are the getters the operator downloads with. Local paths,
+// the getters that run commands and gcs, which would use the operator's
+// google credentials, are left out. The operator's netrc is not used.
+func sourceGetters() map[string]getter.Getter {
+	dialer := &publicDialer{dialer: net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}}
+	httpGetter := httpFileGetter{&getter.HttpGetter{
+		Client: &http.Client{Transport: &http.Transport{
+			Proxy:                 dialer.proxy,
+			DialContext:           dialer.DialContext,
+			TLSHandshakeTimeout:   10 * time.Second,
+			ResponseHeaderTimeout: 30 * time.Second,
+			IdleConnTimeout:       90 * time.Second,
+		}},
+	}}
+	return map[string]getter.Getter{
+		"s3":    new(getter.S3Getter),
+		"http":  httpGetter,
+		"https": httpGetter,
+	}
+}
+
+// getterDownload downloads the address with go-getter. Archives are
+// extracted and checked against the address's checksum, eg
+// ?checksum=sha256:..., when there is one. A single file keeps its name. The
+// subdirectories of the address are read like the ones of a git repo.
+func (d *GitRepoAccessOptions) getterDownload(ctx context.Context, address string) error {
+	err := validateGetterAddress(address)
+	if err != nil {
+		return fmt.Errorf("Download failed for '%s': %v", d.Address, err)
+	}
+	src, subdirstr := getter.SourceDirSubdir(address)
+	d.subdirs = strings.Split(subdirstr, "//")
+
+	// The s3 client can not be given a dialer, so its endpoint is checked
+	// before the download
+	if forced, s3 := forcedGetter(src); forced == "s3" {
+		if u, err := url.Parse(s3); err == nil {
+			_, err = resolveGetterHost(ctx, u.Hostname(), true)
+			if err != nil {
+				return fmt.Errorf("Download failed for '%s': %v", d.Address, err)
+			}
+		}
+	}
+
+	dst := filepath.Join(d.Directory, getterDownloadDir)
+	c := &getter.Client{
+		Ctx:     ctx,
+		Src:     src,
+		Dst:     dst,
+		Pwd:     d.Directory,
+		Mode:    getter.ClientModeAny,
+		Getters: sourceGetters(),
+	}
+	err = c.Get()
+	if err != nil {
+		return fmt.Errorf("Download failed for '%s': %v", d.Address, err)
+	}
+
+	info, err := os.Stat(dst)
+	if err != nil {
+		return fmt.Errorf("Download failed for '%s': %v", d.Address, err)
+	}
+	if info.IsDir() {
+		d.Directory = dst
+		return nil
+	}
+	// .tfvars files are found by their name
+	_, file := forcedGetter(src)
+	name := path.Base(strings.Split(file, "?")[0])
+	if u, err := url.Parse(file); err == nil && u.Path != "" {
+		name = path.Base(u.Path)
+	}
+	return os.Rename(dst, filepath.Join(d.Directory, name))
+}
+
+// withS3Credentials adds the AWS keys of the tf resource's credentials secret
+// to an s3:: address that has none. These are the keys the runner pods get as
+// env vars. An address without keys fails rather than falling back to the
+// operator's own AWS credentials, which could read the buckets of other
+// tenants.
+func withS3Credentials(ctx context.Context, k8sclient client.Client, tf *tfv1alpha2.Terraform, address string) (string, error) {
+	forced, src := forcedGetter(address)
+	if forced != "s3" {
+		return address, nil
+	}
+	src, subdir := getter.SourceDirSubdir(src)
+	u, err := url.Parse(src)
+	if err != nil {
+		return "", fmt.Errorf("unable to parse '%s': %v", address, err)
+	}
+	query := u.Query()
+	if query.Get("aws_profile") != "" {
+		return "", fmt.Errorf("aws_profile is not supported in '%s', it reads the operator's AWS config", address)
+	}
+	if query.Get("aws_access_key_id") != "" {
+		return address, nil
+	}
+
+	for _, c := range runCredentials(tf) {
+		if c.SecretNameRef.Name == "" {
+			continue
+		}
+		// The operator reads the secret for the tf resource, so it must not
+		// reach into namespaces the resource's owner has no access to
+		if ns := c.SecretNameRef.Namespace; ns != "" && ns != tf.Namespace {
+			return "", fmt.Errorf("credentials secret '%s' must be in the namespace '%s', not '%s'", c.SecretNameRef.Name, tf.Namespace, ns)
+		}
+		secret := &corev1.Secret{}
+		err := k8sclient.Get(ctx, types.NamespacedName{Name: c.SecretNameRef.Name, Namespace: tf.Namespace}, secret)
+		if err != nil {
+			return "", fmt.Errorf("unable to get credentials secret '%s': %v", c.SecretNameRef.Name, err)
+		}
+		id, key := string(secret.Data["AWS_ACCESS_KEY_ID"]), string(secret.Data["AWS_SECRET_ACCESS_KEY"])
+		if id == "" || key == "" {
+			continue
+		}
+		query.Set("aws_access_key_id", id)
+		query.Set("aws_access_key_secret", key)
+		if token := string(secret.Data["AWS_SESSION_TOKEN"]); token != "" {
+			query.Set("aws_access_token", token)
+		}
+		if region := string(secret.Data["AWS_REGION"]); region != "" && query.Get("region") == "" {
+			query.Set("region", region)
+		}
+		u.RawQuery = query.Encode()
+		address = forced + "::" + u.String()
+		if subdir != "" {
+			address += "//" + subdir
+		}
+		return address, nil
+	}
+	return "", fmt.Errorf("no AWS keys for '%s': add AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY to a credentials secretNameRef", address)
+}
+
+// getterCacheKey is the key of a go-getter source in the source cache. Only
+// sources with a checksum can be cached because the content of other urls
+// can change. The source is only shared in the namespace, whose credentials
+// downloaded it.
+func getterCacheKey(namespace, address string, extras []string) string {
+	_, src := forcedGetter(address)
+	src, _ = getter.SourceDirSubdir(src)
+	u, err := url.Parse(src)
+	if err != nil || u.Query().Get("checksum") == "" {
+		return ""
+	}
+	return fmt.Sprintf("%s/%s#%s", namespace, address, strings.Join(extras, ","))
+}
@@ -0,0 +1,177 @@
+package controllers
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+
+	tfv1alpha2 "github.com/isaaguilar/terraform-operator/pkg/apis/tf/v1alpha2"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+var _ = Describe("Getter sources", func() {
+
+	It("Should tell git addresses from go-getter addresses", func() {
+		for _, address := range []string{
+			"https://github.com/isaaguilar/terraform-operator.git",
+			"https://github.com/isaaguilar/terraform-operator.git//examples?ref=master",
+			"git::https://example.com/modules/vpc.tar.gz",
+			"git@github.com:isaaguilar/terraform-operator.git",
+		} {
+			Expect(isGetterAddress(address)).To(BeFalse(), address)
+		}
+		for _, address := range []string{
+			"https://example.com/modules/vpc-1.0.0.tar.gz",
+			"https://example.com/modules/vpc-1.0.0.zip//modules/vpc?checksum=sha256:abc",
+			"https://example.com/download?archive=tgz",
+			"s3::http://minio:9000/modules/vpc-1.0.0.zip",
+			"http::https://example.com/vars.tfvars",
+			"file:///tmp/modules/vpc",
+		} {
+			Expect(isGetterAddress(address)).To(BeTrue(), address)
+		}
+	})
+
+	It("Should download archives and files", func() {
+		dir, err := ioutil.TempDir("", "getter")
+		Expect(err).NotTo(HaveOccurred())
+		defer os.RemoveAll(dir)
+
+		archive := filepath.Join(dir, "vars.tar.gz")
+		f, err := os.Create(archive)
+		Expect(err).NotTo(HaveOccurred())
+		gz := gzip.NewWriter(f)
+		tw := tar.NewWriter(gz)
+		for name, content := range map[string]string{"env/prod.tfvars": "region = \"us-east-1\"\n", "env/main.tf": "# main\n"} {
+			Expect(tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(content))})).To(Succeed())
+			_, err = tw.Write([]byte(content))
+			Expect(err).NotTo(HaveOccurred())
+		}
+		Expect(tw.Close()).To(Succeed())
+		Expect(gz.Close()).To(Succeed())
+		Expect(f.Close()).To(Succeed())
+
+		data, err := ioutil.ReadFile(archive)
+		Expect(err).NotTo(HaveOccurred())
+		sum := sha256.Sum256(data)
+
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/vars.tar.gz" {
+				w.Write(data)
+				return
+			}
+			w.Write([]byte("size = 3\n"))
+		}))
+		defer server.Close()
+
+		// The local server is refused unless the test allows it
+		address := server.URL + "/vars.tar.gz//env?checksum=sha256:" + hex.EncodeToString(sum[:])
+		download, err := ioutil.TempDir(dir, "download")
+		Expect(err).NotTo(HaveOccurred())
+		d := GitRepoAccessOptions{Address: address, Directory: download}
+		Expect(d.getterDownload(context.TODO(), address)).NotTo(Succeed())
+
+		getterBlockedIP = func(ip net.IP, private bool) bool { return false }
+		defer func() { getterBlockedIP = blockedGetterIP }()
+
+		Expect(getterCacheKey("default", address, nil)).NotTo(BeEmpty())
+		Expect(getterCacheKey("default", server.URL+"/vars.tar.gz//env", nil)).To(BeEmpty())
+		d = GitRepoAccessOptions{Address: address, Directory: download}
+		Expect(d.getterDownload(context.TODO(), address)).To(Succeed())
+		tfvars, err := d.tfvarFiles()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(tfvars).To(ContainSubstring("us-east-1"))
+		files, err := d.otherConfigFiles()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(files).To(HaveKey("main.tf"))
+
+		badChecksum := server.URL + "/vars.tar.gz?checksum=sha256:" + hex.EncodeToString(make([]byte, 32))
+		download, err = ioutil.TempDir(dir, "download")
+		Expect(err).NotTo(HaveOccurred())
+		d = GitRepoAccessOptions{Address: badChecksum, Directory: download}
+		Expect(d.getterDownload(context.TODO(), badChecksum)).NotTo(Succeed())
+
+		address = "http::" + server.URL + "/shared/common.tfvars"
+		download, err = ioutil.TempDir(dir, "download")
+		Expect(err).NotTo(HaveOccurred())
+		d = GitRepoAccessOptions{Address: address, Directory: download}
+		Expect(d.getterDownload(context.TODO(), address)).To(Succeed())
+		tfvars, err = d.tfvarFiles()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(tfvars).To(ContainSubstring("size = 3"))
+	})
+
+	It("Should keep downloads out of the operator and the cluster", func() {
+		for _, address := range []string{
+			"file:///var/run/secrets/kubernetes.io/serviceaccount",
+			"file::/var/run/secrets/kubernetes.io/serviceaccount",
+			"http::http://169.254.169.254/latest/meta-data/iam/security-credentials/",
+			"http::http://169.254.169.254/latest/meta-data/iam/security-credentials/node",
+			"https://127.0.0.1/modules/vpc.tar.gz",
+			"http::http://localhost:8080/vars.tfvars",
+			"http::http://kubernetes/api",
+			"http::https://kubernetes.default.svc/api",
+			"http::http://metadata.google.internal/computeMetadata/v1/",
+			"https://10.0.0.1/modules/vpc.tar.gz",
+			"s3::http://169.254.169.254/bucket/vpc.zip",
+		} {
+			Expect(validateGetterAddress(address)).NotTo(Succeed(), address)
+		}
+		for _, address := range []string{
+			"https://example.com/modules/vpc-1.0.0.tar.gz",
+			"http::https://example.com/vars.tfvars",
+			"s3::http://minio.minio:9000/modules/vpc-1.0.0.zip",
+		} {
+			Expect(validateGetterAddress(address)).To(Succeed(), address)
+		}
+	})
+
+	It("Should not download s3 sources with the operator's AWS credentials", func() {
+		tf := &tfv1alpha2.Terraform{}
+		_, err := withS3Credentials(context.TODO(), nil, tf, "s3::https://s3.amazonaws.com/bucket/vpc.zip")
+		Expect(err).To(HaveOccurred())
+		_, err = withS3Credentials(context.TODO(), nil, tf, "s3::https://s3.amazonaws.com/bucket/vpc.zip?aws_profile=default")
+		Expect(err).To(HaveOccurred())
+		address := "s3::https://s3.amazonaws.com/bucket/vpc.zip?aws_access_key_id=id&aws_access_key_secret=key"
+		Expect(withS3Credentials(context.TODO(), nil, tf, address)).To(Equal(address))
+	})
+
+	It("Should only read s3 credentials from the tf resource's namespace", func() {
+		k8sclient := fake.NewClientBuilder().WithObjects(
+			&corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Name: "aws", Namespace: "team-a"},
+				Data:       map[string][]byte{"AWS_ACCESS_KEY_ID": []byte("a-id"), "AWS_SECRET_ACCESS_KEY": []byte("a-key")},
+			},
+			&corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Name: "aws", Namespace: "team-b"},
+				Data:       map[string][]byte{"AWS_ACCESS_KEY_ID": []byte("b-id"), "AWS_SECRET_ACCESS_KEY": []byte("b-key")},
+			},
+		).Build()
+		tf := &tfv1alpha2.Terraform{
+			ObjectMeta: metav1.ObjectMeta{Name: "tf", Namespace: "team-b"},
+			Spec: tfv1alpha2.TerraformSpec{
+				Credentials: []tfv1alpha2.Credentials{{SecretNameRef: tfv1alpha2.SecretNameRef{Name: "aws"}}},
+			},
+		}
+		address, err := withS3Credentials(context.TODO(), k8sclient, tf, "s3::https://s3.amazonaws.com/bucket/vpc.zip")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(address).To(ContainSubstring("aws_access_key_id=b-id"))
+
+		tf.Spec.Credentials[0].SecretNameRef.Namespace = "team-a"
+		_, err = withS3Credentials(context.TODO(), k8sclient, tf, "s3::https://s3.amazonaws.com/bucket/vpc.zip")
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("team-b"))
+	})
+})
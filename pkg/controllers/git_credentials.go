@@ -0,0 +1,205 @@
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/MakeNowJust/heredoc"
+	tfv1alpha2 "github.com/isaaguilar/terraform-operator/pkg/apis/tf/v1alpha2"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// Paths of the git credentials in the runner pods. The files are keys of the
+// run's secret mounted at gitCredentialsPath.
+const (
+	gitCredentialsPath      = "/git/askpass"
+	gitCredentialHelperFile = "git-credential-tfo"
+	gitConfigFile           = "gitconfig"
+)
+
+// gitHTTPSCredential is the username and token git uses for a host
+type gitHTTPSCredential struct {
+	host     string
+	username string
+	token    string
+}
+
+// gitHTTPSCredentials returns the credentials of the SCMAuthMethods that use
+// https, in order
+func (r ReconcileTerraform) gitHTTPSCredentials(ctx context.Context, tf *tfv1alpha2.Terraform) ([]gitHTTPSCredential, error) {
+	credentials := []gitHTTPSCredential{}
+	for _, m := range tf.Spec.SCMAuthMethods {
+		if m.Git == nil || m.Git.HTTPS == nil {
+			continue
+		}
+		if m.Git.HTTPS.GitHubApp != nil {
+			token, err := githubAppToken(ctx, r.Client, m.Git.HTTPS.GitHubApp, tf.Namespace)
+			if err != nil {
+				return nil, err
+			}
+			credentials = append(credentials, gitHTTPSCredential{host: m.Host, username: githubAppUser, token: token})
+			continue
+		}
+		if m.Git.HTTPS.TokenSecretRef == nil {
+			continue
+		}
+		key := m.Git.HTTPS.TokenSecretRef.Key
+		if key == "" {
+			key = "token"
+		}
+		ns := m.Git.HTTPS.TokenSecretRef.Namespace
+		if ns == "" {
+			ns = tf.Namespace
+		}
+		token, err := loadPassword(ctx, r.Client, key, m.Git.HTTPS.TokenSecretRef.Name, ns)
+		if err != nil {
+			return nil, fmt.Errorf("unable to get token for '%s': %v", m.Host, err)
+		}
+		credentials = append(credentials, gitHTTPSCredential{host: m.Host, username: "git", token: token})
+	}
+	return credentials, nil
+}
+
+// gitAskpass is the GIT_ASKPASS script of a credential. Tools that do not use
+// the credential helper still get the token of the first host this way.
+func gitAskpass(credential gitHTTPSCredential) []byte {
+	if credential.username == githubAppUser {
+		return githubAppAskpass(credential.token)
+	}
+	return []byte(heredoc.Docf(`
+		#!/bin/sh
+		exec echo "%s"
+	`, credential.token))
+}
+
+// gitCredentialHelper is a git credential helper that answers with the
+// credential of the requested host
+func gitCredentialHelper(credentials []gitHTTPSCredential) []byte {
+	var b bytes.Buffer
+	b.WriteString(heredoc.Doc(`
+		#!/bin/sh
+		test "$1" = get || exit 0
+		while read -r line; do
+		  case "$line" in
+		  host=*) host="${line#host=}" ;;
+		  "") break ;;
+		  esac
+		done
+		case "$host" in
+	`))
+	for _, c := range credentials {
+		fmt.Fprintf(&b, "%s) printf 'username=%%s\\npassword=%%s\\n' %s %s ;;\n", shellQuote(c.host), shellQuote(c.username), shellQuote(c.token))
+	}
+	b.WriteString("esac\n")
+	return b.Bytes()
+}
+
+// shellQuote single quotes s for sh
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// gitConfig is the runner pods' .gitconfig. It uses the credential helper
+// and rewrites the urls of a host to the protocol that has credentials, eg a
+// module that is pulled over ssh from a host that only has a token is pulled
+// over https instead. The https hosts in proxies are cloned through the
+// SOCKS5 proxy of their tunnel, which resolves the host on the other end of
+// the tunnel.
+func gitConfig(methods []tfv1alpha2.SCMAuthMethod, proxies map[string]string) []byte {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "[credential]\n\thelper = %s/%s\n", gitCredentialsPath, gitCredentialHelperFile)
+	for _, m := range methods {
+		if m.Git == nil || m.Host == "" {
+			continue
+		}
+		if m.Git.HTTPS != nil && m.Git.SSH == nil {
+			fmt.Fprintf(&b, "[url \"https://%s/\"]\n", m.Host)
+			fmt.Fprintf(&b, "\tinsteadOf = git@%s:\n", m.Host)
+			fmt.Fprintf(&b, "\tinsteadOf = ssh://git@%s/\n", m.Host)
+		}
+		if m.Git.SSH != nil && m.Git.HTTPS == nil {
+			fmt.Fprintf(&b, "[url \"git@%s:\"]\n", m.Host)
+			fmt.Fprintf(&b, "\tinsteadOf = https://%s/\n", m.Host)
+		}
+	}
+	hosts := make([]string, 0, len(proxies))
+	for host := range proxies {
+		hosts = append(hosts, host)
+	}
+	sort.Strings(hosts)
+	for _, host := range hosts {
+		fmt.Fprintf(&b, "[http \"https://%s/\"]\n", host)
+		fmt.Fprintf(&b, "\tproxy = socks5h://%s\n", proxies[host])
+	}
+	return b.Bytes()
+}
+
+// runnerGitCredentials returns the askpass, credential helper and .gitconfig
+// keys of the run's secret
+func (r ReconcileTerraform) runnerGitCredentials(ctx context.Context, tf *tfv1alpha2.Terraform) (map[string][]byte, error) {
+	data := make(map[string][]byte)
+	if len(tf.Spec.SCMAuthMethods) == 0 {
+		return data, nil
+	}
+	credentials, err := r.gitHTTPSCredentials(ctx, tf)
+	if err != nil {
+		return nil, err
+	}
+	if len(credentials) > 0 {
+		data["gitAskpass"] = gitAskpass(credentials[0])
+	}
+	data["gitCredentialHelper"] = gitCredentialHelper(credentials)
+	data["gitconfig"] = gitConfig(tf.Spec.SCMAuthMethods, runnerGitProxies(tf))
+	return data, nil
+}
+
+// usesGitHubApp returns true when one of the SCMAuthMethods uses a GitHub App
+func usesGitHubApp(tf *tfv1alpha2.Terraform) bool {
+	for _, m := range tf.Spec.SCMAuthMethods {
+		if m.Git != nil && m.Git.HTTPS != nil && m.Git.HTTPS.GitHubApp != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// refreshGitCredentials replaces the git credentials in the run's secret when
+// an installation token was refreshed. Pods that are running see the new
+// token once the kubelet syncs the secret volume.
+func (r ReconcileTerraform) refreshGitCredentials(ctx context.Context, tf *tfv1alpha2.Terraform) error {
+	if !usesGitHubApp(tf) || tf.Status.PodNamePrefix == "" {
+		return nil
+	}
+	secret := &corev1.Secret{}
+	err := r.Client.Get(ctx, types.NamespacedName{Name: tf.Status.PodNamePrefix, Namespace: tf.Namespace}, secret)
+	if errors.IsNotFound(err) {
+		// The secret is created with new tokens when the run starts
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	data, err := r.runnerGitCredentials(ctx, tf)
+	if err != nil {
+		return err
+	}
+	changed := false
+	if secret.Data == nil {
+		secret.Data = make(map[string][]byte)
+	}
+	for k, v := range data {
+		if !bytes.Equal(secret.Data[k], v) {
+			secret.Data[k] = v
+			changed = true
+		}
+	}
+	if !changed {
+		return nil
+	}
+	return r.Client.Update(ctx, secret)
+}
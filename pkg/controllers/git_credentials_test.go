@@ -0,0 +1,73 @@
+package controllers
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	tfv1alpha2 "github.com/isaaguilar/terraform-operator/pkg/apis/tf/v1alpha2"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Runner git credentials", func() {
+
+	It("Should answer with the credential of the requested host", func() {
+		dir, err := ioutil.TempDir("", "credentials")
+		Expect(err).NotTo(HaveOccurred())
+		defer os.RemoveAll(dir)
+		helper := filepath.Join(dir, gitCredentialHelperFile)
+		Expect(ioutil.WriteFile(helper, gitCredentialHelper([]gitHTTPSCredential{
+			{host: "github.com", username: githubAppUser, token: "ghs_token"},
+			{host: "github.example.com", username: "git", token: "it's a token"},
+		}), 0755)).To(Succeed())
+
+		get := func(host string) string {
+			cmd := exec.Command(helper, "get")
+			cmd.Stdin = strings.NewReader("protocol=https\nhost=" + host + "\n\n")
+			out, err := cmd.Output()
+			Expect(err).NotTo(HaveOccurred())
+			return string(out)
+		}
+		Expect(get("github.com")).To(Equal("username=x-access-token\npassword=ghs_token\n"))
+		Expect(get("github.example.com")).To(Equal("username=git\npassword=it's a token\n"))
+		Expect(get("gitlab.com")).To(BeEmpty())
+	})
+
+	It("Should rewrite urls to the protocol that has credentials", func() {
+		config := string(gitConfig([]tfv1alpha2.SCMAuthMethod{
+			{Host: "github.com", Git: &tfv1alpha2.GitSCM{HTTPS: &tfv1alpha2.GitHTTPS{}}},
+			{Host: "github.example.com", Git: &tfv1alpha2.GitSCM{SSH: &tfv1alpha2.GitSSH{}}},
+			{Host: "gitlab.com", Git: &tfv1alpha2.GitSCM{SSH: &tfv1alpha2.GitSSH{}, HTTPS: &tfv1alpha2.GitHTTPS{}}},
+		}, nil))
+		Expect(config).To(ContainSubstring("helper = /git/askpass/git-credential-tfo"))
+		Expect(config).To(ContainSubstring("[url \"https://github.com/\"]\n\tinsteadOf = git@github.com:\n"))
+		Expect(config).To(ContainSubstring("[url \"git@github.example.com:\"]\n\tinsteadOf = https://github.example.com/\n"))
+		Expect(config).NotTo(ContainSubstring("gitlab.com"))
+	})
+
+	It("Should clone the hosts that require the proxy through the SOCKS5 proxy", func() {
+		methods := []tfv1alpha2.SCMAuthMethod{
+			{Host: "github.com", Git: &tfv1alpha2.GitSCM{HTTPS: &tfv1alpha2.GitHTTPS{}}},
+			{Host: "github.example.com", Git: &tfv1alpha2.GitSCM{HTTPS: &tfv1alpha2.GitHTTPS{RequireProxy: true}}},
+		}
+		config := string(gitConfig(methods, map[string]string{"github.example.com": socks5ProxyAddress}))
+		Expect(config).To(ContainSubstring("[http \"https://github.example.com/\"]\n\tproxy = socks5h://127.0.0.1:1080\n"))
+		Expect(config).NotTo(ContainSubstring("[http \"https://github.com/\"]"))
+
+		// Without a tunnel, there is no proxy to clone through
+		Expect(string(gitConfig(methods, nil))).NotTo(ContainSubstring("proxy ="))
+	})
+
+	It("Should only refresh the credentials of GitHub App runs", func() {
+		tf := &tfv1alpha2.Terraform{}
+		Expect(usesGitHubApp(tf)).To(BeFalse())
+		tf.Spec.SCMAuthMethods = []tfv1alpha2.SCMAuthMethod{
+			{Host: "github.example.com", Git: &tfv1alpha2.GitSCM{SSH: &tfv1alpha2.GitSSH{}}},
+			{Host: "github.com", Git: &tfv1alpha2.GitSCM{HTTPS: &tfv1alpha2.GitHTTPS{GitHubApp: &tfv1alpha2.GitHubApp{AppID: 7}}}},
+		}
+		Expect(usesGitHubApp(tf)).To(BeTrue())
+	})
+})
@@ -0,0 +1,242 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	tfv1alpha2 "github.com/isaaguilar/terraform-operator/pkg/apis/tf/v1alpha2"
+	"github.com/isaaguilar/terraform-operator/pkg/gitwebhook"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+)
+
+// pendingRunResendInterval is how often the events of pending runs that did
+// not fit in the events channel are sent again
+const pendingRunResendInterval = 5 * time.Second
+
+// pendingRuns are tf resources that need a new run once the current stage
+// allows it. The value is the reason given to the new run's stage.
+type pendingRuns struct {
+	mu      sync.Mutex
+	reasons map[string]string
+
+	// undelivered are the pending runs whose event did not fit in the
+	// events channel. They are sent again by resendPendingRuns.
+	undelivered map[string]*tfv1alpha2.Terraform
+}
+
+func newPendingRuns() *pendingRuns {
+	return &pendingRuns{
+		reasons:     make(map[string]string),
+		undelivered: make(map[string]*tfv1alpha2.Terraform),
+	}
+}
+
+func (p *pendingRuns) add(key, reason string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.reasons[key] = reason
+}
+
+func (p *pendingRuns) get(key string) (string, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	reason, found := p.reasons[key]
+	return reason, found
+}
+
+func (p *pendingRuns) remove(key string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	delete(p.reasons, key)
+}
+
+func (p *pendingRuns) addUndelivered(key string, tf *tfv1alpha2.Terraform) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.undelivered[key] = tf
+}
+
+// takeUndelivered returns the undelivered events and forgets them
+func (p *pendingRuns) takeUndelivered() map[string]*tfv1alpha2.Terraform {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	undelivered := p.undelivered
+	p.undelivered = make(map[string]*tfv1alpha2.Terraform)
+	return undelivered
+}
+
+// EnqueueGitPush finds the tf resources that use the pushed repo and branch
+// in their terraformModule or sources and queues a new run for each. The
+// resources are found in the background because a push without the default
+// branch contacts the remotes.
+func (r *ReconcileTerraform) EnqueueGitPush(push gitwebhook.PushEvent) {
+	if push.Branch == "" {
+		return
+	}
+	go r.enqueueGitPush(context.TODO(), push)
+}
+
+func (r *ReconcileTerraform) enqueueGitPush(ctx context.Context, push gitwebhook.PushEvent) {
+	reqLogger := r.Log.WithValues("GitPush", push.RepoURLs, "Branch", push.Branch)
+
+	tfs := &tfv1alpha2.TerraformList{}
+	err := r.Client.List(ctx, tfs)
+	if err != nil {
+		reqLogger.Error(err, "unable to list terraform resources")
+		return
+	}
+	defaultBranchCommit := func(tf *tfv1alpha2.Terraform, src *tfv1alpha2.SrcOpts) (string, error) {
+		return r.defaultBranchCommit(ctx, tf, src)
+	}
+	for i := range tfs.Items {
+		tf := &tfs.Items[i]
+		if !pushAffects(tf, push, defaultBranchCommit) {
+			continue
+		}
+		key := types.NamespacedName{Name: tf.Name, Namespace: tf.Namespace}.String()
+		reqLogger.Info(fmt.Sprintf("Queueing '%s' for a new run", key))
+		r.queueRun(key, tf, "GIT_PUSH")
+	}
+}
+
+// defaultBranchCommit resolves the commit of the remote HEAD of a git
+// address with the tf resource's credentials
+func (r *ReconcileTerraform) defaultBranchCommit(ctx context.Context, tf *tfv1alpha2.Terraform, src *tfv1alpha2.SrcOpts) (string, error) {
+	d, err := newGitRepoAccessOptionsFromSpec(tf, src.Address, []string{})
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(d.Directory)
+	d.sshTunnelName = src.SSHTunnel
+	err = d.getParsedAddress()
+	if err != nil {
+		return "", err
+	}
+	return d.resolveCommit(ctx, r.Client, tf.Namespace)
+}
+
+// queueRun adds the pending run and enqueues the tf resource. It does not
+// wait for the controller: when the events channel is full, the event is
+// sent again by resendPendingRuns so that the git host's request returns in
+// time.
+func (r *ReconcileTerraform) queueRun(key string, tf *tfv1alpha2.Terraform, reason string) {
+	r.pendingRuns.add(key, reason)
+	select {
+	case r.events <- event.GenericEvent{Object: tf}:
+	default:
+		r.pendingRuns.addUndelivered(key, tf)
+	}
+}
+
+// resendPendingRuns sends the undelivered events of pending runs until the
+// context is done
+func (r *ReconcileTerraform) resendPendingRuns(ctx context.Context) error {
+	ticker := time.NewTicker(pendingRunResendInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+		r.resendUndelivered(ctx)
+	}
+}
+
+// resendUndelivered sends the undelivered events, waiting for room in the
+// events channel
+func (r *ReconcileTerraform) resendUndelivered(ctx context.Context) {
+	for _, tf := range r.pendingRuns.takeUndelivered() {
+		select {
+		case r.events <- event.GenericEvent{Object: tf}:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// pushAffects returns true when the terraformModule or one of the sources
+// tracks the pushed branch. Addresses without a ref track the default branch.
+// When the push does not name the default branch, they are affected if their
+// remote HEAD, from defaultBranchCommit, is the pushed commit. Addresses
+// pinned to a tag or commit are never affected.
+func pushAffects(tf *tfv1alpha2.Terraform, push gitwebhook.PushEvent, defaultBranchCommit func(*tfv1alpha2.Terraform, *tfv1alpha2.SrcOpts) (string, error)) bool {
+	srcs := []*tfv1alpha2.SrcOpts{}
+	if tf.Spec.TerraformModule != nil {
+		srcs = append(srcs, tf.Spec.TerraformModule)
+	}
+	for _, s := range tf.Spec.Sources {
+		if s != nil {
+			srcs = append(srcs, s)
+		}
+	}
+
+	for _, src := range srcs {
+		if src.Address == "" || isGetterAddress(src.Address) {
+			continue
+		}
+		d := GitRepoAccessOptions{Address: src.Address}
+		if err := d.getParsedAddress(); err != nil {
+			continue
+		}
+		if !push.Matches(d.repo) {
+			continue
+		}
+		if d.hash == "" {
+			if push.DefaultBranch != "" {
+				if push.DefaultBranch == push.Branch {
+					return true
+				}
+				continue
+			}
+			if push.Commit == "" {
+				continue
+			}
+			commit, err := defaultBranchCommit(tf, src)
+			if err == nil && commit == push.Commit {
+				return true
+			}
+			continue
+		}
+		if d.hash == push.Branch {
+			return true
+		}
+	}
+	return false
+}
+
+// checkPendingRun starts the new run queued for the tf resource. The run is
+// kept pending while the current stage can not be interrupted. Returns true
+// when the status was modified and needs to be updated.
+func (r *ReconcileTerraform) checkPendingRun(ctx context.Context, tf *tfv1alpha2.Terraform) (bool, error) {
+	if r.pendingRuns == nil {
+		return false, nil
+	}
+	key := types.NamespacedName{Name: tf.Name, Namespace: tf.Namespace}.String()
+	reason, found := r.pendingRuns.get(key)
+	if !found {
+		return false, nil
+	}
+
+	n := len(tf.Status.Stages)
+	currentStage := tf.Status.Stages[n-1]
+	if currentStage.Interruptible == tfv1alpha2.CanNotBeInterrupt && currentStage.State == tfv1alpha2.StateInProgress {
+		return false, nil
+	}
+	r.pendingRuns.remove(key)
+	if runIsStarting(currentStage) {
+		// A run is about to start and will pick up the latest commit
+		return false, nil
+	}
+
+	r.Recorder.Event(tf, "Normal", "NewRun", fmt.Sprintf("Starting a new run: %s", reason))
+	err := r.startNewRun(ctx, tf, reason)
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
@@ -0,0 +1,64 @@
+package controllers
+
+import (
+	"context"
+
+	tfv1alpha2 "github.com/isaaguilar/terraform-operator/pkg/apis/tf/v1alpha2"
+	"github.com/isaaguilar/terraform-operator/pkg/gitwebhook"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+)
+
+var _ = Describe("Git push runs", func() {
+
+	It("Should not wait for room in the events channel", func() {
+		r := &ReconcileTerraform{
+			pendingRuns: newPendingRuns(),
+			events:      make(chan event.GenericEvent, 1),
+		}
+		first := &tfv1alpha2.Terraform{ObjectMeta: metav1.ObjectMeta{Name: "first", Namespace: "default"}}
+		second := &tfv1alpha2.Terraform{ObjectMeta: metav1.ObjectMeta{Name: "second", Namespace: "default"}}
+		r.queueRun("default/first", first, "GIT_PUSH")
+		r.queueRun("default/second", second, "GIT_PUSH")
+
+		reason, found := r.pendingRuns.get("default/second")
+		Expect(found).To(BeTrue())
+		Expect(reason).To(Equal("GIT_PUSH"))
+		Expect((<-r.events).Object.GetName()).To(Equal("first"))
+
+		// The event that did not fit is sent again
+		r.resendUndelivered(context.TODO())
+		Expect((<-r.events).Object.GetName()).To(Equal("second"))
+		Expect(r.pendingRuns.takeUndelivered()).To(BeEmpty())
+	})
+
+	It("Should resolve the default branch when the push does not name it", func() {
+		push, err := gitwebhook.Parse("gitea", []byte(`{
+			"ref": "refs/heads/main",
+			"after": "1111111111111111111111111111111111111111",
+			"repository": {"clone_url": "https://git.example.com/org/repo.git"}
+		}`))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(push.DefaultBranch).To(BeEmpty())
+
+		tf := &tfv1alpha2.Terraform{Spec: tfv1alpha2.TerraformSpec{
+			TerraformModule: &tfv1alpha2.SrcOpts{Address: "https://git.example.com/org/repo.git"},
+		}}
+		head := ""
+		defaultBranchCommit := func(*tfv1alpha2.Terraform, *tfv1alpha2.SrcOpts) (string, error) {
+			return head, nil
+		}
+
+		// The push was to another branch than the remote HEAD
+		head = "2222222222222222222222222222222222222222"
+		Expect(pushAffects(tf, push, defaultBranchCommit)).To(BeFalse())
+		head = "1111111111111111111111111111111111111111"
+		Expect(pushAffects(tf, push, defaultBranchCommit)).To(BeTrue())
+
+		// Addresses with a ref do not need the default branch
+		tf.Spec.TerraformModule.Address = "https://git.example.com/org/repo.git?ref=main"
+		Expect(pushAffects(tf, push, nil)).To(BeTrue())
+	})
+})
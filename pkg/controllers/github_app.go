@@ -0,0 +1,65 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/MakeNowJust/heredoc"
+	tfv1alpha2 "github.com/isaaguilar/terraform-operator/pkg/apis/tf/v1alpha2"
+	"github.com/isaaguilar/terraform-operator/pkg/githubapp"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// githubAppTokens are the installation tokens of the GitHub Apps of all tf
+// resources
+var githubAppTokens = githubapp.NewTokenCache(&http.Client{Timeout: 30 * time.Second})
+
+// githubAppUser is the git username of installation tokens
+const githubAppUser = "x-access-token"
+
+// githubAppRefreshInterval is how often the askpass of a running pod is
+// checked for a token that is about to expire
+const githubAppRefreshInterval = 5 * time.Minute
+
+// githubAppToken returns an installation token of the app
+func githubAppToken(ctx context.Context, k8sclient client.Client, app *tfv1alpha2.GitHubApp, namespace string) (string, error) {
+	if app.PrivateKeySecretRef == nil {
+		return "", fmt.Errorf("githubApp needs a privateKeySecretRef")
+	}
+	key := app.PrivateKeySecretRef.Key
+	if key == "" {
+		key = "private-key.pem"
+	}
+	ns := app.PrivateKeySecretRef.Namespace
+	if ns == "" {
+		ns = namespace
+	}
+	privateKey, err := loadPassword(ctx, k8sclient, key, app.PrivateKeySecretRef.Name, ns)
+	if err != nil {
+		return "", fmt.Errorf("unable to get githubApp private key: %v", err)
+	}
+	token, err := githubAppTokens.Token(ctx, githubapp.App{
+		ID:             app.AppID,
+		InstallationID: app.InstallationID,
+		PrivateKey:     []byte(privateKey),
+		APIURL:         app.APIURL,
+	})
+	if err != nil {
+		return "", fmt.Errorf("githubApp %d: %v", app.AppID, err)
+	}
+	return token.Token, nil
+}
+
+// githubAppAskpass is the GIT_ASKPASS script of an installation token. git
+// asks for the username too, which has to be x-access-token.
+func githubAppAskpass(token string) []byte {
+	return []byte(heredoc.Docf(`
+		#!/bin/sh
+		case "$1" in
+		Username*) exec echo "%s" ;;
+		esac
+		exec echo "%s"
+	`, githubAppUser, token))
+}
@@ -0,0 +1,17 @@
+package controllers
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("GitHub App authentication", func() {
+
+	It("Should answer the username prompt with x-access-token", func() {
+		askpass := string(githubAppAskpass("ghs_token"))
+		Expect(askpass).To(HavePrefix("#!/bin/sh"))
+		Expect(askpass).To(ContainSubstring(`Username*) exec echo "x-access-token"`))
+		Expect(askpass).To(ContainSubstring(`exec echo "ghs_token"`))
+	})
+
+})
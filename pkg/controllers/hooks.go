@@ -0,0 +1,96 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+
+	tfv1alpha2 "github.com/isaaguilar/terraform-operator/pkg/apis/tf/v1alpha2"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// postHookStages maps the pod types that run post hooks to the stage the
+// hooks belong to
+var postHookStages = map[tfv1alpha2.PodType]tfv1alpha2.PodType{
+	tfv1alpha2.PodPostInit:        tfv1alpha2.PodInit,
+	tfv1alpha2.PodPostPlan:        tfv1alpha2.PodPlan,
+	tfv1alpha2.PodPostApply:       tfv1alpha2.PodApply,
+	tfv1alpha2.PodPostInitDelete:  tfv1alpha2.PodInitDelete,
+	tfv1alpha2.PodPostPlanDelete:  tfv1alpha2.PodPlanDelete,
+	tfv1alpha2.PodPostApplyDelete: tfv1alpha2.PodApplyDelete,
+}
+
+// hookRun is a hook to run in a pod. The script is found in the run's
+// configmap under the key.
+type hookRun struct {
+	key   string
+	image string
+}
+
+// hookKey is the configmap key of the i-th hook of the stage, eg "preinit-0"
+func hookKey(stage tfv1alpha2.PodType, when tfv1alpha2.HookWhen, i int) string {
+	return fmt.Sprintf("%s%s-%d", when, stage, i)
+}
+
+// stageHooks returns the hooks of the stage in the order they run
+func stageHooks(tf *tfv1alpha2.Terraform, stage tfv1alpha2.PodType, when tfv1alpha2.HookWhen) []hookRun {
+	runs := []hookRun{}
+	for _, hook := range tf.Spec.Hooks {
+		if hook.Stage != stage || hook.When != when {
+			continue
+		}
+		runs = append(runs, hookRun{
+			key:   hookKey(stage, when, len(runs)),
+			image: hook.Image,
+		})
+	}
+	return runs
+}
+
+// hasHooks returns true when the stage has hooks that run at when
+func hasHooks(tf *tfv1alpha2.Terraform, stage tfv1alpha2.PodType, when tfv1alpha2.HookWhen) bool {
+	return len(stageHooks(tf, stage, when)) > 0
+}
+
+// podHooks returns the hooks that run in a pod of the pod type. Pods of the
+// terraform stages run the pre hooks before terraform. The post pod types
+// only run the post hooks of their stage.
+func podHooks(tf *tfv1alpha2.Terraform, podType tfv1alpha2.PodType) []hookRun {
+	if stage, found := postHookStages[podType]; found {
+		return stageHooks(tf, stage, tfv1alpha2.HookPost)
+	}
+	return stageHooks(tf, podType, tfv1alpha2.HookPre)
+}
+
+// hookScripts returns the script of every hook keyed by its configmap key.
+// Scripts from a configMapRef are read from the tf resource's namespace.
+func (r ReconcileTerraform) hookScripts(ctx context.Context, tf *tfv1alpha2.Terraform) (map[string]string, error) {
+	scripts := make(map[string]string)
+	counts := make(map[string]int)
+	for _, hook := range tf.Spec.Hooks {
+		countKey := string(hook.When) + string(hook.Stage)
+		key := hookKey(hook.Stage, hook.When, counts[countKey])
+		counts[countKey]++
+
+		if hook.ConfigMapRef == nil {
+			scripts[key] = hook.Script
+			continue
+		}
+		configMap := &corev1.ConfigMap{}
+		name := types.NamespacedName{Namespace: tf.Namespace, Name: hook.ConfigMapRef.Name}
+		err := r.Client.Get(ctx, name, configMap)
+		if err != nil {
+			if hook.ConfigMapRef.Optional != nil && *hook.ConfigMapRef.Optional {
+				scripts[key] = ""
+				continue
+			}
+			return scripts, fmt.Errorf("unable to get configmap '%s' for the %s %s hook: %v", name.Name, hook.When, hook.Stage, err)
+		}
+		script, found := configMap.Data[hook.ConfigMapRef.Key]
+		if !found && (hook.ConfigMapRef.Optional == nil || !*hook.ConfigMapRef.Optional) {
+			return scripts, fmt.Errorf("configmap '%s' has no key '%s' for the %s %s hook", name.Name, hook.ConfigMapRef.Key, hook.When, hook.Stage)
+		}
+		scripts[key] = script
+	}
+	return scripts, nil
+}
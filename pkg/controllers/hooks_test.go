@@ -0,0 +1,53 @@
+package controllers
+
+import (
+	tfv1alpha2 "github.com/isaaguilar/terraform-operator/pkg/apis/tf/v1alpha2"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Terraform hooks", func() {
+
+	tf := &tfv1alpha2.Terraform{
+		Spec: tfv1alpha2.TerraformSpec{
+			Hooks: []tfv1alpha2.Hook{
+				{Stage: tfv1alpha2.PodPlan, When: tfv1alpha2.HookPre, Script: "echo one"},
+				{Stage: tfv1alpha2.PodPlan, When: tfv1alpha2.HookPost, Script: "echo two", Image: "alpine:3"},
+				{Stage: tfv1alpha2.PodPlan, When: tfv1alpha2.HookPre, Script: "echo three"},
+				{Stage: tfv1alpha2.PodPlan, When: tfv1alpha2.HookPost, Script: "echo four"},
+			},
+		},
+	}
+	runOpts := RunOptions{
+		name:                "tf",
+		scriptRunner:        defaultScriptRunner,
+		scriptRunnerVersion: defaultScriptRunnerVersion,
+	}
+
+	It("Should run the pre hooks as init containers of the stage's pod", func() {
+		hooks := podHooks(tf, tfv1alpha2.PodPlan)
+		Expect(hooks).To(Equal([]hookRun{{key: "preplan-0"}, {key: "preplan-1"}}))
+
+		pod := runOpts.generatePod(tfv1alpha2.PodPlan, hooks, true, 1)
+		Expect(pod.Spec.InitContainers).To(HaveLen(2))
+		Expect(pod.Spec.InitContainers[1].Name).To(Equal("pre-script-1"))
+		Expect(pod.Spec.Containers[0].Name).To(Equal("tf"))
+	})
+
+	It("Should run the last post hook as the pod's container", func() {
+		hooks := podHooks(tf, tfv1alpha2.PodPostPlan)
+		Expect(hooks).To(Equal([]hookRun{{key: "postplan-0", image: "alpine:3"}, {key: "postplan-1"}}))
+
+		pod := runOpts.generatePod(tfv1alpha2.PodPostPlan, hooks, false, 1)
+		Expect(pod.Spec.InitContainers).To(HaveLen(1))
+		Expect(pod.Spec.InitContainers[0].Image).To(Equal("alpine:3"))
+		Expect(pod.Spec.InitContainers[0].Command).NotTo(BeEmpty())
+		Expect(pod.Spec.Containers).To(HaveLen(1))
+		Expect(pod.Spec.Containers[0].Image).To(Equal(defaultScriptRunner + ":" + defaultScriptRunnerVersion))
+	})
+
+	It("Should only move to a post hook pod when the stage has post hooks", func() {
+		Expect(hasHooks(tf, tfv1alpha2.PodPlan, tfv1alpha2.HookPost)).To(BeTrue())
+		Expect(hasHooks(tf, tfv1alpha2.PodApply, tfv1alpha2.HookPost)).To(BeFalse())
+	})
+})
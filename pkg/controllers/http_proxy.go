@@ -0,0 +1,166 @@
+package controllers
+
+import (
+	"fmt"
+	"strings"
+
+	tfv1alpha2 "github.com/isaaguilar/terraform-operator/pkg/apis/tf/v1alpha2"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// socks5ProxyPort is where the runners' first SOCKS5 proxy over an sshTunnel
+// listens. Each tunnel has its own port after it, in the order of
+// runnerSSHTunnels.
+const socks5ProxyPort = 1080
+
+// socks5ProxyAddress is the address of the SOCKS5 proxy over the first tunnel
+var socks5ProxyAddress = fmt.Sprintf("127.0.0.1:%d", socks5ProxyPort)
+
+// clusterNoProxy are the hosts that are never proxied. The kubernetes api is
+// reached by its service ip.
+const clusterNoProxy = "localhost,127.0.0.1,.svc,.cluster.local,$(KUBERNETES_SERVICE_HOST)"
+
+// runnerSOCKS5Proxy is a SOCKS5 proxy the runners start over the tunnel of
+// the alias in their ssh config
+type runnerSOCKS5Proxy struct {
+	alias   string
+	address string
+}
+
+// runnerHTTPSHost is an https git host and the alias of the tunnel the
+// runners reach it through
+type runnerHTTPSHost struct {
+	host  string
+	alias string
+}
+
+// runnerHTTPSHosts returns the https hosts that are reached through a
+// tunnel. Like for ssh hosts, a host uses its SCMAuthMethod's sshTunnel, the
+// terraformModule's sshTunnel when it is the module's host, or the spec's
+// sshTunnel when it requires the proxy.
+func runnerHTTPSHosts(tf *tfv1alpha2.Terraform) []runnerHTTPSHost {
+	// moduleHost is only set when the module has a tunnel
+	moduleHost, moduleHTTPS := "", false
+	if m := tf.Spec.TerraformModule; m != nil && m.SSHTunnel != "" && m.Address != "" && !isGetterAddress(m.Address) {
+		module := GitRepoAccessOptions{Address: m.Address}
+		if module.getParsedAddress() == nil {
+			moduleHost = module.host
+			moduleHTTPS = strings.Contains(module.protocol, "http")
+		}
+	}
+
+	hosts := []runnerHTTPSHost{}
+	moduleListed := false
+	for _, m := range tf.Spec.SCMAuthMethods {
+		if m.Git == nil || m.Git.HTTPS == nil || m.Host == "" {
+			continue
+		}
+		alias := ""
+		switch {
+		case m.SSHTunnel != "":
+			alias = sshTunnelAlias(m.SSHTunnel)
+		case m.Host == moduleHost:
+			alias = sshTunnelAlias(tf.Spec.TerraformModule.SSHTunnel)
+		case m.Git.HTTPS.RequireProxy && tf.Spec.SSHTunnel != nil:
+			alias = sshTunnelAlias("")
+		}
+		if m.Host == moduleHost {
+			moduleListed = true
+		}
+		if alias != "" {
+			hosts = append(hosts, runnerHTTPSHost{host: m.Host, alias: alias})
+		}
+	}
+	// A public module has no SCMAuthMethod
+	if moduleHTTPS && !moduleListed {
+		hosts = append(hosts, runnerHTTPSHost{host: moduleHost, alias: sshTunnelAlias(tf.Spec.TerraformModule.SSHTunnel)})
+	}
+	return hosts
+}
+
+// runnerSOCKS5Proxies returns the SOCKS5 proxies the runners start, one for
+// each tunnel that https is sent through. It is empty when there is no
+// sshTunnel or nothing is sent through one over https.
+func runnerSOCKS5Proxies(tf *tfv1alpha2.Terraform) []runnerSOCKS5Proxy {
+	used := make(map[string]bool)
+	if tf.Spec.SSHTunnel != nil && tf.Spec.HTTPProxy != nil && tf.Spec.HTTPProxy.SSHTunnel {
+		used[sshTunnelAlias("")] = true
+	}
+	for _, h := range runnerHTTPSHosts(tf) {
+		used[h.alias] = true
+	}
+	proxies := []runnerSOCKS5Proxy{}
+	for i, t := range runnerSSHTunnels(tf) {
+		if used[t.alias] {
+			proxies = append(proxies, runnerSOCKS5Proxy{alias: t.alias, address: fmt.Sprintf("127.0.0.1:%d", socks5ProxyPort+i)})
+		}
+	}
+	return proxies
+}
+
+// runnerGitProxies are the SOCKS5 proxies git reaches the https hosts
+// through, by host
+func runnerGitProxies(tf *tfv1alpha2.Terraform) map[string]string {
+	addresses := make(map[string]string)
+	for _, p := range runnerSOCKS5Proxies(tf) {
+		addresses[p.alias] = p.address
+	}
+	proxies := make(map[string]string)
+	for _, h := range runnerHTTPSHosts(tf) {
+		if address, found := addresses[h.alias]; found {
+			proxies[h.host] = address
+		}
+	}
+	return proxies
+}
+
+// proxyEnvVars are the proxy settings of the runner pods. Both the upper and
+// lower case variables are set since tools disagree on which one they read.
+func proxyEnvVars(httpProxy *tfv1alpha2.HTTPProxyOpts, socks5Proxies []runnerSOCKS5Proxy) []corev1.EnvVar {
+	envs := []corev1.EnvVar{}
+	if len(socks5Proxies) > 0 {
+		// The runners start a proxy for each "address=alias"
+		proxies := []string{}
+		for _, p := range socks5Proxies {
+			proxies = append(proxies, p.address+"="+p.alias)
+		}
+		envs = append(envs, corev1.EnvVar{
+			Name:  "TFO_SOCKS5_PROXIES",
+			Value: strings.Join(proxies, " "),
+		})
+	}
+	if httpProxy == nil {
+		return envs
+	}
+
+	httpsProxy := httpProxy.HTTPSProxy
+	if httpProxy.SSHTunnel {
+		for _, p := range socks5Proxies {
+			if p.alias == sshTunnelAlias("") {
+				httpsProxy = "socks5://" + p.address
+			}
+		}
+	}
+	if httpsProxy == "" && httpProxy.HTTPProxy == "" {
+		return envs
+	}
+	noProxy := clusterNoProxy
+	if httpProxy.NoProxy != "" {
+		noProxy = httpProxy.NoProxy + "," + noProxy
+	}
+
+	for _, e := range []corev1.EnvVar{
+		{Name: "HTTPS_PROXY", Value: httpsProxy},
+		{Name: "HTTP_PROXY", Value: httpProxy.HTTPProxy},
+		{Name: "NO_PROXY", Value: noProxy},
+	} {
+		if e.Value == "" {
+			continue
+		}
+		envs = append(envs, e, corev1.EnvVar{
+			Name:  strings.ToLower(e.Name),
+			Value: e.Value,
+		})
+	}
+	return envs
+}
@@ -0,0 +1,87 @@
+package controllers
+
+import (
+	tfv1alpha2 "github.com/isaaguilar/terraform-operator/pkg/apis/tf/v1alpha2"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+)
+
+var _ = Describe("Runner proxy", func() {
+
+	envMap := func(envs []corev1.EnvVar) map[string]string {
+		m := make(map[string]string)
+		for _, e := range envs {
+			m[e.Name] = e.Value
+		}
+		return m
+	}
+
+	It("Should set the standard proxy variables", func() {
+		envs := envMap(proxyEnvVars(&tfv1alpha2.HTTPProxyOpts{
+			HTTPSProxy: "http://proxy.example.com:3128",
+			NoProxy:    ".example.com",
+		}, nil))
+		Expect(envs).To(HaveKeyWithValue("HTTPS_PROXY", "http://proxy.example.com:3128"))
+		Expect(envs).To(HaveKeyWithValue("https_proxy", "http://proxy.example.com:3128"))
+		Expect(envs).To(HaveKeyWithValue("NO_PROXY", ".example.com,"+clusterNoProxy))
+		Expect(envs).To(HaveKeyWithValue("no_proxy", ".example.com,"+clusterNoProxy))
+		Expect(envs).NotTo(HaveKey("HTTP_PROXY"))
+		Expect(envs).NotTo(HaveKey("TFO_SOCKS5_PROXIES"))
+	})
+
+	It("Should send https through the sshTunnel", func() {
+		tf := &tfv1alpha2.Terraform{}
+		tf.Spec.HTTPProxy = &tfv1alpha2.HTTPProxyOpts{SSHTunnel: true}
+		Expect(runnerSOCKS5Proxies(tf)).To(BeEmpty())
+
+		tf.Spec.SSHTunnel = &tfv1alpha2.ProxyOpts{Host: "bastion.example.com"}
+		Expect(runnerSOCKS5Proxies(tf)).To(Equal([]runnerSOCKS5Proxy{{alias: "proxy", address: socks5ProxyAddress}}))
+		envs := envMap(proxyEnvVars(tf.Spec.HTTPProxy, runnerSOCKS5Proxies(tf)))
+		Expect(envs).To(HaveKeyWithValue("TFO_SOCKS5_PROXIES", socks5ProxyAddress+"=proxy"))
+		Expect(envs).To(HaveKeyWithValue("HTTPS_PROXY", "socks5://"+socks5ProxyAddress))
+		Expect(envs).To(HaveKeyWithValue("NO_PROXY", clusterNoProxy))
+	})
+
+	It("Should start the SOCKS5 proxy for hosts that require it", func() {
+		tf := &tfv1alpha2.Terraform{}
+		tf.Spec.SSHTunnel = &tfv1alpha2.ProxyOpts{Host: "bastion.example.com"}
+		tf.Spec.SCMAuthMethods = []tfv1alpha2.SCMAuthMethod{
+			{Host: "github.com", Git: &tfv1alpha2.GitSCM{HTTPS: &tfv1alpha2.GitHTTPS{}}},
+		}
+		Expect(runnerSOCKS5Proxies(tf)).To(BeEmpty())
+
+		tf.Spec.SCMAuthMethods[0].Git.HTTPS.RequireProxy = true
+		envs := envMap(proxyEnvVars(nil, runnerSOCKS5Proxies(tf)))
+		Expect(envs).To(Equal(map[string]string{"TFO_SOCKS5_PROXIES": socks5ProxyAddress + "=proxy"}))
+		Expect(runnerGitProxies(tf)).To(Equal(map[string]string{"github.com": socks5ProxyAddress}))
+	})
+
+	It("Should start a SOCKS5 proxy for each tunnel of an https host", func() {
+		tf := &tfv1alpha2.Terraform{}
+		tf.Spec.SSHTunnel = &tfv1alpha2.ProxyOpts{Host: "bastion.example.com"}
+		tf.Spec.SSHTunnels = []tfv1alpha2.ProxyOpts{
+			{Name: "corp", Host: "bastion.corp.example.com"},
+			{Name: "modules", Host: "bastion.modules.example.com"},
+			{Name: "unused", Host: "bastion.unused.example.com"},
+		}
+		tf.Spec.TerraformModule = &tfv1alpha2.SrcOpts{
+			Address:   "https://modules.example.com/org/vpc.git",
+			SSHTunnel: "modules",
+		}
+		tf.Spec.SCMAuthMethods = []tfv1alpha2.SCMAuthMethod{
+			{Host: "git.corp.example.com", SSHTunnel: "corp", Git: &tfv1alpha2.GitSCM{HTTPS: &tfv1alpha2.GitHTTPS{}}},
+			{Host: "github.com", Git: &tfv1alpha2.GitSCM{HTTPS: &tfv1alpha2.GitHTTPS{}}},
+		}
+		Expect(runnerSOCKS5Proxies(tf)).To(Equal([]runnerSOCKS5Proxy{
+			{alias: "proxy-corp", address: "127.0.0.1:1081"},
+			{alias: "proxy-modules", address: "127.0.0.1:1082"},
+		}))
+		Expect(runnerGitProxies(tf)).To(Equal(map[string]string{
+			"git.corp.example.com": "127.0.0.1:1081",
+			"modules.example.com":  "127.0.0.1:1082",
+		}))
+		envs := envMap(proxyEnvVars(nil, runnerSOCKS5Proxies(tf)))
+		Expect(envs).To(HaveKeyWithValue("TFO_SOCKS5_PROXIES", "127.0.0.1:1081=proxy-corp 127.0.0.1:1082=proxy-modules"))
+	})
+})
@@ -0,0 +1,120 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+
+	tfv1alpha2 "github.com/isaaguilar/terraform-operator/pkg/apis/tf/v1alpha2"
+	"github.com/isaaguilar/terraform-operator/pkg/gitclient"
+	"golang.org/x/crypto/ssh"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// loadKnownHosts reads the known_hosts data from the secret or configmap
+func loadKnownHosts(ctx context.Context, k8sclient client.Client, knownHosts *tfv1alpha2.KnownHosts, namespace string) ([]byte, error) {
+	ref := knownHosts.SecretRef
+	if ref == nil {
+		ref = knownHosts.ConfigMapRef
+	}
+	if ref == nil {
+		return nil, fmt.Errorf("knownHosts needs a secretRef or a configMapRef")
+	}
+	key := ref.Key
+	if key == "" {
+		key = "known_hosts"
+	}
+	ns := ref.Namespace
+	if ns == "" {
+		ns = namespace
+	}
+	namespacedName := types.NamespacedName{Namespace: ns, Name: ref.Name}
+
+	var data []byte
+	if knownHosts.SecretRef != nil {
+		secret := &corev1.Secret{}
+		err := k8sclient.Get(ctx, namespacedName, secret)
+		if err != nil {
+			return nil, fmt.Errorf("Could not get known_hosts secret: %v", err)
+		}
+		data = secret.Data[key]
+	} else {
+		configMap := &corev1.ConfigMap{}
+		err := k8sclient.Get(ctx, namespacedName, configMap)
+		if err != nil {
+			return nil, fmt.Errorf("Could not get known_hosts configmap: %v", err)
+		}
+		data = []byte(configMap.Data[key])
+	}
+	if len(data) == 0 {
+		return nil, fmt.Errorf("unable to locate '%s' in '%s'", key, ref.Name)
+	}
+	return data, nil
+}
+
+// knownHostsCallback returns the callback that verifies host keys against the
+// known_hosts data. It is nil when knownHosts is not set, which accepts any
+// host key.
+func knownHostsCallback(ctx context.Context, k8sclient client.Client, knownHosts *tfv1alpha2.KnownHosts, namespace string) (ssh.HostKeyCallback, error) {
+	if knownHosts == nil {
+		return nil, nil
+	}
+	data, err := loadKnownHosts(ctx, k8sclient, knownHosts, namespace)
+	if err != nil {
+		return nil, err
+	}
+	return gitclient.HostKeyCallback(data, knownHosts.Strict)
+}
+
+// withDefaultPort adds the port to the host when it does not have one
+func withDefaultPort(host, port string) string {
+	if _, _, err := net.SplitHostPort(host); err == nil {
+		return host
+	}
+	return net.JoinHostPort(host, port)
+}
+
+// scmKnownHosts returns the knownHosts of the SCMAuthMethod of the repo's host
+func (d GitRepoAccessOptions) scmKnownHosts() *tfv1alpha2.KnownHosts {
+	for _, m := range d.SCMAuthMethods {
+		if m.Host == d.ParsedAddress.host {
+			return m.KnownHosts
+		}
+	}
+	return nil
+}
+
+// gitHostKeyCallback verifies the host key of the repo's host. The host is
+// checked by its name even when the repo is cloned through a tunnel.
+func (d GitRepoAccessOptions) gitHostKeyCallback(ctx context.Context, k8sclient client.Client, namespace string) (ssh.HostKeyCallback, error) {
+	callback, err := knownHostsCallback(ctx, k8sclient, d.scmKnownHosts(), namespace)
+	if err != nil || callback == nil {
+		return nil, err
+	}
+	return gitclient.HostKeyCallbackFor(callback, withDefaultPort(d.ParsedAddress.host, d.ParsedAddress.port)), nil
+}
+
+// sshConfigHostKeyChecking returns the ssh config lines that check the host
+// key of a Host against its known_hosts file. Without knownHosts, any host key
+// is accepted.
+func sshConfigHostKeyChecking(knownHosts *tfv1alpha2.KnownHosts, filename string) string {
+	if knownHosts == nil {
+		return "\tStrictHostKeyChecking no\n" +
+			"\tUserKnownHostsFile=/dev/null\n"
+	}
+	checking := "accept-new"
+	if knownHosts.Strict {
+		checking = "yes"
+	}
+	return fmt.Sprintf("\tStrictHostKeyChecking %s\n"+
+		"\tUserKnownHostsFile ~/.ssh/%s\n", checking, filename)
+}
+
+// knownHostsFilename is the name of a host's known_hosts file in the runner
+// pods' ~/.ssh
+func knownHostsFilename(host string) string {
+	return strings.ReplaceAll(host, ":", "_") + "_known_hosts"
+}
@@ -0,0 +1,38 @@
+package controllers
+
+import (
+	tfv1alpha2 "github.com/isaaguilar/terraform-operator/pkg/apis/tf/v1alpha2"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("SSH known hosts", func() {
+
+	It("Should only skip host key checking without knownHosts", func() {
+		Expect(sshConfigHostKeyChecking(nil, "github.com_known_hosts")).To(ContainSubstring("StrictHostKeyChecking no"))
+
+		knownHosts := &tfv1alpha2.KnownHosts{SecretRef: &tfv1alpha2.KnownHostsRef{Name: "known-hosts"}}
+		config := sshConfigHostKeyChecking(knownHosts, knownHostsFilename("github.com"))
+		Expect(config).To(ContainSubstring("StrictHostKeyChecking accept-new"))
+		Expect(config).To(ContainSubstring("UserKnownHostsFile ~/.ssh/github.com_known_hosts"))
+
+		knownHosts.Strict = true
+		Expect(sshConfigHostKeyChecking(knownHosts, "proxy_known_hosts")).To(ContainSubstring("StrictHostKeyChecking yes"))
+	})
+
+	It("Should check the repo's host when cloning through a tunnel", func() {
+		Expect(withDefaultPort("github.com", "22")).To(Equal("github.com:22"))
+		Expect(withDefaultPort("git.example.com:2222", "22")).To(Equal("git.example.com:2222"))
+		Expect(knownHostsFilename("git.example.com:2222")).To(Equal("git.example.com_2222_known_hosts"))
+
+		d := GitRepoAccessOptions{
+			SCMAuthMethods: []tfv1alpha2.SCMAuthMethod{
+				{Host: "github.com", KnownHosts: &tfv1alpha2.KnownHosts{Strict: true}},
+			},
+		}
+		d.ParsedAddress.host = "github.com"
+		Expect(d.scmKnownHosts()).NotTo(BeNil())
+		d.ParsedAddress.host = "gitlab.com"
+		Expect(d.scmKnownHosts()).To(BeNil())
+	})
+})
@@ -0,0 +1,195 @@
+package controllers
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	tfv1alpha2 "github.com/isaaguilar/terraform-operator/pkg/apis/tf/v1alpha2"
+	"github.com/isaaguilar/terraform-operator/pkg/notifier"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// notificationLogLines is the number of lines from the end of the pod log
+// that are added to the notification payload
+const notificationLogLines = 30
+
+// notify sends the events to every notification endpoint of the tf resource
+// that subscribes to them. Sending happens in the background so a slow
+// endpoint does not hold up the reconcile loop. The pod log is read there
+// too, once for all the events, and only when an endpoint wants one of them.
+// NotifyDriftDetected is dropped when the plan in the log has no changes.
+func (r *ReconcileTerraform) notify(ctx context.Context, tf *tfv1alpha2.Terraform, stage tfv1alpha2.Stage, pod *corev1.Pod, events ...tfv1alpha2.NotificationEvent) {
+	reqLogger := r.Log.WithValues("Terraform", fmt.Sprintf("%s/%s", tf.Namespace, tf.Name))
+
+	endpoints := map[tfv1alpha2.NotificationEvent][]notifier.Endpoint{}
+	for _, event := range events {
+		if e := r.notificationEndpoints(ctx, tf, event); len(e) > 0 {
+			endpoints[event] = e
+		}
+	}
+	if len(endpoints) == 0 {
+		return
+	}
+
+	obj := tf.DeepCopy()
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+
+		var logs, summary string
+		if pod != nil {
+			var err error
+			logs, err = r.podLogs(ctx, pod)
+			if err != nil {
+				reqLogger.V(1).Info(fmt.Sprintf("Could not read logs of pod '%s': %v", pod.Name, err))
+			}
+			summary = planSummary(logs)
+		}
+
+		for _, event := range events {
+			if len(endpoints[event]) == 0 {
+				continue
+			}
+			if event == tfv1alpha2.NotifyDriftDetected && !planHasChanges(summary) {
+				continue
+			}
+			payload := notifier.Payload{
+				Event:       string(event),
+				Name:        obj.Name,
+				Namespace:   obj.Namespace,
+				Generation:  stage.Generation,
+				PodType:     string(stage.PodType),
+				State:       string(stage.State),
+				Reason:      stage.Reason,
+				Timestamp:   time.Now(),
+				Log:         logs,
+				PlanSummary: summary,
+			}
+			if pod != nil {
+				payload.PodName = pod.Name
+			}
+			for _, endpoint := range endpoints[event] {
+				err := notifier.Send(ctx, nil, endpoint, payload)
+				if err != nil {
+					reqLogger.WithValues("Notification", event).Error(err, "")
+					r.Recorder.Event(obj, "Warning", "NotificationError", err.Error())
+				}
+			}
+		}
+	}()
+}
+
+// notificationEndpoints returns the endpoints of the tf resource that
+// subscribe to the event
+func (r *ReconcileTerraform) notificationEndpoints(ctx context.Context, tf *tfv1alpha2.Terraform, event tfv1alpha2.NotificationEvent) []notifier.Endpoint {
+	var endpoints []notifier.Endpoint
+	for _, n := range tf.Spec.Notifications {
+		if !notificationWantsEvent(n, event) {
+			continue
+		}
+		endpoint := notifier.Endpoint{
+			URL:      n.URL,
+			Template: n.Template,
+		}
+		if n.SigningSecretRef != nil {
+			key := n.SigningSecretRef.Key
+			if key == "" {
+				key = "token"
+			}
+			ns := n.SigningSecretRef.Namespace
+			if ns == "" {
+				ns = tf.Namespace
+			}
+			secret, err := loadPassword(ctx, r.Client, key, n.SigningSecretRef.Name, ns)
+			if err != nil {
+				r.Recorder.Event(tf, "Warning", "NotificationError", fmt.Sprintf("Could not load signing secret for %s: %v", n.URL, err))
+				continue
+			}
+			endpoint.Secret = []byte(secret)
+		}
+		endpoints = append(endpoints, endpoint)
+	}
+	return endpoints
+}
+
+// notifyPodCompletion maps a finished pod to the events it triggers
+func (r *ReconcileTerraform) notifyPodCompletion(ctx context.Context, tf *tfv1alpha2.Terraform, stage tfv1alpha2.Stage, pod *corev1.Pod) {
+	if len(tf.Spec.Notifications) == 0 {
+		return
+	}
+	switch stage.PodType {
+	case tfv1alpha2.PodPlan, tfv1alpha2.PodPlanDelete:
+		if stage.State != tfv1alpha2.StateComplete {
+			return
+		}
+		if stage.Generation == tf.Status.LastCompletedGeneration && stage.PodType == tfv1alpha2.PodPlan {
+			r.notify(ctx, tf, stage, pod, tfv1alpha2.NotifyPlanReady, tfv1alpha2.NotifyDriftDetected)
+			return
+		}
+		r.notify(ctx, tf, stage, pod, tfv1alpha2.NotifyPlanReady)
+	case tfv1alpha2.PodApply, tfv1alpha2.PodApplyDelete:
+		if stage.State == tfv1alpha2.StateComplete {
+			r.notify(ctx, tf, stage, pod, tfv1alpha2.NotifyApplySucceeded)
+		} else if stage.State == tfv1alpha2.StateFailed {
+			r.notify(ctx, tf, stage, pod, tfv1alpha2.NotifyApplyFailed)
+		}
+	}
+}
+
+func notificationWantsEvent(n tfv1alpha2.Notification, event tfv1alpha2.NotificationEvent) bool {
+	if len(n.Events) == 0 {
+		return true
+	}
+	for _, e := range n.Events {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+// podLogs returns the last lines of the main container's log
+func (r *ReconcileTerraform) podLogs(ctx context.Context, pod *corev1.Pod) (string, error) {
+	if r.Clientset == nil {
+		return "", fmt.Errorf("no clientset configured to read logs")
+	}
+	if len(pod.Spec.Containers) == 0 {
+		return "", nil
+	}
+	tailLines := int64(notificationLogLines)
+	req := r.Clientset.CoreV1().Pods(pod.Namespace).GetLogs(pod.Name, &corev1.PodLogOptions{
+		Container: pod.Spec.Containers[0].Name,
+		TailLines: &tailLines,
+	})
+	b, err := req.DoRaw(ctx)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+// ansiEscape matches the color codes terraform adds to its output
+var ansiEscape = regexp.MustCompile(`\x1b\[[0-9;]*m`)
+
+// planSummary finds the terraform plan summary line, eg "Plan: 1 to add, 0 to
+// change, 0 to destroy." or "No changes.", in the log
+func planSummary(logs string) string {
+	scanner := bufio.NewScanner(strings.NewReader(logs))
+	for scanner.Scan() {
+		line := strings.TrimSpace(ansiEscape.ReplaceAllString(scanner.Text(), ""))
+		if strings.HasPrefix(line, "Plan: ") || strings.HasPrefix(line, "No changes.") {
+			return line
+		}
+	}
+	return ""
+}
+
+// planHasChanges returns true when the plan summary adds, changes or
+// destroys anything
+func planHasChanges(summary string) bool {
+	return strings.HasPrefix(summary, "Plan: ") && summary != "Plan: 0 to add, 0 to change, 0 to destroy."
+}
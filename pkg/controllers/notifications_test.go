@@ -0,0 +1,72 @@
+package controllers
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Plan notifications", func() {
+
+	It("Should find the plan summary in the pod log", func() {
+		for _, tt := range []struct {
+			name    string
+			logs    string
+			summary string
+			changes bool
+		}{
+			{
+				name: "no changes",
+				logs: "\x1b[0m\x1b[1mnull_resource.this: Refreshing state... [id=6120523187352063937]\x1b[0m\n" +
+					"\n" +
+					"\x1b[0m\x1b[1m\x1b[32mNo changes.\x1b[0m\x1b[1m Your infrastructure matches the configuration.\x1b[0m\n" +
+					"\n" +
+					"\x1b[0mTerraform has compared your real infrastructure against your configuration\n" +
+					"and found no differences, so no changes are needed.\x1b[0m\n",
+				summary: "No changes. Your infrastructure matches the configuration.",
+				changes: false,
+			},
+			{
+				name: "no changes before terraform 0.15",
+				logs: "null_resource.this: Refreshing state... [id=6120523187352063937]\n" +
+					"\n" +
+					"------------------------------------------------------------------------\n" +
+					"\n" +
+					"No changes. Infrastructure is up-to-date.\n",
+				summary: "No changes. Infrastructure is up-to-date.",
+				changes: false,
+			},
+			{
+				name: "changes",
+				logs: "Terraform will perform the following actions:\n" +
+					"\n" +
+					"\x1b[1m  # null_resource.this\x1b[0m will be created\n" +
+					"\x1b[0m  \x1b[32m+\x1b[0m\x1b[0m resource \"null_resource\" \"this\" {\n" +
+					"      \x1b[32m+\x1b[0m\x1b[0m \x1b[1m\x1b[0mid\x1b[0m\x1b[0m = (known after apply)\n" +
+					"    }\n" +
+					"\n" +
+					"\x1b[0m\x1b[1mPlan:\x1b[0m 1 to add, 0 to change, 0 to destroy.\n" +
+					"\x1b[90m\n" +
+					"─────────────────────────────────────────────────────────────────────────────\x1b[0m\n" +
+					"\n" +
+					"Saved the plan to: tfplan\n",
+				summary: "Plan: 1 to add, 0 to change, 0 to destroy.",
+				changes: true,
+			},
+			{
+				name: "error",
+				logs: "\x1b[31m╷\x1b[0m\x1b[0m\n" +
+					"\x1b[31m│\x1b[0m \x1b[0m\x1b[1m\x1b[31mError: \x1b[0m\x1b[0m\x1b[1mReference to undeclared input variable\x1b[0m\n" +
+					"\x1b[31m│\x1b[0m \x1b[0m\n" +
+					"\x1b[31m│\x1b[0m \x1b[0m\x1b[0m  on main.tf line 2, in resource \"null_resource\" \"this\":\n" +
+					"\x1b[31m│\x1b[0m \x1b[0m   2:     name = \x1b[4mvar.name\x1b[0m\x1b[0m\n" +
+					"\x1b[31m╵\x1b[0m\x1b[0m\n",
+				summary: "",
+				changes: false,
+			},
+		} {
+			summary := planSummary(tt.logs)
+			Expect(summary).To(Equal(tt.summary), tt.name)
+			Expect(planHasChanges(summary)).To(Equal(tt.changes), tt.name)
+		}
+	})
+})
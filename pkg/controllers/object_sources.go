@@ -0,0 +1,194 @@
+package controllers
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	tfv1alpha2 "github.com/isaaguilar/terraform-operator/pkg/apis/tf/v1alpha2"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// objectSourcePollInterval is how often the ConfigMap and Secret sources are
+// checked for changes
+const objectSourcePollInterval = time.Minute
+
+// objectSource is the data read from a ConfigMap or Secret source
+type objectSource struct {
+	kind   string
+	name   string
+	secret bool
+	data   map[string]string
+}
+
+// isObjectSource returns true when the source reads a ConfigMap or a Secret
+// instead of downloading an address
+func isObjectSource(s *tfv1alpha2.SrcOpts) bool {
+	return s != nil && (s.ConfigMap != nil || s.Secret != nil)
+}
+
+// hasObjectSources returns true when one of the sources is a ConfigMap or a
+// Secret
+func hasObjectSources(tf *tfv1alpha2.Terraform) bool {
+	for _, s := range tf.Spec.Sources {
+		if isObjectSource(s) {
+			return true
+		}
+	}
+	return false
+}
+
+// selectKeys returns the keys of data, or all of them when keys is empty.
+// A key that is missing is an error.
+func selectKeys(kind, name string, data map[string]string, keys []string) (map[string]string, error) {
+	if len(keys) == 0 {
+		return data, nil
+	}
+	selected := make(map[string]string)
+	for _, key := range keys {
+		value, found := data[key]
+		if !found {
+			return nil, fmt.Errorf("%s '%s' has no key '%s'", kind, name, key)
+		}
+		selected[key] = value
+	}
+	return selected, nil
+}
+
+// readObjectSource reads the keys of the source's ConfigMap or Secret in the
+// tf resource's namespace
+func (r *ReconcileTerraform) readObjectSource(ctx context.Context, tf *tfv1alpha2.Terraform, s *tfv1alpha2.SrcOpts) (objectSource, error) {
+	if s.ConfigMap != nil {
+		configMap := &corev1.ConfigMap{}
+		err := r.Client.Get(ctx, types.NamespacedName{Name: s.ConfigMap.Name, Namespace: tf.Namespace}, configMap)
+		if err != nil {
+			return objectSource{}, fmt.Errorf("unable to get ConfigMap '%s': %v", s.ConfigMap.Name, err)
+		}
+		data, err := selectKeys("ConfigMap", s.ConfigMap.Name, configMap.Data, s.ConfigMap.Keys)
+		if err != nil {
+			return objectSource{}, err
+		}
+		return objectSource{kind: "ConfigMap", name: s.ConfigMap.Name, data: data}, nil
+	}
+
+	secret := &corev1.Secret{}
+	err := r.Client.Get(ctx, types.NamespacedName{Name: s.Secret.Name, Namespace: tf.Namespace}, secret)
+	if err != nil {
+		return objectSource{}, fmt.Errorf("unable to get Secret '%s': %v", s.Secret.Name, err)
+	}
+	secretData := make(map[string]string)
+	for k, v := range secret.Data {
+		secretData[k] = string(v)
+	}
+	data, err := selectKeys("Secret", s.Secret.Name, secretData, s.Secret.Keys)
+	if err != nil {
+		return objectSource{}, err
+	}
+	return objectSource{kind: "Secret", name: s.Secret.Name, secret: true, data: data}, nil
+}
+
+// sortedKeys returns the keys of the source's data in order so that the
+// tfvars of a source are always merged the same way
+func (o objectSource) sortedKeys() []string {
+	keys := []string{}
+	for k := range o.data {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// objectSourcesChecksum reads the ConfigMap and Secret sources and returns
+// the checksum of their data
+func (r *ReconcileTerraform) objectSourcesChecksum(ctx context.Context, tf *tfv1alpha2.Terraform) (string, error) {
+	h := sha256.New()
+	for _, s := range tf.Spec.Sources {
+		if !isObjectSource(s) {
+			continue
+		}
+		o, err := r.readObjectSource(ctx, tf, s)
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(h, "%s/%s\n", o.kind, o.name)
+		for _, k := range o.sortedKeys() {
+			fmt.Fprintf(h, "%s=%d:%s\n", k, len(o.data[k]), o.data[k])
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// checkObjectSources checks the ConfigMap and Secret sources for changes like
+// checkModuleCommit checks the terraformModule's commit. The checksum is
+// only recorded in the status when it is the first one or when a run is about
+// to start. Otherwise, a change starts a new run. Returns true when the status
+// was modified and needs to be updated.
+func (r *ReconcileTerraform) checkObjectSources(ctx context.Context, tf *tfv1alpha2.Terraform) (bool, error) {
+	if !hasObjectSources(tf) {
+		return false, nil
+	}
+
+	n := len(tf.Status.Stages)
+	currentStage := tf.Status.Stages[n-1]
+	if currentStage.Interruptible == tfv1alpha2.CanNotBeInterrupt && currentStage.State == tfv1alpha2.StateInProgress {
+		// Wait for the stage to finish. The check happens on the next
+		// reconcile.
+		return false, nil
+	}
+
+	startingRun := runIsStarting(currentStage)
+	key := "sources/" + types.NamespacedName{Name: tf.Name, Namespace: tf.Namespace}.String()
+	if r.modulePolls == nil || !r.modulePolls.due(key, objectSourcePollInterval) && tf.Status.SourcesChecksum != "" && !startingRun {
+		return false, nil
+	}
+
+	checksum, err := r.objectSourcesChecksum(ctx, tf)
+	if err != nil {
+		return false, fmt.Errorf("Error reading sources: %v", err)
+	}
+
+	if tf.Status.SourcesChecksum == checksum {
+		return false, nil
+	}
+	if tf.Status.SourcesChecksum == "" || startingRun {
+		tf.Status.SourcesChecksum = checksum
+		return true, nil
+	}
+
+	r.Recorder.Event(tf, "Normal", "SourcesChanged", "The ConfigMap or Secret sources changed")
+	tf.Status.SourcesChecksum = checksum
+	err = r.startNewRun(ctx, tf, "SOURCES_CHANGE")
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// addObjectSource adds the .tfvars keys of the source to the tfvars that are
+// merged and copies the other keys into the files. The keys of a Secret go to
+// the sources' secret files and are left out of the exported tfvars.
+func (sources *fetchedSources) addObjectSource(o objectSource) {
+	for _, k := range o.sortedKeys() {
+		v := o.data[k]
+		if strings.HasSuffix(k, ".tfvars") {
+			f := tfvarsFile{name: fmt.Sprintf("%s %s/%s", o.kind, o.name, k), content: v}
+			sources.tfvarsFiles = append(sources.tfvarsFiles, f)
+			if o.secret {
+				sources.sensitive = true
+			} else {
+				sources.exportTfvarsFiles = append(sources.exportTfvarsFiles, f)
+			}
+			continue
+		}
+		if o.secret {
+			sources.secretFiles[k] = v
+		} else {
+			sources.files[k] = v
+		}
+	}
+}
@@ -0,0 +1,49 @@
+package controllers
+
+import (
+	tfv1alpha2 "github.com/isaaguilar/terraform-operator/pkg/apis/tf/v1alpha2"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("ConfigMap and Secret sources", func() {
+
+	It("Should tell object sources from addresses", func() {
+		Expect(isObjectSource(&tfv1alpha2.SrcOpts{Address: "https://github.com/isaaguilar/terraform-operator.git"})).To(BeFalse())
+		Expect(isObjectSource(&tfv1alpha2.SrcOpts{ConfigMap: &tfv1alpha2.ConfigMapOpts{Name: "vars"}})).To(BeTrue())
+		Expect(isObjectSource(&tfv1alpha2.SrcOpts{Secret: &tfv1alpha2.SecretOpts{Name: "vars"}})).To(BeTrue())
+	})
+
+	It("Should select the keys of the source", func() {
+		data := map[string]string{"a.tfvars": "a = 1", "b.tfvars": "b = 2"}
+		selected, err := selectKeys("ConfigMap", "vars", data, nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(selected).To(HaveLen(2))
+		selected, err = selectKeys("ConfigMap", "vars", data, []string{"b.tfvars"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(selected).To(Equal(map[string]string{"b.tfvars": "b = 2"}))
+		_, err = selectKeys("ConfigMap", "vars", data, []string{"c.tfvars"})
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("Should keep the values of Secret sources out of the export", func() {
+		sources := &fetchedSources{files: make(map[string]string), secretFiles: make(map[string]string)}
+		sources.addObjectSource(objectSource{kind: "ConfigMap", name: "vars", data: map[string]string{
+			"common.tfvars": "region = \"us-east-1\"",
+			"backend.tf":    "# backend",
+		}})
+		Expect(sources.sensitive).To(BeFalse())
+		sources.addObjectSource(objectSource{kind: "Secret", name: "secret-vars", secret: true, data: map[string]string{
+			"db.tfvars": "password = \"hunter2\"",
+			"ca.pem":    "cert",
+		}})
+		Expect(sources.sensitive).To(BeTrue())
+		Expect(sources.merge()).To(Succeed())
+		Expect(sources.tfvars).To(ContainSubstring("us-east-1"))
+		Expect(sources.tfvars).To(ContainSubstring("hunter2"))
+		Expect(sources.exportTfvars).To(ContainSubstring("us-east-1"))
+		Expect(sources.exportTfvars).NotTo(ContainSubstring("hunter2"))
+		Expect(sources.files).To(Equal(map[string]string{"backend.tf": "# backend"}))
+		Expect(sources.secretFiles).To(Equal(map[string]string{"ca.pem": "cert"}))
+	})
+})
@@ -0,0 +1,192 @@
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"sigs.k8s.io/yaml"
+)
+
+// OperatorConfig are the operator-wide defaults used for tf resources that do
+// not set the field themselves. It is read from a yaml file, which is usually
+// a mounted ConfigMap.
+type OperatorConfig struct {
+	TerraformRunner           string            `json:"terraformRunner,omitempty"`
+	TerraformRunnerPullPolicy corev1.PullPolicy `json:"terraformRunnerPullPolicy,omitempty"`
+	TerraformVersion          string            `json:"terraformVersion,omitempty"`
+
+	ScriptRunner           string            `json:"scriptRunner,omitempty"`
+	ScriptRunnerPullPolicy corev1.PullPolicy `json:"scriptRunnerPullPolicy,omitempty"`
+	ScriptRunnerVersion    string            `json:"scriptRunnerVersion,omitempty"`
+
+	SetupRunner           string            `json:"setupRunner,omitempty"`
+	SetupRunnerPullPolicy corev1.PullPolicy `json:"setupRunnerPullPolicy,omitempty"`
+	SetupRunnerVersion    string            `json:"setupRunnerVersion,omitempty"`
+
+	// BackendTemplate is the backend used when a tf resource does not define
+	// a customBackend. "${TFO_NAMESPACE}" and "${TFO_RUNNER}" are replaced
+	// with the namespace and the run's name. When empty, the setup runner's
+	// built-in backend is used.
+	BackendTemplate string `json:"backendTemplate,omitempty"`
+
+	// PVCSize is the size of the volume that holds the module and the run's
+	// outputs, eg "2Gi"
+	PVCSize string `json:"pvcSize,omitempty"`
+
+	// StorageClassName is the storage class of the volume. When empty, the
+	// cluster's default storage class is used.
+	StorageClassName string `json:"storageClassName,omitempty"`
+
+	// ServiceAccountPrefix is prefixed to the name of the service account
+	// created for a tf resource that does not define a serviceAccount
+	ServiceAccountPrefix string `json:"serviceAccountPrefix,omitempty"`
+
+	// MaxRunnerPods is the number of runner pods that can run at once. Stages
+	// that would exceed a limit are queued. 0 is unlimited.
+	MaxRunnerPods int `json:"maxRunnerPods,omitempty"`
+
+	// MaxRunnerPodsPerNamespace is the number of runner pods that can run at
+	// once in a namespace. 0 is unlimited.
+	MaxRunnerPodsPerNamespace int `json:"maxRunnerPodsPerNamespace,omitempty"`
+
+	// MaxRunnerPodsPerCredential is the number of runner pods that can run
+	// at once with the same credential, eg a secretNameRef or an irsa role.
+	// 0 is unlimited.
+	MaxRunnerPodsPerCredential int `json:"maxRunnerPodsPerCredential,omitempty"`
+}
+
+// DefaultOperatorConfig returns the defaults the operator uses without a
+// config file
+func DefaultOperatorConfig() OperatorConfig {
+	return OperatorConfig{
+		TerraformRunner:           defaultTerraformRunner,
+		TerraformRunnerPullPolicy: defaultTerraformRunnerPullPolicy,
+		TerraformVersion:          defaultTerraformVersion,
+		ScriptRunner:              defaultScriptRunner,
+		ScriptRunnerPullPolicy:    defaultScriptRunnerPullPolicy,
+		ScriptRunnerVersion:       defaultScriptRunnerVersion,
+		SetupRunner:               defaultSetupRunner,
+		SetupRunnerPullPolicy:     defaultSetupRunnerPullPolicy,
+		SetupRunnerVersion:        defaultSetupRunnerVersion,
+		PVCSize:                   defaultPVCSize,
+		// By prefixing the service account with "tf-", IRSA roles can use
+		// wildcard "tf-*" service account for AWS credentials.
+		ServiceAccountPrefix: defaultServiceAccountPrefix,
+	}
+}
+
+// ParseOperatorConfig reads the yaml config. Fields that are not in the
+// config keep their default.
+func ParseOperatorConfig(data []byte) (OperatorConfig, error) {
+	config := DefaultOperatorConfig()
+	err := yaml.UnmarshalStrict(data, &config)
+	if err != nil {
+		return config, fmt.Errorf("unable to parse operator config: %v", err)
+	}
+	for _, policy := range []corev1.PullPolicy{config.TerraformRunnerPullPolicy, config.ScriptRunnerPullPolicy, config.SetupRunnerPullPolicy} {
+		if errs := validatePullPolicy(field.NewPath("pullPolicy"), policy); len(errs) > 0 {
+			return config, fmt.Errorf("unsupported pull policy '%s' in operator config", policy)
+		}
+	}
+	if config.MaxRunnerPods < 0 || config.MaxRunnerPodsPerNamespace < 0 || config.MaxRunnerPodsPerCredential < 0 {
+		return config, fmt.Errorf("runner pod limits in operator config can not be negative")
+	}
+	if _, err := resource.ParseQuantity(config.PVCSize); err != nil {
+		return config, fmt.Errorf("invalid pvcSize '%s' in operator config: %v", config.PVCSize, err)
+	}
+	return config, nil
+}
+
+// backend returns the backend template for the run
+func (c OperatorConfig) backend(namespace, name string) string {
+	return strings.NewReplacer(
+		"${TFO_NAMESPACE}", namespace,
+		"${TFO_RUNNER}", name,
+	).Replace(c.BackendTemplate)
+}
+
+// OperatorConfigStore holds the current operator config. It is safe to use
+// from multiple goroutines. A nil store returns the defaults.
+type OperatorConfigStore struct {
+	mu     sync.RWMutex
+	config OperatorConfig
+}
+
+// NewOperatorConfigStore returns a store that holds the config
+func NewOperatorConfigStore(config OperatorConfig) *OperatorConfigStore {
+	return &OperatorConfigStore{config: config}
+}
+
+// Get returns the current config
+func (s *OperatorConfigStore) Get() OperatorConfig {
+	if s == nil {
+		return DefaultOperatorConfig()
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.config
+}
+
+// Set replaces the current config
+func (s *OperatorConfigStore) Set(config OperatorConfig) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.config = config
+}
+
+// OperatorConfigWatcher reloads the config file into the store when the file
+// changes. The file is polled rather than watched with inotify because
+// kubelet updates mounted ConfigMaps by swapping symlinks. It implements the
+// controller-runtime manager.Runnable interface.
+type OperatorConfigWatcher struct {
+	Path     string
+	Interval time.Duration
+	Store    *OperatorConfigStore
+	Log      logr.Logger
+}
+
+// Start polls the file until the context is done. An invalid config is
+// logged and the previous config stays in use.
+func (w OperatorConfigWatcher) Start(ctx context.Context) error {
+	last, _ := ioutil.ReadFile(w.Path)
+	ticker := time.NewTicker(w.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+		data, err := ioutil.ReadFile(w.Path)
+		if err != nil {
+			w.Log.Error(err, "unable to read operator config")
+			continue
+		}
+		if bytes.Equal(data, last) {
+			continue
+		}
+		last = data
+		config, err := ParseOperatorConfig(data)
+		if err != nil {
+			w.Log.Error(err, "keeping the previous operator config")
+			continue
+		}
+		w.Store.Set(config)
+		w.Log.Info(fmt.Sprintf("Reloaded operator config from %s", w.Path))
+	}
+}
+
+// NeedLeaderElection returns false so that every replica, including the ones
+// serving webhooks, uses the latest config
+func (w OperatorConfigWatcher) NeedLeaderElection() bool {
+	return false
+}
@@ -0,0 +1,61 @@
+package controllers
+
+import (
+	tfv1alpha2 "github.com/isaaguilar/terraform-operator/pkg/apis/tf/v1alpha2"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+var _ = Describe("Operator config", func() {
+
+	It("Should use the defaults for an empty config", func() {
+		config, err := ParseOperatorConfig([]byte("# terraformVersion: 1.0.2\n"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(config).To(Equal(DefaultOperatorConfig()))
+	})
+
+	It("Should reject invalid configs", func() {
+		_, err := ParseOperatorConfig([]byte("terraformRunnerPullPolicy: Sometimes\n"))
+		Expect(err).To(HaveOccurred())
+		_, err = ParseOperatorConfig([]byte("pvcSize: lots\n"))
+		Expect(err).To(HaveOccurred())
+		_, err = ParseOperatorConfig([]byte("unknownField: true\n"))
+		Expect(err).To(HaveOccurred())
+		_, err = ParseOperatorConfig([]byte("maxRunnerPods: -1\n"))
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("Should set the run options", func() {
+		config, err := ParseOperatorConfig([]byte(`
+setupRunner: registry.internal/setup-runner
+pvcSize: 5Gi
+storageClassName: fast
+serviceAccountPrefix: tfo-
+backendTemplate: |-
+  terraform {
+    backend "kubernetes" {
+      secret_suffix = "${TFO_RUNNER}"
+      namespace     = "${TFO_NAMESPACE}"
+    }
+  }
+`))
+		Expect(err).NotTo(HaveOccurred())
+
+		tf := &tfv1alpha2.Terraform{}
+		tf.Namespace = "team-a"
+		tf.Status.PodNamePrefix = "vpc-abc123"
+		runOpts := newRunOptions(tf, config)
+		Expect(runOpts.setupRunner).To(Equal("registry.internal/setup-runner"))
+		Expect(runOpts.terraformRunner).To(Equal(defaultTerraformRunner))
+		Expect(runOpts.serviceAccount).To(Equal("tfo-vpc-abc123"))
+
+		pvc := runOpts.generatePVC()
+		Expect(*pvc.Spec.StorageClassName).To(Equal("fast"))
+		Expect(pvc.Spec.Resources.Requests.Storage().Equal(resource.MustParse("5Gi"))).To(BeTrue())
+
+		backend := config.backend(tf.Namespace, runOpts.name)
+		Expect(backend).To(ContainSubstring(`secret_suffix = "vpc-abc123"`))
+		Expect(backend).To(ContainSubstring(`namespace     = "team-a"`))
+	})
+})
@@ -0,0 +1,277 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	tfv1alpha2 "github.com/isaaguilar/terraform-operator/pkg/apis/tf/v1alpha2"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+)
+
+// runQueuePollInterval is how often a queued stage checks whether it can
+// start
+const runQueuePollInterval = 10 * time.Second
+
+// runReservationTTL is how long an admitted stage counts as running before
+// the cache shows its stage in progress
+const runReservationTTL = time.Minute
+
+// runQueue admits the stages of tf resources within the operator's
+// concurrency limits. The stages that run are read from the status of the tf
+// resources. Admitted stages are reserved until their status catches up so
+// that concurrent reconciles do not exceed the limits.
+type runQueue struct {
+	mu       sync.Mutex
+	reserved map[string]runSlot
+}
+
+// runSlot is a stage that runs or waits to run
+type runSlot struct {
+	key         string
+	namespace   string
+	credentials []string
+	priority    int32
+	continuing  bool
+	queuedAt    time.Time
+	tf          *tfv1alpha2.Terraform
+}
+
+// runLimits are the concurrency limits of the operator config. 0 is
+// unlimited.
+type runLimits struct {
+	total         int
+	perNamespace  int
+	perCredential int
+}
+
+func (l runLimits) unlimited() bool {
+	return l.total <= 0 && l.perNamespace <= 0 && l.perCredential <= 0
+}
+
+// runCounts are the running stages overall, per namespace and per credential
+type runCounts struct {
+	total       int
+	namespaces  map[string]int
+	credentials map[string]int
+}
+
+func newRunCounts() runCounts {
+	return runCounts{namespaces: make(map[string]int), credentials: make(map[string]int)}
+}
+
+func (c runCounts) add(slot runSlot) runCounts {
+	c.total++
+	c.namespaces[slot.namespace]++
+	for _, cred := range slot.credentials {
+		c.credentials[cred]++
+	}
+	return c
+}
+
+// fits returns true when the slot can run without exceeding the limits
+func (c runCounts) fits(limits runLimits, slot runSlot) bool {
+	if limits.total > 0 && c.total >= limits.total {
+		return false
+	}
+	if limits.perNamespace > 0 && c.namespaces[slot.namespace] >= limits.perNamespace {
+		return false
+	}
+	if limits.perCredential > 0 {
+		for _, cred := range slot.credentials {
+			if c.credentials[cred] >= limits.perCredential {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// newRunSlot returns the slot of the tf resource's current stage
+func newRunSlot(tf *tfv1alpha2.Terraform) runSlot {
+	stage := tf.Status.Stages[len(tf.Status.Stages)-1]
+	return runSlot{
+		key:         types.NamespacedName{Name: tf.Name, Namespace: tf.Namespace}.String(),
+		namespace:   tf.Namespace,
+		credentials: credentialKeys(tf),
+		priority:    tf.Spec.Priority,
+		// The stages after the first one continue a run that has already
+		// started and go before new runs
+		continuing: stage.PodType != tfv1alpha2.PodInit && stage.PodType != tfv1alpha2.PodInitDelete,
+		queuedAt:   stage.StartTime.Time,
+		tf:         tf,
+	}
+}
+
+// runCredentials returns the credentials the runner pods get, including the
+// ones merged from the namespace's TerraformDefaults
+func runCredentials(tf *tfv1alpha2.Terraform) []tfv1alpha2.Credentials {
+	if tf.Status.MergedDefaults != nil {
+		return tf.Status.MergedDefaults.Spec.Credentials
+	}
+	return tf.Spec.Credentials
+}
+
+// credentialKeys identifies the cloud credentials of the tf resource. The
+// credentials merged from the namespace's TerraformDefaults are included.
+func credentialKeys(tf *tfv1alpha2.Terraform) []string {
+	keys := []string{}
+	for _, c := range runCredentials(tf) {
+		if c.SecretNameRef.Name != "" {
+			namespace := c.SecretNameRef.Namespace
+			if namespace == "" {
+				namespace = tf.Namespace
+			}
+			keys = append(keys, fmt.Sprintf("secret:%s/%s", namespace, c.SecretNameRef.Name))
+		}
+		if c.AWSCredentials.IRSA != "" {
+			keys = append(keys, "irsa:"+c.AWSCredentials.IRSA)
+		}
+		if c.AWSCredentials.KIAM != "" {
+			keys = append(keys, "kiam:"+c.AWSCredentials.KIAM)
+		}
+		for k, v := range c.ServiceAccountAnnotations {
+			keys = append(keys, fmt.Sprintf("serviceAccountAnnotation:%s=%s", k, v))
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// sortRunSlots orders the slots by priority, then continuing runs before new
+// runs and then by the time the stage was added
+func sortRunSlots(slots []runSlot) {
+	sort.SliceStable(slots, func(i, j int) bool {
+		a, b := slots[i], slots[j]
+		if a.priority != b.priority {
+			return a.priority > b.priority
+		}
+		if a.continuing != b.continuing {
+			return a.continuing
+		}
+		if !a.queuedAt.Equal(b.queuedAt) {
+			return a.queuedAt.Before(b.queuedAt)
+		}
+		return a.key < b.key
+	})
+}
+
+// admit decides whether the stage of self can start. Stages that wait are
+// admitted in order, skipping the ones a namespace or credential limit holds
+// back. Returns the position of self in the queue when it has to wait and the
+// slots ahead of it that can start now.
+func (q *runQueue) admit(limits runLimits, running, waiting []runSlot, self runSlot, now time.Time) (bool, int, []runSlot) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	counts := newRunCounts()
+	runningKeys := make(map[string]bool)
+	for _, slot := range running {
+		runningKeys[slot.key] = true
+		counts = counts.add(slot)
+	}
+	for key, slot := range q.reserved {
+		if runningKeys[key] || now.Sub(slot.queuedAt) > runReservationTTL {
+			delete(q.reserved, key)
+			continue
+		}
+		if key != self.key {
+			counts = counts.add(slot)
+		}
+	}
+
+	queue := []runSlot{self}
+	for _, slot := range waiting {
+		if slot.key != self.key && !runningKeys[slot.key] && q.reserved[slot.key].key == "" {
+			queue = append(queue, slot)
+		}
+	}
+	sortRunSlots(queue)
+
+	ready := []runSlot{}
+	for i, slot := range queue {
+		if !counts.fits(limits, slot) {
+			if slot.key == self.key {
+				return false, i + 1, ready
+			}
+			continue
+		}
+		if slot.key == self.key {
+			reservation := self
+			reservation.queuedAt = now
+			reservation.tf = nil
+			q.reserved[self.key] = reservation
+			return true, 0, ready
+		}
+		// The slot goes first and is expected to start on its next reconcile
+		counts = counts.add(slot)
+		ready = append(ready, slot)
+	}
+	return false, len(queue), ready
+}
+
+// release removes the reservation of a stage that failed to start
+func (q *runQueue) release(key string) {
+	if q == nil {
+		return
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	delete(q.reserved, key)
+}
+
+// runLimits returns the concurrency limits of the operator config
+func (c OperatorConfig) runLimits() runLimits {
+	return runLimits{
+		total:         c.MaxRunnerPods,
+		perNamespace:  c.MaxRunnerPodsPerNamespace,
+		perCredential: c.MaxRunnerPodsPerCredential,
+	}
+}
+
+// admitRun decides whether the current stage of the tf resource can create
+// its pod. When it has to wait, the position in the queue is returned and the
+// stages ahead of it that can start are enqueued.
+func (r *ReconcileTerraform) admitRun(ctx context.Context, tf *tfv1alpha2.Terraform) (bool, int, error) {
+	limits := r.Config.Get().runLimits()
+	if limits.unlimited() || r.runQueue == nil {
+		return true, 0, nil
+	}
+
+	tfs := &tfv1alpha2.TerraformList{}
+	err := r.Client.List(ctx, tfs)
+	if err != nil {
+		return false, 0, fmt.Errorf("unable to list terraform resources: %v", err)
+	}
+	self := newRunSlot(tf)
+	running := []runSlot{}
+	waiting := []runSlot{}
+	for i := range tfs.Items {
+		item := &tfs.Items[i]
+		if len(item.Status.Stages) == 0 || !matchesSelector(r.Selector, item) {
+			continue
+		}
+		slot := newRunSlot(item)
+		if slot.key == self.key {
+			continue
+		}
+		switch item.Status.Stages[len(item.Status.Stages)-1].State {
+		case tfv1alpha2.StateInProgress:
+			running = append(running, slot)
+		case tfv1alpha2.StateQueued:
+			waiting = append(waiting, slot)
+		}
+	}
+
+	admitted, position, ready := r.runQueue.admit(limits, running, waiting, self, time.Now())
+	for _, slot := range ready {
+		select {
+		case r.events <- event.GenericEvent{Object: slot.tf}:
+		default:
+		}
+	}
+	return admitted, position, nil
+}
@@ -0,0 +1,84 @@
+package controllers
+
+import (
+	"time"
+
+	tfv1alpha2 "github.com/isaaguilar/terraform-operator/pkg/apis/tf/v1alpha2"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+var _ = Describe("Run queue", func() {
+
+	now := time.Now()
+	slot := func(namespace, name string, podType tfv1alpha2.PodType, priority int32, age time.Duration, credentials ...tfv1alpha2.Credentials) runSlot {
+		tf := &tfv1alpha2.Terraform{}
+		tf.Name = name
+		tf.Namespace = namespace
+		tf.Spec.Priority = priority
+		tf.Spec.Credentials = credentials
+		tf.Status.Stages = []tfv1alpha2.Stage{{PodType: podType, StartTime: metav1.NewTime(now.Add(-age))}}
+		return newRunSlot(tf)
+	}
+	secret := func(name string) tfv1alpha2.Credentials {
+		return tfv1alpha2.Credentials{SecretNameRef: tfv1alpha2.SecretNameRef{Name: name}}
+	}
+
+	It("Should admit stages within the limits", func() {
+		q := &runQueue{reserved: make(map[string]runSlot)}
+		limits := runLimits{total: 2}
+		running := []runSlot{slot("a", "running", tfv1alpha2.PodPlan, 0, time.Minute)}
+
+		admitted, _, _ := q.admit(limits, running, nil, slot("a", "first", tfv1alpha2.PodInit, 0, time.Minute), now)
+		Expect(admitted).To(BeTrue())
+
+		// The reservation of "first" counts until its status shows it running
+		admitted, position, _ := q.admit(limits, running, nil, slot("a", "second", tfv1alpha2.PodInit, 0, time.Minute), now)
+		Expect(admitted).To(BeFalse())
+		Expect(position).To(Equal(1))
+
+		q.release("a/first")
+		admitted, _, _ = q.admit(limits, running, nil, slot("a", "second", tfv1alpha2.PodInit, 0, time.Minute), now)
+		Expect(admitted).To(BeTrue())
+	})
+
+	It("Should order the queue by priority, started runs and age", func() {
+		q := &runQueue{reserved: make(map[string]runSlot)}
+		limits := runLimits{total: 1}
+		running := []runSlot{slot("a", "running", tfv1alpha2.PodPlan, 0, time.Minute)}
+		waiting := []runSlot{
+			slot("a", "old", tfv1alpha2.PodInit, 0, time.Hour),
+			slot("a", "urgent", tfv1alpha2.PodInit, 10, time.Second),
+			slot("a", "continuing", tfv1alpha2.PodApply, 0, time.Second),
+		}
+
+		_, position, _ := q.admit(limits, running, waiting, slot("a", "new", tfv1alpha2.PodInit, 0, time.Second), now)
+		Expect(position).To(Equal(4))
+
+		// The slot frees up and the highest priority goes first
+		admitted, position, ready := q.admit(limits, nil, waiting, slot("a", "new", tfv1alpha2.PodInit, 0, time.Second), now)
+		Expect(admitted).To(BeFalse())
+		Expect(position).To(Equal(4))
+		Expect(ready).To(HaveLen(1))
+		Expect(ready[0].key).To(Equal("a/urgent"))
+	})
+
+	It("Should skip stages held back by a namespace or credential limit", func() {
+		q := &runQueue{reserved: make(map[string]runSlot)}
+		limits := runLimits{perNamespace: 1, perCredential: 1}
+		running := []runSlot{
+			slot("a", "running", tfv1alpha2.PodPlan, 0, time.Minute),
+			slot("b", "running", tfv1alpha2.PodPlan, 0, time.Minute, secret("aws")),
+		}
+		waiting := []runSlot{slot("a", "blocked", tfv1alpha2.PodInit, 0, time.Hour)}
+
+		admitted, _, _ := q.admit(limits, running, waiting, slot("c", "other", tfv1alpha2.PodInit, 0, time.Second), now)
+		Expect(admitted).To(BeTrue())
+
+		admitted, _, _ = q.admit(limits, running, waiting, slot("d", "same-credential", tfv1alpha2.PodInit, 0, time.Second, tfv1alpha2.Credentials{
+			SecretNameRef: tfv1alpha2.SecretNameRef{Name: "aws", Namespace: "b"},
+		}), now)
+		Expect(admitted).To(BeFalse())
+	})
+})
@@ -0,0 +1,24 @@
+package controllers
+
+import (
+	"k8s.io/apimachinery/pkg/labels"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+)
+
+// matchesSelector returns true when the object's labels match the selector.
+// A nil selector matches everything.
+func matchesSelector(selector labels.Selector, obj client.Object) bool {
+	if selector == nil {
+		return true
+	}
+	return selector.Matches(labels.Set(obj.GetLabels()))
+}
+
+// selectorPredicate filters the events of objects whose labels do not match
+// the selector
+func selectorPredicate(selector labels.Selector) predicate.Predicate {
+	return predicate.NewPredicateFuncs(func(obj client.Object) bool {
+		return matchesSelector(selector, obj)
+	})
+}
@@ -0,0 +1,25 @@
+package controllers
+
+import (
+	tfv1alpha2 "github.com/isaaguilar/terraform-operator/pkg/apis/tf/v1alpha2"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+var _ = Describe("Selector", func() {
+
+	It("Should match the labels of the resource", func() {
+		tf := &tfv1alpha2.Terraform{}
+		tf.Labels = map[string]string{"team": "a"}
+		Expect(matchesSelector(nil, tf)).To(BeTrue())
+
+		selector, err := labels.Parse("team=a")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(matchesSelector(selector, tf)).To(BeTrue())
+
+		selector, err = labels.Parse("team in (b, c)")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(matchesSelector(selector, tf)).To(BeFalse())
+	})
+})
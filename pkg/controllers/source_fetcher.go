@@ -0,0 +1,375 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	tfv1alpha2 "github.com/isaaguilar/terraform-operator/pkg/apis/tf/v1alpha2"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+)
+
+// errSourcesFetching is returned while the sources of a tf resource are
+// downloaded in the background
+var errSourcesFetching = errors.New("sources are being fetched")
+
+// sourceFetchTTL is how long the fetched sources of a stage are kept after
+// they were last asked for
+const sourceFetchTTL = 10 * time.Minute
+
+// sourceFetchPollInterval is how often a stage that waits for its sources is
+// reconciled in case the completion event was missed
+const sourceFetchPollInterval = 30 * time.Second
+
+// maxCachedSources is the number of downloaded sources kept by commit
+const maxCachedSources = 200
+
+// sourceFetchQueueSize is the number of fetches that wait for a worker. A
+// stage whose fetch does not fit is retried after sourceFetchPollInterval.
+const sourceFetchQueueSize = 100
+
+// fetchedSources are the tfvars and the other files of a tf resource's
+// sources that go into the run's configmap
+type fetchedSources struct {
+	tfvars string
+	files  map[string]string
+
+	// secretFiles are the files of Secret sources. They go into the run's
+	// sources secret instead of the configmap.
+	secretFiles map[string]string
+	// sensitive is true when the tfvars have values of Secret sources
+	sensitive bool
+	// exportTfvars are the tfvars without the values of Secret sources
+	exportTfvars string
+
+	// tfvarsFiles and exportTfvarsFiles are the tfvars of each source. They
+	// are merged into tfvars and exportTfvars.
+	tfvarsFiles       []tfvarsFile
+	exportTfvarsFiles []tfvarsFile
+}
+
+// merge merges the tfvars of the sources. The value of a variable set by
+// more than one source is the value of the last one.
+func (sources *fetchedSources) merge() error {
+	var err error
+	sources.tfvars, err = mergeTfvars(sources.tfvarsFiles...)
+	if err != nil {
+		return err
+	}
+	sources.exportTfvars, err = mergeTfvars(sources.exportTfvarsFiles...)
+	return err
+}
+
+// sourceFetch is a download of the sources of a stage
+type sourceFetch struct {
+	done     bool
+	sources  *fetchedSources
+	err      error
+	lastUsed time.Time
+}
+
+// sourceFetcher downloads the sources of tf resources with a pool of workers
+// so that a slow git server does not block the reconciles of other
+// resources. When a download finishes, the tf resource is enqueued. The
+// downloaded files are cached by the commit of the source.
+type sourceFetcher struct {
+	mu      sync.Mutex
+	fetches map[string]*sourceFetch
+	jobs    chan *tfv1alpha2.Terraform
+	workers int
+
+	cacheMu sync.Mutex
+	cache   map[string]sourceCacheEntry
+}
+
+// sourceCacheEntry is a source downloaded at a commit
+type sourceCacheEntry struct {
+	tfvars   string
+	files    map[string]string
+	lastUsed time.Time
+}
+
+func newSourceFetcher(workers int) *sourceFetcher {
+	if workers <= 0 {
+		workers = 1
+	}
+	return &sourceFetcher{
+		fetches: make(map[string]*sourceFetch),
+		jobs:    make(chan *tfv1alpha2.Terraform, sourceFetchQueueSize),
+		workers: workers,
+		cache:   make(map[string]sourceCacheEntry),
+	}
+}
+
+// sourceFetchKey identifies the stage the sources are fetched for. A new run
+// of the same generation adds a stage and fetches the sources again.
+func sourceFetchKey(tf *tfv1alpha2.Terraform) string {
+	return fmt.Sprintf("%s/%d/%d", types.NamespacedName{Name: tf.Name, Namespace: tf.Namespace}.String(), tf.Generation, len(tf.Status.Stages))
+}
+
+// needsSources returns true when the current stage writes the sources to the
+// run's configmap
+func needsSources(tf *tfv1alpha2.Terraform) bool {
+	return len(tf.Spec.Sources) > 0 && runDataChanged(tf)
+}
+
+// get returns the sources of the stage when they were fetched. Otherwise,
+// the fetch is queued and errSourcesFetching is returned. When the queue is
+// full, nothing is queued and the next call tries again. A failed fetch
+// returns its error once and is retried on the next call.
+func (f *sourceFetcher) get(tf *tfv1alpha2.Terraform) (*fetchedSources, error) {
+	key := sourceFetchKey(tf)
+	now := time.Now()
+
+	f.mu.Lock()
+	for k, fetch := range f.fetches {
+		if fetch.done && now.Sub(fetch.lastUsed) > sourceFetchTTL {
+			delete(f.fetches, k)
+		}
+	}
+	fetch, found := f.fetches[key]
+	if found {
+		fetch.lastUsed = now
+		if !fetch.done {
+			f.mu.Unlock()
+			return nil, errSourcesFetching
+		}
+		if fetch.err != nil {
+			delete(f.fetches, key)
+		}
+		f.mu.Unlock()
+		return fetch.sources, fetch.err
+	}
+	select {
+	case f.jobs <- tf.DeepCopy():
+		f.fetches[key] = &sourceFetch{lastUsed: now}
+	default:
+	}
+	f.mu.Unlock()
+	return nil, errSourcesFetching
+}
+
+// finish records the result of the fetch
+func (f *sourceFetcher) finish(key string, sources *fetchedSources, err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.fetches[key] = &sourceFetch{
+		done:     true,
+		sources:  sources,
+		err:      err,
+		lastUsed: time.Now(),
+	}
+}
+
+// cached returns the source downloaded at the commit
+func (f *sourceFetcher) cached(key string) (sourceCacheEntry, bool) {
+	f.cacheMu.Lock()
+	defer f.cacheMu.Unlock()
+	entry, found := f.cache[key]
+	if found {
+		entry.lastUsed = time.Now()
+		f.cache[key] = entry
+	}
+	return entry, found
+}
+
+// store caches the source downloaded at the commit. The least recently used
+// entry is dropped when the cache is full.
+func (f *sourceFetcher) store(key, tfvars string, files map[string]string) {
+	f.cacheMu.Lock()
+	defer f.cacheMu.Unlock()
+	if _, found := f.cache[key]; !found && len(f.cache) >= maxCachedSources {
+		oldest := ""
+		for k, entry := range f.cache {
+			if oldest == "" || entry.lastUsed.Before(f.cache[oldest].lastUsed) {
+				oldest = k
+			}
+		}
+		delete(f.cache, oldest)
+	}
+	f.cache[key] = sourceCacheEntry{tfvars: tfvars, files: files, lastUsed: time.Now()}
+}
+
+// startSourceFetchers runs the workers until the context is done
+func (r *ReconcileTerraform) startSourceFetchers(ctx context.Context) error {
+	var wg sync.WaitGroup
+	for i := 0; i < r.sources.workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case tf := <-r.sources.jobs:
+					sources, err := r.downloadSources(ctx, tf)
+					r.sources.finish(sourceFetchKey(tf), sources, err)
+					select {
+					case r.events <- event.GenericEvent{Object: tf}:
+					case <-ctx.Done():
+						return
+					}
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	return nil
+}
+
+// fetchSources returns the sources of the current stage. When they are not
+// downloaded yet, the download runs in the background and
+// errSourcesFetching is returned. Without a fetcher, the sources are
+// downloaded right away.
+func (r *ReconcileTerraform) fetchSources(ctx context.Context, tf *tfv1alpha2.Terraform) (*fetchedSources, error) {
+	if !needsSources(tf) {
+		return nil, nil
+	}
+	if r.sources == nil {
+		return r.downloadSources(ctx, tf)
+	}
+	return r.sources.get(tf)
+}
+
+// downloadSources downloads the sources and reads their tfvars and files.
+// Sources whose commit was downloaded before are read from the cache.
+// ConfigMap and Secret sources are read from the tf resource's namespace.
+func (r *ReconcileTerraform) downloadSources(ctx context.Context, tf *tfv1alpha2.Terraform) (*fetchedSources, error) {
+	reqLogger := r.Log.WithValues("Terraform", types.NamespacedName{Name: tf.Name, Namespace: tf.Namespace}.String(), "Function", "downloadSources")
+	sources := &fetchedSources{files: make(map[string]string), secretFiles: make(map[string]string)}
+	for _, s := range tf.Spec.Sources {
+		if isObjectSource(s) {
+			o, err := r.readObjectSource(ctx, tf, s)
+			if err != nil {
+				return nil, err
+			}
+			sources.addObjectSource(o)
+			continue
+		}
+		tfvars, files, err := r.downloadSource(ctx, reqLogger, tf, strings.TrimSpace(s.Address), s.Extras, s.SSHTunnel)
+		if err != nil {
+			return nil, err
+		}
+		sources.tfvarsFiles = append(sources.tfvarsFiles, tfvarsFile{name: s.Address, content: tfvars})
+		sources.exportTfvarsFiles = append(sources.exportTfvarsFiles, tfvarsFile{name: s.Address, content: tfvars})
+		for k, v := range files {
+			sources.files[k] = v
+		}
+	}
+	err := sources.merge()
+	if err != nil {
+		return nil, err
+	}
+	return sources, nil
+}
+
+// downloadSource downloads one source. The commit of a git address is
+// resolved first so that a source that did not change is not downloaded
+// again. Other addresses are downloaded with go-getter. A git address is
+// downloaded through the sshTunnel it names.
+func (r *ReconcileTerraform) downloadSource(ctx context.Context, reqLogger logr.Logger, tf *tfv1alpha2.Terraform, address string, extras []string, sshTunnel string) (string, map[string]string, error) {
+	d, err := newGitRepoAccessOptionsFromSpec(tf, address, extras)
+	if err != nil {
+		return "", nil, fmt.Errorf("Error in newGitRepoAccessOptionsFromSpec: %v", err)
+	}
+	d.sshTunnelName = sshTunnel
+	defer os.RemoveAll(d.Directory)
+	d.mirrors = r.GitMirrors
+	d.sparse = true
+
+	cacheKey := ""
+	if isGetterAddress(address) {
+		// Only a source with a checksum is known not to change
+		if r.sources != nil {
+			cacheKey = getterCacheKey(tf.Namespace, address, extras)
+		}
+		if cacheKey != "" {
+			if entry, found := r.sources.cached(cacheKey); found {
+				reqLogger.V(1).Info(fmt.Sprintf("Using cached source '%s'", address))
+				return entry.tfvars, entry.files, nil
+			}
+		}
+		src, err := withS3Credentials(ctx, r.Client, tf, address)
+		if err != nil {
+			return "", nil, err
+		}
+		err = d.getterDownload(ctx, src)
+		if err != nil {
+			return "", nil, fmt.Errorf("Error in download: %v", err)
+		}
+		return r.readSource(d, cacheKey)
+	}
+
+	err = d.getParsedAddress()
+	if err != nil {
+		return "", nil, fmt.Errorf("Error in parsing address: %v", err)
+	}
+
+	if r.sources != nil {
+		commit, err := d.resolveCommit(ctx, r.Client, tf.Namespace)
+		if err != nil {
+			// The download reports the error when the repo is unreachable
+			reqLogger.V(1).Info(fmt.Sprintf("Unable to resolve commit of '%s': %v", address, err))
+		} else {
+			cacheKey = gitSourceCacheKey(tf.Namespace, d, commit, extras)
+			if entry, found := r.sources.cached(cacheKey); found {
+				reqLogger.V(1).Info(fmt.Sprintf("Using cached source '%s' at %s", address, commit))
+				return entry.tfvars, entry.files, nil
+			}
+			// Download the commit that was resolved
+			d.hash = commit
+		}
+	}
+
+	err = d.startProxy(ctx, r.Client, tf.Namespace, reqLogger)
+	if err != nil {
+		return "", nil, err
+	}
+	defer d.TunnelClose(reqLogger.WithValues("Spec", "source"))
+
+	err = d.download(ctx, r.Client, tf.Namespace)
+	if err != nil {
+		return "", nil, fmt.Errorf("Error in download: %v", err)
+	}
+	return r.readSource(d, cacheKey)
+}
+
+// gitSourceCacheKey is the key of a git source in the source cache. A commit
+// hash is used without asking the remote, so a source is only shared by the
+// resources of the namespace that reach its host with the same
+// SCMAuthMethod.
+func gitSourceCacheKey(namespace string, d GitRepoAccessOptions, commit string, extras []string) string {
+	auth := ""
+	for _, m := range d.SCMAuthMethods {
+		if m.Host == d.ParsedAddress.host {
+			b, _ := json.Marshal(m)
+			auth = string(b)
+			break
+		}
+	}
+	return fmt.Sprintf("%s/%s//%s@%s#%s#%s", namespace, d.repo, strings.Join(d.subdirs, "//"), commit, strings.Join(extras, ","), auth)
+}
+
+// readSource reads the tfvars and the other files of a downloaded source and
+// caches them under cacheKey when it is set
+func (r *ReconcileTerraform) readSource(d GitRepoAccessOptions, cacheKey string) (string, map[string]string, error) {
+	tfvars, err := d.tfvarFiles()
+	if err != nil {
+		return "", nil, fmt.Errorf("Error in reading tfvarFiles of '%s': %v", d.Address, err)
+	}
+	files, err := d.otherConfigFiles()
+	if err != nil {
+		return "", nil, fmt.Errorf("Error in reading otherConfigFiles: %v", err)
+	}
+	if cacheKey != "" {
+		r.sources.store(cacheKey, tfvars, files)
+	}
+	return tfvars, files, nil
+}
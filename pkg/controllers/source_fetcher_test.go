@@ -0,0 +1,127 @@
+package controllers
+
+import (
+	"fmt"
+	"time"
+
+	tfv1alpha2 "github.com/isaaguilar/terraform-operator/pkg/apis/tf/v1alpha2"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Source fetcher", func() {
+
+	newTerraform := func() *tfv1alpha2.Terraform {
+		tf := &tfv1alpha2.Terraform{}
+		tf.Name = "vpc"
+		tf.Namespace = "default"
+		tf.Generation = 2
+		tf.Spec.Sources = []*tfv1alpha2.SrcOpts{{Address: "https://github.com/example/config.git"}}
+		tf.Status.Stages = []tfv1alpha2.Stage{{PodType: tfv1alpha2.PodInit, Reason: "GENERATION_CHANGE"}}
+		return tf
+	}
+
+	It("Should only fetch sources for stages that create the run's configmap", func() {
+		tf := newTerraform()
+		Expect(needsSources(tf)).To(BeTrue())
+		tf.Status.Stages = append(tf.Status.Stages, tfv1alpha2.Stage{PodType: tfv1alpha2.PodPlan})
+		Expect(needsSources(tf)).To(BeFalse())
+		tf.Spec.Sources = nil
+		tf.Status.Stages[0].Reason = "TF_RESOURCE_CREATED"
+		Expect(needsSources(tf)).To(BeFalse())
+	})
+
+	It("Should start a fetch and keep its result for the stage", func() {
+		f := newSourceFetcher(1)
+		tf := newTerraform()
+
+		_, err := f.get(tf)
+		Expect(err).To(Equal(errSourcesFetching))
+		var job *tfv1alpha2.Terraform
+		Eventually(f.jobs).Should(Receive(&job))
+		Expect(job.Name).To(Equal("vpc"))
+
+		// The fetch is running
+		_, err = f.get(tf)
+		Expect(err).To(Equal(errSourcesFetching))
+
+		f.finish(sourceFetchKey(tf), &fetchedSources{tfvars: "a = 1\n"}, nil)
+		sources, err := f.get(tf)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(sources.tfvars).To(Equal("a = 1\n"))
+		sources, err = f.get(tf)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(sources.tfvars).To(Equal("a = 1\n"))
+
+		// A failed fetch is retried
+		tf.Generation = 3
+		f.finish(sourceFetchKey(tf), nil, fmt.Errorf("timeout"))
+		_, err = f.get(tf)
+		Expect(err).To(MatchError("timeout"))
+		_, err = f.get(tf)
+		Expect(err).To(Equal(errSourcesFetching))
+	})
+
+	It("Should not queue more fetches than the queue holds", func() {
+		f := newSourceFetcher(1)
+		for i := 0; i < sourceFetchQueueSize; i++ {
+			tf := newTerraform()
+			tf.Name = fmt.Sprintf("vpc-%d", i)
+			_, err := f.get(tf)
+			Expect(err).To(Equal(errSourcesFetching))
+		}
+		Expect(f.jobs).To(HaveLen(sourceFetchQueueSize))
+
+		// The fetch is queued when there is room again
+		tf := newTerraform()
+		_, err := f.get(tf)
+		Expect(err).To(Equal(errSourcesFetching))
+		Expect(f.fetches).NotTo(HaveKey(sourceFetchKey(tf)))
+		<-f.jobs
+		_, err = f.get(tf)
+		Expect(err).To(Equal(errSourcesFetching))
+		Expect(f.fetches).To(HaveKey(sourceFetchKey(tf)))
+		Expect(f.jobs).To(HaveLen(sourceFetchQueueSize))
+	})
+
+	It("Should not share cached sources with other namespaces or credentials", func() {
+		f := newSourceFetcher(1)
+		commit := "0123456789abcdef0123456789abcdef01234567"
+		address := "https://github.com/org/private.git//vars?ref=" + commit
+		methods := []tfv1alpha2.SCMAuthMethod{{Host: "github.com", Git: &tfv1alpha2.GitSCM{
+			HTTPS: &tfv1alpha2.GitHTTPS{TokenSecretRef: &tfv1alpha2.TokenSecretRef{Name: "github-token"}},
+		}}}
+		source := func(methods []tfv1alpha2.SCMAuthMethod) GitRepoAccessOptions {
+			d := GitRepoAccessOptions{Address: address, SCMAuthMethods: methods}
+			Expect(d.getParsedAddress()).To(Succeed())
+			return d
+		}
+
+		f.store(gitSourceCacheKey("team-b", source(methods), commit, nil), "secret = 1\n", nil)
+		_, found := f.cached(gitSourceCacheKey("team-b", source(methods), commit, nil))
+		Expect(found).To(BeTrue())
+		// Another namespace names the commit of the private repo
+		_, found = f.cached(gitSourceCacheKey("team-a", source(nil), commit, nil))
+		Expect(found).To(BeFalse())
+		_, found = f.cached(gitSourceCacheKey("team-a", source(methods), commit, nil))
+		Expect(found).To(BeFalse())
+		// The same namespace without the credentials
+		_, found = f.cached(gitSourceCacheKey("team-b", source(nil), commit, nil))
+		Expect(found).To(BeFalse())
+	})
+
+	It("Should evict the least recently used source", func() {
+		f := newSourceFetcher(1)
+		for i := 0; i < maxCachedSources; i++ {
+			f.store(fmt.Sprintf("repo@%d", i), "", nil)
+		}
+		f.cache["repo@0"] = sourceCacheEntry{lastUsed: time.Now().Add(-time.Hour)}
+		f.store("repo@new", "b = 2\n", nil)
+		Expect(f.cache).To(HaveLen(maxCachedSources))
+		_, found := f.cached("repo@0")
+		Expect(found).To(BeFalse())
+		entry, found := f.cached("repo@new")
+		Expect(found).To(BeTrue())
+		Expect(entry.tfvars).To(Equal("b = 2\n"))
+	})
+})
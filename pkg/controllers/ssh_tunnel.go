@@ -0,0 +1,350 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/go-logr/logr"
+	tfv1alpha2 "github.com/isaaguilar/terraform-operator/pkg/apis/tf/v1alpha2"
+	"github.com/isaaguilar/terraform-operator/pkg/gitclient"
+	"golang.org/x/crypto/ssh"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// sshTunnel returns the tunnel the download goes through: the tunnel the
+// address selects, the tunnel of its host's SCMAuthMethod or the spec's
+// sshTunnel. It is nil when there is none.
+func (d GitRepoAccessOptions) sshTunnel() (*tfv1alpha2.ProxyOpts, error) {
+	name := d.sshTunnelName
+	if name == "" {
+		for _, m := range d.SCMAuthMethods {
+			if m.Host == d.ParsedAddress.host {
+				name = m.SSHTunnel
+				break
+			}
+		}
+	}
+	if name == "" {
+		return d.SSHProxy, nil
+	}
+	for i := range d.SSHTunnels {
+		if d.SSHTunnels[i].Name == name {
+			return &d.SSHTunnels[i], nil
+		}
+	}
+	return nil, fmt.Errorf("sshTunnel '%s' is not in sshTunnels", name)
+}
+
+// startProxy connects to the sshTunnel of the download. Https requests are
+// sent through the connection and ssh is forwarded from a local port. The
+// connection is closed by TunnelClose.
+func (d *GitRepoAccessOptions) startProxy(ctx context.Context, k8sclient client.Client, namespace string, reqLogger logr.Logger) error {
+	proxy, err := d.sshTunnel()
+	if err != nil || proxy == nil {
+		return err
+	}
+	if !strings.Contains(d.protocol, "http") && d.protocol != "ssh" {
+		return nil
+	}
+
+	reqLogger.V(1).Info(fmt.Sprintf("Setting up %s proxy through '%s'", d.protocol, proxy.Host))
+	chain, err := dialSSHChain(ctx, k8sclient, proxy, namespace)
+	if err != nil {
+		return fmt.Errorf("failed to start %s proxy: %v", d.protocol, err)
+	}
+
+	if d.protocol == "ssh" {
+		tunnel, err := startSSHForward(chain, withDefaultPort(d.host, d.port))
+		if err != nil {
+			chain.Close()
+			return fmt.Errorf("failed to start ssh proxy: %v", err)
+		}
+		d.tunnel = tunnel
+		uri := d.uri
+		if !strings.HasPrefix(uri, "/") {
+			uri = "/" + uri
+		}
+		d.repo = fmt.Sprintf("ssh://%s@127.0.0.1:%d%s", d.user, tunnel.port(), uri)
+		return nil
+	}
+
+	d.proxyChain = chain
+	d.httpProxy = gitclient.NewHTTPProxy(chain.Dial)
+	return nil
+}
+
+// sshHops are the ssh servers on the way to the proxy, in order, ending with
+// the proxy
+func sshHops(proxy *tfv1alpha2.ProxyOpts) []tfv1alpha2.JumpHost {
+	hops := append([]tfv1alpha2.JumpHost{}, proxy.JumpHosts...)
+	return append(hops, tfv1alpha2.JumpHost{
+		Host:            proxy.Host,
+		User:            proxy.User,
+		SSHKeySecretRef: proxy.SSHKeySecretRef,
+		KnownHosts:      proxy.KnownHosts,
+	})
+}
+
+// sshChain is the connection to a proxy through its jump hosts
+type sshChain struct {
+	clients []*ssh.Client
+}
+
+// dialSSHChain connects to each hop through the hops before it
+func dialSSHChain(ctx context.Context, k8sclient client.Client, proxy *tfv1alpha2.ProxyOpts, namespace string) (*sshChain, error) {
+	chain := &sshChain{}
+	for _, hop := range sshHops(proxy) {
+		config, err := sshHopConfig(ctx, k8sclient, hop, namespace)
+		if err != nil {
+			chain.Close()
+			return nil, err
+		}
+		sshClient, err := chain.dialHop(withDefaultPort(hop.Host, "22"), config)
+		if err != nil {
+			chain.Close()
+			return nil, fmt.Errorf("unable to connect to '%s': %v", hop.Host, err)
+		}
+		chain.clients = append(chain.clients, sshClient)
+	}
+	return chain, nil
+}
+
+// sshHopConfig authenticates with the hop's key and verifies its host key
+// against its knownHosts
+func sshHopConfig(ctx context.Context, k8sclient client.Client, hop tfv1alpha2.JumpHost, namespace string) (*ssh.ClientConfig, error) {
+	key := hop.SSHKeySecretRef.Key
+	if key == "" {
+		key = "id_rsa"
+	}
+	ns := hop.SSHKeySecretRef.Namespace
+	if ns == "" {
+		ns = namespace
+	}
+	privateKey, err := loadPassword(ctx, k8sclient, key, hop.SSHKeySecretRef.Name, ns)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get privkey of '%s': %v", hop.Host, err)
+	}
+	signer, err := ssh.ParsePrivateKey([]byte(privateKey))
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse privkey of '%s': %v", hop.Host, err)
+	}
+	hostKeyCallback, err := knownHostsCallback(ctx, k8sclient, hop.KnownHosts, namespace)
+	if err != nil {
+		return nil, fmt.Errorf("Error getting known_hosts of '%s': %v", hop.Host, err)
+	}
+	if hostKeyCallback == nil {
+		hostKeyCallback = ssh.InsecureIgnoreHostKey()
+	}
+	return &ssh.ClientConfig{
+		User:            hop.User,
+		Auth:            []ssh.AuthMethod{ssh.PublicKeys(signer)},
+		HostKeyCallback: hostKeyCallback,
+		Timeout:         30 * time.Second,
+	}, nil
+}
+
+// dialHop connects to the next hop through the last one
+func (c *sshChain) dialHop(address string, config *ssh.ClientConfig) (*ssh.Client, error) {
+	if len(c.clients) == 0 {
+		return ssh.Dial("tcp", address, config)
+	}
+	conn, err := c.Dial("tcp", address)
+	if err != nil {
+		return nil, err
+	}
+	sshConn, chans, reqs, err := ssh.NewClientConn(conn, address, config)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return ssh.NewClient(sshConn, chans, reqs), nil
+}
+
+// Dial connects to the address from the proxy
+func (c *sshChain) Dial(network, address string) (net.Conn, error) {
+	return c.clients[len(c.clients)-1].Dial(network, address)
+}
+
+// Close disconnects from the proxy and then from each jump host
+func (c *sshChain) Close() {
+	for i := len(c.clients) - 1; i >= 0; i-- {
+		c.clients[i].Close()
+	}
+}
+
+// sshForward forwards the connections to a local port through the chain to
+// the remote address, like `ssh -L`
+type sshForward struct {
+	listener net.Listener
+	chain    *sshChain
+	remote   string
+}
+
+func startSSHForward(chain *sshChain, remote string) (*sshForward, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	f := &sshForward{listener: listener, chain: chain, remote: remote}
+	go f.serve()
+	return f, nil
+}
+
+func (f *sshForward) serve() {
+	for {
+		local, err := f.listener.Accept()
+		if err != nil {
+			// The listener is closed
+			return
+		}
+		go f.forward(local)
+	}
+}
+
+func (f *sshForward) forward(local net.Conn) {
+	defer local.Close()
+	remote, err := f.chain.Dial("tcp", f.remote)
+	if err != nil {
+		return
+	}
+	defer remote.Close()
+	done := make(chan struct{}, 2)
+	go func() {
+		io.Copy(remote, local)
+		done <- struct{}{}
+	}()
+	go func() {
+		io.Copy(local, remote)
+		done <- struct{}{}
+	}()
+	<-done
+}
+
+func (f *sshForward) port() int {
+	return f.listener.Addr().(*net.TCPAddr).Port
+}
+
+// Close stops the listener and disconnects the chain
+func (f *sshForward) Close() {
+	f.listener.Close()
+	f.chain.Close()
+}
+
+// runnerSSHTunnel is a tunnel in the runner pods' ssh config
+type runnerSSHTunnel struct {
+	alias string
+	proxy *tfv1alpha2.ProxyOpts
+}
+
+// runnerSSHTunnels are the spec's sshTunnel, the "proxy" host, and its
+// sshTunnels, the "proxy-<name>" hosts
+func runnerSSHTunnels(instance *tfv1alpha2.Terraform) []runnerSSHTunnel {
+	tunnels := []runnerSSHTunnel{}
+	if instance.Spec.SSHTunnel != nil {
+		tunnels = append(tunnels, runnerSSHTunnel{alias: sshTunnelAlias(""), proxy: instance.Spec.SSHTunnel})
+	}
+	for i := range instance.Spec.SSHTunnels {
+		proxy := &instance.Spec.SSHTunnels[i]
+		tunnels = append(tunnels, runnerSSHTunnel{alias: sshTunnelAlias(proxy.Name), proxy: proxy})
+	}
+	return tunnels
+}
+
+// sshTunnelAlias is the Host of a tunnel in the runner pods' ssh config
+func sshTunnelAlias(name string) string {
+	if name == "" {
+		return "proxy"
+	}
+	return "proxy-" + name
+}
+
+// jumpHostAlias is the Host of a tunnel's i-th jump host
+func jumpHostAlias(alias string, i int) string {
+	return fmt.Sprintf("%s-jump-%d", alias, i)
+}
+
+// sshConfigHostname sets the Hostname and the Port of a "host:port" address
+func sshConfigHostname(address string) string {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return fmt.Sprintf("\tHostname %s\n", address)
+	}
+	return fmt.Sprintf("\tHostname %s\n\tPort %s\n", host, port)
+}
+
+// hostSSHTunnelAlias is the tunnel the runners reach an SCMAuthMethod's ssh
+// host through: the method's sshTunnel, the terraformModule's sshTunnel when
+// it is the module's host, or the spec's sshTunnel when the method requires
+// a proxy. It is empty when the host is reached directly.
+func hostSSHTunnelAlias(instance *tfv1alpha2.Terraform, m tfv1alpha2.SCMAuthMethod, moduleHost string) string {
+	switch {
+	case m.SSHTunnel != "":
+		return sshTunnelAlias(m.SSHTunnel)
+	case m.Host == moduleHost && instance.Spec.TerraformModule.SSHTunnel != "":
+		return sshTunnelAlias(instance.Spec.TerraformModule.SSHTunnel)
+	case m.Git.SSH.RequireProxy && instance.Spec.SSHTunnel != nil:
+		return sshTunnelAlias("")
+	}
+	return ""
+}
+
+// jobSSHConfig is the runner pods' ~/.ssh/config. Each hop of a tunnel is a
+// Host that jumps through the hop before it, so a host behind a tunnel only
+// needs a ProxyJump to the tunnel's alias.
+func jobSSHConfig(instance *tfv1alpha2.Terraform) string {
+	config := ""
+	for _, t := range runnerSSHTunnels(instance) {
+		previous := ""
+		for i, hop := range sshHops(t.proxy) {
+			alias := t.alias
+			if i < len(t.proxy.JumpHosts) {
+				alias = jumpHostAlias(t.alias, i)
+			}
+			config += fmt.Sprintf("Host %s\n"+
+				"%s"+
+				"\tUser %s\n"+
+				"%s"+
+				"\tIdentityFile ~/.ssh/%s_key\n",
+				alias,
+				sshConfigHostKeyChecking(hop.KnownHosts, alias+"_known_hosts"),
+				hop.User,
+				sshConfigHostname(hop.Host),
+				alias)
+			if previous != "" {
+				config += fmt.Sprintf("\tProxyJump %s\n", previous)
+			}
+			config += "\n"
+			previous = alias
+		}
+	}
+
+	moduleHost := ""
+	if instance.Spec.TerraformModule != nil && instance.Spec.TerraformModule.Address != "" {
+		module := GitRepoAccessOptions{Address: instance.Spec.TerraformModule.Address}
+		if module.getParsedAddress() == nil {
+			moduleHost = module.host
+		}
+	}
+	for _, m := range instance.Spec.SCMAuthMethods {
+		if m.Git.SSH == nil {
+			continue
+		}
+		config += fmt.Sprintf("Host %s\n"+
+			"%s"+
+			"\tHostname %s\n"+
+			"\tIdentityFile ~/.ssh/%s\n",
+			m.Host,
+			sshConfigHostKeyChecking(m.KnownHosts, knownHostsFilename(m.Host)),
+			m.Host,
+			m.Host)
+		if alias := hostSSHTunnelAlias(instance, m, moduleHost); alias != "" {
+			config += fmt.Sprintf("\tProxyJump %s\n", alias)
+		}
+		config += "\n"
+	}
+	return config
+}
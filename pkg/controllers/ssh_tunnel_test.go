@@ -0,0 +1,93 @@
+package controllers
+
+import (
+	tfv1alpha2 "github.com/isaaguilar/terraform-operator/pkg/apis/tf/v1alpha2"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("SSH tunnels", func() {
+
+	newTerraform := func() *tfv1alpha2.Terraform {
+		tf := &tfv1alpha2.Terraform{}
+		tf.Spec.TerraformModule = &tfv1alpha2.SrcOpts{Address: "git@modules.example.com:org/modules.git", SSHTunnel: "modules"}
+		tf.Spec.SSHTunnel = &tfv1alpha2.ProxyOpts{Host: "bastion.example.com", User: "ec2-user"}
+		tf.Spec.SSHTunnels = []tfv1alpha2.ProxyOpts{
+			{
+				Name: "modules",
+				Host: "bastion-a.internal:2222",
+				User: "tunnel",
+				JumpHosts: []tfv1alpha2.JumpHost{
+					{Host: "edge.example.com", User: "jump"},
+					{Host: "dmz.internal", User: "jump"},
+				},
+			},
+			{Name: "tfvars", Host: "bastion-b.internal", User: "tunnel"},
+		}
+		tf.Spec.SCMAuthMethods = []tfv1alpha2.SCMAuthMethod{
+			{Host: "modules.example.com", Git: &tfv1alpha2.GitSCM{SSH: &tfv1alpha2.GitSSH{}}},
+			{Host: "tfvars.example.com", SSHTunnel: "tfvars", Git: &tfv1alpha2.GitSCM{SSH: &tfv1alpha2.GitSSH{RequireProxy: true}}},
+			{Host: "github.com", Git: &tfv1alpha2.GitSCM{SSH: &tfv1alpha2.GitSSH{RequireProxy: true}}},
+			{Host: "gitlab.com", Git: &tfv1alpha2.GitSCM{SSH: &tfv1alpha2.GitSSH{}}},
+		}
+		return tf
+	}
+
+	It("Should select the tunnel of the address, then of its host", func() {
+		tf := newTerraform()
+		d := GitRepoAccessOptions{
+			SCMAuthMethods: tf.Spec.SCMAuthMethods,
+			SSHProxy:       tf.Spec.SSHTunnel,
+			SSHTunnels:     tf.Spec.SSHTunnels,
+		}
+		d.ParsedAddress.host = "tfvars.example.com"
+		proxy, err := d.sshTunnel()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(proxy.Host).To(Equal("bastion-b.internal"))
+
+		d.sshTunnelName = "modules"
+		proxy, err = d.sshTunnel()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(proxy.Host).To(Equal("bastion-a.internal:2222"))
+		Expect(sshHops(proxy)).To(HaveLen(3))
+
+		d.sshTunnelName = ""
+		d.ParsedAddress.host = "github.com"
+		proxy, err = d.sshTunnel()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(proxy.Host).To(Equal("bastion.example.com"))
+
+		d.sshTunnelName = "missing"
+		_, err = d.sshTunnel()
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("Should chain the jump hosts in the runner ssh config", func() {
+		config := jobSSHConfig(newTerraform())
+		Expect(config).To(ContainSubstring("Host proxy\n"))
+		Expect(config).To(ContainSubstring("Host proxy-modules-jump-0\n"))
+		Expect(config).To(ContainSubstring("Host proxy-modules-jump-1\n" +
+			"\tStrictHostKeyChecking no\n" +
+			"\tUserKnownHostsFile=/dev/null\n" +
+			"\tUser jump\n" +
+			"\tHostname dmz.internal\n" +
+			"\tIdentityFile ~/.ssh/proxy-modules-jump-1_key\n" +
+			"\tProxyJump proxy-modules-jump-0\n"))
+		Expect(config).To(ContainSubstring("\tHostname bastion-a.internal\n" +
+			"\tPort 2222\n" +
+			"\tIdentityFile ~/.ssh/proxy-modules_key\n" +
+			"\tProxyJump proxy-modules-jump-1\n"))
+	})
+
+	It("Should jump to the tunnel of each host in the runner ssh config", func() {
+		tf := newTerraform()
+		Expect(hostSSHTunnelAlias(tf, tf.Spec.SCMAuthMethods[0], "modules.example.com")).To(Equal("proxy-modules"))
+		Expect(hostSSHTunnelAlias(tf, tf.Spec.SCMAuthMethods[1], "modules.example.com")).To(Equal("proxy-tfvars"))
+		Expect(hostSSHTunnelAlias(tf, tf.Spec.SCMAuthMethods[2], "modules.example.com")).To(Equal("proxy"))
+		Expect(hostSSHTunnelAlias(tf, tf.Spec.SCMAuthMethods[3], "modules.example.com")).To(BeEmpty())
+
+		config := jobSSHConfig(tf)
+		Expect(config).To(ContainSubstring("IdentityFile ~/.ssh/modules.example.com\n\tProxyJump proxy-modules\n"))
+		Expect(config).To(ContainSubstring("IdentityFile ~/.ssh/gitlab.com\n\n"))
+	})
+})
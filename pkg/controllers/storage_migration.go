@@ -0,0 +1,97 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/go-logr/logr"
+	tfv1alpha2 "github.com/isaaguilar/terraform-operator/pkg/apis/tf/v1alpha2"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/util/retry"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// terraformCRDName is the name of the CustomResourceDefinition of the tf
+// resources
+const terraformCRDName = "terraforms.tf.isaaguilar.com"
+
+// StorageVersionMigrator rewrites every tf resource so that it is stored as
+// the storage version, v1alpha2. Once all resources are rewritten, the older
+// versions are removed from the CRD's status.storedVersions which allows a
+// later release to stop serving them. It implements the controller-runtime
+// manager.Runnable interface.
+type StorageVersionMigrator struct {
+	// Client writes the resources
+	Client client.Client
+	// Reader reads directly from the api server. The manager's cache is not
+	// used because it may not be synced when the migration starts.
+	Reader client.Reader
+	Log    logr.Logger
+}
+
+// Start runs the migration once. Errors are logged and the migration is tried
+// again on the next start of the operator.
+func (m StorageVersionMigrator) Start(ctx context.Context) error {
+	err := m.migrate(ctx)
+	if err != nil {
+		m.Log.Error(err, "storage version migration failed")
+		return nil
+	}
+	m.Log.Info(fmt.Sprintf("Terraform resources are stored as %s", tfv1alpha2.SchemeGroupVersion.Version))
+	return nil
+}
+
+func (m StorageVersionMigrator) migrate(ctx context.Context) error {
+	crd := &unstructured.Unstructured{}
+	crd.SetGroupVersionKind(schema.GroupVersionKind{
+		Group:   "apiextensions.k8s.io",
+		Version: "v1",
+		Kind:    "CustomResourceDefinition",
+	})
+	err := m.Reader.Get(ctx, types.NamespacedName{Name: terraformCRDName}, crd)
+	if err != nil {
+		return fmt.Errorf("unable to get crd: %v", err)
+	}
+	storedVersions, _, err := unstructured.NestedStringSlice(crd.Object, "status", "storedVersions")
+	if err != nil {
+		return fmt.Errorf("unable to read crd storedVersions: %v", err)
+	}
+	storageVersion := tfv1alpha2.SchemeGroupVersion.Version
+	if len(storedVersions) == 1 && storedVersions[0] == storageVersion {
+		return nil
+	}
+
+	tfs := &tfv1alpha2.TerraformList{}
+	err = m.Reader.List(ctx, tfs)
+	if err != nil {
+		return fmt.Errorf("unable to list terraform resources: %v", err)
+	}
+	for _, item := range tfs.Items {
+		key := types.NamespacedName{Name: item.Name, Namespace: item.Namespace}
+		err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+			tf := &tfv1alpha2.Terraform{}
+			err := m.Reader.Get(ctx, key, tf)
+			if err != nil {
+				return client.IgnoreNotFound(err)
+			}
+			// An update without changes still writes the object in the
+			// storage version
+			return client.IgnoreNotFound(m.Client.Update(ctx, tf))
+		})
+		if err != nil {
+			return fmt.Errorf("unable to rewrite '%s': %v", key, err)
+		}
+	}
+
+	err = unstructured.SetNestedStringSlice(crd.Object, []string{storageVersion}, "status", "storedVersions")
+	if err != nil {
+		return err
+	}
+	err = m.Client.Status().Update(ctx, crd)
+	if err != nil {
+		return fmt.Errorf("unable to update crd storedVersions: %v", err)
+	}
+	return nil
+}
@@ -2,34 +2,22 @@ package controllers
 
 import (
 	"archive/tar"
-	"bufio"
-	"bytes"
 	"context"
 	"fmt"
 	"io"
 	"io/ioutil"
-	"log"
-	"net/http"
 	"os"
 	"path/filepath"
-	"sort"
-	"strconv"
 	"strings"
 	"time"
 
-	"github.com/MakeNowJust/heredoc"
-	"github.com/elliotchance/sshtunnel"
 	"github.com/go-logr/logr"
 	getter "github.com/hashicorp/go-getter"
-	goSocks5 "github.com/isaaguilar/socks5-proxy"
-	tfv1alpha1 "github.com/isaaguilar/terraform-operator/pkg/apis/tf/v1alpha1"
+	tfv1alpha2 "github.com/isaaguilar/terraform-operator/pkg/apis/tf/v1alpha2"
 	"github.com/isaaguilar/terraform-operator/pkg/gitclient"
 	"github.com/isaaguilar/terraform-operator/pkg/utils"
 	giturl "github.com/whilp/git-urls"
-	"golang.org/x/crypto/ssh"
-	"golang.org/x/net/proxy"
-	gitTransportClient "gopkg.in/src-d/go-git.v4/plumbing/transport/client"
-	githttp "gopkg.in/src-d/go-git.v4/plumbing/transport/http"
+	"gopkg.in/src-d/go-git.v4/plumbing"
 	batchv1 "k8s.io/api/batch/v1"
 	corev1 "k8s.io/api/core/v1"
 	rbacv1 "k8s.io/api/rbac/v1"
@@ -38,14 +26,19 @@ import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/fields"
 
-	// "k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/event"
 	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 	"sigs.k8s.io/controller-runtime/pkg/source"
 )
@@ -53,7 +46,7 @@ import (
 // SetupWithManager sets up the controller with the Manager.
 func (r *ReconcileTerraform) SetupWithManager(mgr ctrl.Manager) error {
 	// err := ctrl.NewControllerManagedBy(mgr).
-	// 	For(&tfv1alpha1.Terraform{}).
+	// 	For(&tfv1alpha2.Terraform{}).
 	// 	Complete(r)
 	// if err != nil {
 	// 	return err
@@ -63,19 +56,36 @@ func (r *ReconcileTerraform) SetupWithManager(mgr ctrl.Manager) error {
 	// 	For(&batchv1.Job{}).
 	// 	Watches(&source.Kind{Type: &batchv1.Job{}}, &handler.EnqueueRequestForOwner{
 	// 		IsController: true,
-	// 		OwnerType:    &tfv1alpha1.Terraform{},
+	// 		OwnerType:    &tfv1alpha2.Terraform{},
 	// 	}).
 	// 	Complete(r)
 	// if err != nil {
 	// 	return err
 	// }
-	var err error
+	r.modulePolls = &pollTimes{times: make(map[string]time.Time)}
+	r.pendingRuns = newPendingRuns()
+	r.events = make(chan event.GenericEvent, 100)
+	r.runQueue = &runQueue{reserved: make(map[string]runSlot)}
+	r.sources = newSourceFetcher(r.SourceFetchWorkers)
+
+	err := mgr.Add(manager.RunnableFunc(r.startSourceFetchers))
+	if err != nil {
+		return err
+	}
+	err = mgr.Add(manager.RunnableFunc(r.resendPendingRuns))
+	if err != nil {
+		return err
+	}
+
 	err = ctrl.NewControllerManagedBy(mgr).
-		For(&tfv1alpha1.Terraform{}).
+		For(&tfv1alpha2.Terraform{}, builder.WithPredicates(selectorPredicate(r.Selector))).
 		Watches(&source.Kind{Type: &corev1.Pod{}}, &handler.EnqueueRequestForOwner{
 			IsController: true,
-			OwnerType:    &tfv1alpha1.Terraform{},
+			OwnerType:    &tfv1alpha2.Terraform{},
 		}).
+		Watches(&source.Channel{Source: r.events}, &handler.EnqueueRequestForObject{}).
+		Watches(&source.Kind{Type: &tfv1alpha2.TerraformDefaults{}}, handler.EnqueueRequestsFromMapFunc(r.terraformsInNamespace)).
+		WithOptions(controller.Options{MaxConcurrentReconciles: r.MaxConcurrentReconciles}).
 		Complete(r)
 	if err != nil {
 		return err
@@ -91,6 +101,46 @@ type ReconcileTerraform struct {
 	Scheme   *runtime.Scheme
 	Recorder record.EventRecorder
 	Log      logr.Logger
+
+	// Clientset is used for api calls the controller-runtime client does not
+	// support, like reading pod logs. It is optional.
+	Clientset kubernetes.Interface
+
+	// modulePolls keeps the last time the terraformModule commit of a tf
+	// resource was resolved
+	modulePolls *pollTimes
+
+	// pendingRuns are new runs queued by git push events. The events channel
+	// is how the tf resources get enqueued.
+	pendingRuns *pendingRuns
+	events      chan event.GenericEvent
+
+	// Config holds the operator-wide defaults. The defaults are used when it
+	// is nil.
+	Config *OperatorConfigStore
+
+	// Selector limits the tf resources the controller reconciles to the ones
+	// with matching labels. All tf resources are reconciled when it is nil.
+	Selector labels.Selector
+
+	// MaxConcurrentReconciles is the number of tf resources that are
+	// reconciled at once. Defaults to 1.
+	MaxConcurrentReconciles int
+
+	// runQueue admits the stages within the concurrency limits of the
+	// operator config
+	runQueue *runQueue
+
+	// SourceFetchWorkers is the number of sources downloaded at once.
+	// Defaults to 1.
+	SourceFetchWorkers int
+
+	// sources downloads the sources of the tf resources in the background
+	sources *sourceFetcher
+
+	// GitMirrors is the local git cache sources are downloaded through. The
+	// sources are cloned directly when it is nil.
+	GitMirrors *gitclient.MirrorCache
 }
 
 type ParsedAddress struct {
@@ -103,6 +153,11 @@ type ParsedAddress struct {
 	port      string
 	user      string
 	repo      string
+
+	// getter is the go-getter address of a module that is not a git repo
+	getter string
+	// inline is true when the files of the module are defined in the spec
+	inline bool
 }
 
 type GitRepoAccessOptions struct {
@@ -110,10 +165,27 @@ type GitRepoAccessOptions struct {
 	Address        string
 	Directory      string
 	Extras         []string
-	SCMAuthMethods []tfv1alpha1.SCMAuthMethod
-	SSHProxy       tfv1alpha1.ProxyOpts
-	tunnel         *sshtunnel.SSHTunnel
+	SCMAuthMethods []tfv1alpha2.SCMAuthMethod
+	SSHProxy       *tfv1alpha2.ProxyOpts
+	SSHTunnels     []tfv1alpha2.ProxyOpts
+	tunnel         *sshForward
 	ParsedAddress
+
+	// sshTunnelName selects the address's tunnel from SSHTunnels
+	sshTunnelName string
+
+	// httpProxy sends the https requests of the download through
+	// proxyChain, the connection to the sshTunnel
+	httpProxy  *gitclient.HTTPProxy
+	proxyChain *sshChain
+
+	// mirrors is the local git cache the repo is downloaded through. The
+	// repo is cloned directly when it is nil.
+	mirrors *gitclient.MirrorCache
+
+	// sparse checks out only the subdirs of the address instead of the whole
+	// repo. Repos that are committed to must be checked out fully.
+	sparse bool
 }
 
 type RunOptions struct {
@@ -121,11 +193,13 @@ type RunOptions struct {
 	namespace                 string
 	name                      string
 	envVars                   []corev1.EnvVar
-	credentials               []tfv1alpha1.Credentials
+	credentials               []tfv1alpha2.Credentials
 	stack                     ParsedAddress
 	serviceAccount            string
 	configMapData             map[string]string
 	secretData                map[string][]byte
+	sourcesSecretData         map[string][]byte
+	moduleConfigMapData       map[string]string
 	terraformRunner           string
 	terraformRunnerPullPolicy corev1.PullPolicy
 	terraformVersion          string
@@ -135,30 +209,52 @@ type RunOptions struct {
 	setupRunner               string
 	setupRunnerPullPolicy     corev1.PullPolicy
 	setupRunnerVersion        string
-}
+	pvcSize                   string
+	storageClassName          string
+	httpProxy                 *tfv1alpha2.HTTPProxyOpts
+	// socks5Proxies are the SOCKS5 proxies the runners start over the
+	// sshTunnels. Empty when the runners do not need one.
+	socks5Proxies []runnerSOCKS5Proxy
+}
+
+// Default runner images used when the tf resource does not define them
+const (
+	defaultTerraformRunner           = "isaaguilar/tf-runner-alphav2"
+	defaultTerraformRunnerPullPolicy = corev1.PullIfNotPresent
+	defaultTerraformVersion          = "1.0.2"
+
+	defaultScriptRunner           = "isaaguilar/script-runner-alphav1"
+	defaultScriptRunnerPullPolicy = corev1.PullIfNotPresent
+	defaultScriptRunnerVersion    = "1.0.0"
+
+	defaultSetupRunner           = "isaaguilar/setup-runner-alphav1"
+	defaultSetupRunnerPullPolicy = corev1.PullIfNotPresent
+	defaultSetupRunnerVersion    = "1.0.0"
+
+	defaultPVCSize              = "2Gi"
+	defaultServiceAccountPrefix = "tf-"
+)
 
-func newRunOptions(tf *tfv1alpha1.Terraform) RunOptions {
+func newRunOptions(tf *tfv1alpha2.Terraform, config OperatorConfig) RunOptions {
 	// TODO Read the tfstate and decide IF_NEW_RESOURCE based on that
 	// applyAction := false
 	name := tf.Status.PodNamePrefix
-	terraformRunner := "isaaguilar/tf-runner-alphav2"
-	terraformRunnerPullPolicy := corev1.PullIfNotPresent
-	terraformVersion := "1.0.2"
+	terraformRunner := config.TerraformRunner
+	terraformRunnerPullPolicy := config.TerraformRunnerPullPolicy
+	terraformVersion := config.TerraformVersion
 
-	scriptRunner := "isaaguilar/script-runner-alphav1"
-	scriptRunnerPullPolicy := corev1.PullIfNotPresent
-	scriptRunnerVersion := "1.0.0"
+	scriptRunner := config.ScriptRunner
+	scriptRunnerPullPolicy := config.ScriptRunnerPullPolicy
+	scriptRunnerVersion := config.ScriptRunnerVersion
 
-	setupRunner := "isaaguilar/setup-runner-alphav1"
-	setupRunnerPullPolicy := corev1.PullIfNotPresent
-	setupRunnerVersion := "1.0.0"
+	setupRunner := config.SetupRunner
+	setupRunnerPullPolicy := config.SetupRunnerPullPolicy
+	setupRunnerVersion := config.SetupRunnerVersion
 
 	// sshConfig := utils.TruncateResourceName(tf.Name, 242) + "-ssh-config"
 	serviceAccount := tf.Spec.ServiceAccount
 	if serviceAccount == "" {
-		// By prefixing the service account with "tf-", IRSA roles can use wildcard
-		// "tf-*" service account for AWS credentials.
-		serviceAccount = "tf-" + name
+		serviceAccount = config.ServiceAccountPrefix + name
 	}
 
 	if tf.Spec.TerraformRunner != "" {
@@ -203,12 +299,18 @@ func newRunOptions(tf *tfv1alpha1.Terraform) RunOptions {
 		serviceAccount:            serviceAccount,
 		configMapData:             make(map[string]string),
 		secretData:                make(map[string][]byte),
+		sourcesSecretData:         make(map[string][]byte),
+		moduleConfigMapData:       make(map[string]string),
 		scriptRunner:              scriptRunner,
 		scriptRunnerPullPolicy:    scriptRunnerPullPolicy,
 		scriptRunnerVersion:       scriptRunnerVersion,
 		setupRunner:               setupRunner,
 		setupRunnerPullPolicy:     setupRunnerPullPolicy,
 		setupRunnerVersion:        setupRunnerVersion,
+		pvcSize:                   config.PVCSize,
+		storageClassName:          config.StorageClassName,
+		httpProxy:                 tf.Spec.HTTPProxy,
+		socks5Proxies:             runnerSOCKS5Proxies(tf),
 	}
 }
 
@@ -236,7 +338,7 @@ func (r *ReconcileTerraform) Reconcile(ctx context.Context, request reconcile.Re
 	reqLogger.V(2).Info("Reconciling Terraform")
 
 	// Check for the resource's existance
-	tf := &tfv1alpha1.Terraform{}
+	tf := &tfv1alpha2.Terraform{}
 	err := r.Client.Get(ctx, request.NamespacedName, tf)
 	if err != nil {
 		if errors.IsNotFound(err) {
@@ -251,9 +353,15 @@ func (r *ReconcileTerraform) Reconcile(ctx context.Context, request reconcile.Re
 		reqLogger.Error(err, "Failed to get Terraform")
 		return reconcile.Result{}, err
 	}
+	if !matchesSelector(r.Selector, tf) {
+		// Pod events and git pushes enqueue tf resources of other operator
+		// instances too
+		reqLogger.V(2).Info("Terraform resource does not match the selector")
+		return reconcile.Result{}, nil
+	}
 
 	// Final delete by removing finalizers
-	if tf.Status.Phase == tfv1alpha1.PhaseDeleted {
+	if tf.Status.Phase == tfv1alpha2.PhaseDeleted {
 		reqLogger.Info("Remove finalizers")
 		_ = updateFinalizer(tf)
 		err := r.update(ctx, tf)
@@ -274,6 +382,22 @@ func (r *ReconcileTerraform) Reconcile(ctx context.Context, request reconcile.Re
 		return reconcile.Result{}, nil
 	}
 
+	// The spec is not updated after this point, so the defaults only get
+	// merged in memory
+	defaultsChanged, err := r.applyTerraformDefaults(ctx, tf)
+	if err != nil {
+		r.Recorder.Event(tf, "Warning", "TerraformDefaultsError", err.Error())
+		return reconcile.Result{}, err
+	}
+	if defaultsChanged {
+		err := r.updateStatus(ctx, tf)
+		if err != nil {
+			reqLogger.V(1).Info(err.Error())
+			return reconcile.Result{Requeue: true}, nil
+		}
+		return reconcile.Result{}, nil
+	}
+
 	// Initialize resource
 	if tf.Status.PodNamePrefix == "" {
 		// Generate a unique name for everything related to this tf resource
@@ -283,9 +407,9 @@ func (r *ReconcileTerraform) Reconcile(ctx context.Context, request reconcile.Re
 			utils.TruncateResourceName(tf.Name, 220),
 			utils.StringWithCharset(8, utils.AlphaNum),
 		)
-		tf.Status.Stages = []tfv1alpha1.Stage{}
+		tf.Status.Stages = []tfv1alpha2.Stage{}
 		tf.Status.LastCompletedGeneration = 0
-		tf.Status.Phase = tfv1alpha1.PhaseInitializing
+		tf.Status.Phase = tfv1alpha2.PhaseInitializing
 		err := r.updateStatus(ctx, tf)
 		if err != nil {
 			reqLogger.V(1).Info(err.Error())
@@ -295,9 +419,9 @@ func (r *ReconcileTerraform) Reconcile(ctx context.Context, request reconcile.Re
 
 	// Add the first stage
 	if len(tf.Status.Stages) == 0 {
-		podType := tfv1alpha1.PodInit
-		stageState := tfv1alpha1.StateInitializing
-		interruptible := tfv1alpha1.CanNotBeInterrupt
+		podType := tfv1alpha2.PodInit
+		stageState := tfv1alpha2.StateInitializing
+		interruptible := tfv1alpha2.CanNotBeInterrupt
 		addNewStage(tf, podType, "TF_RESOURCE_CREATED", interruptible, stageState)
 		err := r.updateStatus(ctx, tf)
 		if err != nil {
@@ -307,20 +431,20 @@ func (r *ReconcileTerraform) Reconcile(ctx context.Context, request reconcile.Re
 	}
 
 	deletePhases := []string{
-		string(tfv1alpha1.PhaseDeleting),
-		string(tfv1alpha1.PhaseInitDelete),
-		string(tfv1alpha1.PhaseDeleted),
+		string(tfv1alpha2.PhaseDeleting),
+		string(tfv1alpha2.PhaseInitDelete),
+		string(tfv1alpha2.PhaseDeleted),
 	}
 
 	// Check if the resource is marked to be deleted which is
 	// indicated by the deletion timestamp being set.
 	if tf.GetDeletionTimestamp() != nil && !utils.ListContainsStr(deletePhases, string(tf.Status.Phase)) {
-		tf.Status.Phase = tfv1alpha1.PhaseInitDelete
+		tf.Status.Phase = tfv1alpha2.PhaseInitDelete
 	}
 
 	// Check the status on stages that have not completed
 	for _, stage := range tf.Status.Stages {
-		if stage.State == tfv1alpha1.StateInProgress {
+		if stage.State == tfv1alpha2.StateInProgress {
 			// TODO
 		}
 	}
@@ -333,7 +457,42 @@ func (r *ReconcileTerraform) Reconcile(ctx context.Context, request reconcile.Re
 		return reconcile.Result{}, nil
 	}
 
-	var podType tfv1alpha1.PodType
+	// Start a new run when a git push was received, the terraformModule
+	// commit moves or a ConfigMap or Secret source changes
+	requeueAfter := modulePollInterval(tf)
+	if hasObjectSources(tf) && (requeueAfter <= 0 || requeueAfter > objectSourcePollInterval) {
+		requeueAfter = objectSourcePollInterval
+	}
+	if !utils.ListContainsStr(deletePhases, string(tf.Status.Phase)) {
+		changed, err := r.checkPendingRun(ctx, tf)
+		if err != nil {
+			reqLogger.Error(err, "")
+		}
+		if !changed {
+			changed, err = r.checkModuleCommit(ctx, tf)
+			if err != nil {
+				reqLogger.Error(err, "")
+				r.Recorder.Event(tf, "Warning", "PollError", err.Error())
+			}
+		}
+		if !changed {
+			changed, err = r.checkObjectSources(ctx, tf)
+			if err != nil {
+				reqLogger.Error(err, "")
+				r.Recorder.Event(tf, "Warning", "PollError", err.Error())
+			}
+		}
+		if changed {
+			err := r.updateStatus(ctx, tf)
+			if err != nil {
+				reqLogger.V(1).Info(err.Error())
+				return reconcile.Result{Requeue: true}, nil
+			}
+			return reconcile.Result{}, nil
+		}
+	}
+
+	var podType tfv1alpha2.PodType
 	var generation int64
 	n := len(tf.Status.Stages)
 	currentStage := tf.Status.Stages[n-1]
@@ -341,22 +500,23 @@ func (r *ReconcileTerraform) Reconcile(ctx context.Context, request reconcile.Re
 	generation = currentStage.Generation
 
 	if podType == "" {
-		if tf.Status.Phase == tfv1alpha1.PhaseRunning {
-			tf.Status.Phase = tfv1alpha1.PhaseCompleted
+		if tf.Status.Phase == tfv1alpha2.PhaseRunning {
+			tf.Status.Phase = tfv1alpha2.PhaseCompleted
+			tf.Status.LastCompletedGeneration = generation
 			err := r.updateStatus(ctx, tf)
 			if err != nil {
 				reqLogger.V(1).Info(err.Error())
 				return reconcile.Result{}, err
 			}
-		} else if tf.Status.Phase == tfv1alpha1.PhaseDeleting {
-			tf.Status.Phase = tfv1alpha1.PhaseDeleted
+		} else if tf.Status.Phase == tfv1alpha2.PhaseDeleting {
+			tf.Status.Phase = tfv1alpha2.PhaseDeleted
 			err := r.updateStatus(ctx, tf)
 			if err != nil {
 				reqLogger.V(1).Info(err.Error())
 				return reconcile.Result{}, err
 			}
 		}
-		return reconcile.Result{}, nil
+		return reconcile.Result{RequeueAfter: requeueAfter}, nil
 	}
 
 	// Check for the current stage pod
@@ -375,12 +535,20 @@ func (r *ReconcileTerraform) Reconcile(ctx context.Context, request reconcile.Re
 		reqLogger.Error(err, "")
 		return reconcile.Result{}, nil
 	}
+	// Pods that are being deleted belong to a previous run
+	activePods := []corev1.Pod{}
+	for _, pod := range pods.Items {
+		if pod.DeletionTimestamp == nil {
+			activePods = append(activePods, pod)
+		}
+	}
+	pods.Items = activePods
 
-	if len(pods.Items) == 0 && tf.Status.Stages[n-1].State == tfv1alpha1.StateInProgress {
+	if len(pods.Items) == 0 && tf.Status.Stages[n-1].State == tfv1alpha2.StateInProgress {
 		// This condition is generally met when the user deletes the pod.
 		// Force the state to transition away from in-progress and then
 		// requeue.
-		tf.Status.Stages[n-1].State = tfv1alpha1.StateInitializing
+		tf.Status.Stages[n-1].State = tfv1alpha2.StateInitializing
 		err = r.updateStatus(ctx, tf)
 		if err != nil {
 			reqLogger.V(1).Info(err.Error())
@@ -390,19 +558,73 @@ func (r *ReconcileTerraform) Reconcile(ctx context.Context, request reconcile.Re
 	}
 
 	if len(pods.Items) == 0 {
+		// The sources are downloaded in the background. The tf resource is
+		// enqueued when they are ready.
+		sources, err := r.fetchSources(ctx, tf)
+		if err == errSourcesFetching {
+			if tf.Status.Stages[n-1].State != tfv1alpha2.StateFetchingSources {
+				tf.Status.Stages[n-1].State = tfv1alpha2.StateFetchingSources
+				tf.Status.QueuePosition = 0
+				err := r.updateStatus(ctx, tf)
+				if err != nil {
+					reqLogger.V(1).Info(err.Error())
+				}
+			}
+			return reconcile.Result{RequeueAfter: sourceFetchPollInterval}, nil
+		}
+		if err != nil {
+			r.Recorder.Event(tf, "Warning", "DownloadError", fmt.Errorf("Error downloading sources: %v", err).Error())
+			return reconcile.Result{}, fmt.Errorf("Error downloading sources: %v", err)
+		}
+
+		// Wait for the concurrency limits before creating the pod
+		admitted, position, err := r.admitRun(ctx, tf)
+		if err != nil {
+			reqLogger.Error(err, "")
+			return reconcile.Result{}, err
+		}
+		if !admitted {
+			if tf.Status.Stages[n-1].State != tfv1alpha2.StateQueued {
+				r.Recorder.Event(tf, "Normal", "Queued", fmt.Sprintf("The '%s' pod is queued at position %d", podType, position))
+			}
+			if tf.Status.Stages[n-1].State != tfv1alpha2.StateQueued || tf.Status.QueuePosition != position {
+				tf.Status.Stages[n-1].State = tfv1alpha2.StateQueued
+				tf.Status.QueuePosition = position
+				err := r.updateStatus(ctx, tf)
+				if err != nil {
+					reqLogger.V(1).Info(err.Error())
+				}
+			}
+			return reconcile.Result{RequeueAfter: runQueuePollInterval}, nil
+		}
+		tf.Status.QueuePosition = 0
+
+		// Stages after the first one reuse the run's secret
+		err = r.refreshGitCredentials(ctx, tf)
+		if err != nil {
+			r.Recorder.Event(tf, "Warning", "GitHubAppError", err.Error())
+		}
+
 		// Trigger a new pod when no pods are found for current stage
 		reqLogger.V(1).Info(fmt.Sprintf("Setting up the '%s' pod", podType))
-		err := r.setupAndRun(ctx, tf)
+		err = r.setupAndRun(ctx, tf, sources)
 		if err != nil {
+			r.runQueue.release(types.NamespacedName{Name: tf.Name, Namespace: tf.Namespace}.String())
 			reqLogger.Error(err, "")
 			return reconcile.Result{}, err
 		}
-		if tf.Status.Phase == tfv1alpha1.PhaseInitializing {
-			tf.Status.Phase = tfv1alpha1.PhaseRunning
-		} else if tf.Status.Phase == tfv1alpha1.PhaseInitDelete {
-			tf.Status.Phase = tfv1alpha1.PhaseDeleting
+		if tf.Status.Phase == tfv1alpha2.PhaseInitializing {
+			tf.Status.Phase = tfv1alpha2.PhaseRunning
+		} else if tf.Status.Phase == tfv1alpha2.PhaseCompleted && podType == tfv1alpha2.PodInit {
+			// A new run of a resource that has already completed
+			tf.Status.Phase = tfv1alpha2.PhaseRunning
+		} else if tf.Status.Phase == tfv1alpha2.PhaseInitDelete {
+			tf.Status.Phase = tfv1alpha2.PhaseDeleting
+		}
+		tf.Status.Stages[n-1].State = tfv1alpha2.StateInProgress
+		if podType == tfv1alpha2.PodInit || podType == tfv1alpha2.PodInitDelete {
+			r.notify(ctx, tf, tf.Status.Stages[n-1], nil, tfv1alpha2.NotifyRunStarted)
 		}
-		tf.Status.Stages[n-1].State = tfv1alpha1.StateInProgress
 
 		// TODO Becuase the pod is already running, is it critical that the
 		// phase and state be updated. The updateStatus function needs to retry
@@ -435,24 +657,29 @@ func (r *ReconcileTerraform) Reconcile(ctx context.Context, request reconcile.Re
 	reqLogger.V(1).Info(msg)
 
 	if pods.Items[0].Status.Phase == corev1.PodFailed {
-		tf.Status.Stages[n-1].State = tfv1alpha1.StateFailed
+		alreadyFailed := tf.Status.Stages[n-1].State == tfv1alpha2.StateFailed
+		tf.Status.Stages[n-1].State = tfv1alpha2.StateFailed
 		tf.Status.Stages[n-1].StopTime = metav1.NewTime(time.Now())
 		err = r.updateStatus(ctx, tf)
 		if err != nil {
 			reqLogger.V(1).Info(err.Error())
 			return reconcile.Result{}, err
 		}
-		return reconcile.Result{}, nil
+		if !alreadyFailed {
+			r.notifyPodCompletion(ctx, tf, tf.Status.Stages[n-1], &pods.Items[0])
+		}
+		return reconcile.Result{RequeueAfter: requeueAfter}, nil
 	}
 
 	if pods.Items[0].Status.Phase == corev1.PodSucceeded {
-		tf.Status.Stages[n-1].State = tfv1alpha1.StateComplete
+		tf.Status.Stages[n-1].State = tfv1alpha2.StateComplete
 		tf.Status.Stages[n-1].StopTime = metav1.NewTime(time.Now())
 		err = r.updateStatus(ctx, tf)
 		if err != nil {
 			reqLogger.V(1).Info(err.Error())
 			return reconcile.Result{}, err
 		}
+		r.notifyPodCompletion(ctx, tf, tf.Status.Stages[n-1], &pods.Items[0])
 		err := r.Client.Delete(ctx, &pods.Items[0])
 		if err != nil {
 			reqLogger.V(1).Info(err.Error())
@@ -460,26 +687,35 @@ func (r *ReconcileTerraform) Reconcile(ctx context.Context, request reconcile.Re
 		return reconcile.Result{}, nil
 	}
 
+	// Keep the installation token of a running pod from expiring
+	if usesGitHubApp(tf) {
+		err = r.refreshGitCredentials(ctx, tf)
+		if err != nil {
+			r.Recorder.Event(tf, "Warning", "GitHubAppError", err.Error())
+		}
+		return reconcile.Result{RequeueAfter: githubAppRefreshInterval}, nil
+	}
+
 	// TODO should tf operator "auto" reconciliate (eg plan+apply)?
 	// TODO how should we handle manually triggering apply
 	return reconcile.Result{}, nil
 }
 
-// func stageCheck(tf *tfv1alpha1.Terraform) {
+// func stageCheck(tf *tfv1alpha2.Terraform) {
 // 	n := len(tf.Status.Stages)
-// 	if tf.Status.Stages[n-1].State == tfv1alpha1.StateComplete {
+// 	if tf.Status.Stages[n-1].State == tfv1alpha2.StateComplete {
 // 		// Get the next stage and set to initialize and return after appending
 // 		// the new stage
 // 	}
 // }
 
-func addNewStage(tf *tfv1alpha1.Terraform, podType tfv1alpha1.PodType, reason string, interruptible tfv1alpha1.Interruptible, stageState tfv1alpha1.StageState) {
+func addNewStage(tf *tfv1alpha2.Terraform, podType tfv1alpha2.PodType, reason string, interruptible tfv1alpha2.Interruptible, stageState tfv1alpha2.StageState) {
 	startTime := metav1.NewTime(time.Now())
 	stopTime := metav1.NewTime(time.Unix(0, 0))
-	if stageState == tfv1alpha1.StateComplete {
+	if stageState == tfv1alpha2.StateComplete {
 		stopTime = startTime
 	}
-	tf.Status.Stages = append(tf.Status.Stages, tfv1alpha1.Stage{
+	tf.Status.Stages = append(tf.Status.Stages, tfv1alpha2.Stage{
 		Generation:    tf.Generation,
 		Interruptible: interruptible,
 		Reason:        reason,
@@ -488,6 +724,7 @@ func addNewStage(tf *tfv1alpha1.Terraform, podType tfv1alpha1.PodType, reason st
 		StartTime:     startTime,
 		StopTime:      stopTime,
 	})
+	tf.Status.QueuePosition = 0
 }
 
 // checkSetNewStage uses the tf resource's `.status.stage` state to find the next stage of the terraform run. The following set of rules are used:
@@ -504,28 +741,28 @@ func addNewStage(tf *tfv1alpha1.Terraform, podType tfv1alpha1.PodType, reason st
 //
 // TODO Should stages be cleaned? If not, the `.status.stages` list can become very long.
 //
-func checkSetNewStage(tf *tfv1alpha1.Terraform) bool {
+func checkSetNewStage(tf *tfv1alpha2.Terraform) bool {
 	var isNewStage bool
 
 	deletePhases := []string{
-		string(tfv1alpha1.PhaseDeleted),
-		string(tfv1alpha1.PhaseInitDelete),
-		string(tfv1alpha1.PhaseDeleted),
+		string(tfv1alpha2.PhaseDeleted),
+		string(tfv1alpha2.PhaseInitDelete),
+		string(tfv1alpha2.PhaseDeleted),
 	}
 	tfIsFinalizing := utils.ListContainsStr(deletePhases, string(tf.Status.Phase))
 	tfIsNotFinalizing := !tfIsFinalizing
 
 	deletePodTypes := []string{
-		string(tfv1alpha1.PodPreInitDelete),
-		string(tfv1alpha1.PodInitDelete),
-		string(tfv1alpha1.PodPostInitDelete),
+		string(tfv1alpha2.PodPreInitDelete),
+		string(tfv1alpha2.PodInitDelete),
+		string(tfv1alpha2.PodPostInitDelete),
 	}
-	initDelete := tf.Status.Phase == tfv1alpha1.PhaseInitDelete
+	initDelete := tf.Status.Phase == tfv1alpha2.PhaseInitDelete
 
-	var podType tfv1alpha1.PodType
+	var podType tfv1alpha2.PodType
 	var reason string
-	stageState := tfv1alpha1.StateInitializing
-	interruptible := tfv1alpha1.CanBeInterrupt
+	stageState := tfv1alpha2.StateInitializing
+	interruptible := tfv1alpha2.CanBeInterrupt
 	// current stage
 	n := len(tf.Status.Stages)
 	if n == 0 {
@@ -533,8 +770,8 @@ func checkSetNewStage(tf *tfv1alpha1.Terraform) bool {
 	}
 	currentStage := tf.Status.Stages[n-1]
 	currentStagePodType := currentStage.PodType
-	currentStageCanNotBeInterrupted := currentStage.Interruptible == tfv1alpha1.CanNotBeInterrupt
-	currentStageIsRunning := currentStage.State == tfv1alpha1.StateInProgress
+	currentStageCanNotBeInterrupted := currentStage.Interruptible == tfv1alpha2.CanNotBeInterrupt
+	currentStageIsRunning := currentStage.State == tfv1alpha2.StateInProgress
 
 	// resource status
 	if currentStageCanNotBeInterrupted && currentStageIsRunning {
@@ -546,17 +783,17 @@ func checkSetNewStage(tf *tfv1alpha1.Terraform) bool {
 		// normal terraform workflow
 		isNewStage = true
 		reason = "GENERATION_CHANGE"
-		podType = tfv1alpha1.PodInit
+		podType = tfv1alpha2.PodInit
 
 	} else if initDelete && !utils.ListContainsStr(deletePodTypes, string(currentStagePodType)) {
 		// The tf resource is marked for deletion and this is the first pod
 		// in the terraform destroy workflow.
 		isNewStage = true
 		reason = "TF_RESOURCE_DELETED"
-		podType = tfv1alpha1.PodInitDelete
-		interruptible = tfv1alpha1.CanNotBeInterrupt
+		podType = tfv1alpha2.PodInitDelete
+		interruptible = tfv1alpha2.CanNotBeInterrupt
 
-	} else if currentStage.State == tfv1alpha1.StateComplete {
+	} else if currentStage.State == tfv1alpha2.StateComplete {
 		isNewStage = true
 		reason = ""
 
@@ -564,97 +801,97 @@ func checkSetNewStage(tf *tfv1alpha1.Terraform) bool {
 		//
 		// init types
 		//
-		case tfv1alpha1.PodInit:
-			if tf.Spec.PostInitScript != "" {
-				podType = tfv1alpha1.PodPostInit
+		case tfv1alpha2.PodInit:
+			if hasHooks(tf, tfv1alpha2.PodInit, tfv1alpha2.HookPost) {
+				podType = tfv1alpha2.PodPostInit
 			} else {
-				podType = tfv1alpha1.PodPlan
-				interruptible = tfv1alpha1.CanNotBeInterrupt
+				podType = tfv1alpha2.PodPlan
+				interruptible = tfv1alpha2.CanNotBeInterrupt
 			}
 
-		case tfv1alpha1.PodPostInit:
-			podType = tfv1alpha1.PodPlan
-			interruptible = tfv1alpha1.CanNotBeInterrupt
+		case tfv1alpha2.PodPostInit:
+			podType = tfv1alpha2.PodPlan
+			interruptible = tfv1alpha2.CanNotBeInterrupt
 
 		//
 		// plan types
 		//
-		case tfv1alpha1.PodPlan:
-			if tf.Spec.PostPlanScript != "" {
-				podType = tfv1alpha1.PodPostPlan
+		case tfv1alpha2.PodPlan:
+			if hasHooks(tf, tfv1alpha2.PodPlan, tfv1alpha2.HookPost) {
+				podType = tfv1alpha2.PodPostPlan
 			} else {
-				podType = tfv1alpha1.PodApply
-				interruptible = tfv1alpha1.CanNotBeInterrupt
+				podType = tfv1alpha2.PodApply
+				interruptible = tfv1alpha2.CanNotBeInterrupt
 			}
 
-		case tfv1alpha1.PodPostPlan:
-			podType = tfv1alpha1.PodApply
-			interruptible = tfv1alpha1.CanNotBeInterrupt
+		case tfv1alpha2.PodPostPlan:
+			podType = tfv1alpha2.PodApply
+			interruptible = tfv1alpha2.CanNotBeInterrupt
 
 		//
 		// apply types
 		//
-		case tfv1alpha1.PodApply:
-			if tf.Spec.PostApplyScript != "" {
-				podType = tfv1alpha1.PodPostApply
+		case tfv1alpha2.PodApply:
+			if hasHooks(tf, tfv1alpha2.PodApply, tfv1alpha2.HookPost) {
+				podType = tfv1alpha2.PodPostApply
 			} else {
 				reason = "COMPLETED_TERRAFORM"
-				podType = tfv1alpha1.PodNil
-				stageState = tfv1alpha1.StateComplete
+				podType = tfv1alpha2.PodNil
+				stageState = tfv1alpha2.StateComplete
 			}
 
-		case tfv1alpha1.PodPostApply:
+		case tfv1alpha2.PodPostApply:
 			reason = "COMPLETED_TERRAFORM"
-			podType = tfv1alpha1.PodNil
-			stageState = tfv1alpha1.StateComplete
+			podType = tfv1alpha2.PodNil
+			stageState = tfv1alpha2.StateComplete
 
 		//
 		// init (delete) types
-		case tfv1alpha1.PodInitDelete:
-			if tf.Spec.PostInitDeleteScript != "" {
-				podType = tfv1alpha1.PodPostInitDelete
+		case tfv1alpha2.PodInitDelete:
+			if hasHooks(tf, tfv1alpha2.PodInitDelete, tfv1alpha2.HookPost) {
+				podType = tfv1alpha2.PodPostInitDelete
 			} else {
-				podType = tfv1alpha1.PodPlanDelete
-				interruptible = tfv1alpha1.CanNotBeInterrupt
+				podType = tfv1alpha2.PodPlanDelete
+				interruptible = tfv1alpha2.CanNotBeInterrupt
 			}
 
-		case tfv1alpha1.PodPostInitDelete:
-			podType = tfv1alpha1.PodPlanDelete
-			interruptible = tfv1alpha1.CanNotBeInterrupt
+		case tfv1alpha2.PodPostInitDelete:
+			podType = tfv1alpha2.PodPlanDelete
+			interruptible = tfv1alpha2.CanNotBeInterrupt
 
 		//
 		// plan (delete) types
 		//
-		case tfv1alpha1.PodPlanDelete:
-			if tf.Spec.PostPlanDeleteScript != "" {
-				podType = tfv1alpha1.PodPostPlanDelete
+		case tfv1alpha2.PodPlanDelete:
+			if hasHooks(tf, tfv1alpha2.PodPlanDelete, tfv1alpha2.HookPost) {
+				podType = tfv1alpha2.PodPostPlanDelete
 			} else {
-				podType = tfv1alpha1.PodApplyDelete
-				interruptible = tfv1alpha1.CanNotBeInterrupt
+				podType = tfv1alpha2.PodApplyDelete
+				interruptible = tfv1alpha2.CanNotBeInterrupt
 			}
 
-		case tfv1alpha1.PodPostPlanDelete:
-			podType = tfv1alpha1.PodApplyDelete
-			interruptible = tfv1alpha1.CanNotBeInterrupt
+		case tfv1alpha2.PodPostPlanDelete:
+			podType = tfv1alpha2.PodApplyDelete
+			interruptible = tfv1alpha2.CanNotBeInterrupt
 
 		//
 		// apply (delete) types
 		//
-		case tfv1alpha1.PodApplyDelete:
-			if tf.Spec.PostApplyDeleteScript != "" {
-				podType = tfv1alpha1.PodPostApplyDelete
+		case tfv1alpha2.PodApplyDelete:
+			if hasHooks(tf, tfv1alpha2.PodApplyDelete, tfv1alpha2.HookPost) {
+				podType = tfv1alpha2.PodPostApplyDelete
 			} else {
 				reason = "COMPLETED_TERRAFORM"
-				podType = tfv1alpha1.PodNil
-				stageState = tfv1alpha1.StateComplete
+				podType = tfv1alpha2.PodNil
+				stageState = tfv1alpha2.StateComplete
 			}
 
-		case tfv1alpha1.PodPostApplyDelete:
+		case tfv1alpha2.PodPostApplyDelete:
 			reason = "COMPLETED_TERRAFORM"
-			podType = tfv1alpha1.PodNil
-			stageState = tfv1alpha1.StateComplete
+			podType = tfv1alpha2.PodNil
+			stageState = tfv1alpha2.StateComplete
 
-		case tfv1alpha1.PodNil:
+		case tfv1alpha2.PodNil:
 			isNewStage = false
 		}
 
@@ -670,10 +907,10 @@ func checkSetNewStage(tf *tfv1alpha1.Terraform) bool {
 // the finalizer is added.
 //
 // The finalizer will be responsible for kicking off the destroy workflow.
-func updateFinalizer(tf *tfv1alpha1.Terraform) bool {
+func updateFinalizer(tf *tfv1alpha2.Terraform) bool {
 	finalizers := tf.GetFinalizers()
 
-	if tf.Status.Phase == tfv1alpha1.PhaseDeleted {
+	if tf.Status.Phase == tfv1alpha2.PhaseDeleted {
 		if utils.ListContainsStr(finalizers, terraformFinalizer) {
 			tf.SetFinalizers(utils.ListRemoveStr(finalizers, terraformFinalizer))
 			return true
@@ -696,7 +933,7 @@ func updateFinalizer(tf *tfv1alpha1.Terraform) bool {
 	return false
 }
 
-func (r ReconcileTerraform) update(ctx context.Context, tf *tfv1alpha1.Terraform) error {
+func (r ReconcileTerraform) update(ctx context.Context, tf *tfv1alpha2.Terraform) error {
 	err := r.Client.Update(ctx, tf)
 	if err != nil {
 		return fmt.Errorf("failed to update tf resource: %s", err)
@@ -704,7 +941,7 @@ func (r ReconcileTerraform) update(ctx context.Context, tf *tfv1alpha1.Terraform
 	return nil
 }
 
-func (r ReconcileTerraform) updateStatus(ctx context.Context, tf *tfv1alpha1.Terraform) error {
+func (r ReconcileTerraform) updateStatus(ctx context.Context, tf *tfv1alpha2.Terraform) error {
 	err := r.Client.Status().Update(ctx, tf)
 	if err != nil {
 		return fmt.Errorf("failed to update tf status: %s", err)
@@ -712,9 +949,9 @@ func (r ReconcileTerraform) updateStatus(ctx context.Context, tf *tfv1alpha1.Ter
 	return nil
 }
 
-func (r ReconcileTerraform) PodStatus(ctx context.Context, tf tfv1alpha1.Terraform, stage tfv1alpha1.Stage) (tfv1alpha1.StageState, error) {
+func (r ReconcileTerraform) PodStatus(ctx context.Context, tf tfv1alpha2.Terraform, stage tfv1alpha2.Stage) (tfv1alpha2.StageState, error) {
 
-	return tfv1alpha1.StateInProgress, nil
+	return tfv1alpha2.StateInProgress, nil
 
 }
 
@@ -726,6 +963,12 @@ func IsJobFinished(job *batchv1.Job) bool {
 
 func (d GitRepoAccessOptions) TunnelClose(reqLogger logr.Logger) {
 	reqLogger.V(1).Info("Closing tunnel")
+	if d.httpProxy != nil {
+		d.httpProxy.Close()
+		d.proxyChain.Close()
+		reqLogger.V(1).Info("Closed http proxy")
+		return
+	}
 	if d.tunnel != nil {
 		d.tunnel.Close()
 		reqLogger.V(1).Info("Closed tunnel")
@@ -735,58 +978,52 @@ func (d GitRepoAccessOptions) TunnelClose(reqLogger logr.Logger) {
 	return
 }
 
-func formatJobSSHConfig(ctx context.Context, reqLogger logr.Logger, instance *tfv1alpha1.Terraform, k8sclient client.Client) (map[string][]byte, error) {
+func formatJobSSHConfig(ctx context.Context, reqLogger logr.Logger, instance *tfv1alpha2.Terraform, k8sclient client.Client) (map[string][]byte, error) {
 	data := make(map[string]string)
 	dataAsByte := make(map[string][]byte)
-	if instance.Spec.SSHTunnel != nil {
-		data["config"] = fmt.Sprintf("Host proxy\n"+
-			"\tStrictHostKeyChecking no\n"+
-			"\tUserKnownHostsFile=/dev/null\n"+
-			"\tUser %s\n"+
-			"\tHostname %s\n"+
-			"\tIdentityFile ~/.ssh/proxy_key\n",
-			instance.Spec.SSHTunnel.User,
-			instance.Spec.SSHTunnel.Host)
-		k := instance.Spec.SSHTunnel.SSHKeySecretRef.Key
-		if k == "" {
-			k = "id_rsa"
-		}
-		ns := instance.Spec.SSHTunnel.SSHKeySecretRef.Namespace
-		if ns == "" {
-			ns = instance.Namespace
-		}
-
-		key, err := loadPassword(ctx, k8sclient, k, instance.Spec.SSHTunnel.SSHKeySecretRef.Name, ns)
-		if err != nil {
-			return dataAsByte, err
+	data["config"] = jobSSHConfig(instance)
+
+	// Each hop of a tunnel has a key and known_hosts file named after its
+	// alias in the config
+	for _, t := range runnerSSHTunnels(instance) {
+		for i, hop := range sshHops(t.proxy) {
+			hopAlias := t.alias
+			if i < len(t.proxy.JumpHosts) {
+				hopAlias = jumpHostAlias(t.alias, i)
+			}
+			if hop.KnownHosts != nil {
+				knownHosts, err := loadKnownHosts(ctx, k8sclient, hop.KnownHosts, instance.Namespace)
+				if err != nil {
+					return dataAsByte, err
+				}
+				data[hopAlias+"_known_hosts"] = string(knownHosts)
+			}
+			k := hop.SSHKeySecretRef.Key
+			if k == "" {
+				k = "id_rsa"
+			}
+			ns := hop.SSHKeySecretRef.Namespace
+			if ns == "" {
+				ns = instance.Namespace
+			}
+			key, err := loadPassword(ctx, k8sclient, k, hop.SSHKeySecretRef.Name, ns)
+			if err != nil {
+				return dataAsByte, err
+			}
+			data[hopAlias+"_key"] = key
 		}
-		data["proxy_key"] = key
-
 	}
 
 	for _, m := range instance.Spec.SCMAuthMethods {
 
 		// TODO validate SSH in resource manifest
 		if m.Git.SSH != nil {
-			if m.Git.SSH.RequireProxy {
-				data["config"] += fmt.Sprintf("\nHost %s\n"+
-					"\tStrictHostKeyChecking no\n"+
-					"\tUserKnownHostsFile=/dev/null\n"+
-					"\tHostname %s\n"+
-					"\tIdentityFile ~/.ssh/%s\n"+
-					"\tProxyJump proxy",
-					m.Host,
-					m.Host,
-					m.Host)
-			} else {
-				data["config"] += fmt.Sprintf("\nHost %s\n"+
-					"\tStrictHostKeyChecking no\n"+
-					"\tUserKnownHostsFile=/dev/null\n"+
-					"\tHostname %s\n"+
-					"\tIdentityFile ~/.ssh/%s\n",
-					m.Host,
-					m.Host,
-					m.Host)
+			if m.KnownHosts != nil {
+				knownHosts, err := loadKnownHosts(ctx, k8sclient, m.KnownHosts, instance.Namespace)
+				if err != nil {
+					return dataAsByte, err
+				}
+				data[knownHostsFilename(m.Host)] = string(knownHosts)
 			}
 			k := m.Git.SSH.SSHKeySecretRef.Key
 			if k == "" {
@@ -811,19 +1048,17 @@ func formatJobSSHConfig(ctx context.Context, reqLogger logr.Logger, instance *tf
 	return dataAsByte, nil
 }
 
-func (r *ReconcileTerraform) setupAndRun(ctx context.Context, tf *tfv1alpha1.Terraform) error {
+func (r *ReconcileTerraform) setupAndRun(ctx context.Context, tf *tfv1alpha2.Terraform, sources *fetchedSources) error {
 	reqLogger := r.Log.WithValues("Terraform", types.NamespacedName{Name: tf.Name, Namespace: tf.Namespace}.String())
-	n := len(tf.Status.Stages)
-	isNewGeneration := tf.Status.Stages[n-1].Reason == "GENERATION_CHANGE"
-	isFirstInstall := tf.Status.Stages[n-1].Reason == "TF_RESOURCE_CREATED"
-	isChanged := isNewGeneration || isFirstInstall
+	isChanged := runDataChanged(tf)
 	// r.Recorder.Event(tf, "Normal", "InitializeJobCreate", fmt.Sprintf("Setting up a Job"))
 	// TODO(user): Add the cleanup steps that the operator
 	// needs to do before the CR can be deleted. Examples
 	// of finalizers include performing backups and deleting
 	// resources that are not owned by this CR, like a PVC.
 
-	runOpts := newRunOptions(tf)
+	config := r.Config.Get()
+	runOpts := newRunOptions(tf, config)
 	// runOpts.updateEnvVars(corev1.EnvVar{
 	// 	Name:  "DEPLOYMENT",
 	// 	Value: instance.Name,
@@ -837,11 +1072,20 @@ func (r *ReconcileTerraform) setupAndRun(ctx context.Context, tf *tfv1alpha1.Ter
 		r.Recorder.Event(tf, "Warning", "ProcessingError", fmt.Errorf("Error in newGitRepoAccessOptionsFromSpec: %v", err).Error())
 		return fmt.Errorf("Error in newGitRepoAccessOptionsFromSpec: %v", err)
 	}
+	os.RemoveAll(stackRepoAccessOptions.Directory)
 
-	err = stackRepoAccessOptions.getParsedAddress()
-	if err != nil {
-		r.Recorder.Event(tf, "Warning", "ProcessingError", fmt.Errorf("Error in parsing address: %v", err).Error())
-		return fmt.Errorf("Error in parsing address: %v", err)
+	if len(tf.Spec.TerraformModule.Inline) > 0 {
+		// The setup runner copies the files from the module's configmap
+		stackRepoAccessOptions.ParsedAddress = ParsedAddress{inline: true}
+	} else if isGetterAddress(address) {
+		// The setup runner downloads the module with go-getter
+		stackRepoAccessOptions.ParsedAddress = ParsedAddress{getter: address, repo: address}
+	} else {
+		err = stackRepoAccessOptions.getParsedAddress()
+		if err != nil {
+			r.Recorder.Event(tf, "Warning", "ProcessingError", fmt.Errorf("Error in parsing address: %v", err).Error())
+			return fmt.Errorf("Error in parsing address: %v", err)
+		}
 	}
 
 	// Since we're not going to download this to a configmap, we need to
@@ -851,168 +1095,86 @@ func (r *ReconcileTerraform) setupAndRun(ctx context.Context, tf *tfv1alpha1.Ter
 
 	runOpts.updateDownloadedModules(stackRepoAccessOptions.hash)
 	runOpts.stack = stackRepoAccessOptions.ParsedAddress
-	if runOpts.stack.repo == "" {
+	if runOpts.stack.repo == "" && !runOpts.stack.inline {
 		return fmt.Errorf("Error is parsing terraformModule")
 	}
+	if modulePollInterval(tf) > 0 && tf.Status.ModuleCommit != "" {
+		// Run the exact commit that was resolved by polling
+		runOpts.stack.hash = tf.Status.ModuleCommit
+	}
 
 	// TODO Update secrets only when the generation changes
 	if isChanged {
-		for _, m := range stackRepoAccessOptions.SCMAuthMethods {
-			// I think Terraform only allows for one git token. Add the first one
-			// to the job's env vars as GIT_PASSWORD.
-			if m.Git.HTTPS != nil {
-				tokenSecret := *m.Git.HTTPS.TokenSecretRef
-				if tokenSecret.Key == "" {
-					tokenSecret.Key = "token"
-				}
-				gitAskpass, err := r.createGitAskpass(ctx, tokenSecret)
-				if err != nil {
-					return err
-				}
-				runOpts.secretData["gitAskpass"] = gitAskpass
+		// Each host gets its own token through the credential helper
+		gitCredentials, err := r.runnerGitCredentials(ctx, tf)
+		if err != nil {
+			r.Recorder.Event(tf, "Warning", "GitCredentialsError", err.Error())
+			return fmt.Errorf("Error setting up git credentials: %v", err)
+		}
+		for k, v := range gitCredentials {
+			runOpts.secretData[k] = v
+		}
 
-			}
+		// The ssh config has a Host for each SCMAuthMethod that uses ssh and
+		// the proxy the runners' SOCKS5 proxy connects to
+		needsSSHConfig := len(runOpts.socks5Proxies) > 0
+		for _, m := range stackRepoAccessOptions.SCMAuthMethods {
 			if m.Git.SSH != nil {
-				sshConfigData, err := formatJobSSHConfig(ctx, reqLogger, tf, r.Client)
-				if err != nil {
-					r.Recorder.Event(tf, "Warning", "SSHConfigError", fmt.Errorf("%v", err).Error())
-					return fmt.Errorf("Error setting up sshconfig: %v", err)
-				}
-				for k, v := range sshConfigData {
-					runOpts.secretData[k] = v
-				}
-
+				needsSSHConfig = true
+				break
+			}
+		}
+		if needsSSHConfig {
+			sshConfigData, err := formatJobSSHConfig(ctx, reqLogger, tf, r.Client)
+			if err != nil {
+				r.Recorder.Event(tf, "Warning", "SSHConfigError", fmt.Errorf("%v", err).Error())
+				return fmt.Errorf("Error setting up sshconfig: %v", err)
+			}
+			for k, v := range sshConfigData {
+				runOpts.secretData[k] = v
 			}
-			break
 		}
 	}
 
-	//
-	// TODO
-	//		The following section can have downloads from other sources. This
-	//		can take a few seconds to a few mintues to complete and will block
-	// 		the entire queue until it is completed.
-	//
-	//		Implement a way to run this in the background and signal that the
-	//		configmap is ready for usage which will then trigger the controller
-	//		to go ahead and configure the pods.
-	//
 	tfvars := ""
 	if isChanged {
 		// ConfigMap Data only needs to be updated when generation changes
 
-		otherConfigFiles := make(map[string]string)
-		for _, s := range tf.Spec.Sources {
-			address := strings.TrimSpace(s.Address)
-			extras := s.Extras
-			// Loop thru all the sources in spec.config
-			configRepoAccessOptions, err := newGitRepoAccessOptionsFromSpec(tf, address, extras)
-			if err != nil {
-				r.Recorder.Event(tf, "Warning", "ConfigError", fmt.Errorf("Error in Spec: %v", err).Error())
-				return fmt.Errorf("Error in newGitRepoAccessOptionsFromSpec: %v", err)
-			}
-
-			err = configRepoAccessOptions.getParsedAddress()
-			if err != nil {
-				return err
-			}
-			reqLogger.V(1).Info("Setting up download options for config repo access")
-
-			if (tfv1alpha1.ProxyOpts{}) != configRepoAccessOptions.SSHProxy {
-				if strings.Contains(configRepoAccessOptions.protocol, "http") {
-					err := configRepoAccessOptions.startHTTPSProxy(ctx, r.Client, tf.Namespace, reqLogger)
-					if err != nil {
-						reqLogger.Error(err, "failed to start ssh proxy")
-						return err
-					}
-				} else if configRepoAccessOptions.protocol == "ssh" {
-					err := configRepoAccessOptions.startSSHProxy(ctx, r.Client, tf.Namespace, reqLogger)
-					if err != nil {
-						reqLogger.Error(err, "failed to start ssh proxy")
-						return err
-					}
-					defer configRepoAccessOptions.TunnelClose(reqLogger.WithValues("Spec", "source"))
-				}
-			}
+		for k, v := range tf.Spec.TerraformModule.Inline {
+			runOpts.moduleConfigMapData[k] = v
+		}
 
-			err = configRepoAccessOptions.download(ctx, r.Client, tf.Namespace)
-			if err != nil {
-				r.Recorder.Event(tf, "Warning", "DownloadError", fmt.Errorf("Error in download: %v", err).Error())
-				return fmt.Errorf("Error in download: %v", err)
+		// The sources were downloaded in the background before the run
+		if sources != nil {
+			tfvars = sources.tfvars
+			for k, v := range sources.files {
+				runOpts.configMapData[k] = v
 			}
-
-			reqLogger.V(1).Info(fmt.Sprintf("Config was downloaded and updated GitRepoAccessOptions: %+v", configRepoAccessOptions))
-
-			tfvarSource, err := configRepoAccessOptions.tfvarFiles()
-			if err != nil {
-				r.Recorder.Event(tf, "Warning", "ReadFileError", fmt.Errorf("Error reading tfvar files: %v", err).Error())
-				return fmt.Errorf("Error in reading tfvarFiles: %v", err)
-			}
-			tfvars += tfvarSource
-
-			otherConfigFiles, err = configRepoAccessOptions.otherConfigFiles()
-			if err != nil {
-				r.Recorder.Event(tf, "Warning", "ReadFileError", fmt.Errorf("Error reading files: %v", err).Error())
-				return fmt.Errorf("Error in reading otherConfigFiles: %v", err)
+			for k, v := range sources.secretFiles {
+				runOpts.sourcesSecretData[k] = []byte(v)
 			}
 		}
-
-		runOpts.configMapData["tfvars"] = tfvars
-		for k, v := range otherConfigFiles {
-			runOpts.configMapData[k] = v
+		// Values of Secret sources are not written to the configmap
+		if sources != nil && sources.sensitive {
+			runOpts.sourcesSecretData["tfvars"] = []byte(tfvars)
+		} else {
+			runOpts.configMapData["tfvars"] = tfvars
 		}
 
 		// Override the backend.tf by inserting a custom backend
 		if tf.Spec.CustomBackend != "" {
 			runOpts.configMapData["backend_override.tf"] = tf.Spec.CustomBackend
+		} else if config.BackendTemplate != "" {
+			runOpts.configMapData["backend_override.tf"] = config.backend(tf.Namespace, runOpts.name)
 		}
 
-		if tf.Spec.PreInitScript != "" {
-			runOpts.configMapData[string(tfv1alpha1.PodPreInit)] = tf.Spec.PreInitScript
-		}
-
-		if tf.Spec.PostInitScript != "" {
-			runOpts.configMapData[string(tfv1alpha1.PodPostInit)] = tf.Spec.PostInitScript
-		}
-
-		if tf.Spec.PrePlanScript != "" {
-			runOpts.configMapData[string(tfv1alpha1.PodPrePlan)] = tf.Spec.PrePlanScript
-		}
-
-		if tf.Spec.PostPlanScript != "" {
-			runOpts.configMapData[string(tfv1alpha1.PodPostPlan)] = tf.Spec.PostPlanScript
-		}
-
-		if tf.Spec.PreApplyScript != "" {
-			runOpts.configMapData[string(tfv1alpha1.PodPreApply)] = tf.Spec.PreApplyScript
-		}
-
-		if tf.Spec.PostApplyScript != "" {
-			runOpts.configMapData[string(tfv1alpha1.PodPostApply)] = tf.Spec.PostApplyScript
-		}
-
-		if tf.Spec.PreInitDeleteScript != "" {
-			runOpts.configMapData[string(tfv1alpha1.PodPreInitDelete)] = tf.Spec.PreInitDeleteScript
-		}
-
-		if tf.Spec.PostInitDeleteScript != "" {
-			runOpts.configMapData[string(tfv1alpha1.PodPostInitDelete)] = tf.Spec.PostInitDeleteScript
-		}
-
-		if tf.Spec.PrePlanDeleteScript != "" {
-			runOpts.configMapData[string(tfv1alpha1.PodPrePlanDelete)] = tf.Spec.PrePlanDeleteScript
-		}
-
-		if tf.Spec.PostPlanDeleteScript != "" {
-			runOpts.configMapData[string(tfv1alpha1.PodPostPlanDelete)] = tf.Spec.PostPlanDeleteScript
-		}
-
-		if tf.Spec.PreApplyDeleteScript != "" {
-			runOpts.configMapData[string(tfv1alpha1.PodPreApplyDelete)] = tf.Spec.PostApplyScript
+		scripts, err := r.hookScripts(ctx, tf)
+		if err != nil {
+			r.Recorder.Event(tf, "Warning", "HookError", err.Error())
+			return fmt.Errorf("Error in reading hook scripts: %v", err)
 		}
-
-		if tf.Spec.PostApplyDeleteScript != "" {
-			runOpts.configMapData[string(tfv1alpha1.PodPostApplyDelete)] = tf.Spec.PostApplyDeleteScript
+		for k, v := range scripts {
+			runOpts.configMapData[k] = v
 		}
 	}
 
@@ -1028,12 +1190,24 @@ func (r *ReconcileTerraform) setupAndRun(ctx context.Context, tf *tfv1alpha1.Ter
 		}
 		err = exportRepoAccessOptions.getParsedAddress()
 		if err != nil {
+			os.RemoveAll(exportRepoAccessOptions.Directory)
 			return fmt.Errorf("Error parsing export repo address %s", err)
 		}
 
-		// TODO decide what to do on errors
-		// Closing the tunnel from within this function
-		go exportRepoAccessOptions.commitTfvars(ctx, r.Client, tfvars, e.TFVarsFile, e.ConfFile, tf.Namespace, tf.Spec.CustomBackend, runOpts, reqLogger)
+		// The export does not hold up the run. Its result is an event.
+		exportTfvars := ""
+		if sources != nil {
+			exportTfvars = sources.exportTfvars
+		}
+		go func(tf *tfv1alpha2.Terraform, backend string) {
+			result, err := exportRepoAccessOptions.commitTfvars(ctx, r.Client, tf, exportTfvars, backend, runOpts, reqLogger)
+			if err != nil {
+				reqLogger.Error(err, "unable to export tfvars")
+				r.Recorder.Event(tf, "Warning", "ExportRepoError", fmt.Sprintf("Could not export to %s: %v", tf.Spec.ExportRepo.Address, err))
+				return
+			}
+			r.Recorder.Event(tf, "Normal", "ExportRepo", result)
+		}(tf.DeepCopy(), runOpts.configMapData["backend_override.tf"])
 	}
 
 	// RUN
@@ -1057,7 +1231,7 @@ func (r ReconcileTerraform) checkPersistentVolumeClaimExists(ctx context.Context
 	return resource, true, nil
 }
 
-func (r ReconcileTerraform) createPVC(ctx context.Context, tf *tfv1alpha1.Terraform, runOpts RunOptions) error {
+func (r ReconcileTerraform) createPVC(ctx context.Context, tf *tfv1alpha2.Terraform, runOpts RunOptions) error {
 	kind := "PersistentVolumeClaim"
 	_, found, err := r.checkPersistentVolumeClaimExists(ctx, types.NamespacedName{
 		Name:      runOpts.name,
@@ -1068,7 +1242,7 @@ func (r ReconcileTerraform) createPVC(ctx context.Context, tf *tfv1alpha1.Terraf
 	} else if found {
 		return nil
 	}
-	resource := runOpts.generatePVC("2Gi")
+	resource := runOpts.generatePVC()
 	controllerutil.SetControllerReference(tf, resource, r.Scheme)
 
 	err = r.Client.Create(ctx, resource)
@@ -1110,7 +1284,7 @@ func (r ReconcileTerraform) deleteConfigMapIfExists(ctx context.Context, name, n
 	return nil
 }
 
-func (r ReconcileTerraform) createConfigMap(ctx context.Context, tf *tfv1alpha1.Terraform, runOpts RunOptions) error {
+func (r ReconcileTerraform) createConfigMap(ctx context.Context, tf *tfv1alpha2.Terraform, runOpts RunOptions) error {
 	kind := "ConfigMap"
 	err := r.deleteConfigMapIfExists(ctx, runOpts.name, runOpts.namespace)
 	if err != nil {
@@ -1159,7 +1333,7 @@ func (r ReconcileTerraform) deleteSecretIfExists(ctx context.Context, name, name
 	return nil
 }
 
-func (r ReconcileTerraform) createSecret(ctx context.Context, tf *tfv1alpha1.Terraform, runOpts RunOptions) error {
+func (r ReconcileTerraform) createSecret(ctx context.Context, tf *tfv1alpha2.Terraform, runOpts RunOptions) error {
 	kind := "Secret"
 	err := r.deleteSecretIfExists(ctx, runOpts.name, runOpts.namespace)
 	if err != nil {
@@ -1178,6 +1352,54 @@ func (r ReconcileTerraform) createSecret(ctx context.Context, tf *tfv1alpha1.Ter
 	return nil
 }
 
+// createModuleConfigMap replaces the configmap with the files of an inline
+// terraformModule. No configmap is created for other modules.
+func (r ReconcileTerraform) createModuleConfigMap(ctx context.Context, tf *tfv1alpha2.Terraform, runOpts RunOptions) error {
+	kind := "ConfigMap"
+	err := r.deleteConfigMapIfExists(ctx, moduleConfigMapName(runOpts.name), runOpts.namespace)
+	if err != nil {
+		return err
+	}
+	if len(runOpts.moduleConfigMapData) == 0 {
+		return nil
+	}
+
+	resource := runOpts.generateModuleConfigMap()
+	controllerutil.SetControllerReference(tf, resource, r.Scheme)
+
+	err = r.Client.Create(ctx, resource)
+	if err != nil {
+		r.Recorder.Event(tf, "Warning", fmt.Sprintf("%sCreateError", kind), fmt.Sprintf("Could not create %s %v", kind, err))
+		return err
+	}
+	r.Recorder.Event(tf, "Normal", "SuccessfulCreate", fmt.Sprintf("Created %s: '%s'", kind, resource.Name))
+	return nil
+}
+
+// createSourcesSecret replaces the secret with the files of the Secret
+// sources. No secret is created when there are none.
+func (r ReconcileTerraform) createSourcesSecret(ctx context.Context, tf *tfv1alpha2.Terraform, runOpts RunOptions) error {
+	kind := "Secret"
+	err := r.deleteSecretIfExists(ctx, sourcesSecretName(runOpts.name), runOpts.namespace)
+	if err != nil {
+		return err
+	}
+	if len(runOpts.sourcesSecretData) == 0 {
+		return nil
+	}
+
+	resource := runOpts.generateSourcesSecret()
+	controllerutil.SetControllerReference(tf, resource, r.Scheme)
+
+	err = r.Client.Create(ctx, resource)
+	if err != nil {
+		r.Recorder.Event(tf, "Warning", fmt.Sprintf("%sCreateError", kind), fmt.Sprintf("Could not create %s %v", kind, err))
+		return err
+	}
+	r.Recorder.Event(tf, "Normal", "SuccessfulCreate", fmt.Sprintf("Created %s: '%s'", kind, resource.Name))
+	return nil
+}
+
 func (r ReconcileTerraform) checkServiceAccountExists(ctx context.Context, lookupKey types.NamespacedName) (*corev1.ServiceAccount, bool, error) {
 	resource := &corev1.ServiceAccount{}
 
@@ -1208,7 +1430,7 @@ func (r ReconcileTerraform) deleteServiceAccountIfExists(ctx context.Context, na
 	return nil
 }
 
-func (r ReconcileTerraform) createServiceAccount(ctx context.Context, tf *tfv1alpha1.Terraform, runOpts RunOptions) error {
+func (r ReconcileTerraform) createServiceAccount(ctx context.Context, tf *tfv1alpha2.Terraform, runOpts RunOptions) error {
 	kind := "ServiceAccount"
 	err := r.deleteServiceAccountIfExists(ctx, runOpts.serviceAccount, runOpts.namespace)
 	if err != nil {
@@ -1256,7 +1478,7 @@ func (r ReconcileTerraform) deleteRoleIfExists(ctx context.Context, name, namesp
 	return nil
 }
 
-func (r ReconcileTerraform) createRole(ctx context.Context, tf *tfv1alpha1.Terraform, runOpts RunOptions) error {
+func (r ReconcileTerraform) createRole(ctx context.Context, tf *tfv1alpha2.Terraform, runOpts RunOptions) error {
 	kind := "Role"
 	err := r.deleteRoleIfExists(ctx, runOpts.name, runOpts.namespace)
 	if err != nil {
@@ -1304,7 +1526,7 @@ func (r ReconcileTerraform) deleteRoleBindingIfExists(ctx context.Context, name,
 	return nil
 }
 
-func (r ReconcileTerraform) createRoleBinding(ctx context.Context, tf *tfv1alpha1.Terraform, runOpts RunOptions) error {
+func (r ReconcileTerraform) createRoleBinding(ctx context.Context, tf *tfv1alpha2.Terraform, runOpts RunOptions) error {
 	kind := "RoleBinding"
 	err := r.deleteRoleBindingIfExists(ctx, runOpts.name, runOpts.namespace)
 	if err != nil {
@@ -1323,7 +1545,7 @@ func (r ReconcileTerraform) createRoleBinding(ctx context.Context, tf *tfv1alpha
 	return nil
 }
 
-func (r ReconcileTerraform) createPod(ctx context.Context, tf *tfv1alpha1.Terraform, runOpts RunOptions) error {
+func (r ReconcileTerraform) createPod(ctx context.Context, tf *tfv1alpha2.Terraform, runOpts RunOptions) error {
 	kind := "Pod"
 
 	n := len(tf.Status.Stages)
@@ -1331,32 +1553,19 @@ func (r ReconcileTerraform) createPod(ctx context.Context, tf *tfv1alpha1.Terraf
 	generation := tf.Status.Stages[n-1].Generation
 
 	tfRunnerPodTypes := []string{
-		string(tfv1alpha1.PodInit),
-		string(tfv1alpha1.PodInitDelete),
-		string(tfv1alpha1.PodPlan),
-		string(tfv1alpha1.PodPlanDelete),
-		string(tfv1alpha1.PodApply),
-		string(tfv1alpha1.PodApplyDelete),
+		string(tfv1alpha2.PodInit),
+		string(tfv1alpha2.PodInitDelete),
+		string(tfv1alpha2.PodPlan),
+		string(tfv1alpha2.PodPlanDelete),
+		string(tfv1alpha2.PodApply),
+		string(tfv1alpha2.PodApplyDelete),
 	}
 
 	isTFRunner := utils.ListContainsStr(tfRunnerPodTypes, string(podType))
 
-	var preScriptPodType tfv1alpha1.PodType
-	if podType == tfv1alpha1.PodInit && tf.Spec.PreInitScript != "" {
-		preScriptPodType = tfv1alpha1.PodPreInit
-	} else if podType == tfv1alpha1.PodInitDelete && tf.Spec.PreInitDeleteScript != "" {
-		preScriptPodType = tfv1alpha1.PodPreInitDelete
-	} else if podType == tfv1alpha1.PodPlan && tf.Spec.PrePlanScript != "" {
-		preScriptPodType = tfv1alpha1.PodPrePlan
-	} else if podType == tfv1alpha1.PodPlanDelete && tf.Spec.PrePlanDeleteScript != "" {
-		preScriptPodType = tfv1alpha1.PodPrePlanDelete
-	} else if podType == tfv1alpha1.PodApply && tf.Spec.PreApplyScript != "" {
-		preScriptPodType = tfv1alpha1.PodPreApply
-	} else if podType == tfv1alpha1.PodApplyDelete && tf.Spec.PreApplyDeleteScript != "" {
-		preScriptPodType = tfv1alpha1.PodPreApplyDelete
-	}
-
-	resource := runOpts.generatePod(podType, preScriptPodType, isTFRunner, generation)
+	hooks := podHooks(tf, podType)
+
+	resource := runOpts.generatePod(podType, hooks, isTFRunner, generation)
 	controllerutil.SetControllerReference(tf, resource, r.Scheme)
 
 	err := r.Client.Create(ctx, resource)
@@ -1654,7 +1863,7 @@ func (r RunOptions) generateRoleBinding() *rbacv1.RoleBinding {
 // 	}
 
 // 	for _, c := range r.credentials {
-// 		if (tfv1alpha1.SecretNameRef{}) != c.SecretNameRef {
+// 		if (tfv1alpha2.SecretNameRef{}) != c.SecretNameRef {
 // 			envFrom = append(envFrom, []corev1.EnvFromSource{
 // 				{
 // 					SecretRef: &corev1.SecretEnvSource{
@@ -1722,7 +1931,11 @@ func (r RunOptions) generateRoleBinding() *rbacv1.RoleBinding {
 // 	return job
 // }
 
-func (r RunOptions) generatePVC(size string) *corev1.PersistentVolumeClaim {
+func (r RunOptions) generatePVC() *corev1.PersistentVolumeClaim {
+	var storageClassName *string
+	if r.storageClassName != "" {
+		storageClassName = &r.storageClassName
+	}
 	return &corev1.PersistentVolumeClaim{
 		ObjectMeta: metav1.ObjectMeta{
 			Name:      r.name,
@@ -1734,19 +1947,22 @@ func (r RunOptions) generatePVC(size string) *corev1.PersistentVolumeClaim {
 			},
 			Resources: corev1.ResourceRequirements{
 				Requests: corev1.ResourceList{
-					corev1.ResourceStorage: resource.MustParse(size),
+					corev1.ResourceStorage: resource.MustParse(r.pvcSize),
 				},
 			},
+			StorageClassName: storageClassName,
 		},
 	}
 }
 
-func (r RunOptions) generatePod(podType, preScriptPodType tfv1alpha1.PodType, isTFRunner bool, generation int64) *corev1.Pod {
+func (r RunOptions) generatePod(podType tfv1alpha2.PodType, hooks []hookRun, isTFRunner bool, generation int64) *corev1.Pod {
 	pod := &corev1.Pod{}
 	id := r.name
 	generateName := id + "-" + string(podType) + "-"
 
-	envs := r.envVars
+	// The proxy settings come first so the spec's env can override them
+	envs := proxyEnvVars(r.httpProxy, r.socks5Proxies)
+	envs = append(envs, r.envVars...)
 	envs = append(envs, []corev1.EnvVar{
 		{
 			Name:  "TFO_RUNNER",
@@ -1812,6 +2028,13 @@ func (r RunOptions) generatePod(podType, preScriptPodType tfv1alpha1.PodType, is
 	// 	// 		validitiy?)
 	// }
 
+	if r.stack.getter != "" {
+		envs = append(envs, corev1.EnvVar{
+			Name:  "TFO_MAIN_MODULE_ADDR",
+			Value: r.stack.getter,
+		})
+	}
+
 	ref := r.stack.hash
 	if ref == "" {
 		ref = "master"
@@ -1855,13 +2078,29 @@ func (r RunOptions) generatePod(podType, preScriptPodType tfv1alpha1.PodType, is
 
 	downloadsVol := "downloads"
 	downloadsPath := "/tmp/downloads"
+	sourcesOptional := true
 	volumes = append(volumes, []corev1.Volume{
 		{
 			Name: downloadsVol,
 			VolumeSource: corev1.VolumeSource{
-				ConfigMap: &corev1.ConfigMapVolumeSource{
-					LocalObjectReference: corev1.LocalObjectReference{
-						Name: id,
+				// The files of Secret sources are kept in a secret
+				Projected: &corev1.ProjectedVolumeSource{
+					Sources: []corev1.VolumeProjection{
+						{
+							ConfigMap: &corev1.ConfigMapProjection{
+								LocalObjectReference: corev1.LocalObjectReference{
+									Name: id,
+								},
+							},
+						},
+						{
+							Secret: &corev1.SecretProjection{
+								LocalObjectReference: corev1.LocalObjectReference{
+									Name: sourcesSecretName(id),
+								},
+								Optional: &sourcesOptional,
+							},
+						},
 					},
 				},
 			},
@@ -1880,6 +2119,31 @@ func (r RunOptions) generatePod(podType, preScriptPodType tfv1alpha1.PodType, is
 		},
 	}...)
 
+	if r.stack.inline {
+		// The setup runner copies the files of an inline module instead of
+		// cloning a repo
+		moduleVol := "module"
+		modulePath := "/tmp/module"
+		volumes = append(volumes, corev1.Volume{
+			Name: moduleVol,
+			VolumeSource: corev1.VolumeSource{
+				ConfigMap: &corev1.ConfigMapVolumeSource{
+					LocalObjectReference: corev1.LocalObjectReference{
+						Name: moduleConfigMapName(id),
+					},
+				},
+			},
+		})
+		volumeMounts = append(volumeMounts, corev1.VolumeMount{
+			Name:      moduleVol,
+			MountPath: modulePath,
+		})
+		envs = append(envs, corev1.EnvVar{
+			Name:  "TFO_MAIN_MODULE_INLINE",
+			Value: modulePath,
+		})
+	}
+
 	optional := true
 	xmode := int32(0775)
 	volumes = append(volumes, corev1.Volume{
@@ -1894,6 +2158,15 @@ func (r RunOptions) generatePod(podType, preScriptPodType tfv1alpha1.PodType, is
 						Path: "GIT_ASKPASS",
 						Mode: &xmode,
 					},
+					{
+						Key:  "gitCredentialHelper",
+						Path: gitCredentialHelperFile,
+						Mode: &xmode,
+					},
+					{
+						Key:  "gitconfig",
+						Path: gitConfigFile,
+					},
 				},
 			},
 		},
@@ -1901,13 +2174,17 @@ func (r RunOptions) generatePod(podType, preScriptPodType tfv1alpha1.PodType, is
 	volumeMounts = append(volumeMounts, []corev1.VolumeMount{
 		{
 			Name:      "gitaskpass",
-			MountPath: "/git/askpass",
+			MountPath: gitCredentialsPath,
 		},
 	}...)
 	envs = append(envs, []corev1.EnvVar{
 		{
 			Name:  "GIT_ASKPASS",
-			Value: "/git/askpass/GIT_ASKPASS",
+			Value: gitCredentialsPath + "/GIT_ASKPASS",
+		},
+		{
+			Name:  "TFO_GIT_CONFIG",
+			Value: gitCredentialsPath + "/" + gitConfigFile,
 		},
 	}...)
 
@@ -1915,7 +2192,7 @@ func (r RunOptions) generatePod(podType, preScriptPodType tfv1alpha1.PodType, is
 	sshMountPath := "/tmp/ssh"
 	mode := int32(0775)
 	sshConfigItems := []corev1.KeyToPath{}
-	keysToIgnore := []string{"gitAskpass"}
+	keysToIgnore := []string{"gitAskpass", "gitCredentialHelper", "gitconfig"}
 	for key := range r.secretData {
 		if utils.ListContainsStr(keysToIgnore, key) {
 			continue
@@ -1962,7 +2239,7 @@ func (r RunOptions) generatePod(podType, preScriptPodType tfv1alpha1.PodType, is
 	}
 
 	for _, c := range r.credentials {
-		if (tfv1alpha1.SecretNameRef{}) != c.SecretNameRef {
+		if (tfv1alpha2.SecretNameRef{}) != c.SecretNameRef {
 			envFrom = append(envFrom, []corev1.EnvFromSource{
 				{
 					SecretRef: &corev1.SecretEnvSource{
@@ -2007,7 +2284,7 @@ func (r RunOptions) generatePod(podType, preScriptPodType tfv1alpha1.PodType, is
 			VolumeMounts:    volumeMounts,
 		})
 
-		if podType == tfv1alpha1.PodInit {
+		if podType == tfv1alpha2.PodInit {
 			// setup once per generation
 
 			initContainers = append(initContainers, corev1.Container{
@@ -2021,36 +2298,20 @@ func (r RunOptions) generatePod(podType, preScriptPodType tfv1alpha1.PodType, is
 			})
 		}
 
-		if preScriptPodType != "" {
-			envs = append(envs, corev1.EnvVar{
-				Name:  "TFO_SCRIPT",
-				Value: string(preScriptPodType),
-			})
-			initContainers = append(initContainers, corev1.Container{
-				SecurityContext: securityContext,
-				Name:            "pre-script",
-				Image:           r.scriptRunner + ":" + r.scriptRunnerVersion,
-				ImagePullPolicy: r.scriptRunnerPullPolicy,
-				EnvFrom:         envFrom,
-				Env:             envs,
-				VolumeMounts:    volumeMounts,
-			})
+		for i, hook := range hooks {
+			initContainers = append(initContainers, r.hookContainer(fmt.Sprintf("pre-script-%d", i), hook, securityContext, envFrom, envs, volumeMounts))
 		}
 
 	} else {
-		envs = append(envs, corev1.EnvVar{
-			Name:  "TFO_SCRIPT",
-			Value: string(podType),
-		})
-		containers = append(containers, corev1.Container{
-			SecurityContext: securityContext,
-			Name:            "script",
-			Image:           r.scriptRunner + ":" + r.scriptRunnerVersion,
-			ImagePullPolicy: r.scriptRunnerPullPolicy,
-			EnvFrom:         envFrom,
-			Env:             envs,
-			VolumeMounts:    volumeMounts,
-		})
+		// The last hook is the pod's container and the hooks before it run
+		// in order as init containers
+		for i, hook := range hooks {
+			if i == len(hooks)-1 {
+				containers = append(containers, r.hookContainer("script", hook, securityContext, envFrom, envs, volumeMounts))
+				break
+			}
+			initContainers = append(initContainers, r.hookContainer(fmt.Sprintf("script-%d", i), hook, securityContext, envFrom, envs, volumeMounts))
+		}
 	}
 	podSecurityContext := corev1.PodSecurityContext{
 		FSGroup: &user,
@@ -2074,6 +2335,31 @@ func (r RunOptions) generatePod(podType, preScriptPodType tfv1alpha1.PodType, is
 	return pod
 }
 
+// hookContainer runs the hook's script. Hooks without an image run in the
+// scriptRunner image. Custom images run the script with "/bin/sh".
+func (r RunOptions) hookContainer(name string, hook hookRun, securityContext *corev1.SecurityContext, envFrom []corev1.EnvFromSource, envs []corev1.EnvVar, volumeMounts []corev1.VolumeMount) corev1.Container {
+	hookEnvs := append([]corev1.EnvVar{}, envs...)
+	hookEnvs = append(hookEnvs, corev1.EnvVar{
+		Name:  "TFO_SCRIPT",
+		Value: hook.key,
+	})
+	container := corev1.Container{
+		SecurityContext: securityContext,
+		Name:            name,
+		Image:           r.scriptRunner + ":" + r.scriptRunnerVersion,
+		ImagePullPolicy: r.scriptRunnerPullPolicy,
+		EnvFrom:         envFrom,
+		Env:             hookEnvs,
+		VolumeMounts:    volumeMounts,
+	}
+	if hook.image != "" {
+		container.Image = hook.image
+		container.ImagePullPolicy = ""
+		container.Command = []string{"/bin/sh", "-c", `cd "$TFO_MAIN_MODULE" && chmod +x "$TFO_SCRIPT" && exec "./$TFO_SCRIPT"`}
+	}
+	return container
+}
+
 // getOrCreateEnv will check if an env exists. If it does not, it will be
 // created with the value
 func (r *RunOptions) getOrCreateEnv(name, value string) {
@@ -2088,10 +2374,10 @@ func (r *RunOptions) getOrCreateEnv(name, value string) {
 	})
 }
 
-func (r ReconcileTerraform) run(ctx context.Context, reqLogger logr.Logger, tf *tfv1alpha1.Terraform, runOpts RunOptions) (err error) {
+func (r ReconcileTerraform) run(ctx context.Context, reqLogger logr.Logger, tf *tfv1alpha2.Terraform, runOpts RunOptions) (err error) {
 
 	n := len(tf.Status.Stages)
-	isNewGeneration := tf.Status.Stages[n-1].Reason == "GENERATION_CHANGE"
+	isNewGeneration := isNewRunReason(tf.Status.Stages[n-1].Reason)
 	isFirstInstall := tf.Status.Stages[n-1].Reason == "TF_RESOURCE_CREATED"
 
 	if isFirstInstall || isNewGeneration {
@@ -2104,6 +2390,14 @@ func (r ReconcileTerraform) run(ctx context.Context, reqLogger logr.Logger, tf *
 			return err
 		}
 
+		if err := r.createSourcesSecret(ctx, tf, runOpts); err != nil {
+			return err
+		}
+
+		if err := r.createModuleConfigMap(ctx, tf, runOpts); err != nil {
+			return err
+		}
+
 		if err := r.createConfigMap(ctx, tf, runOpts); err != nil {
 			return err
 		}
@@ -2184,7 +2478,7 @@ func (r ReconcileTerraform) run(ctx context.Context, reqLogger logr.Logger, tf *
 	// TODO recreate resources for new inits podTypes
 	//
 	// createResources := false
-	// if podType == tfv1alpha1.PodInit || podType == tfv1alpha1.PodInitDelete {
+	// if podType == tfv1alpha2.PodInit || podType == tfv1alpha2.PodInitDelete {
 	// 	createResources = true
 	// }
 	// _ = createResources
@@ -2245,24 +2539,6 @@ func (r ReconcileTerraform) run(ctx context.Context, reqLogger logr.Logger, tf *
 	return nil
 }
 
-func (r ReconcileTerraform) createGitAskpass(ctx context.Context, tokenSecret tfv1alpha1.TokenSecretRef) ([]byte, error) {
-	gitAskpass := []byte{}
-	secret, err := r.loadSecret(ctx, tokenSecret.Name, tokenSecret.Namespace)
-	if err != nil {
-		return []byte{}, err
-	}
-	if key, ok := secret.Data[tokenSecret.Key]; !ok {
-		return []byte{}, fmt.Errorf("secret '%s' did not contain '%s'", secret.Name, key)
-	}
-	s := heredoc.Docf(`
-		#!/bin/sh
-		exec echo "%s"
-	`, secret.Data[tokenSecret.Key])
-	gitAskpass = []byte(s)
-	return gitAskpass, nil
-
-}
-
 func (r ReconcileTerraform) loadSecret(ctx context.Context, name, namespace string) (*corev1.Secret, error) {
 	if namespace == "" {
 		namespace = "default"
@@ -2277,20 +2553,39 @@ func (r ReconcileTerraform) loadSecret(ctx context.Context, name, namespace stri
 	return secret, nil
 }
 
-func newGitRepoAccessOptionsFromSpec(instance *tfv1alpha1.Terraform, address string, extras []string) (GitRepoAccessOptions, error) {
+// repoDirPrefix is the prefix of the temp directories repos are downloaded to
+const repoDirPrefix = "repo"
+
+// RemoveStaleRepoDirs removes the temp directories of downloads that were
+// left behind, eg by a previous operator process that was killed
+func RemoveStaleRepoDirs() error {
+	dirs, err := filepath.Glob(filepath.Join(os.TempDir(), repoDirPrefix+"*"))
+	if err != nil {
+		return err
+	}
+	for _, dir := range dirs {
+		if info, err := os.Stat(dir); err == nil && info.IsDir() {
+			if err := os.RemoveAll(dir); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func newGitRepoAccessOptionsFromSpec(instance *tfv1alpha2.Terraform, address string, extras []string) (GitRepoAccessOptions, error) {
 	d := GitRepoAccessOptions{}
-	var sshProxyOptions tfv1alpha1.ProxyOpts
 
-	// var tfAuthOptions []tfv1alpha1.AuthOpts
+	// var tfAuthOptions []tfv1alpha2.AuthOpts
 
 	// TODO allow configmaps as a source. This has to be parsed differently
 	// before being passed to terraform's parsing mechanism
 
-	temp, err := ioutil.TempDir("", "repo")
+	// The caller removes the directory when it is done with the repo
+	temp, err := ioutil.TempDir("", repoDirPrefix)
 	if err != nil {
 		return d, fmt.Errorf("Unable to make directory: %v", err)
 	}
-	// defer os.RemoveAll(temp) // clean up
 
 	d = GitRepoAccessOptions{
 		Address:   address,
@@ -2298,48 +2593,16 @@ func newGitRepoAccessOptionsFromSpec(instance *tfv1alpha1.Terraform, address str
 		Directory: temp,
 	}
 	d.SCMAuthMethods = instance.Spec.SCMAuthMethods
-
-	if instance.Spec.SSHTunnel != nil {
-		sshProxyOptions = *instance.Spec.SSHTunnel
-	}
-	d.SSHProxy = sshProxyOptions
+	d.SSHProxy = instance.Spec.SSHTunnel
+	d.SSHTunnels = instance.Spec.SSHTunnels
 
 	return d, nil
 }
 
-func getHostKey(host string) (ssh.PublicKey, error) {
-	file, err := os.Open(filepath.Join(os.Getenv("HOME"), ".ssh", "known_hosts"))
-	if err != nil {
-		return nil, err
-	}
-	defer file.Close()
-
-	scanner := bufio.NewScanner(file)
-	var hostKey ssh.PublicKey
-	for scanner.Scan() {
-		fields := strings.Split(scanner.Text(), " ")
-		if len(fields) != 3 {
-			continue
-		}
-		if strings.Contains(fields[0], host) {
-			var err error
-			hostKey, _, _, _, err = ssh.ParseAuthorizedKey(scanner.Bytes())
-			if err != nil {
-				return nil, fmt.Errorf("error parsing %q: %v", fields[2], err)
-			}
-			break
-		}
-	}
-
-	if hostKey == nil {
-		return nil, fmt.Errorf("no hostkey for %s", host)
-	}
-	return hostKey, nil
-}
-
+// tfvarFiles merges the .tfvars files of the source. Errors are reported
+// with the file's path in the source.
 func (d GitRepoAccessOptions) tfvarFiles() (string, error) {
-	// dump contents of tfvar files into a var
-	tfvars := ""
+	files := []tfvarsFile{}
 
 	// TODO Should path definitions walk the path?
 	if utils.ListContainsStr(d.Extras, "is-file") {
@@ -2352,7 +2615,7 @@ func (d GitRepoAccessOptions) tfvarFiles() (string, error) {
 			if err != nil {
 				return "", fmt.Errorf("error reading file: %v", err)
 			}
-			tfvars += string(content) + "\n"
+			files = append(files, tfvarsFile{name: filename, content: string(content)})
 		}
 	} else if len(d.subdirs) > 0 {
 		for _, s := range d.subdirs {
@@ -2371,7 +2634,7 @@ func (d GitRepoAccessOptions) tfvarFiles() (string, error) {
 						return "", fmt.Errorf("error reading file: %v", err)
 					}
 
-					tfvars += string(content) + "\n"
+					files = append(files, tfvarsFile{name: filepath.Join(s, f.Name()), content: string(content)})
 				}
 			}
 		}
@@ -2390,12 +2653,11 @@ func (d GitRepoAccessOptions) tfvarFiles() (string, error) {
 					return "", fmt.Errorf("error reading file: %v", err)
 				}
 
-				tfvars += string(content) + "\n"
+				files = append(files, tfvarsFile{name: f.Name(), content: string(content)})
 			}
 		}
 	}
-	// TODO validate tfvars
-	return tfvars, nil
+	return mergeTfvars(files...)
 }
 
 // TODO combine this with the tfvars and make it a generic  get configs method
@@ -2422,6 +2684,10 @@ func (d GitRepoAccessOptions) otherConfigFiles() (map[string]string, error) {
 			}
 
 			for _, f := range lsdir {
+				// Nested directories, eg .git, are not config files
+				if f.IsDir() {
+					continue
+				}
 
 				file := filepath.Join(subdir, f.Name())
 
@@ -2441,6 +2707,10 @@ func (d GitRepoAccessOptions) otherConfigFiles() (map[string]string, error) {
 		}
 
 		for _, f := range lsdir {
+			// Nested directories, eg .git, are not config files
+			if f.IsDir() {
+				continue
+			}
 
 			file := filepath.Join(d.Directory, f.Name())
 
@@ -2457,38 +2727,6 @@ func (d GitRepoAccessOptions) otherConfigFiles() (map[string]string, error) {
 	return configFiles, nil
 }
 
-// downloadFromSource will downlaod the files locally. It will also download
-// tf modules locally if the user opts to. TF module downloading
-// is probably going to be used in the event that go-getter cannot fetch the
-// modules, perhaps becuase of a firewall. Check for proxy settings to send
-// to the download command.
-func downloadFromSource(src, moduleDir string) error {
-
-	// Check for global proxy
-
-	ds := getter.Detectors
-	output, err := getter.Detect(src, moduleDir, ds)
-	if err != nil {
-		return fmt.Errorf("Could not Detect source: %v", err)
-	}
-
-	if strings.HasPrefix(output, "git::") {
-		// send to gitSource
-		return fmt.Errorf("There isn't an error, reading output as %v", output)
-	} else if strings.HasPrefix(output, "https://") {
-		return fmt.Errorf("downloadFromSource does not yet support http(s)")
-	} else if strings.HasPrefix(output, "file://") {
-		return fmt.Errorf("downloadFromSource does not yet support file")
-	} else if strings.HasPrefix(output, "s3::") {
-		return fmt.Errorf("downloadFromSource does not yet support s3")
-	}
-
-	// TODO If the total size of the stacks configmap is too large, it will have
-	// to uploaded else where.
-
-	return nil
-}
-
 func configureGitSSHString(user, host, port, uri string) string {
 	if !strings.HasPrefix(uri, "/") {
 		uri = "/" + uri
@@ -2591,6 +2829,39 @@ func tarBinaryData(fullpath, filename string) (map[string][]byte, error) {
 // 	return nil
 // }
 
+// moduleConfigMapName is the name of the configmap that holds the files of an
+// inline terraformModule
+func moduleConfigMapName(name string) string {
+	return name + "-module"
+}
+
+func (r RunOptions) generateModuleConfigMap() *corev1.ConfigMap {
+	return &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      moduleConfigMapName(r.name),
+			Namespace: r.namespace,
+		},
+		Data: r.moduleConfigMapData,
+	}
+}
+
+// sourcesSecretName is the name of the secret that holds the files of a
+// run's Secret sources
+func sourcesSecretName(name string) string {
+	return name + "-sources"
+}
+
+func (r RunOptions) generateSourcesSecret() *corev1.Secret {
+	return &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      sourcesSecretName(r.name),
+			Namespace: r.namespace,
+		},
+		Data: r.sourcesSecretData,
+		Type: corev1.SecretTypeOpaque,
+	}
+}
+
 func (r RunOptions) generateSecret() *corev1.Secret {
 	secretObject := &corev1.Secret{
 		ObjectMeta: metav1.ObjectMeta{
@@ -2768,6 +3039,15 @@ func untar(tarball, target string) error {
 	return nil
 }
 
+// checkoutPaths returns the paths of the repo that are checked out. nil
+// checks out the whole repo.
+func (d GitRepoAccessOptions) checkoutPaths() []string {
+	if !d.sparse {
+		return nil
+	}
+	return d.subdirs
+}
+
 func (d *GitRepoAccessOptions) download(ctx context.Context, k8sclient client.Client, namespace string) error {
 	// This function only supports git modules. There's no explicit check
 	// for this yet.
@@ -2782,20 +3062,32 @@ func (d *GitRepoAccessOptions) download(ctx context.Context, k8sclient client.Cl
 			return fmt.Errorf("Download failed for '%s': %v", d.repo, err)
 		}
 		defer os.Remove(filename)
-		gitRepo, err = gitclient.GitSSHDownload(d.repo, d.Directory, filename, d.hash, reqLogger)
+		hostKeyCallback, err := d.gitHostKeyCallback(ctx, k8sclient, namespace)
+		if err != nil {
+			return fmt.Errorf("Download failed for '%s': %v", d.repo, err)
+		}
+		if d.mirrors != nil {
+			gitRepo, err = d.mirrors.MirrorSSHDownload(ctx, d.repo, d.Directory, filename, d.hash, d.checkoutPaths(), hostKeyCallback)
+		} else {
+			gitRepo, err = gitclient.GitSSHDownload(d.repo, d.Directory, filename, d.hash, d.checkoutPaths(), hostKeyCallback, reqLogger)
+		}
 		if err != nil {
 			return fmt.Errorf("Download failed for '%s': %v", d.repo, err)
 		}
 	} else {
 		// TODO find out and support any other protocols
 		// Just assume http is the only other protocol for now
-		token, err := d.getGitToken(ctx, k8sclient, namespace, d.protocol, reqLogger)
+		user, token, err := d.getGitToken(ctx, k8sclient, namespace, d.protocol, reqLogger)
 		if err != nil {
 			// Maybe we don't need to exit if no creds are used here
 			reqLogger.Info(fmt.Sprintf("%v", err))
 		}
 
-		gitRepo, err = gitclient.GitHTTPDownload(d.repo, d.Directory, "git", token, d.hash)
+		if d.mirrors != nil {
+			gitRepo, err = d.mirrors.MirrorHTTPDownload(ctx, d.repo, d.Directory, user, token, d.hash, d.checkoutPaths(), d.httpProxy)
+		} else {
+			gitRepo, err = gitclient.GitHTTPDownload(d.repo, d.Directory, user, token, d.hash, d.checkoutPaths(), d.httpProxy)
+		}
 		if err != nil {
 			return fmt.Errorf("Download failed for '%s': %v", d.repo, err)
 		}
@@ -2809,125 +3101,47 @@ func (d *GitRepoAccessOptions) download(ctx context.Context, k8sclient client.Cl
 		return err
 	}
 	reqLogger.Info(fmt.Sprintf("Hash: %v", d.hash))
-	return nil
-}
-
-func (d *GitRepoAccessOptions) startHTTPSProxy(ctx context.Context, k8sclient client.Client, namespace string, reqLogger logr.Logger) error {
-	proxyAuthMethod, err := d.getProxyAuthMethod(ctx, k8sclient, namespace)
-	if err != nil {
-		return fmt.Errorf("Error getting proxyAuthMethod: %v", err)
-	}
-
-	reqLogger.V(1).Info("Setting up http proxy")
-	proxyServer := ""
-	if strings.Contains(d.host, ":") {
-		proxyServer = d.SSHProxy.Host
-	} else {
-		// fmt.Sprintf("%s:22", d.SSHProxy.Host)
-	}
-
-	hostKey := goSocks5.NewHostKey()
-	duration := time.Duration(60 * time.Second)
-	socks5Proxy := goSocks5.NewSocks5Proxy(hostKey, nil, duration)
-
-	err = socks5Proxy.Start(d.SSHProxy.User, proxyServer, proxyAuthMethod)
-	if err != nil {
-		return fmt.Errorf("unable to start socks5: %v", err)
-	}
-	time.Sleep(100 * time.Millisecond)
-
-	socks5Addr, err := socks5Proxy.Addr()
-	if err != nil {
-		return fmt.Errorf("unable to get socks5Addr: %v", err)
-	}
-
-	dialer, err := proxy.SOCKS5("tcp", socks5Addr, nil, proxy.Direct)
-	if err != nil {
-		return fmt.Errorf("unable to get dialer: %v", err)
+	if d.mirrors != nil {
+		if err := d.mirrors.Evict(); err != nil {
+			reqLogger.Error(err, "unable to evict git mirrors")
+		}
 	}
-
-	httpTransport := &http.Transport{Dial: dialer.Dial}
-	// set our socks5 as the dialer
-	// httpTransport.Dial = dialer.Dial
-	httpClient := &http.Client{Transport: httpTransport}
-
-	gitTransportClient.InstallProtocol("http", githttp.NewClient(httpClient))
-	gitTransportClient.InstallProtocol("https", githttp.NewClient(httpClient))
 	return nil
 }
 
-func (d *GitRepoAccessOptions) startSSHProxy(ctx context.Context, k8sclient client.Client, namespace string, reqLogger logr.Logger) error {
-	uri := d.uri
+// resolveCommit finds the commit the address's ref points to without
+// downloading the repo
+func (d *GitRepoAccessOptions) resolveCommit(ctx context.Context, k8sclient client.Client, namespace string) (string, error) {
+	reqLogger := logf.WithValues("ResolveCommit", d.Address, "Namespace", namespace, "Function", "resolveCommit")
 
-	reqLogger.V(1).Info(fmt.Sprintf("Setting up ssh proxy for %s with job: %+v", namespace, d))
-	port, tunnel, err := d.setupSSHProxy(ctx, k8sclient, namespace)
+	// The proxy points the repo at a local port that is closed when this
+	// returns
+	repo := d.repo
+	defer func() { d.repo = repo }()
+	err := d.startProxy(ctx, k8sclient, namespace, reqLogger)
 	if err != nil {
-		return err
+		return "", err
 	}
+	defer d.TunnelClose(reqLogger.WithValues("Spec", "terraformModule"))
 
-	if os.Getenv("DEBUG_SSHTUNNEL") != "" {
-		tunnel.Log = log.New(os.Stdout, "", log.Ldate|log.Lmicroseconds)
-	}
-	d.tunnel = tunnel
-
-	if strings.Index(uri, "/") != 0 {
-		uri = "/" + uri
+	if d.protocol == "ssh" {
+		filename, err := d.getGitSSHKey(ctx, k8sclient, namespace, d.protocol, reqLogger)
+		if err != nil {
+			return "", fmt.Errorf("ls-remote failed for '%s': %v", d.repo, err)
+		}
+		defer os.Remove(filename)
+		hostKeyCallback, err := d.gitHostKeyCallback(ctx, k8sclient, namespace)
+		if err != nil {
+			return "", fmt.Errorf("ls-remote failed for '%s': %v", d.repo, err)
+		}
+		return gitclient.GitSSHResolveRef(d.repo, filename, d.hash, hostKeyCallback)
 	}
-	reqLogger.V(1).Info("SSH proxy is ready for usage")
-	// configure auth with go git options
-	d.repo = fmt.Sprintf("ssh://%s@127.0.0.1:%s%s", d.user, port, uri)
-	return nil
-
-}
-
-func (d *GitRepoAccessOptions) setupSSHProxy(ctx context.Context, k8sclient client.Client, namespace string) (string, *sshtunnel.SSHTunnel, error) {
-	var port string
-	var tunnel *sshtunnel.SSHTunnel
-	proxyAuthMethod, err := d.getProxyAuthMethod(ctx, k8sclient, namespace)
+	user, token, err := d.getGitToken(ctx, k8sclient, namespace, d.protocol, reqLogger)
 	if err != nil {
-		return port, tunnel, fmt.Errorf("Error getting proxyAuthMethod: %v", err)
-	}
-	proxyServerWithUser := fmt.Sprintf("%s@%s", d.SSHProxy.User, d.SSHProxy.Host)
-	destination := ""
-	if strings.Contains(d.host, ":") {
-		destination = d.host
-	} else {
-		destination = fmt.Sprintf("%s:%s", d.host, d.port)
+		// Public repos do not need a token
+		reqLogger.V(1).Info(fmt.Sprintf("%v", err))
 	}
-
-	// Setup the tunnel, but do not yet start it yet.
-	// // User and host of tunnel server, it will default to port 22
-	// // if not specified.
-	// proxyServerWithUser,
-
-	// // Pick ONE of the following authentication methods:
-	// // sshtunnel.PrivateKeyFile(filepath.Join(os.Getenv("HOME"), ".ssh", "id_rsa")), // 1. private key
-	// proxyAuthMethod,
-
-	// // The destination host and port of the actual server.
-	// destination,
-	tunnel = sshtunnel.NewSSHTunnel(proxyServerWithUser, proxyAuthMethod, destination, "0")
-
-	// NewSSHTunnel will bind to a random port so that you can have
-	// multiple SSH tunnels available. The port is available through:
-	//   tunnel.Local.Port
-
-	// You can use any normal Go code to connect to the destination server
-	// through localhost. You may need to use 127.0.0.1 for some libraries.
-
-	// You can provide a logger for debugging, or remove this line to
-	// make it silent.
-	// tunnel.Log = log.New(os.Stdout, "", log.Ldate|log.Lmicroseconds)
-	// reqLogger.Info(tunnel.Log)
-
-	// Start the server in the background. You will need to wait a
-	// small amount of time for it to bind to the localhost port
-	// before you can start sending connections.
-	go tunnel.Start()
-	time.Sleep(1000 * time.Millisecond)
-	port = strconv.Itoa(tunnel.Local.Port)
-
-	return port, tunnel, nil
+	return gitclient.GitHTTPResolveRef(d.repo, user, token, d.hash, d.httpProxy)
 }
 
 func (d *GitRepoAccessOptions) getParsedAddress() error {
@@ -2991,30 +3205,6 @@ func (d *GitRepoAccessOptions) getParsedAddress() error {
 	return nil
 }
 
-func (d GitRepoAccessOptions) getProxyAuthMethod(ctx context.Context, k8sclient client.Client, namespace string) (ssh.AuthMethod, error) {
-	var proxyAuthMethod ssh.AuthMethod
-
-	name := d.SSHProxy.SSHKeySecretRef.Name
-	key := d.SSHProxy.SSHKeySecretRef.Key
-	if key == "" {
-		key = "id_rsa"
-	}
-	ns := d.SSHProxy.SSHKeySecretRef.Namespace
-	if ns == "" {
-		ns = namespace
-	}
-
-	sshKey, err := loadPrivateKey(ctx, k8sclient, key, name, ns)
-	if err != nil {
-		return proxyAuthMethod, fmt.Errorf("unable to get privkey: %v", err)
-	}
-	defer os.Remove(sshKey.Name())
-	defer sshKey.Close()
-	proxyAuthMethod = sshtunnel.PrivateKeyFile(sshKey.Name())
-
-	return proxyAuthMethod, nil
-}
-
 func (d *GitRepoAccessOptions) getGitSSHKey(ctx context.Context, k8sclient client.Client, namespace, protocol string, reqLogger logr.Logger) (string, error) {
 	var filename string
 	for _, m := range d.SCMAuthMethods {
@@ -3043,11 +3233,22 @@ func (d *GitRepoAccessOptions) getGitSSHKey(ctx context.Context, k8sclient clien
 	return filename, nil
 }
 
-func (d *GitRepoAccessOptions) getGitToken(ctx context.Context, k8sclient client.Client, namespace, protocol string, reqLogger logr.Logger) (string, error) {
+// getGitToken returns the username and token of the SCMAuthMethod of the
+// repo's host. The token is an installation token when the method uses a
+// GitHub App.
+func (d *GitRepoAccessOptions) getGitToken(ctx context.Context, k8sclient client.Client, namespace, protocol string, reqLogger logr.Logger) (string, string, error) {
 	var token string
 	var err error
+	user := "git"
 	for _, m := range d.SCMAuthMethods {
-		if m.Host == d.ParsedAddress.host && m.Git.HTTPS != nil {
+		if m.Host == d.ParsedAddress.host && m.Git.HTTPS != nil && m.Git.HTTPS.GitHubApp != nil {
+			reqLogger.Info("Using Git over HTTPS with a GitHub App")
+			user = githubAppUser
+			token, err = githubAppToken(ctx, k8sclient, m.Git.HTTPS.GitHubApp, namespace)
+			if err != nil {
+				return user, token, fmt.Errorf("unable to get token: %v", err)
+			}
+		} else if m.Host == d.ParsedAddress.host && m.Git.HTTPS != nil {
 			reqLogger.Info("Using Git over HTTPS with a token")
 			name := m.Git.HTTPS.TokenSecretRef.Name
 			key := m.Git.HTTPS.TokenSecretRef.Key
@@ -3060,155 +3261,63 @@ func (d *GitRepoAccessOptions) getGitToken(ctx context.Context, k8sclient client
 			}
 			token, err = loadPassword(ctx, k8sclient, key, name, ns)
 			if err != nil {
-				return token, fmt.Errorf("unable to get token: %v", err)
+				return user, token, fmt.Errorf("unable to get token: %v", err)
 			}
 		}
 	}
 	if token == "" {
-		return token, fmt.Errorf("Failed to find Git token Key for %v\n", d.ParsedAddress.host)
+		return user, token, fmt.Errorf("Failed to find Git token Key for %v\n", d.ParsedAddress.host)
 	}
-	return token, nil
+	return user, token, nil
 }
 
-func (d GitRepoAccessOptions) commitTfvars(ctx context.Context, k8sclient client.Client, tfvars, tfvarsFile, confFile, namespace, customBackend string, runOpts RunOptions, reqLogger logr.Logger) {
+// commitTfvars pushes the tfvars and the backend config of the run to the
+// exportRepo. It returns what was exported, eg the url of the pull request.
+func (d GitRepoAccessOptions) commitTfvars(ctx context.Context, k8sclient client.Client, tf *tfv1alpha2.Terraform, tfvars, customBackend string, runOpts RunOptions, reqLogger logr.Logger) (string, error) {
+	defer os.RemoveAll(d.Directory)
+	e := tf.Spec.ExportRepo
+	namespace := tf.Namespace
+	tfvarsFile := e.TFVarsFile
+	confFile := e.ConfFile
 	filesToCommit := []string{}
 
+	base, head := exportBranches(tf, d.hash)
+	d.hash = base
+
 	reqLogger.V(1).Info("Setting up download options for export")
-	if (tfv1alpha1.ProxyOpts{}) != d.SSHProxy {
-		if strings.Contains(d.protocol, "http") {
-			err := d.startHTTPSProxy(ctx, k8sclient, namespace, reqLogger)
-			if err != nil {
-				reqLogger.Error(err, "failed to start ssh proxy")
-				return
-			}
-		} else if d.protocol == "ssh" {
-			err := d.startSSHProxy(ctx, k8sclient, namespace, reqLogger)
-			if err != nil {
-				reqLogger.Error(err, "failed to start ssh proxy")
-				return
-			}
-			defer d.TunnelClose(reqLogger.WithValues("Spec", "exportRepo"))
-		}
+	err := d.startProxy(ctx, k8sclient, namespace, reqLogger)
+	if err != nil {
+		return "", err
 	}
-	err := d.download(ctx, k8sclient, namespace)
+	defer d.TunnelClose(reqLogger.WithValues("Spec", "exportRepo"))
+	err = d.download(ctx, k8sclient, namespace)
 	if err != nil {
-		errString := fmt.Sprintf("Could not download repo %v", err)
-		reqLogger.Info(errString)
-		return
+		return "", fmt.Errorf("Could not download repo %v", err)
 	}
 
 	// Create a file in the external repo
 	err = d.Client.CheckoutBranch("")
 	if err != nil {
-		errString := fmt.Sprintf("Could not check out new branch %v", err)
-		reqLogger.Info(errString)
-		return
+		return "", fmt.Errorf("Could not check out new branch %v", err)
 	}
 
 	// Format TFVars File
-	// First read in the tfvar file that gets created earlier. This tfvar
-	// file should have already concatenated all the tfvars found
-	// from the git repos
-	tfvarsFileContent := tfvars
-	for _, i := range runOpts.envVars {
-		k := i.Name
-		v := i.Value
-		// TODO Attempt to resolve other kinds of TF_VAR_ values via
-		// 		an EnvVarSource other than `Value`
-		if v == "" {
-			continue
-		}
-		if !strings.Contains(k, "TF_VAR") {
-			continue
-		}
-		k = strings.ReplaceAll(k, "TF_VAR_", "")
-		if string(v[0]) != "{" && string(v[0]) != "[" {
-			v = fmt.Sprintf("\"%s\"", v)
-		}
-		tfvarsFileContent = tfvarsFileContent + fmt.Sprintf("\n%s = %s", k, v)
-	}
-
-	// Remove Duplicates
-	// TODO replace this code with a more terraform native method of merging tfvars
-	var c bytes.Buffer
-	var currentKey string
-	var currentValue string
-	keyIndexer := make(map[string]string)
-	var openBrackets int
-	for _, line := range strings.Split(tfvarsFileContent, "\n") {
-		lineArr := strings.Split(line, "=")
-		// ignore blank lines
-		if strings.TrimSpace(lineArr[0]) == "" {
-			continue
-		}
-
-		if openBrackets > 0 {
-			currentValue += "\n" + strings.ReplaceAll(line, "\t", "  ")
-			// Check for more open brackets and close brackets
-			trimmedLine := strings.TrimSpace(line)
-			lastCharIdx := len(trimmedLine) - 1
-			lastChar := string(trimmedLine[lastCharIdx])
-			lastTwoChar := ""
-			if lastCharIdx > 0 {
-				lastTwoChar = string(trimmedLine[lastCharIdx-1:])
-			}
-
-			if lastChar == "{" || lastChar == "[" {
-				openBrackets++
-			} else if lastChar == "}" || lastChar == "]" || lastTwoChar == "}," || lastTwoChar == "]," {
-				openBrackets--
-			}
-			if openBrackets == 0 {
-				keyIndexer[currentKey] = currentValue
-			}
-			continue
-		}
-		currentKey = strings.TrimSpace(lineArr[0])
-
-		if len(lineArr) > 1 {
-			lastLineArrIdx := len(lineArr) - 1
-			trimmedLine := lineArr[lastLineArrIdx]
-			lastCharIdx := len(trimmedLine) - 1
-			lastChar := string(trimmedLine[lastCharIdx])
-			if lastChar == "{" || lastChar == "[" {
-				openBrackets++
-			}
-		} else {
-			errString := fmt.Sprintf("Error in parsing tfvars string: %s", line)
-			reqLogger.Info(errString)
-			return
-		}
-
-		currentValue = line
-		if openBrackets > 0 {
-			continue
-		}
-		keyIndexer[currentKey] = currentValue
-	}
-
-	keys := make([]string, 0, len(keyIndexer))
-	for k := range keyIndexer {
-		keys = append(keys, k)
-	}
-	sort.Strings(keys)
-	for _, k := range keys {
-		fmt.Fprintf(&c, "%s\n\n", keyIndexer[k])
-
+	// The tfvars have already been merged from the sources. The TF_VAR envs
+	// are merged under them.
+	content, err := mergeExportTfvars(runOpts.envVars, tfvars)
+	if err != nil {
+		return "", err
 	}
 
 	// Write HCL to file
 	// Create the path if not exists
 	err = os.MkdirAll(filepath.Dir(filepath.Join(d.Directory, tfvarsFile)), 0755)
 	if err != nil {
-		errString := fmt.Sprintf("Could not create path: %v", err)
-		reqLogger.Info(errString)
-		return
+		return "", fmt.Errorf("Could not create path: %v", err)
 	}
-	err = ioutil.WriteFile(filepath.Join(d.Directory, tfvarsFile), c.Bytes(), 0644)
+	err = ioutil.WriteFile(filepath.Join(d.Directory, tfvarsFile), []byte(content), 0644)
 	if err != nil {
-		errString := fmt.Sprintf("Could not write file %v", err)
-		reqLogger.Info(errString)
-		return
+		return "", fmt.Errorf("Could not write file %v", err)
 	}
 
 	// Write to file
@@ -3240,32 +3349,48 @@ func (d GitRepoAccessOptions) commitTfvars(ctx context.Context, k8sclient client
 		// Write to file
 		err = os.MkdirAll(filepath.Dir(filepath.Join(d.Directory, confFile)), 0755)
 		if err != nil {
-			errString := fmt.Sprintf("Could not create path: %v", err)
-			reqLogger.Info(errString)
-			return
+			return "", fmt.Errorf("Could not create path: %v", err)
 		}
 		err = ioutil.WriteFile(filepath.Join(d.Directory, confFile), []byte(confFileContent), 0644)
 		if err != nil {
-			errString := fmt.Sprintf("Could not write file %v", err)
-			reqLogger.Info(errString)
-			return
+			return "", fmt.Errorf("Could not write file %v", err)
 		}
 		filesToCommit = append(filesToCommit, confFile)
 	}
 
 	// Commit and push to repo
-	commitMsg := fmt.Sprintf("automatic update via terraform-operator\nupdates to:\n%s", strings.Join(filesToCommit, "\n"))
-	err = d.Client.Commit(filesToCommit, commitMsg)
-	if err != nil {
-		errString := fmt.Sprintf("Could not commit to repo %v", err)
-		reqLogger.V(1).Info(errString)
-		return
+	data := exportTemplateData{
+		Name:       tf.Name,
+		Namespace:  tf.Namespace,
+		Generation: tf.Generation,
+		Files:      filesToCommit,
 	}
-	err = d.Client.Push("refs/heads/master")
+	commitMsg, authorName, authorEmail, err := exportCommit(e, data)
 	if err != nil {
-		errString := fmt.Sprintf("Could not push to repo %v", err)
-		reqLogger.V(1).Info(errString)
-		return
+		return "", err
+	}
+	err = d.Client.CommitAs(filesToCommit, commitMsg, authorName, authorEmail)
+	if err == gitclient.ErrNoChanges {
+		return fmt.Sprintf("No changes to export to %s", base), nil
+	} else if err != nil {
+		return "", fmt.Errorf("Could not commit to repo %v", err)
+	}
+	if e.PullRequest == nil {
+		err = d.Client.Push(plumbing.NewBranchReferenceName(head))
+		if err != nil {
+			return "", fmt.Errorf("Could not push to repo %v", err)
+		}
+		return fmt.Sprintf("Exported to %s", head), nil
 	}
 
+	// The branch of the pull request only has the latest export
+	err = d.Client.ForcePush(plumbing.NewBranchReferenceName(head))
+	if err != nil {
+		return "", fmt.Errorf("Could not push to repo %v", err)
+	}
+	url, err := d.openPullRequest(ctx, k8sclient, e, namespace, head, base, commitMsg, data, reqLogger)
+	if err != nil {
+		return "", fmt.Errorf("Could not open pull request from %s into %s: %v", head, base, err)
+	}
+	return fmt.Sprintf("Exported to pull request %s", url), nil
 }
@@ -20,7 +20,7 @@ import (
 	"context"
 	"time"
 
-	tfv1alpha1 "github.com/isaaguilar/terraform-operator/pkg/apis/tf/v1alpha1"
+	tfv1alpha2 "github.com/isaaguilar/terraform-operator/pkg/apis/tf/v1alpha2"
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
 	batchv1 "k8s.io/api/batch/v1"
@@ -49,13 +49,13 @@ var _ = Describe("Terraform controller", func() {
 			By("By creating a new Terraform")
 			ctx := context.Background()
 
-			terraform := tfv1alpha1.Terraform{
+			terraform := tfv1alpha2.Terraform{
 				ObjectMeta: metav1.ObjectMeta{
 					Name:      TerraformName,
 					Namespace: TerraformNamespace,
 				},
-				Spec: tfv1alpha1.TerraformSpec{
-					TerraformModule: &tfv1alpha1.SrcOpts{
+				Spec: tfv1alpha2.TerraformSpec{
+					TerraformModule: &tfv1alpha2.SrcOpts{
 						Address: "https://github.com/cloudposse/terraform-example-module.git?ref=master",
 					},
 					ApplyOnCreate: true,
@@ -64,7 +64,7 @@ var _ = Describe("Terraform controller", func() {
 			Expect(k8sClient.Create(ctx, &terraform)).Should(Succeed())
 
 			terraformLookupKey := types.NamespacedName{Name: TerraformName, Namespace: TerraformNamespace}
-			createdTerraform := &tfv1alpha1.Terraform{}
+			createdTerraform := &tfv1alpha2.Terraform{}
 
 			Eventually(func() bool {
 				err := k8sClient.Get(ctx, terraformLookupKey, createdTerraform)
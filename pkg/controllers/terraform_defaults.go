@@ -0,0 +1,178 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	tfv1alpha2 "github.com/isaaguilar/terraform-operator/pkg/apis/tf/v1alpha2"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// getTerraformDefaults returns the TerraformDefaults of the namespace or nil
+// when there is none. When there are more than one, which the validating
+// webhook prevents, the oldest is used.
+func getTerraformDefaults(ctx context.Context, c client.Reader, namespace string) (*tfv1alpha2.TerraformDefaults, error) {
+	list := &tfv1alpha2.TerraformDefaultsList{}
+	err := c.List(ctx, list, client.InNamespace(namespace))
+	if err != nil {
+		return nil, fmt.Errorf("unable to list terraformdefaults: %v", err)
+	}
+	if len(list.Items) == 0 {
+		return nil, nil
+	}
+	sort.Slice(list.Items, func(i, j int) bool {
+		a, b := list.Items[i], list.Items[j]
+		if a.CreationTimestamp.Equal(&b.CreationTimestamp) {
+			return a.Name < b.Name
+		}
+		return a.CreationTimestamp.Before(&b.CreationTimestamp)
+	})
+	return &list.Items[0], nil
+}
+
+// applyTerraformDefaults merges the namespace's TerraformDefaults into the
+// spec and records the merged values in the status. The spec is only changed
+// in memory and must not be written back. Returns true when the status was
+// modified and needs to be updated.
+func (r ReconcileTerraform) applyTerraformDefaults(ctx context.Context, tf *tfv1alpha2.Terraform) (bool, error) {
+	defaults, err := getTerraformDefaults(ctx, r.Client, tf.Namespace)
+	if err != nil {
+		return false, err
+	}
+	var merged *tfv1alpha2.MergedDefaults
+	if defaults != nil {
+		mergeDefaults(&tf.Spec, defaults.Spec)
+		merged = &tfv1alpha2.MergedDefaults{
+			Name: defaults.Name,
+			Spec: defaultedFields(tf.Spec),
+		}
+	}
+	if equality.Semantic.DeepEqual(tf.Status.MergedDefaults, merged) {
+		return false, nil
+	}
+	tf.Status.MergedDefaults = merged
+	return true, nil
+}
+
+// mergeDefaults fills the spec with the defaults. Values in the spec take
+// precedence. Credentials of the defaults come first, env is merged by name
+// and scmAuthMethods by host.
+func mergeDefaults(spec *tfv1alpha2.TerraformSpec, defaults tfv1alpha2.TerraformDefaultsSpec) {
+	mergeRunnerDefaults(spec, defaults)
+
+	if len(defaults.Credentials) > 0 {
+		credentials := append([]tfv1alpha2.Credentials{}, defaults.Credentials...)
+		spec.Credentials = append(credentials, spec.Credentials...)
+	}
+
+	env := []corev1.EnvVar{}
+	for _, d := range defaults.Env {
+		found := false
+		for _, e := range spec.Env {
+			if e.Name == d.Name {
+				found = true
+			}
+		}
+		if !found {
+			env = append(env, d)
+		}
+	}
+	if len(env) > 0 {
+		spec.Env = append(env, spec.Env...)
+	}
+
+	methods := []tfv1alpha2.SCMAuthMethod{}
+	for _, d := range defaults.SCMAuthMethods {
+		found := false
+		for _, m := range spec.SCMAuthMethods {
+			if m.Host == d.Host {
+				found = true
+			}
+		}
+		if !found {
+			methods = append(methods, d)
+		}
+	}
+	if len(methods) > 0 {
+		spec.SCMAuthMethods = append(spec.SCMAuthMethods, methods...)
+	}
+
+	if spec.SSHTunnel == nil && defaults.SSHTunnel != nil {
+		spec.SSHTunnel = defaults.SSHTunnel.DeepCopy()
+	}
+	if spec.HTTPProxy == nil && defaults.HTTPProxy != nil {
+		proxy := *defaults.HTTPProxy
+		spec.HTTPProxy = &proxy
+	}
+	if spec.CustomBackend == "" {
+		spec.CustomBackend = defaults.CustomBackend
+	}
+}
+
+// mergeRunnerDefaults fills the empty runner fields of the spec with the
+// defaults
+func mergeRunnerDefaults(spec *tfv1alpha2.TerraformSpec, defaults tfv1alpha2.TerraformDefaultsSpec) {
+	for _, f := range []struct {
+		value        *string
+		defaultValue string
+	}{
+		{&spec.TerraformRunner, defaults.TerraformRunner},
+		{(*string)(&spec.TerraformRunnerPullPolicy), string(defaults.TerraformRunnerPullPolicy)},
+		{&spec.TerraformVersion, defaults.TerraformVersion},
+		{&spec.ScriptRunner, defaults.ScriptRunner},
+		{(*string)(&spec.ScriptRunnerPullPolicy), string(defaults.ScriptRunnerPullPolicy)},
+		{&spec.ScriptRunnerVersion, defaults.ScriptRunnerVersion},
+		{&spec.SetupRunner, defaults.SetupRunner},
+		{(*string)(&spec.SetupRunnerPullPolicy), string(defaults.SetupRunnerPullPolicy)},
+		{&spec.SetupRunnerVersion, defaults.SetupRunnerVersion},
+	} {
+		if *f.value == "" {
+			*f.value = f.defaultValue
+		}
+	}
+}
+
+// defaultedFields returns the fields of the spec that TerraformDefaults
+// supplies
+func defaultedFields(spec tfv1alpha2.TerraformSpec) tfv1alpha2.TerraformDefaultsSpec {
+	return tfv1alpha2.TerraformDefaultsSpec{
+		Credentials:               spec.Credentials,
+		Env:                       spec.Env,
+		SCMAuthMethods:            spec.SCMAuthMethods,
+		SSHTunnel:                 spec.SSHTunnel,
+		HTTPProxy:                 spec.HTTPProxy,
+		CustomBackend:             spec.CustomBackend,
+		TerraformVersion:          spec.TerraformVersion,
+		TerraformRunner:           spec.TerraformRunner,
+		TerraformRunnerPullPolicy: spec.TerraformRunnerPullPolicy,
+		ScriptRunner:              spec.ScriptRunner,
+		ScriptRunnerPullPolicy:    spec.ScriptRunnerPullPolicy,
+		ScriptRunnerVersion:       spec.ScriptRunnerVersion,
+		SetupRunner:               spec.SetupRunner,
+		SetupRunnerPullPolicy:     spec.SetupRunnerPullPolicy,
+		SetupRunnerVersion:        spec.SetupRunnerVersion,
+	}
+}
+
+// terraformsInNamespace maps a TerraformDefaults to the tf resources of its
+// namespace so their merged defaults get updated
+func (r *ReconcileTerraform) terraformsInNamespace(obj client.Object) []reconcile.Request {
+	tfs := &tfv1alpha2.TerraformList{}
+	err := r.Client.List(context.TODO(), tfs, client.InNamespace(obj.GetNamespace()))
+	if err != nil {
+		r.Log.Error(err, "unable to list terraform resources")
+		return nil
+	}
+	requests := []reconcile.Request{}
+	for _, tf := range tfs.Items {
+		requests = append(requests, reconcile.Request{
+			NamespacedName: types.NamespacedName{Name: tf.Name, Namespace: tf.Namespace},
+		})
+	}
+	return requests
+}
@@ -0,0 +1,76 @@
+package controllers
+
+import (
+	tfv1alpha2 "github.com/isaaguilar/terraform-operator/pkg/apis/tf/v1alpha2"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+)
+
+var _ = Describe("TerraformDefaults", func() {
+
+	defaults := tfv1alpha2.TerraformDefaultsSpec{
+		Credentials: []tfv1alpha2.Credentials{
+			{SecretNameRef: tfv1alpha2.SecretNameRef{Name: "aws-credentials"}},
+		},
+		Env: []corev1.EnvVar{
+			{Name: "AWS_REGION", Value: "us-east-1"},
+			{Name: "TF_LOG", Value: "INFO"},
+		},
+		SCMAuthMethods: []tfv1alpha2.SCMAuthMethod{
+			{Host: "github.com", Git: &tfv1alpha2.GitSCM{HTTPS: &tfv1alpha2.GitHTTPS{TokenSecretRef: &tfv1alpha2.TokenSecretRef{Name: "default-token"}}}},
+			{Host: "gitlab.com", Git: &tfv1alpha2.GitSCM{HTTPS: &tfv1alpha2.GitHTTPS{TokenSecretRef: &tfv1alpha2.TokenSecretRef{Name: "gitlab-token"}}}},
+		},
+		SSHTunnel:       &tfv1alpha2.ProxyOpts{Host: "bastion.internal"},
+		HTTPProxy:       &tfv1alpha2.HTTPProxyOpts{SSHTunnel: true},
+		CustomBackend:   "terraform {}",
+		TerraformRunner: "registry.internal/tf-runner",
+	}
+
+	It("Should keep the values of the spec", func() {
+		spec := tfv1alpha2.TerraformSpec{
+			Credentials: []tfv1alpha2.Credentials{
+				{SecretNameRef: tfv1alpha2.SecretNameRef{Name: "team-credentials"}},
+			},
+			Env: []corev1.EnvVar{{Name: "TF_LOG", Value: "DEBUG"}},
+			SCMAuthMethods: []tfv1alpha2.SCMAuthMethod{
+				{Host: "github.com", Git: &tfv1alpha2.GitSCM{HTTPS: &tfv1alpha2.GitHTTPS{TokenSecretRef: &tfv1alpha2.TokenSecretRef{Name: "team-token"}}}},
+			},
+			TerraformRunner: "custom/tf-runner",
+		}
+		mergeDefaults(&spec, defaults)
+
+		Expect(spec.Credentials).To(HaveLen(2))
+		Expect(spec.Credentials[0].SecretNameRef.Name).To(Equal("aws-credentials"))
+		Expect(spec.Env).To(Equal([]corev1.EnvVar{
+			{Name: "AWS_REGION", Value: "us-east-1"},
+			{Name: "TF_LOG", Value: "DEBUG"},
+		}))
+		Expect(spec.SCMAuthMethods).To(HaveLen(2))
+		Expect(spec.SCMAuthMethods[0].Git.HTTPS.TokenSecretRef.Name).To(Equal("team-token"))
+		Expect(spec.SCMAuthMethods[1].Host).To(Equal("gitlab.com"))
+		Expect(spec.SSHTunnel.Host).To(Equal("bastion.internal"))
+		Expect(spec.HTTPProxy.SSHTunnel).To(BeTrue())
+		Expect(spec.CustomBackend).To(Equal("terraform {}"))
+		Expect(spec.TerraformRunner).To(Equal("custom/tf-runner"))
+	})
+
+	It("Should not modify the defaults", func() {
+		spec := tfv1alpha2.TerraformSpec{}
+		mergeDefaults(&spec, defaults)
+		spec.SSHTunnel.Host = "changed"
+		spec.Credentials[0].SecretNameRef.Name = "changed"
+		Expect(defaults.SSHTunnel.Host).To(Equal("bastion.internal"))
+		Expect(defaults.Credentials[0].SecretNameRef.Name).To(Equal("aws-credentials"))
+	})
+
+	It("Should reject invalid defaults", func() {
+		tfd := &tfv1alpha2.TerraformDefaults{
+			Spec: tfv1alpha2.TerraformDefaultsSpec{
+				SCMAuthMethods:         []tfv1alpha2.SCMAuthMethod{{Host: "github.com"}},
+				ScriptRunnerPullPolicy: "Sometimes",
+			},
+		}
+		Expect(validateTerraformDefaults(tfd)).To(HaveLen(2))
+	})
+})
@@ -0,0 +1,598 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"text/template"
+
+	tfv1alpha2 "github.com/isaaguilar/terraform-operator/pkg/apis/tf/v1alpha2"
+	"github.com/isaaguilar/terraform-operator/pkg/pullrequest"
+	"github.com/isaaguilar/terraform-operator/pkg/utils"
+	admissionv1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+// Paths where the admission handlers are served
+const (
+	ValidatingWebhookPath = "/validate-tf-isaaguilar-com-v1alpha2-terraform"
+	MutatingWebhookPath   = "/mutate-tf-isaaguilar-com-v1alpha2-terraform"
+
+	DefaultsValidatingWebhookPath = "/validate-tf-isaaguilar-com-v1alpha2-terraformdefaults"
+)
+
+// supportedProtocols are the address schemes the controller can download
+var supportedProtocols = []string{"ssh", "https", "http"}
+
+// TerraformValidator is an admission handler that rejects tf resources the
+// controller would fail to run
+type TerraformValidator struct {
+	decoder *admission.Decoder
+}
+
+// InjectDecoder is called by the webhook server to set the decoder
+func (v *TerraformValidator) InjectDecoder(d *admission.Decoder) error {
+	v.decoder = d
+	return nil
+}
+
+// Handle validates creates and updates of tf resources
+func (v *TerraformValidator) Handle(ctx context.Context, req admission.Request) admission.Response {
+	if req.Operation != admissionv1.Create && req.Operation != admissionv1.Update {
+		return admission.Allowed("")
+	}
+
+	tf := &tfv1alpha2.Terraform{}
+	err := v.decoder.Decode(req, tf)
+	if err != nil {
+		return admission.Errored(http.StatusBadRequest, err)
+	}
+	var old *tfv1alpha2.Terraform
+	if req.Operation == admissionv1.Update {
+		old = &tfv1alpha2.Terraform{}
+		err := v.decoder.DecodeRaw(req.OldObject, old)
+		if err != nil {
+			return admission.Errored(http.StatusBadRequest, err)
+		}
+	}
+	errs := validateTerraformRequest(old, tf)
+
+	if len(errs) > 0 {
+		return admission.Denied(errs.ToAggregate().Error())
+	}
+	return admission.Allowed("")
+}
+
+// validateTerraformRequest validates a create, when old is nil, or an update.
+// Updates that leave the spec alone, like the controller adding or removing
+// its finalizer, are allowed even if the spec would no longer pass, so that
+// resources created before a check was added can still be deleted.
+func validateTerraformRequest(old, tf *tfv1alpha2.Terraform) field.ErrorList {
+	if old == nil {
+		return validateTerraform(tf)
+	}
+	if tf.DeletionTimestamp != nil || equality.Semantic.DeepEqual(old.Spec, tf.Spec) {
+		return nil
+	}
+	return append(validateTerraform(tf), validateTerraformUpdate(old, tf)...)
+}
+
+// validateTerraform checks the spec for errors that would otherwise only be
+// found when the controller runs the resource
+func validateTerraform(tf *tfv1alpha2.Terraform) field.ErrorList {
+	var errs field.ErrorList
+	specPath := field.NewPath("spec")
+
+	errs = append(errs, validateTerraformModule(specPath.Child("terraformModule"), tf.Spec.TerraformModule)...)
+
+	for i, s := range tf.Spec.Sources {
+		errs = append(errs, validateSource(specPath.Child("sources").Index(i), s)...)
+	}
+
+	errs = append(errs, validateSCMAuthMethods(specPath.Child("scmAuthMethods"), tf.Spec.SCMAuthMethods)...)
+	errs = append(errs, validateSSHTunnel(specPath.Child("sshTunnel"), tf.Spec.SSHTunnel)...)
+	errs = append(errs, validateSSHTunnels(specPath.Child("sshTunnels"), tf.Spec.SSHTunnels)...)
+	errs = append(errs, validateSSHTunnelRefs(specPath, tf)...)
+	errs = append(errs, validateHTTPProxy(specPath.Child("httpProxy"), tf.Spec.HTTPProxy)...)
+	errs = append(errs, validateExportRepo(specPath.Child("exportRepo"), tf.Spec.ExportRepo)...)
+
+	for i, hook := range tf.Spec.Hooks {
+		errs = append(errs, validateHook(specPath.Child("hooks").Index(i), hook)...)
+	}
+
+	errs = append(errs, validatePullPolicy(specPath.Child("terraformRunnerPullPolicy"), tf.Spec.TerraformRunnerPullPolicy)...)
+	errs = append(errs, validatePullPolicy(specPath.Child("scriptRunnerPullPolicy"), tf.Spec.ScriptRunnerPullPolicy)...)
+	errs = append(errs, validatePullPolicy(specPath.Child("setupRunnerPullPolicy"), tf.Spec.SetupRunnerPullPolicy)...)
+
+	return errs
+}
+
+// validateTerraformModule checks that the module has exactly one of an
+// address or inline files and that the inline filenames can be configmap
+// keys
+func validateTerraformModule(path *field.Path, m *tfv1alpha2.SrcOpts) field.ErrorList {
+	var errs field.ErrorList
+	if m == nil || (m.Address == "" && len(m.Inline) == 0) {
+		return append(errs, field.Required(path.Child("address"), "one of address or inline must be set"))
+	}
+	if m.Address != "" && len(m.Inline) > 0 {
+		return append(errs, field.Invalid(path, "", "only one of address or inline can be set"))
+	}
+	if m.Address != "" {
+		return append(errs, validateAddress(path.Child("address"), m.Address)...)
+	}
+	names := []string{}
+	for name := range m.Inline {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		for _, msg := range validation.IsConfigMapKey(name) {
+			errs = append(errs, field.Invalid(path.Child("inline").Key(name), name, msg))
+		}
+	}
+	return errs
+}
+
+// validateSource checks that a source has exactly one of an address, a
+// configMap or a secret
+func validateSource(path *field.Path, s *tfv1alpha2.SrcOpts) field.ErrorList {
+	var errs field.ErrorList
+	if s == nil {
+		return append(errs, field.Required(path.Child("address"), ""))
+	}
+	set := 0
+	if s.Address != "" {
+		set++
+	}
+	if s.ConfigMap != nil {
+		set++
+		if s.ConfigMap.Name == "" {
+			errs = append(errs, field.Required(path.Child("configMap", "name"), ""))
+		}
+	}
+	if s.Secret != nil {
+		set++
+		if s.Secret.Name == "" {
+			errs = append(errs, field.Required(path.Child("secret", "name"), ""))
+		}
+	}
+	switch {
+	case set == 0:
+		errs = append(errs, field.Required(path.Child("address"), "one of address, configMap or secret must be set"))
+	case set > 1:
+		errs = append(errs, field.Invalid(path, "", "only one of address, configMap or secret can be set"))
+	case s.Address != "":
+		errs = append(errs, validateAddress(path.Child("address"), s.Address)...)
+	}
+	return errs
+}
+
+func validateSCMAuthMethods(path *field.Path, methods []tfv1alpha2.SCMAuthMethod) field.ErrorList {
+	var errs field.ErrorList
+	for i, m := range methods {
+		path := path.Index(i)
+		errs = append(errs, validateKnownHosts(path.Child("knownHosts"), m.KnownHosts)...)
+		if m.Git == nil || (m.Git.SSH == nil && m.Git.HTTPS == nil) {
+			errs = append(errs, field.Required(path.Child("git"), "one of git.ssh or git.https must be set"))
+			continue
+		}
+		if m.Git.SSH != nil && m.Git.SSH.SSHKeySecretRef == nil {
+			errs = append(errs, field.Required(path.Child("git", "ssh", "sshKeySecretRef"), ""))
+		}
+		if m.Git.HTTPS != nil {
+			errs = append(errs, validateGitHTTPS(path.Child("git", "https"), m.Git.HTTPS)...)
+		}
+	}
+	return errs
+}
+
+// validateGitHTTPS checks that https uses exactly one of a token or a GitHub
+// App
+func validateGitHTTPS(path *field.Path, https *tfv1alpha2.GitHTTPS) field.ErrorList {
+	var errs field.ErrorList
+	if (https.TokenSecretRef == nil) == (https.GitHubApp == nil) {
+		return append(errs, field.Required(path.Child("tokenSecretRef"), "exactly one of tokenSecretRef or githubApp must be set"))
+	}
+	if app := https.GitHubApp; app != nil {
+		if app.AppID <= 0 {
+			errs = append(errs, field.Required(path.Child("githubApp", "appID"), ""))
+		}
+		if app.InstallationID <= 0 {
+			errs = append(errs, field.Required(path.Child("githubApp", "installationID"), ""))
+		}
+		if app.PrivateKeySecretRef == nil || app.PrivateKeySecretRef.Name == "" {
+			errs = append(errs, field.Required(path.Child("githubApp", "privateKeySecretRef", "name"), ""))
+		}
+	}
+	return errs
+}
+
+// validateKnownHosts checks that the known_hosts are read from exactly one of
+// a secret or a configmap
+func validateKnownHosts(path *field.Path, knownHosts *tfv1alpha2.KnownHosts) field.ErrorList {
+	var errs field.ErrorList
+	if knownHosts == nil {
+		return errs
+	}
+	if (knownHosts.SecretRef == nil) == (knownHosts.ConfigMapRef == nil) {
+		return append(errs, field.Invalid(path, "", "exactly one of secretRef or configMapRef must be set"))
+	}
+	if knownHosts.SecretRef != nil && knownHosts.SecretRef.Name == "" {
+		errs = append(errs, field.Required(path.Child("secretRef", "name"), ""))
+	}
+	if knownHosts.ConfigMapRef != nil && knownHosts.ConfigMapRef.Name == "" {
+		errs = append(errs, field.Required(path.Child("configMapRef", "name"), ""))
+	}
+	return errs
+}
+
+// validateSSHTunnel checks the known_hosts of the tunnel and its jump hosts
+func validateSSHTunnel(path *field.Path, proxy *tfv1alpha2.ProxyOpts) field.ErrorList {
+	var errs field.ErrorList
+	if proxy == nil {
+		return errs
+	}
+	errs = append(errs, validateKnownHosts(path.Child("knownHosts"), proxy.KnownHosts)...)
+	for i, hop := range proxy.JumpHosts {
+		path := path.Child("jumpHosts").Index(i)
+		if hop.Host == "" {
+			errs = append(errs, field.Required(path.Child("host"), ""))
+		}
+		errs = append(errs, validateKnownHosts(path.Child("knownHosts"), hop.KnownHosts)...)
+	}
+	return errs
+}
+
+// validateSSHTunnels checks that each tunnel has a unique name that can be a
+// host alias in the runners' ssh config
+func validateSSHTunnels(path *field.Path, tunnels []tfv1alpha2.ProxyOpts) field.ErrorList {
+	var errs field.ErrorList
+	names := map[string]bool{}
+	for i, t := range tunnels {
+		path := path.Index(i)
+		switch {
+		case t.Name == "":
+			errs = append(errs, field.Required(path.Child("name"), ""))
+		case names[t.Name]:
+			errs = append(errs, field.Duplicate(path.Child("name"), t.Name))
+		default:
+			for _, msg := range validation.IsDNS1123Label(t.Name) {
+				errs = append(errs, field.Invalid(path.Child("name"), t.Name, msg))
+			}
+		}
+		names[t.Name] = true
+		errs = append(errs, validateSSHTunnel(path, &tunnels[i])...)
+	}
+	return errs
+}
+
+// validateSSHTunnelRefs checks that the tunnels the terraformModule, the
+// sources and the scmAuthMethods select are in sshTunnels
+func validateSSHTunnelRefs(specPath *field.Path, tf *tfv1alpha2.Terraform) field.ErrorList {
+	var errs field.ErrorList
+	names := map[string]bool{}
+	for _, t := range tf.Spec.SSHTunnels {
+		names[t.Name] = true
+	}
+	checkRef := func(path *field.Path, name string) {
+		if name != "" && !names[name] {
+			errs = append(errs, field.NotFound(path, name))
+		}
+	}
+	if tf.Spec.TerraformModule != nil {
+		checkRef(specPath.Child("terraformModule", "sshTunnel"), tf.Spec.TerraformModule.SSHTunnel)
+	}
+	for i, s := range tf.Spec.Sources {
+		if s != nil {
+			checkRef(specPath.Child("sources").Index(i).Child("sshTunnel"), s.SSHTunnel)
+		}
+	}
+	for i, m := range tf.Spec.SCMAuthMethods {
+		checkRef(specPath.Child("scmAuthMethods").Index(i).Child("sshTunnel"), m.SSHTunnel)
+	}
+	return errs
+}
+
+// validateHTTPProxy checks that the proxies are urls. The sshTunnel is not
+// required since it can come from the TerraformDefaults.
+func validateHTTPProxy(path *field.Path, proxy *tfv1alpha2.HTTPProxyOpts) field.ErrorList {
+	var errs field.ErrorList
+	if proxy == nil {
+		return errs
+	}
+	if proxy.SSHTunnel && proxy.HTTPSProxy != "" {
+		errs = append(errs, field.Invalid(path.Child("httpsProxy"), proxy.HTTPSProxy, "only one of httpsProxy or sshTunnel can be set"))
+	}
+	for name, value := range map[string]string{"httpsProxy": proxy.HTTPSProxy, "httpProxy": proxy.HTTPProxy} {
+		if value == "" {
+			continue
+		}
+		u, err := url.Parse(value)
+		if err != nil || u.Scheme == "" || u.Host == "" {
+			errs = append(errs, field.Invalid(path.Child(name), value, "must be a url, eg http://proxy.example.com:3128"))
+		}
+	}
+	return errs
+}
+
+// validateExportRepo checks the templates and the pull request provider of
+// the export
+func validateExportRepo(path *field.Path, e *tfv1alpha2.ExportRepo) field.ErrorList {
+	var errs field.ErrorList
+	if e == nil {
+		return errs
+	}
+	errs = append(errs, validateAddress(path.Child("address"), e.Address)...)
+	type exportTemplate struct {
+		path *field.Path
+		tmpl string
+	}
+	templates := []exportTemplate{{path.Child("commitMessage"), e.CommitMessage}}
+	if e.CommitAuthor != nil {
+		templates = append(templates,
+			exportTemplate{path.Child("commitAuthor", "name"), e.CommitAuthor.Name},
+			exportTemplate{path.Child("commitAuthor", "email"), e.CommitAuthor.Email})
+	}
+	if pr := e.PullRequest; pr != nil {
+		switch pr.Provider {
+		case pullrequest.GitHub, pullrequest.GitLab, pullrequest.Gitea:
+		default:
+			errs = append(errs, field.NotSupported(path.Child("pullRequest", "provider"), pr.Provider, []string{pullrequest.GitHub, pullrequest.GitLab, pullrequest.Gitea}))
+		}
+		if e.Branch != "" && e.Branch == pr.BaseBranch {
+			errs = append(errs, field.Invalid(path.Child("branch"), e.Branch, "must not be the pull request's baseBranch"))
+		}
+		templates = append(templates,
+			exportTemplate{path.Child("pullRequest", "title"), pr.Title},
+			exportTemplate{path.Child("pullRequest", "body"), pr.Body})
+	}
+	for _, t := range templates {
+		if _, err := template.New(t.path.String()).Parse(t.tmpl); err != nil {
+			errs = append(errs, field.Invalid(t.path, t.tmpl, err.Error()))
+		}
+	}
+	return errs
+}
+
+// validateAddress parses the address the same way the controller does
+func validateAddress(path *field.Path, address string) field.ErrorList {
+	var errs field.ErrorList
+	if isGetterAddress(address) {
+		if err := validateGetterAddress(address); err != nil {
+			errs = append(errs, field.Invalid(path, address, err.Error()))
+		}
+		return errs
+	}
+	d := GitRepoAccessOptions{Address: address}
+	err := d.getParsedAddress()
+	if err != nil {
+		return append(errs, field.Invalid(path, address, err.Error()))
+	}
+	if d.repo == "" {
+		return append(errs, field.Invalid(path, address, "unable to find a repo in the address"))
+	}
+	supported := false
+	for _, p := range supportedProtocols {
+		if d.protocol == p {
+			supported = true
+		}
+	}
+	if !supported {
+		errs = append(errs, field.Invalid(path, address, fmt.Sprintf("unsupported protocol '%s', supported protocols are %v", d.protocol, supportedProtocols)))
+	}
+	return errs
+}
+
+// validateHook checks the hook runs with a terraform stage and has exactly
+// one source for its script
+func validateHook(path *field.Path, hook tfv1alpha2.Hook) field.ErrorList {
+	var errs field.ErrorList
+	stages := []string{}
+	for _, stage := range postHookStages {
+		stages = append(stages, string(stage))
+	}
+	sort.Strings(stages)
+	if !utils.ListContainsStr(stages, string(hook.Stage)) {
+		errs = append(errs, field.NotSupported(path.Child("stage"), hook.Stage, stages))
+	}
+	if hook.When != tfv1alpha2.HookPre && hook.When != tfv1alpha2.HookPost {
+		errs = append(errs, field.NotSupported(path.Child("when"), hook.When, []string{string(tfv1alpha2.HookPre), string(tfv1alpha2.HookPost)}))
+	}
+	if hook.Script == "" && hook.ConfigMapRef == nil {
+		errs = append(errs, field.Required(path, "one of script or configMapRef must be set"))
+	}
+	if hook.Script != "" && hook.ConfigMapRef != nil {
+		errs = append(errs, field.Invalid(path.Child("configMapRef"), hook.ConfigMapRef.Name, "script and configMapRef are mutually exclusive"))
+	}
+	if hook.ConfigMapRef != nil && (hook.ConfigMapRef.Name == "" || hook.ConfigMapRef.Key == "") {
+		errs = append(errs, field.Required(path.Child("configMapRef"), "name and key must be set"))
+	}
+	return errs
+}
+
+func validatePullPolicy(path *field.Path, policy corev1.PullPolicy) field.ErrorList {
+	var errs field.ErrorList
+	switch policy {
+	case "", corev1.PullAlways, corev1.PullNever, corev1.PullIfNotPresent:
+	default:
+		errs = append(errs, field.NotSupported(path, policy, []string{
+			string(corev1.PullAlways), string(corev1.PullNever), string(corev1.PullIfNotPresent),
+		}))
+	}
+	return errs
+}
+
+// validateTerraformUpdate rejects spec changes while an apply is running.
+// The apply pod can not be interrupted, so the change would otherwise sit
+// unnoticed until the apply is done.
+func validateTerraformUpdate(old, tf *tfv1alpha2.Terraform) field.ErrorList {
+	var errs field.ErrorList
+	n := len(old.Status.Stages)
+	if n == 0 || equality.Semantic.DeepEqual(old.Spec, tf.Spec) {
+		return errs
+	}
+	currentStage := old.Status.Stages[n-1]
+	isApply := currentStage.PodType == tfv1alpha2.PodApply || currentStage.PodType == tfv1alpha2.PodApplyDelete
+	if isApply && currentStage.Interruptible == tfv1alpha2.CanNotBeInterrupt && currentStage.State == tfv1alpha2.StateInProgress {
+		errs = append(errs, field.Forbidden(field.NewPath("spec"), "the spec can not be changed while terraform apply is running"))
+	}
+	return errs
+}
+
+// TerraformDefaulter is an admission handler that writes the runner defaults
+// into the spec of new tf resources. The images and versions a resource runs
+// are then visible on the object and do not change when the operator is
+// upgraded.
+type TerraformDefaulter struct {
+	decoder *admission.Decoder
+
+	// Config holds the operator-wide defaults. The defaults are used when it
+	// is nil.
+	Config *OperatorConfigStore
+
+	// Client reads the namespace's TerraformDefaults. When nil, only the
+	// operator-wide defaults are used.
+	Client client.Reader
+}
+
+// InjectDecoder is called by the webhook server to set the decoder
+func (d *TerraformDefaulter) InjectDecoder(decoder *admission.Decoder) error {
+	d.decoder = decoder
+	return nil
+}
+
+// Handle defaults the spec of created tf resources
+func (d *TerraformDefaulter) Handle(ctx context.Context, req admission.Request) admission.Response {
+	if req.Operation != admissionv1.Create {
+		return admission.Allowed("")
+	}
+
+	tf := &tfv1alpha2.Terraform{}
+	err := d.decoder.Decode(req, tf)
+	if err != nil {
+		return admission.Errored(http.StatusBadRequest, err)
+	}
+	// The patch is made from the decoded object rather than the raw request
+	// so that only the defaulted fields end up in the patch
+	original, err := json.Marshal(tf)
+	if err != nil {
+		return admission.Errored(http.StatusInternalServerError, err)
+	}
+	if d.Client != nil {
+		defaults, err := getTerraformDefaults(ctx, d.Client, req.Namespace)
+		if err != nil {
+			return admission.Errored(http.StatusInternalServerError, err)
+		}
+		if defaults != nil {
+			mergeRunnerDefaults(&tf.Spec, defaults.Spec)
+		}
+	}
+	setRunnerDefaults(tf, d.Config.Get())
+	defaulted, err := json.Marshal(tf)
+	if err != nil {
+		return admission.Errored(http.StatusInternalServerError, err)
+	}
+	return admission.PatchResponseFromRaw(original, defaulted)
+}
+
+// setRunnerDefaults fills the empty runner fields with the values
+// newRunOptions would use
+func setRunnerDefaults(tf *tfv1alpha2.Terraform, config OperatorConfig) {
+	if tf.Spec.TerraformRunner == "" {
+		tf.Spec.TerraformRunner = config.TerraformRunner
+	}
+	if tf.Spec.TerraformRunnerPullPolicy == "" {
+		tf.Spec.TerraformRunnerPullPolicy = config.TerraformRunnerPullPolicy
+	}
+	if tf.Spec.TerraformVersion == "" {
+		tf.Spec.TerraformVersion = config.TerraformVersion
+	}
+
+	if tf.Spec.ScriptRunner == "" {
+		tf.Spec.ScriptRunner = config.ScriptRunner
+	}
+	if tf.Spec.ScriptRunnerPullPolicy == "" {
+		tf.Spec.ScriptRunnerPullPolicy = config.ScriptRunnerPullPolicy
+	}
+	if tf.Spec.ScriptRunnerVersion == "" {
+		tf.Spec.ScriptRunnerVersion = config.ScriptRunnerVersion
+	}
+
+	if tf.Spec.SetupRunner == "" {
+		tf.Spec.SetupRunner = config.SetupRunner
+	}
+	if tf.Spec.SetupRunnerPullPolicy == "" {
+		tf.Spec.SetupRunnerPullPolicy = config.SetupRunnerPullPolicy
+	}
+	if tf.Spec.SetupRunnerVersion == "" {
+		tf.Spec.SetupRunnerVersion = config.SetupRunnerVersion
+	}
+}
+
+// TerraformDefaultsValidator is an admission handler that only allows one
+// TerraformDefaults per namespace
+type TerraformDefaultsValidator struct {
+	decoder *admission.Decoder
+	Client  client.Reader
+}
+
+// InjectDecoder is called by the webhook server to set the decoder
+func (v *TerraformDefaultsValidator) InjectDecoder(d *admission.Decoder) error {
+	v.decoder = d
+	return nil
+}
+
+// Handle validates creates and updates of TerraformDefaults
+func (v *TerraformDefaultsValidator) Handle(ctx context.Context, req admission.Request) admission.Response {
+	if req.Operation != admissionv1.Create && req.Operation != admissionv1.Update {
+		return admission.Allowed("")
+	}
+
+	defaults := &tfv1alpha2.TerraformDefaults{}
+	err := v.decoder.Decode(req, defaults)
+	if err != nil {
+		return admission.Errored(http.StatusBadRequest, err)
+	}
+	errs := validateTerraformDefaults(defaults)
+
+	if req.Operation == admissionv1.Create {
+		list := &tfv1alpha2.TerraformDefaultsList{}
+		err := v.Client.List(ctx, list, client.InNamespace(req.Namespace))
+		if err != nil {
+			return admission.Errored(http.StatusInternalServerError, err)
+		}
+		for _, item := range list.Items {
+			if item.Name != req.Name {
+				errs = append(errs, field.Forbidden(field.NewPath("metadata", "name"), fmt.Sprintf("namespace already has TerraformDefaults '%s'", item.Name)))
+			}
+		}
+	}
+
+	if len(errs) > 0 {
+		return admission.Denied(errs.ToAggregate().Error())
+	}
+	return admission.Allowed("")
+}
+
+// validateTerraformDefaults checks the fields that are also validated on the
+// Terraform resources
+func validateTerraformDefaults(defaults *tfv1alpha2.TerraformDefaults) field.ErrorList {
+	var errs field.ErrorList
+	specPath := field.NewPath("spec")
+	errs = append(errs, validateSCMAuthMethods(specPath.Child("scmAuthMethods"), defaults.Spec.SCMAuthMethods)...)
+	errs = append(errs, validateSSHTunnel(specPath.Child("sshTunnel"), defaults.Spec.SSHTunnel)...)
+	errs = append(errs, validateHTTPProxy(specPath.Child("httpProxy"), defaults.Spec.HTTPProxy)...)
+	errs = append(errs, validatePullPolicy(specPath.Child("terraformRunnerPullPolicy"), defaults.Spec.TerraformRunnerPullPolicy)...)
+	errs = append(errs, validatePullPolicy(specPath.Child("scriptRunnerPullPolicy"), defaults.Spec.ScriptRunnerPullPolicy)...)
+	errs = append(errs, validatePullPolicy(specPath.Child("setupRunnerPullPolicy"), defaults.Spec.SetupRunnerPullPolicy)...)
+	return errs
+}
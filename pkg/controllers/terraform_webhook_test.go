@@ -0,0 +1,251 @@
+package controllers
+
+import (
+	tfv1alpha2 "github.com/isaaguilar/terraform-operator/pkg/apis/tf/v1alpha2"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+var _ = Describe("Terraform validating webhook", func() {
+
+	newTerraform := func() *tfv1alpha2.Terraform {
+		return &tfv1alpha2.Terraform{
+			Spec: tfv1alpha2.TerraformSpec{
+				TerraformModule: &tfv1alpha2.SrcOpts{
+					Address: "https://github.com/cloudposse/terraform-example-module.git?ref=master",
+				},
+				SCMAuthMethods: []tfv1alpha2.SCMAuthMethod{
+					{
+						Host: "github.com",
+						Git: &tfv1alpha2.GitSCM{
+							HTTPS: &tfv1alpha2.GitHTTPS{
+								TokenSecretRef: &tfv1alpha2.TokenSecretRef{Name: "gh-token"},
+							},
+						},
+					},
+				},
+			},
+		}
+	}
+
+	It("Should allow a valid spec", func() {
+		Expect(validateTerraform(newTerraform())).To(BeEmpty())
+	})
+
+	It("Should reject a missing terraformModule address", func() {
+		tf := newTerraform()
+		tf.Spec.TerraformModule = nil
+		Expect(validateTerraform(tf)).To(HaveLen(1))
+	})
+
+	It("Should allow an inline terraformModule", func() {
+		tf := newTerraform()
+		tf.Spec.TerraformModule.Inline = map[string]string{"main.tf": "resource \"null_resource\" \"this\" {}\n"}
+		Expect(validateTerraform(tf)).To(HaveLen(1))
+		tf.Spec.TerraformModule.Address = ""
+		Expect(validateTerraform(tf)).To(BeEmpty())
+		tf.Spec.TerraformModule.Inline["modules/main.tf"] = ""
+		Expect(validateTerraform(tf)).To(HaveLen(1))
+	})
+
+	It("Should reject an unsupported protocol", func() {
+		tf := newTerraform()
+		tf.Spec.TerraformModule.Address = "ftp://example.com/module.git"
+		Expect(validateTerraform(tf)).To(HaveLen(1))
+	})
+
+	It("Should allow go-getter addresses", func() {
+		tf := newTerraform()
+		tf.Spec.TerraformModule.Address = "s3::http://minio:9000/modules/vpc-1.0.0.zip"
+		Expect(validateTerraform(tf)).To(BeEmpty())
+		tf.Spec.TerraformModule.Address = "ftp::https://example.com/modules/vpc-1.0.0.zip"
+		Expect(validateTerraform(tf)).To(HaveLen(1))
+	})
+
+	It("Should reject sources without exactly one of address, configMap or secret", func() {
+		tf := newTerraform()
+		tf.Spec.Sources = []*tfv1alpha2.SrcOpts{
+			{ConfigMap: &tfv1alpha2.ConfigMapOpts{Name: "vars"}},
+			{Secret: &tfv1alpha2.SecretOpts{Name: "secret-vars", Keys: []string{"db.tfvars"}}},
+		}
+		Expect(validateTerraform(tf)).To(BeEmpty())
+		tf.Spec.Sources[0].Address = "https://github.com/isaaguilar/terraform-operator.git"
+		Expect(validateTerraform(tf)).To(HaveLen(1))
+		tf.Spec.Sources[0] = &tfv1alpha2.SrcOpts{}
+		Expect(validateTerraform(tf)).To(HaveLen(1))
+	})
+
+	It("Should reject an SCMAuthMethod without ssh or https", func() {
+		tf := newTerraform()
+		tf.Spec.SCMAuthMethods[0].Git.HTTPS = nil
+		Expect(validateTerraform(tf)).To(HaveLen(1))
+	})
+
+	It("Should reject knownHosts without exactly one of secretRef or configMapRef", func() {
+		tf := newTerraform()
+		tf.Spec.SCMAuthMethods[0].KnownHosts = &tfv1alpha2.KnownHosts{
+			ConfigMapRef: &tfv1alpha2.KnownHostsRef{Name: "known-hosts"},
+			Strict:       true,
+		}
+		Expect(validateTerraform(tf)).To(BeEmpty())
+		tf.Spec.SCMAuthMethods[0].KnownHosts.SecretRef = &tfv1alpha2.KnownHostsRef{Name: "known-hosts"}
+		Expect(validateTerraform(tf)).To(HaveLen(1))
+		tf.Spec.SSHTunnel = &tfv1alpha2.ProxyOpts{Host: "bastion", KnownHosts: &tfv1alpha2.KnownHosts{}}
+		Expect(validateTerraform(tf)).To(HaveLen(2))
+	})
+
+	It("Should reject https without exactly one of a token or a GitHub App", func() {
+		tf := newTerraform()
+		tf.Spec.SCMAuthMethods[0].Git.HTTPS.GitHubApp = &tfv1alpha2.GitHubApp{
+			AppID:               7,
+			InstallationID:      42,
+			PrivateKeySecretRef: &tfv1alpha2.TokenSecretRef{Name: "github-app"},
+		}
+		Expect(validateTerraform(tf)).To(HaveLen(1))
+		tf.Spec.SCMAuthMethods[0].Git.HTTPS.TokenSecretRef = nil
+		Expect(validateTerraform(tf)).To(BeEmpty())
+		tf.Spec.SCMAuthMethods[0].Git.HTTPS.GitHubApp.InstallationID = 0
+		Expect(validateTerraform(tf)).To(HaveLen(1))
+	})
+
+	It("Should reject sshTunnels without a unique name or that are not defined", func() {
+		tf := newTerraform()
+		tf.Spec.SSHTunnels = []tfv1alpha2.ProxyOpts{
+			{Name: "modules", Host: "bastion-a", JumpHosts: []tfv1alpha2.JumpHost{{Host: "edge"}}},
+			{Name: "tfvars", Host: "bastion-b"},
+		}
+		tf.Spec.TerraformModule.SSHTunnel = "modules"
+		tf.Spec.Sources = []*tfv1alpha2.SrcOpts{{Address: "https://github.com/org/tfvars.git", SSHTunnel: "tfvars"}}
+		Expect(validateTerraform(tf)).To(BeEmpty())
+
+		tf.Spec.SCMAuthMethods[0].SSHTunnel = "other"
+		Expect(validateTerraform(tf)).To(HaveLen(1))
+		tf.Spec.SSHTunnels[1].Name = "modules"
+		Expect(validateTerraform(tf)).To(HaveLen(3))
+		tf.Spec.SSHTunnels[1].Name = "Tf_Vars"
+		Expect(validateTerraform(tf)).To(HaveLen(3))
+		tf.Spec.SSHTunnels[0].JumpHosts[0].Host = ""
+		Expect(validateTerraform(tf)).To(HaveLen(4))
+	})
+
+	It("Should reject an exportRepo with a bad template or pull request provider", func() {
+		tf := newTerraform()
+		tf.Spec.ExportRepo = &tfv1alpha2.ExportRepo{
+			Address:       "https://github.com/org/tfvars.git",
+			TFVarsFile:    "vpc.tfvars",
+			CommitMessage: "Update {{ .Name }}",
+			PullRequest:   &tfv1alpha2.ExportPullRequest{Provider: "github", BaseBranch: "main"},
+		}
+		Expect(validateTerraform(tf)).To(BeEmpty())
+
+		tf.Spec.ExportRepo.CommitMessage = "Update {{ .Name"
+		tf.Spec.ExportRepo.PullRequest.Provider = "bitbucket"
+		Expect(validateTerraform(tf)).To(HaveLen(2))
+		tf.Spec.ExportRepo.Branch = "main"
+		Expect(validateTerraform(tf)).To(HaveLen(3))
+	})
+
+	It("Should reject an httpProxy that is not a url", func() {
+		tf := newTerraform()
+		tf.Spec.HTTPProxy = &tfv1alpha2.HTTPProxyOpts{HTTPSProxy: "http://proxy.example.com:3128", NoProxy: ".example.com"}
+		Expect(validateTerraform(tf)).To(BeEmpty())
+		tf.Spec.HTTPProxy.HTTPProxy = "proxy.example.com"
+		Expect(validateTerraform(tf)).To(HaveLen(1))
+
+		tf.Spec.HTTPProxy = &tfv1alpha2.HTTPProxyOpts{SSHTunnel: true}
+		Expect(validateTerraform(tf)).To(BeEmpty())
+		tf.Spec.HTTPProxy.HTTPSProxy = "http://proxy.example.com:3128"
+		Expect(validateTerraform(tf)).To(HaveLen(1))
+	})
+
+	It("Should reject a bad pull policy", func() {
+		tf := newTerraform()
+		tf.Spec.TerraformRunnerPullPolicy = "Sometimes"
+		Expect(validateTerraform(tf)).To(HaveLen(1))
+	})
+
+	It("Should reject hooks without exactly one script source", func() {
+		tf := newTerraform()
+		tf.Spec.Hooks = []tfv1alpha2.Hook{
+			{Stage: tfv1alpha2.PodPlan, When: tfv1alpha2.HookPre, Script: "echo ok"},
+			{Stage: tfv1alpha2.PodPlan, When: tfv1alpha2.HookPost},
+		}
+		Expect(validateTerraform(tf)).To(HaveLen(1))
+
+		tf.Spec.Hooks[1].Script = "echo ok"
+		tf.Spec.Hooks[1].ConfigMapRef = &corev1.ConfigMapKeySelector{
+			LocalObjectReference: corev1.LocalObjectReference{Name: "scripts"},
+			Key:                  "plan.sh",
+		}
+		Expect(validateTerraform(tf)).To(HaveLen(1))
+	})
+
+	It("Should reject hooks for an unknown stage", func() {
+		tf := newTerraform()
+		tf.Spec.Hooks = []tfv1alpha2.Hook{
+			{Stage: tfv1alpha2.PodPostPlan, When: tfv1alpha2.HookPre, Script: "echo ok"},
+		}
+		Expect(validateTerraform(tf)).To(HaveLen(1))
+	})
+
+	It("Should reject spec changes during an apply", func() {
+		old := newTerraform()
+		old.Status.Stages = []tfv1alpha2.Stage{{
+			PodType:       tfv1alpha2.PodApply,
+			State:         tfv1alpha2.StateInProgress,
+			Interruptible: tfv1alpha2.CanNotBeInterrupt,
+		}}
+		tf := old.DeepCopy()
+		tf.Spec.ApplyOnUpdate = true
+		Expect(validateTerraformUpdate(old, tf)).To(HaveLen(1))
+
+		old.Status.Stages[0].State = tfv1alpha2.StateComplete
+		Expect(validateTerraformUpdate(old, tf)).To(BeEmpty())
+	})
+
+	It("Should allow updates that do not change an invalid spec", func() {
+		old := newTerraform()
+		old.Spec.TerraformModule.Address = "ftp://example.com/module.git"
+		Expect(validateTerraformRequest(nil, old)).To(HaveLen(1))
+
+		tf := old.DeepCopy()
+		tf.Finalizers = []string{terraformFinalizer}
+		Expect(validateTerraformRequest(old, tf)).To(BeEmpty())
+
+		now := metav1.Now()
+		tf.DeletionTimestamp = &now
+		tf.Finalizers = nil
+		Expect(validateTerraformRequest(old, tf)).To(BeEmpty())
+
+		tf = old.DeepCopy()
+		tf.Spec.ApplyOnUpdate = true
+		Expect(validateTerraformRequest(old, tf)).To(HaveLen(1))
+	})
+})
+
+var _ = Describe("Terraform defaulting webhook", func() {
+
+	It("Should only set runner fields that are empty", func() {
+		tf := &tfv1alpha2.Terraform{
+			Spec: tfv1alpha2.TerraformSpec{
+				TerraformVersion: "0.14.5",
+			},
+		}
+		setRunnerDefaults(tf, DefaultOperatorConfig())
+		Expect(tf.Spec.TerraformVersion).To(Equal("0.14.5"))
+		Expect(tf.Spec.TerraformRunner).To(Equal(defaultTerraformRunner))
+		Expect(tf.Spec.ScriptRunnerVersion).To(Equal(defaultScriptRunnerVersion))
+		Expect(tf.Spec.SetupRunnerPullPolicy).To(Equal(defaultSetupRunnerPullPolicy))
+	})
+
+	It("Should use the operator config", func() {
+		config, err := ParseOperatorConfig([]byte("terraformRunner: registry.internal/tf-runner\n"))
+		Expect(err).NotTo(HaveOccurred())
+		tf := &tfv1alpha2.Terraform{}
+		setRunnerDefaults(tf, config)
+		Expect(tf.Spec.TerraformRunner).To(Equal("registry.internal/tf-runner"))
+		Expect(tf.Spec.TerraformVersion).To(Equal(defaultTerraformVersion))
+	})
+})
@@ -0,0 +1,488 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-logr/logr"
+	tfv1alpha2 "github.com/isaaguilar/terraform-operator/pkg/apis/tf/v1alpha2"
+	"github.com/isaaguilar/terraform-operator/pkg/gitclient"
+	"github.com/isaaguilar/terraform-operator/pkg/utils"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// terraformSetLabel is set on the Terraform resources generated by a
+// TerraformSet to the name of the set
+const terraformSetLabel = "tf.isaaguilar.com/terraformset"
+
+const defaultGitGeneratorPollInterval = 3 * time.Minute
+
+// templateParam matches "{{ name }}" in a template. Names must start with a
+// letter so that go templates like "{{ .Name }}", eg in hook scripts, are
+// left alone.
+var templateParam = regexp.MustCompile(`\{\{\s*([A-Za-z_][A-Za-z0-9_.\-]*)\s*\}\}`)
+
+// ReconcileTerraformSet reconciles a TerraformSet object
+type ReconcileTerraformSet struct {
+	Client   client.Client
+	Scheme   *runtime.Scheme
+	Recorder record.EventRecorder
+	Log      logr.Logger
+
+	// Selector limits the sets the controller reconciles to the ones with
+	// matching labels. All sets are reconciled when it is nil.
+	Selector labels.Selector
+
+	// GitMirrors is the local git cache the git generators download through
+	GitMirrors *gitclient.MirrorCache
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *ReconcileTerraformSet) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&tfv1alpha2.TerraformSet{}, builder.WithPredicates(selectorPredicate(r.Selector))).
+		Owns(&tfv1alpha2.Terraform{}).
+		Complete(r)
+}
+
+// Reconcile generates the parameters of the set, creates or updates a
+// Terraform resource for each of them and deletes the generated resources
+// that are no longer generated.
+func (r *ReconcileTerraformSet) Reconcile(ctx context.Context, request reconcile.Request) (reconcile.Result, error) {
+	reqLogger := r.Log.WithValues("TerraformSet", request.NamespacedName)
+
+	set := &tfv1alpha2.TerraformSet{}
+	err := r.Client.Get(ctx, request.NamespacedName, set)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return reconcile.Result{}, nil
+		}
+		return reconcile.Result{}, err
+	}
+	if !matchesSelector(r.Selector, set) {
+		return reconcile.Result{}, nil
+	}
+
+	// Deleting the set deletes the Terraform resources it owns. The finalizer
+	// is only used to release them when they are preserved.
+	finalizers := set.GetFinalizers()
+	if set.GetDeletionTimestamp() != nil {
+		if !utils.ListContainsStr(finalizers, terraformFinalizer) {
+			return reconcile.Result{}, nil
+		}
+		err := r.releaseResources(ctx, set)
+		if err != nil {
+			return reconcile.Result{}, err
+		}
+		set.SetFinalizers(utils.ListRemoveStr(finalizers, terraformFinalizer))
+		return reconcile.Result{}, r.Client.Update(ctx, set)
+	}
+	if set.Spec.PreserveResourcesOnDeletion != utils.ListContainsStr(finalizers, terraformFinalizer) {
+		if set.Spec.PreserveResourcesOnDeletion {
+			set.SetFinalizers(append(finalizers, terraformFinalizer))
+		} else {
+			set.SetFinalizers(utils.ListRemoveStr(finalizers, terraformFinalizer))
+		}
+		return reconcile.Result{}, r.Client.Update(ctx, set)
+	}
+
+	result := reconcile.Result{}
+	if interval := gitGeneratorPollInterval(set); interval > 0 {
+		result.RequeueAfter = interval
+	}
+
+	status := set.Status.DeepCopy()
+	err = r.generate(ctx, reqLogger, set, status)
+	if err != nil {
+		r.Recorder.Event(set, "Warning", "GenerateError", err.Error())
+		status.Error = err.Error()
+	} else {
+		status.Error = ""
+	}
+	if !equality.Semantic.DeepEqual(*status, set.Status) {
+		set.Status = *status
+		if err := r.Client.Status().Update(ctx, set); err != nil {
+			return reconcile.Result{}, err
+		}
+	}
+	if err != nil && result.RequeueAfter == 0 {
+		return reconcile.Result{}, err
+	}
+	return result, nil
+}
+
+// generate creates, updates and prunes the Terraform resources of the set and
+// records them in the status
+func (r *ReconcileTerraformSet) generate(ctx context.Context, reqLogger logr.Logger, set *tfv1alpha2.TerraformSet, status *tfv1alpha2.TerraformSetStatus) error {
+	params, err := r.generateParams(ctx, reqLogger, set)
+	if err != nil {
+		return err
+	}
+
+	tfs := []*tfv1alpha2.Terraform{}
+	names := make(map[string]bool)
+	for _, p := range params {
+		tf, err := renderTerraform(set, p)
+		if err != nil {
+			return err
+		}
+		if names[tf.Name] {
+			return fmt.Errorf("template generates the name '%s' more than once", tf.Name)
+		}
+		names[tf.Name] = true
+		tfs = append(tfs, tf)
+	}
+
+	for _, tf := range tfs {
+		err := r.applyTerraform(ctx, set, tf)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = r.prune(ctx, reqLogger, set, names)
+	if err != nil {
+		return err
+	}
+
+	status.Resources = []string{}
+	for name := range names {
+		status.Resources = append(status.Resources, name)
+	}
+	sort.Strings(status.Resources)
+	status.Count = len(status.Resources)
+	return nil
+}
+
+// generateParams returns the parameters of all generators
+func (r *ReconcileTerraformSet) generateParams(ctx context.Context, reqLogger logr.Logger, set *tfv1alpha2.TerraformSet) ([]map[string]string, error) {
+	params := []map[string]string{}
+	for i, g := range set.Spec.Generators {
+		switch {
+		case g.List != nil:
+			params = append(params, listParams(*g.List)...)
+		case g.Matrix != nil:
+			params = append(params, matrixParams(*g.Matrix)...)
+		case g.Git != nil:
+			p, err := r.gitParams(ctx, reqLogger, set, *g.Git)
+			if err != nil {
+				return nil, fmt.Errorf("git generator %d: %v", i, err)
+			}
+			params = append(params, p...)
+		default:
+			return nil, fmt.Errorf("generator %d must define one of list, matrix or git", i)
+		}
+	}
+	return params, nil
+}
+
+// listParams returns a copy of the list's elements
+func listParams(g tfv1alpha2.ListGenerator) []map[string]string {
+	params := []map[string]string{}
+	for _, e := range g.Elements {
+		p := make(map[string]string)
+		for k, v := range e {
+			p[k] = v
+		}
+		params = append(params, p)
+	}
+	return params
+}
+
+// matrixParams returns every combination of the dimensions' values. The last
+// dimension varies fastest.
+func matrixParams(g tfv1alpha2.MatrixGenerator) []map[string]string {
+	if len(g.Dimensions) == 0 {
+		return []map[string]string{}
+	}
+	params := []map[string]string{{}}
+	for _, d := range g.Dimensions {
+		next := []map[string]string{}
+		for _, p := range params {
+			for _, v := range d.Values {
+				combination := make(map[string]string)
+				for k, pv := range p {
+					combination[k] = pv
+				}
+				combination[d.Name] = v
+				next = append(next, combination)
+			}
+		}
+		params = next
+	}
+	return params
+}
+
+// gitParams downloads the repo with the template's scmAuthMethods and
+// sshTunnel and returns the parameters of the matching directories
+func (r *ReconcileTerraformSet) gitParams(ctx context.Context, reqLogger logr.Logger, set *tfv1alpha2.TerraformSet, g tfv1alpha2.GitGenerator) ([]map[string]string, error) {
+	tf := &tfv1alpha2.Terraform{
+		ObjectMeta: metav1.ObjectMeta{Namespace: set.Namespace},
+		Spec:       set.Spec.Template.Spec,
+	}
+	d, err := newGitRepoAccessOptionsFromSpec(tf, g.Address, []string{})
+	if err != nil {
+		return nil, fmt.Errorf("Error in newGitRepoAccessOptionsFromSpec: %v", err)
+	}
+	defer os.RemoveAll(d.Directory)
+	d.mirrors = r.GitMirrors
+
+	err = d.getParsedAddress()
+	if err != nil {
+		return nil, fmt.Errorf("Error in parsing address: %v", err)
+	}
+
+	err = d.startProxy(ctx, r.Client, set.Namespace, reqLogger)
+	if err != nil {
+		return nil, err
+	}
+	defer d.TunnelClose(reqLogger.WithValues("Spec", "generators"))
+
+	err = d.download(ctx, r.Client, set.Namespace)
+	if err != nil {
+		return nil, fmt.Errorf("Error in download: %v", err)
+	}
+
+	dirs, err := matchDirectories(d.Directory, g.Directories)
+	if err != nil {
+		return nil, err
+	}
+	params := []map[string]string{}
+	for _, dir := range dirs {
+		params = append(params, map[string]string{
+			"path":          dir,
+			"path.basename": filepath.Base(dir),
+		})
+	}
+	return params, nil
+}
+
+// matchDirectories returns the directories under root, relative to root,
+// that match a path pattern and no exclude pattern
+func matchDirectories(root string, patterns []tfv1alpha2.GitDirectory) ([]string, error) {
+	dirs := []string{}
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() || path == root {
+			return nil
+		}
+		if info.Name() == ".git" {
+			return filepath.SkipDir
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		included := false
+		for _, p := range patterns {
+			matched, err := filepath.Match(strings.Trim(p.Path, "/"), rel)
+			if err != nil {
+				return fmt.Errorf("invalid directory pattern '%s': %v", p.Path, err)
+			}
+			if !matched {
+				continue
+			}
+			if p.Exclude {
+				return nil
+			}
+			included = true
+		}
+		if included {
+			dirs = append(dirs, rel)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return dirs, nil
+}
+
+// renderTerraform returns the Terraform resource of the template with the
+// parameters substituted. Parameters that are not defined are left as is.
+func renderTerraform(set *tfv1alpha2.TerraformSet, params map[string]string) (*tfv1alpha2.Terraform, error) {
+	data, err := json.Marshal(set.Spec.Template)
+	if err != nil {
+		return nil, fmt.Errorf("unable to marshal template: %v", err)
+	}
+	var renderErr error
+	data = templateParam.ReplaceAllFunc(data, func(match []byte) []byte {
+		name := string(templateParam.FindSubmatch(match)[1])
+		value, ok := params[name]
+		if !ok {
+			return match
+		}
+		// The value is inserted into a json string and must be escaped
+		escaped, err := json.Marshal(value)
+		if err != nil {
+			renderErr = err
+			return match
+		}
+		return escaped[1 : len(escaped)-1]
+	})
+	if renderErr != nil {
+		return nil, fmt.Errorf("unable to render template: %v", renderErr)
+	}
+
+	template := tfv1alpha2.TerraformSetTemplate{}
+	err = json.Unmarshal(data, &template)
+	if err != nil {
+		return nil, fmt.Errorf("unable to render template: %v", err)
+	}
+	if template.Metadata.Name == "" {
+		return nil, fmt.Errorf("template generates an empty name for %v", params)
+	}
+	if errs := validation.IsDNS1123Subdomain(template.Metadata.Name); len(errs) > 0 {
+		return nil, fmt.Errorf("template generates an invalid name '%s': %s", template.Metadata.Name, strings.Join(errs, ", "))
+	}
+
+	labels := make(map[string]string)
+	for k, v := range template.Metadata.Labels {
+		labels[k] = v
+	}
+	labels[terraformSetLabel] = set.Name
+
+	return &tfv1alpha2.Terraform{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        template.Metadata.Name,
+			Namespace:   set.Namespace,
+			Labels:      labels,
+			Annotations: template.Metadata.Annotations,
+		},
+		Spec: template.Spec,
+	}, nil
+}
+
+// applyTerraform creates the Terraform resource or updates the one the set
+// generated before. Resources that were not generated by the set are not
+// modified.
+func (r *ReconcileTerraformSet) applyTerraform(ctx context.Context, set *tfv1alpha2.TerraformSet, desired *tfv1alpha2.Terraform) error {
+	tf := &tfv1alpha2.Terraform{}
+	err := r.Client.Get(ctx, types.NamespacedName{Name: desired.Name, Namespace: desired.Namespace}, tf)
+	if err != nil && !errors.IsNotFound(err) {
+		return err
+	}
+	if err == nil && !metav1.IsControlledBy(tf, set) {
+		return fmt.Errorf("terraform '%s' already exists and is not managed by this terraformset", tf.Name)
+	}
+
+	tf.Name = desired.Name
+	tf.Namespace = desired.Namespace
+	_, err = controllerutil.CreateOrUpdate(ctx, r.Client, tf, func() error {
+		// The defaulting webhook sets the runner images on create. Keep them
+		// so that the spec does not change back and forth and start runs.
+		spec := *desired.Spec.DeepCopy()
+		mergeRunnerDefaults(&spec, defaultedFields(tf.Spec))
+		tf.Spec = spec
+
+		if tf.Labels == nil {
+			tf.Labels = make(map[string]string)
+		}
+		for k, v := range desired.Labels {
+			tf.Labels[k] = v
+		}
+		if len(desired.Annotations) > 0 && tf.Annotations == nil {
+			tf.Annotations = make(map[string]string)
+		}
+		for k, v := range desired.Annotations {
+			tf.Annotations[k] = v
+		}
+		return controllerutil.SetControllerReference(set, tf, r.Scheme)
+	})
+	if err != nil {
+		return fmt.Errorf("unable to create or update terraform '%s': %v", desired.Name, err)
+	}
+	return nil
+}
+
+// prune deletes the Terraform resources of the set that are no longer
+// generated
+func (r *ReconcileTerraformSet) prune(ctx context.Context, reqLogger logr.Logger, set *tfv1alpha2.TerraformSet, names map[string]bool) error {
+	tfs := &tfv1alpha2.TerraformList{}
+	err := r.Client.List(ctx, tfs, client.InNamespace(set.Namespace), client.MatchingLabels{terraformSetLabel: set.Name})
+	if err != nil {
+		return fmt.Errorf("unable to list terraform resources: %v", err)
+	}
+	for i := range tfs.Items {
+		tf := &tfs.Items[i]
+		if names[tf.Name] || !metav1.IsControlledBy(tf, set) || tf.GetDeletionTimestamp() != nil {
+			continue
+		}
+		reqLogger.Info(fmt.Sprintf("Deleting terraform '%s' that is no longer generated", tf.Name))
+		err := r.Client.Delete(ctx, tf)
+		if err != nil && !errors.IsNotFound(err) {
+			return fmt.Errorf("unable to delete terraform '%s': %v", tf.Name, err)
+		}
+		r.Recorder.Event(set, "Normal", "Pruned", fmt.Sprintf("Deleted terraform '%s'", tf.Name))
+	}
+	return nil
+}
+
+// releaseResources removes the set's owner reference from its Terraform
+// resources so they are not deleted with the set
+func (r *ReconcileTerraformSet) releaseResources(ctx context.Context, set *tfv1alpha2.TerraformSet) error {
+	tfs := &tfv1alpha2.TerraformList{}
+	err := r.Client.List(ctx, tfs, client.InNamespace(set.Namespace), client.MatchingLabels{terraformSetLabel: set.Name})
+	if err != nil {
+		return fmt.Errorf("unable to list terraform resources: %v", err)
+	}
+	for i := range tfs.Items {
+		tf := &tfs.Items[i]
+		refs := []metav1.OwnerReference{}
+		for _, ref := range tf.GetOwnerReferences() {
+			if ref.UID != set.UID {
+				refs = append(refs, ref)
+			}
+		}
+		if len(refs) == len(tf.GetOwnerReferences()) {
+			continue
+		}
+		tf.SetOwnerReferences(refs)
+		delete(tf.Labels, terraformSetLabel)
+		err := r.Client.Update(ctx, tf)
+		if err != nil && !errors.IsNotFound(err) {
+			return fmt.Errorf("unable to release terraform '%s': %v", tf.Name, err)
+		}
+	}
+	return nil
+}
+
+// gitGeneratorPollInterval returns the shortest poll interval of the set's
+// git generators or 0 when there are none
+func gitGeneratorPollInterval(set *tfv1alpha2.TerraformSet) time.Duration {
+	var interval time.Duration
+	for _, g := range set.Spec.Generators {
+		if g.Git == nil {
+			continue
+		}
+		i := defaultGitGeneratorPollInterval
+		if g.Git.PollInterval != nil && g.Git.PollInterval.Duration > 0 {
+			i = g.Git.PollInterval.Duration
+		}
+		if interval == 0 || i < interval {
+			interval = i
+		}
+	}
+	return interval
+}
@@ -0,0 +1,77 @@
+package controllers
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	tfv1alpha2 "github.com/isaaguilar/terraform-operator/pkg/apis/tf/v1alpha2"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+)
+
+var _ = Describe("TerraformSet", func() {
+
+	It("Should generate every combination of a matrix", func() {
+		params := matrixParams(tfv1alpha2.MatrixGenerator{
+			Dimensions: []tfv1alpha2.MatrixDimension{
+				{Name: "env", Values: []string{"staging", "production"}},
+				{Name: "region", Values: []string{"us-east-1", "eu-west-1"}},
+			},
+		})
+		Expect(params).To(Equal([]map[string]string{
+			{"env": "staging", "region": "us-east-1"},
+			{"env": "staging", "region": "eu-west-1"},
+			{"env": "production", "region": "us-east-1"},
+			{"env": "production", "region": "eu-west-1"},
+		}))
+		Expect(matrixParams(tfv1alpha2.MatrixGenerator{})).To(BeEmpty())
+	})
+
+	It("Should render the template", func() {
+		set := &tfv1alpha2.TerraformSet{}
+		set.Name = "vpc"
+		set.Namespace = "team-a"
+		set.Spec.Template = tfv1alpha2.TerraformSetTemplate{
+			Metadata: tfv1alpha2.TerraformSetTemplateMeta{
+				Name:   "vpc-{{ env }}-{{region}}",
+				Labels: map[string]string{"env": "{{ env }}"},
+			},
+			Spec: tfv1alpha2.TerraformSpec{
+				TerraformModule: &tfv1alpha2.SrcOpts{Address: "https://github.com/example/vpc.git"},
+				Env: []corev1.EnvVar{
+					{Name: "TF_VAR_note", Value: "{{ note }}"},
+					{Name: "TF_VAR_unknown", Value: "{{ unknown }} {{ .Name }}"},
+				},
+			},
+		}
+
+		tf, err := renderTerraform(set, map[string]string{"env": "staging", "region": "us-east-1", "note": `say "hi"`})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(tf.Name).To(Equal("vpc-staging-us-east-1"))
+		Expect(tf.Namespace).To(Equal("team-a"))
+		Expect(tf.Labels).To(Equal(map[string]string{"env": "staging", terraformSetLabel: "vpc"}))
+		Expect(tf.Spec.Env[0].Value).To(Equal(`say "hi"`))
+		Expect(tf.Spec.Env[1].Value).To(Equal("{{ unknown }} {{ .Name }}"))
+
+		_, err = renderTerraform(set, map[string]string{"env": "Staging", "region": "us-east-1"})
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("Should match the directories of a repo", func() {
+		root, err := ioutil.TempDir("", "terraformset")
+		Expect(err).NotTo(HaveOccurred())
+		defer os.RemoveAll(root)
+		for _, dir := range []string{".git/refs", "stacks/network", "stacks/database", "stacks/experimental", "modules/vpc"} {
+			Expect(os.MkdirAll(filepath.Join(root, dir), 0755)).To(Succeed())
+		}
+
+		dirs, err := matchDirectories(root, []tfv1alpha2.GitDirectory{
+			{Path: "stacks/*"},
+			{Path: "stacks/experimental", Exclude: true},
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(dirs).To(Equal([]string{"stacks/database", "stacks/network"}))
+	})
+})
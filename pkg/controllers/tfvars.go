@@ -0,0 +1,112 @@
+package controllers
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/hashicorp/hcl/v2/hclwrite"
+	"github.com/zclconf/go-cty/cty"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// tfvarsFile is the content of a tfvars file. Its errors are reported with
+// the name.
+type tfvarsFile struct {
+	name    string
+	content string
+}
+
+// mergeTfvars merges the files into a single tfvars file. A variable that is
+// set in more than one file gets the value of the last one, like terraform
+// does with the -var-file options. The variables are written in alphabetical
+// order. Syntax errors are returned with the file and the line.
+func mergeTfvars(files ...tfvarsFile) (string, error) {
+	values := make(map[string]hclwrite.Tokens)
+	for _, f := range files {
+		if strings.TrimSpace(f.content) == "" {
+			continue
+		}
+		err := validateTfvars(f)
+		if err != nil {
+			return "", err
+		}
+		file, diags := hclwrite.ParseConfig([]byte(f.content), f.name, hcl.Pos{Line: 1, Column: 1})
+		if diags.HasErrors() {
+			return "", fmt.Errorf("Error in parsing tfvars: %v", diags)
+		}
+		for name, attr := range file.Body().Attributes() {
+			values[name] = attr.Expr().BuildTokens(nil)
+		}
+	}
+
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	merged := hclwrite.NewEmptyFile()
+	for _, name := range names {
+		merged.Body().SetAttributeRaw(name, values[name])
+	}
+	return string(hclwrite.Format(merged.Bytes())), nil
+}
+
+// validateTfvars checks that the file only sets variables to values, the
+// same as terraform when it reads a tfvars file
+func validateTfvars(f tfvarsFile) error {
+	file, diags := hclsyntax.ParseConfig([]byte(f.content), f.name, hcl.Pos{Line: 1, Column: 1})
+	if diags.HasErrors() {
+		return fmt.Errorf("Error in parsing tfvars: %v", diags)
+	}
+	body := file.Body.(*hclsyntax.Body)
+	if len(body.Blocks) > 0 {
+		return fmt.Errorf("Error in parsing tfvars: %s: blocks are not allowed in tfvars", body.Blocks[0].DefRange())
+	}
+	attrs := make([]*hclsyntax.Attribute, 0, len(body.Attributes))
+	for _, attr := range body.Attributes {
+		attrs = append(attrs, attr)
+	}
+	sort.Slice(attrs, func(i, j int) bool { return attrs[i].SrcRange.Start.Byte < attrs[j].SrcRange.Start.Byte })
+	for _, attr := range attrs {
+		if vars := attr.Expr.Variables(); len(vars) > 0 {
+			return fmt.Errorf("Error in parsing tfvars: %s: variables are not allowed in tfvars", vars[0].SourceRange())
+		}
+	}
+	return nil
+}
+
+// envTfvars are the values of the TF_VAR_ env vars as tfvars files. Values
+// that start like a map or a list are hcl, the others are strings.
+func envTfvars(envVars []corev1.EnvVar) []tfvarsFile {
+	files := []tfvarsFile{}
+	for _, env := range envVars {
+		// TODO Attempt to resolve other kinds of TF_VAR_ values via
+		// 		an EnvVarSource other than `Value`
+		if env.Value == "" || !strings.HasPrefix(env.Name, "TF_VAR_") {
+			continue
+		}
+		name := strings.TrimPrefix(env.Name, "TF_VAR_")
+		value := strings.TrimSpace(env.Value)
+		var tokens hclwrite.Tokens
+		if strings.HasPrefix(value, "{") || strings.HasPrefix(value, "[") {
+			tokens = hclwrite.Tokens{{Type: hclsyntax.TokenIdent, Bytes: []byte(value)}}
+		} else {
+			tokens = hclwrite.TokensForValue(cty.StringVal(env.Value))
+		}
+		file := hclwrite.NewEmptyFile()
+		file.Body().SetAttributeRaw(name, tokens)
+		files = append(files, tfvarsFile{name: "env " + env.Name, content: string(file.Bytes())})
+	}
+	return files
+}
+
+// mergeExportTfvars merges the TF_VAR_ env vars and the tfvars of the sources
+// into the exported tfvars. The tfvars take precedence over the env vars, as
+// they do when terraform runs.
+func mergeExportTfvars(envVars []corev1.EnvVar, tfvars string) (string, error) {
+	files := append(envTfvars(envVars), tfvarsFile{name: "sources", content: tfvars})
+	return mergeTfvars(files...)
+}
@@ -0,0 +1,82 @@
+package controllers
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+)
+
+var _ = Describe("Merging tfvars", func() {
+
+	It("Should give the last file precedence", func() {
+		merged, err := mergeTfvars(
+			tfvarsFile{name: "a.tfvars", content: "region = \"us-east-1\"\nsize = 1\n"},
+			tfvarsFile{name: "b.tfvars", content: "region = \"us-west-2\"\n"},
+		)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(merged).To(Equal("region = \"us-west-2\"\nsize   = 1\n"))
+	})
+
+	It("Should merge values the line scanner could not", func() {
+		merged, err := mergeTfvars(
+			tfvarsFile{name: "a.tfvars", content: `# a comment with a = sign
+tags = { team = "infra", env = "dev" }
+url = "https://example.com/?a=b"
+policy = <<EOF
+{
+  "a": [
+    "b"
+  ]
+}
+EOF
+list = [
+  "a", # first
+  "b",
+]
+`},
+			tfvarsFile{name: "b.tfvars", content: "url = \"https://example.com/?c=d\" // override\n"},
+		)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(merged).To(ContainSubstring(`tags   = { team = "infra", env = "dev" }`))
+		Expect(merged).To(ContainSubstring(`url    = "https://example.com/?c=d"`))
+		Expect(merged).To(ContainSubstring("policy = <<EOF\n{\n  \"a\": [\n    \"b\"\n  ]\n}\nEOF\n"))
+		Expect(merged).To(ContainSubstring("\"a\", # first"))
+		Expect(merged).NotTo(ContainSubstring("us-east-1"))
+	})
+
+	It("Should report syntax errors with the file and the line", func() {
+		_, err := mergeTfvars(
+			tfvarsFile{name: "a.tfvars", content: "a = 1\n"},
+			tfvarsFile{name: "b.tfvars", content: "b = 1\nc = = 2\nd = 3\n"},
+		)
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("b.tfvars:2"))
+	})
+
+	It("Should only allow values in tfvars", func() {
+		_, err := mergeTfvars(tfvarsFile{name: "a.tfvars", content: "a = 1\nb {\n}\n"})
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("a.tfvars:2"))
+		_, err = mergeTfvars(tfvarsFile{name: "a.tfvars", content: "a = 1\nb = var.a\n"})
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("a.tfvars:2"))
+	})
+
+	It("Should merge the TF_VAR envs under the tfvars", func() {
+		envVars := []corev1.EnvVar{
+			{Name: "TF_VAR_region", Value: "us-east-1"},
+			{Name: "TF_VAR_size", Value: "1"},
+			{Name: "TF_VAR_quoted", Value: `say "hi"`},
+			{Name: "TF_VAR_tags", Value: `{ team = "infra" }`},
+			{Name: "TF_VAR_empty"},
+			{Name: "AWS_REGION", Value: "us-east-1"},
+		}
+		merged, err := mergeExportTfvars(envVars, "size = 2\n")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(merged).To(Equal(`quoted = "say \"hi\""
+region = "us-east-1"
+size   = 2
+tags   = { team = "infra" }
+`))
+	})
+})
@@ -1,11 +1,12 @@
 package gitclient
 
 import (
+	"context"
 	"fmt"
 	"io/ioutil"
-	"log"
 	"os"
-	"strconv"
+	"path"
+	"strings"
 	"sync"
 	"time"
 
@@ -14,13 +15,16 @@ import (
 	"github.com/isaaguilar/terraform-operator/pkg/utils"
 
 	"golang.org/x/crypto/ssh"
+	"gopkg.in/src-d/go-billy.v4"
 	git "gopkg.in/src-d/go-git.v4"
 	"gopkg.in/src-d/go-git.v4/config"
 	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/filemode"
 	"gopkg.in/src-d/go-git.v4/plumbing/object"
 	gitauth "gopkg.in/src-d/go-git.v4/plumbing/transport"
 	githttp "gopkg.in/src-d/go-git.v4/plumbing/transport/http"
 	gitssh "gopkg.in/src-d/go-git.v4/plumbing/transport/ssh"
+	"gopkg.in/src-d/go-git.v4/storage/memory"
 )
 
 type GitRepo struct {
@@ -47,56 +51,43 @@ func (g GitRepo) BranchName() (string, error) {
 	return g.ref.Name().String(), nil
 }
 
-func (g *GitRepo) checkout(commit string) error {
-	w, err := g.repo.Worktree()
-	if err != nil {
-		return fmt.Errorf("Could not get Worktree: %v", err)
-	}
+// downloadGitRepo clones only the commit of ref when a branch or tag of the
+// remote points to it. A commit that no ref points to is looked up in the
+// repo's full history. When paths is not empty, only the files under paths
+// are checked out.
+func (g *GitRepo) downloadGitRepo(c chan error, wg *sync.WaitGroup, url, repoDir, ref string, paths []string) {
+	defer wg.Done()
+	defer close(c)
 
-	// Check if this is a hash
-	n, _ := strconv.ParseUint(commit, 16, 64)
-	if len(commit) == 40 && n > 0 {
-		fmt.Printf("checking out hash: %v\n", commit)
-		// Try checking out a hash commit
-		err = w.Checkout(&git.CheckoutOptions{
-			Hash: plumbing.NewHash(commit),
-		})
-		if err != nil {
-			return fmt.Errorf("Error checking out hash: %v", err)
-		}
-	} else {
-		fmt.Printf("checking out branch: %v\n", "refs/heads/"+commit)
-		// Try checking out a branch
-		err = w.Checkout(&git.CheckoutOptions{
-			Branch: plumbing.ReferenceName("refs/heads/" + commit),
-		})
-		if err != nil {
-			return fmt.Errorf("Error checking out branch: %v", err)
-		}
-	}
-	ref, err := g.repo.Head()
+	refs, err := listRemote(url, g.auth)
 	if err != nil {
-		return fmt.Errorf("Error reading head: %v", err)
+		c <- err
+		return
 	}
-	g.ref = ref
-	return nil
-}
 
-func (g *GitRepo) downloadGitRepo(c chan error, wg *sync.WaitGroup, url, repoDir string) {
-	defer wg.Done()
-	defer close(c)
 	gitConfigs := git.CloneOptions{
-		URL:               url,
-		RecurseSubmodules: git.DefaultSubmoduleRecursionDepth,
-		ReferenceName:     plumbing.NewBranchReferenceName("master"),
-		Progress:          os.Stdout,
+		URL:        url,
+		NoCheckout: true,
+		Progress:   os.Stdout,
 	}
-
 	if g.auth != nil {
 		gitConfigs.Auth = g.auth
 	}
 
-	err := gitConfigs.Validate()
+	name, hash, found := findRef(refs, ref)
+	if found {
+		gitConfigs.ReferenceName = name
+		gitConfigs.SingleBranch = name != plumbing.HEAD
+		gitConfigs.Depth = 1
+		gitConfigs.Tags = git.NoTags
+	} else if isHash(ref) {
+		gitConfigs.Tags = git.AllTags
+	} else {
+		c <- fmt.Errorf("ref '%s' not found in %s", ref, url)
+		return
+	}
+
+	err = gitConfigs.Validate()
 	if err != nil {
 		c <- fmt.Errorf("Git config not valid: %v", err)
 		return
@@ -104,35 +95,276 @@ func (g *GitRepo) downloadGitRepo(c chan error, wg *sync.WaitGroup, url, repoDir
 
 	r, err := git.PlainClone(repoDir, false, &gitConfigs)
 	if err != nil {
-		// try using the main branch since GitHub is renaming the default branch
-		// reference: https://github.com/github/renaming
-		gitConfigs.ReferenceName = plumbing.NewBranchReferenceName("main")
-		r, err = git.PlainClone(repoDir, false, &gitConfigs)
+		c <- fmt.Errorf("Could not checkout repo: %v", err)
+		return
+	}
+	if !found {
+		hash, err = findCommit(r, ref)
 		if err != nil {
-			c <- fmt.Errorf("Could not checkout repo: %v", err)
+			c <- err
 			return
 		}
 	}
 
-	// Checkout the git-refs used for checkouts
-	err = r.Fetch(&git.FetchOptions{
-		Auth:     g.auth,
-		RefSpecs: []config.RefSpec{"refs/*:refs/*", "HEAD:refs/heads/HEAD"},
-	})
+	branch := plumbing.ReferenceName("")
+	if name.IsBranch() {
+		branch = name
+	}
+	head, err := checkoutCommit(context.Background(), r, branch, hash, g.auth, paths)
 	if err != nil {
-		c <- fmt.Errorf("Could not Fetch: %v", err)
+		c <- err
 		return
 	}
 	g.repo = r
+	g.ref = head
+}
 
-	ref, err := r.Head()
+// listRemote lists the references of the remote repo, like `git ls-remote`
+func listRemote(url string, auth gitauth.AuthMethod) ([]*plumbing.Reference, error) {
+	remote := git.NewRemote(memory.NewStorage(), &config.RemoteConfig{
+		Name: "origin",
+		URLs: []string{url},
+	})
+	refs, err := remote.List(&git.ListOptions{Auth: auth})
 	if err != nil {
-		c <- fmt.Errorf("Error reading head: %v", err)
-		return
+		return nil, fmt.Errorf("Could not list remote refs: %v", err)
 	}
-	g.ref = ref
+	return refs, nil
+}
+
+// isHash returns true when ref can be a full or abbreviated commit hash
+func isHash(ref string) bool {
+	if len(ref) < 4 || len(ref) > 40 {
+		return false
+	}
+	for _, r := range strings.ToLower(ref) {
+		if !strings.ContainsRune("0123456789abcdef", r) {
+			return false
+		}
+	}
+	return true
+}
+
+// findRef returns the ref among the remote's refs that ref names and the
+// hash it points to. The ref can be a branch, a tag, a full ref name or the
+// full or abbreviated hash a branch or tag points to. An empty ref finds the
+// remote's default branch (HEAD).
+func findRef(refs []*plumbing.Reference, ref string) (plumbing.ReferenceName, plumbing.Hash, bool) {
+	byName := make(map[plumbing.ReferenceName]*plumbing.Reference)
+	for _, r := range refs {
+		byName[r.Name()] = r
+	}
+
+	candidates := []plumbing.ReferenceName{plumbing.HEAD}
+	if ref != "" {
+		candidates = []plumbing.ReferenceName{
+			plumbing.NewBranchReferenceName(ref),
+			plumbing.NewTagReferenceName(ref),
+			plumbing.ReferenceName(ref),
+		}
+	}
+	for _, name := range candidates {
+		r, found := byName[name]
+		if !found {
+			continue
+		}
+		// A symbolic ref, like HEAD, has to be followed
+		if r.Type() == plumbing.SymbolicReference {
+			r, found = byName[r.Target()]
+			if !found || r.Type() != plumbing.HashReference {
+				continue
+			}
+		}
+		if r.Name() == plumbing.HEAD {
+			// The remote does not say which branch HEAD is. The branch that
+			// points to the same commit is cloned when there is one.
+			for _, branch := range refs {
+				if branch.Name().IsBranch() && branch.Hash() == r.Hash() {
+					return branch.Name(), branch.Hash(), true
+				}
+			}
+		}
+		return r.Name(), r.Hash(), true
+	}
+
+	if !isHash(ref) {
+		return "", plumbing.ZeroHash, false
+	}
+	prefix := strings.ToLower(ref)
+	for _, isKind := range []func(plumbing.ReferenceName) bool{
+		plumbing.ReferenceName.IsBranch,
+		plumbing.ReferenceName.IsTag,
+	} {
+		for _, r := range refs {
+			if r.Type() == plumbing.HashReference && isKind(r.Name()) && strings.HasPrefix(r.Hash().String(), prefix) {
+				return r.Name(), r.Hash(), true
+			}
+		}
+	}
+	return "", plumbing.ZeroHash, false
+}
 
-	return
+// findCommit returns the commit in the repo whose hash starts with ref
+func findCommit(r *git.Repository, ref string) (plumbing.Hash, error) {
+	prefix := strings.ToLower(ref)
+	if len(prefix) == 40 {
+		commit, err := r.CommitObject(plumbing.NewHash(prefix))
+		if err != nil {
+			return plumbing.ZeroHash, fmt.Errorf("commit '%s' not found: %v", ref, err)
+		}
+		return commit.Hash, nil
+	}
+
+	commits, err := r.CommitObjects()
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+	matches := []plumbing.Hash{}
+	err = commits.ForEach(func(commit *object.Commit) error {
+		if strings.HasPrefix(commit.Hash.String(), prefix) {
+			matches = append(matches, commit.Hash)
+		}
+		return nil
+	})
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+	switch len(matches) {
+	case 0:
+		return plumbing.ZeroHash, fmt.Errorf("commit '%s' not found", ref)
+	case 1:
+		return matches[0], nil
+	default:
+		return plumbing.ZeroHash, fmt.Errorf("short hash '%s' is ambiguous", ref)
+	}
+}
+
+// checkoutCommit checks out the commit, or the commit of the annotated tag,
+// that hash points to. A branch is checked out as a local branch; otherwise
+// HEAD is detached. When paths is not empty, only the files under paths are
+// written to the worktree. Repos with submodules are always checked out
+// fully.
+func checkoutCommit(ctx context.Context, r *git.Repository, branch plumbing.ReferenceName, hash plumbing.Hash, auth gitauth.AuthMethod, paths []string) (*plumbing.Reference, error) {
+	if tag, err := r.TagObject(hash); err == nil {
+		commit, err := tag.Commit()
+		if err != nil {
+			return nil, fmt.Errorf("Error reading tag %s: %v", tag.Name, err)
+		}
+		hash = commit.Hash
+	}
+	commit, err := r.CommitObject(hash)
+	if err != nil {
+		return nil, fmt.Errorf("Error reading commit %s: %v", hash, err)
+	}
+	w, err := r.Worktree()
+	if err != nil {
+		return nil, fmt.Errorf("Could not get Worktree: %v", err)
+	}
+	if branch != "" {
+		err = r.Storer.SetReference(plumbing.NewHashReference(branch, hash))
+		if err != nil {
+			return nil, fmt.Errorf("Error creating branch: %v", err)
+		}
+	}
+
+	paths = sparsePaths(paths)
+	if _, err := commit.File(".gitmodules"); len(paths) > 0 && err == object.ErrFileNotFound {
+		err = sparseCheckout(w.Filesystem, commit, paths)
+		if err != nil {
+			return nil, fmt.Errorf("Error checking out %s: %v", hash, err)
+		}
+		head := plumbing.NewHashReference(plumbing.HEAD, hash)
+		if branch != "" {
+			head = plumbing.NewSymbolicReference(plumbing.HEAD, branch)
+		}
+		err = r.Storer.SetReference(head)
+		if err != nil {
+			return nil, fmt.Errorf("Error setting head: %v", err)
+		}
+	} else {
+		checkoutOptions := &git.CheckoutOptions{Hash: hash, Force: true}
+		if branch != "" {
+			checkoutOptions = &git.CheckoutOptions{Branch: branch, Force: true}
+		}
+		err = w.Checkout(checkoutOptions)
+		if err != nil {
+			return nil, fmt.Errorf("Error checking out %s: %v", hash, err)
+		}
+		submodules, err := w.Submodules()
+		if err != nil {
+			return nil, fmt.Errorf("Could not read submodules: %v", err)
+		}
+		err = submodules.UpdateContext(ctx, &git.SubmoduleUpdateOptions{
+			Init:              true,
+			Auth:              auth,
+			RecurseSubmodules: git.DefaultSubmoduleRecursionDepth,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("Could not update submodules: %v", err)
+		}
+	}
+
+	head, err := r.Head()
+	if err != nil {
+		return nil, fmt.Errorf("Error reading head: %v", err)
+	}
+	return head, nil
+}
+
+// sparsePaths cleans the paths to check out. It returns nil, which checks
+// out the whole repo, when one of the paths is the root of the repo.
+func sparsePaths(paths []string) []string {
+	cleaned := []string{}
+	for _, p := range paths {
+		p = strings.Trim(path.Clean("/"+p), "/")
+		if p == "" {
+			return nil
+		}
+		cleaned = append(cleaned, p)
+	}
+	return cleaned
+}
+
+// sparseCheckout writes the files of the commit that are under paths to fs
+func sparseCheckout(fs billy.Filesystem, commit *object.Commit, paths []string) error {
+	files, err := commit.Files()
+	if err != nil {
+		return err
+	}
+	return files.ForEach(func(f *object.File) error {
+		inPaths := false
+		for _, p := range paths {
+			if f.Name == p || strings.HasPrefix(f.Name, p+"/") {
+				inPaths = true
+				break
+			}
+		}
+		if !inPaths {
+			return nil
+		}
+
+		contents, err := f.Contents()
+		if err != nil {
+			return err
+		}
+		if err := fs.MkdirAll(path.Dir(f.Name), 0755); err != nil {
+			return err
+		}
+		if f.Mode == filemode.Symlink {
+			return fs.Symlink(contents, f.Name)
+		}
+		mode, err := f.Mode.ToOSFileMode()
+		if err != nil {
+			return err
+		}
+		file, err := fs.OpenFile(f.Name, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, mode.Perm())
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		_, err = file.Write([]byte(contents))
+		return err
+	})
 }
 
 func passwordAuthMethod(user, password string) gitauth.AuthMethod {
@@ -143,7 +375,9 @@ func passwordAuthMethod(user, password string) gitauth.AuthMethod {
 	return auth
 }
 
-func sshAuthMethod(sshKeyFilename string) (gitauth.AuthMethod, error) {
+// sshAuthMethod authenticates with the ssh key. Host keys are verified with
+// hostKeyCallback. Any host key is accepted when it is nil.
+func sshAuthMethod(sshKeyFilename string, hostKeyCallback ssh.HostKeyCallback) (gitauth.AuthMethod, error) {
 	var auth gitauth.AuthMethod
 
 	sshKey, err := os.Open(sshKeyFilename)
@@ -164,11 +398,14 @@ func sshAuthMethod(sshKeyFilename string) (gitauth.AuthMethod, error) {
 		return auth, err
 	}
 
+	if hostKeyCallback == nil {
+		hostKeyCallback = ssh.InsecureIgnoreHostKey()
+	}
 	auth = &gitssh.PublicKeys{
 		User:   "git",
 		Signer: signer,
 		HostKeyCallbackHelper: gitssh.HostKeyCallbackHelper{
-			HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+			HostKeyCallback: hostKeyCallback,
 		},
 	}
 
@@ -179,17 +416,17 @@ func sshAuthMethod(sshKeyFilename string) (gitauth.AuthMethod, error) {
 	return auth, nil
 }
 
-func GitHTTPDownload(url, repoDir, user, password, ref string) (GitRepo, error) {
+// GitHTTPDownload clones ref of the repo into repoDir with a token. When paths
+// is not empty, only the files under paths are checked out. The requests go
+// through proxy when it is not nil.
+func GitHTTPDownload(url, repoDir, user, password, ref string, paths []string, proxy *HTTPProxy) (GitRepo, error) {
 	gitRepo := GitRepo{}
-	if password != "" {
-		auth := passwordAuthMethod(user, password)
-		gitRepo.auth = auth
-	}
+	gitRepo.auth = httpAuthMethod(user, password, proxy)
 
 	c := make(chan error)
 	var wg sync.WaitGroup
 	wg.Add(1)
-	go gitRepo.downloadGitRepo(c, &wg, url, repoDir)
+	go gitRepo.downloadGitRepo(c, &wg, url, repoDir, ref, paths)
 	select {
 	case err := <-c:
 		if err != nil {
@@ -199,17 +436,16 @@ func GitHTTPDownload(url, repoDir, user, password, ref string) (GitRepo, error)
 		return gitRepo, fmt.Errorf("timeout occured fetching %s", url)
 	}
 	wg.Wait()
-
-	if ref != "" {
-		gitRepo.checkout(ref)
-	}
 	return gitRepo, nil
 }
 
-func GitSSHDownload(url, repoDir, sshKeyFilename, ref string, reqLogger logr.Logger) (GitRepo, error) {
+// GitSSHDownload clones ref of the repo into repoDir with an ssh key. When
+// paths is not empty, only the files under paths are checked out. Host keys
+// are verified with hostKeyCallback when it is not nil.
+func GitSSHDownload(url, repoDir, sshKeyFilename, ref string, paths []string, hostKeyCallback ssh.HostKeyCallback, reqLogger logr.Logger) (GitRepo, error) {
 	reqLogger.Info(fmt.Sprintf("Downloading '%s'", url))
 	gitRepo := GitRepo{}
-	auth, err := sshAuthMethod(sshKeyFilename)
+	auth, err := sshAuthMethod(sshKeyFilename, hostKeyCallback)
 	if err != nil {
 		return GitRepo{}, err
 	}
@@ -219,7 +455,7 @@ func GitSSHDownload(url, repoDir, sshKeyFilename, ref string, reqLogger logr.Log
 	c := make(chan error)
 	var wg sync.WaitGroup
 	wg.Add(1)
-	go gitRepo.downloadGitRepo(c, &wg, url, repoDir)
+	go gitRepo.downloadGitRepo(c, &wg, url, repoDir, ref, paths)
 	select {
 	case err := <-c:
 		if err != nil {
@@ -231,7 +467,6 @@ func GitSSHDownload(url, repoDir, sshKeyFilename, ref string, reqLogger logr.Log
 	wg.Wait()
 
 	if ref != "" {
-		gitRepo.checkout(ref)
 		reqLogger.Info(fmt.Sprintf("Checked out '%s' for '%s'", ref, url))
 	}
 	return gitRepo, nil
@@ -258,7 +493,7 @@ func (g *GitRepo) CheckoutBranch(branch string) error {
 	ref := plumbing.NewHashReference(b, g.ref.Hash())
 	err := g.repo.Storer.SetReference(ref)
 	if err != nil {
-		log.Fatal(err)
+		return fmt.Errorf("Error creating branch: %v", err)
 	}
 
 	w, err := g.repo.Worktree()
@@ -281,7 +516,22 @@ func (g *GitRepo) CheckoutBranch(branch string) error {
 	return nil
 }
 
+// ErrNoChanges is returned by Commit when none of the files changed
+var ErrNoChanges = fmt.Errorf("no changes to commit")
+
+// DefaultAuthorName and DefaultAuthorEmail are the author of commits made by
+// Commit
+const (
+	DefaultAuthorName  = "devops-automation"
+	DefaultAuthorEmail = "devops-automation@example.com"
+)
+
 func (g *GitRepo) Commit(filenames []string, message string) error {
+	return g.CommitAs(filenames, message, DefaultAuthorName, DefaultAuthorEmail)
+}
+
+// CommitAs commits the files with the author's name and email
+func (g *GitRepo) CommitAs(filenames []string, message, authorName, authorEmail string) error {
 	w, err := g.repo.Worktree()
 	if err != nil {
 		return fmt.Errorf("Could not get Worktree: %v", err)
@@ -293,7 +543,7 @@ func (g *GitRepo) Commit(filenames []string, message string) error {
 	}
 
 	if status.IsClean() {
-		return fmt.Errorf("no changes to commit")
+		return ErrNoChanges
 	}
 
 	filesInStatus := []string{}
@@ -312,7 +562,7 @@ func (g *GitRepo) Commit(filenames []string, message string) error {
 	}
 
 	if !isFileInStatus {
-		return fmt.Errorf("no changes to commit")
+		return ErrNoChanges
 	}
 
 	for _, f := range filenames {
@@ -326,11 +576,14 @@ func (g *GitRepo) Commit(filenames []string, message string) error {
 
 	commit, err := w.Commit(message, &git.CommitOptions{
 		Author: &object.Signature{
-			Name:  "devops-automation",
-			Email: "devops-automation@example.com",
+			Name:  authorName,
+			Email: authorEmail,
 			When:  time.Now(),
 		},
 	})
+	if err != nil {
+		return fmt.Errorf("Error committing: %v", err)
+	}
 
 	fmt.Printf("This is the commit object: %v\n", commit)
 
@@ -344,12 +597,21 @@ func (g *GitRepo) Commit(filenames []string, message string) error {
 }
 
 func (g *GitRepo) Push(target plumbing.ReferenceName) error {
+	return g.push(target, "")
+}
+
+// ForcePush replaces the target branch with the checked out branch
+func (g *GitRepo) ForcePush(target plumbing.ReferenceName) error {
+	return g.push(target, "+")
+}
+
+func (g *GitRepo) push(target plumbing.ReferenceName, force string) error {
 	fmt.Printf("Pushing to repo\n")
 	if target == "" {
 		target = g.ref.Name()
 	}
 	err := g.repo.Push(&git.PushOptions{
-		RefSpecs: []config.RefSpec{config.RefSpec(g.ref.Name() + ":" + target)},
+		RefSpecs: []config.RefSpec{config.RefSpec(force + g.ref.Name().String() + ":" + target.String())},
 		Auth:     g.auth,
 	})
 	if err != nil {
@@ -357,3 +619,40 @@ func (g *GitRepo) Push(target plumbing.ReferenceName) error {
 	}
 	return nil
 }
+
+// resolveRef lists the references of the remote repo, like `git ls-remote`,
+// and returns the commit hash that ref points to. The ref can be a branch, a
+// tag or the abbreviated hash a branch or tag points to. An empty ref
+// resolves the remote's default branch (HEAD). A full commit hash is returned
+// as-is.
+func resolveRef(url string, auth gitauth.AuthMethod, ref string) (string, error) {
+	if len(ref) == 40 && isHash(ref) {
+		return strings.ToLower(ref), nil
+	}
+
+	refs, err := listRemote(url, auth)
+	if err != nil {
+		return "", err
+	}
+	_, hash, found := findRef(refs, ref)
+	if !found {
+		return "", fmt.Errorf("ref '%s' not found in %s", ref, url)
+	}
+	return hash.String(), nil
+}
+
+// GitHTTPResolveRef returns the commit hash of ref in the remote repo without
+// cloning it. The requests go through proxy when it is not nil.
+func GitHTTPResolveRef(url, user, password, ref string, proxy *HTTPProxy) (string, error) {
+	return resolveRef(url, httpAuthMethod(user, password, proxy), ref)
+}
+
+// GitSSHResolveRef returns the commit hash of ref in the remote repo without
+// cloning it
+func GitSSHResolveRef(url, sshKeyFilename, ref string, hostKeyCallback ssh.HostKeyCallback) (string, error) {
+	auth, err := sshAuthMethod(sshKeyFilename, hostKeyCallback)
+	if err != nil {
+		return "", err
+	}
+	return resolveRef(url, auth, ref)
+}
@@ -0,0 +1,223 @@
+package gitclient
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	git "gopkg.in/src-d/go-git.v4"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/object"
+)
+
+func TestResolveRef(t *testing.T) {
+	dir, err := ioutil.TempDir("", "resolveref")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	repo, err := git.PlainInit(dir, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w, err := repo.Worktree()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "main.tf"), []byte(""), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Add("main.tf"); err != nil {
+		t.Fatal(err)
+	}
+	hash, err := w.Commit("initial", &git.CommitOptions{
+		Author: &object.Signature{Name: "test", Email: "test@example.com", When: time.Now()},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.CreateTag("v1.0.0", hash, nil); err != nil {
+		t.Fatal(err)
+	}
+	err = repo.Storer.SetReference(plumbing.NewHashReference(plumbing.NewBranchReferenceName("feature"), hash))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, ref := range []string{"", "master", "feature", "v1.0.0", hash.String()} {
+		got, err := resolveRef(dir, nil, ref)
+		if err != nil {
+			t.Errorf("resolveRef(%q) returned error: %v", ref, err)
+			continue
+		}
+		if got != hash.String() {
+			t.Errorf("resolveRef(%q) = %s, want %s", ref, got, hash)
+		}
+	}
+
+	if _, err := resolveRef(dir, nil, "does-not-exist"); err == nil {
+		t.Error("expected an error for an unknown ref")
+	}
+}
+
+func TestGitHTTPDownload(t *testing.T) {
+	dir, err := ioutil.TempDir("", "download")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// The default branch is neither master nor main
+	remote := filepath.Join(dir, "remote")
+	repo, err := git.PlainInit(remote, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = repo.Storer.SetReference(plumbing.NewSymbolicReference(plumbing.HEAD, plumbing.NewBranchReferenceName("trunk")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Join(remote, "vars"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	first := commitFile(t, repo, remote, "vars/a.tfvars", "a = 1")
+	commitFile(t, repo, remote, "main.tf", "# main")
+	if _, err := repo.CreateTag("v1.0.0", plumbing.NewHash(first), nil); err != nil {
+		t.Fatal(err)
+	}
+	head, err := repo.Head()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = repo.CreateTag("v2.0.0", head.Hash(), &git.CreateTagOptions{
+		Tagger:  &object.Signature{Name: "test", Email: "test@example.com", When: time.Now()},
+		Message: "v2.0.0",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	last := commitFile(t, repo, remote, "outputs.tf", "# outputs")
+
+	tests := []struct {
+		ref   string
+		paths []string
+		want  string
+		files []string
+		not   []string
+	}{
+		{ref: "", want: last, files: []string{"main.tf", "outputs.tf", "vars/a.tfvars"}},
+		{ref: "trunk", want: last, files: []string{"outputs.tf"}},
+		{ref: "v1.0.0", want: first, files: []string{"vars/a.tfvars"}, not: []string{"main.tf"}},
+		{ref: "v2.0.0", want: head.Hash().String(), files: []string{"main.tf"}, not: []string{"outputs.tf"}},
+		{ref: last[:7], want: last, files: []string{"outputs.tf"}},
+		{ref: head.Hash().String()[:8], want: head.Hash().String(), files: []string{"main.tf"}, not: []string{"outputs.tf"}},
+		{ref: "", paths: []string{"vars"}, want: last, files: []string{"vars/a.tfvars"}, not: []string{"main.tf", "outputs.tf"}},
+		{ref: "", paths: []string{"/main.tf", "vars/"}, want: last, files: []string{"main.tf", "vars/a.tfvars"}, not: []string{"outputs.tf"}},
+		{ref: "", paths: []string{""}, want: last, files: []string{"main.tf", "outputs.tf", "vars/a.tfvars"}},
+	}
+	for i, test := range tests {
+		dest := filepath.Join(dir, fmt.Sprintf("checkout%d", i))
+		gitRepo, err := GitHTTPDownload(remote, dest, "", "", test.ref, test.paths, nil)
+		if err != nil {
+			t.Errorf("GitHTTPDownload(%q, %v) returned error: %v", test.ref, test.paths, err)
+			continue
+		}
+		if got, _ := gitRepo.HashString(); got != test.want {
+			t.Errorf("GitHTTPDownload(%q, %v) checked out %s, want %s", test.ref, test.paths, got, test.want)
+		}
+		for _, f := range test.files {
+			if _, err := os.Stat(filepath.Join(dest, f)); err != nil {
+				t.Errorf("GitHTTPDownload(%q, %v) did not check out %s", test.ref, test.paths, f)
+			}
+		}
+		for _, f := range test.not {
+			if _, err := os.Stat(filepath.Join(dest, f)); err == nil {
+				t.Errorf("GitHTTPDownload(%q, %v) checked out %s", test.ref, test.paths, f)
+			}
+		}
+	}
+
+	gitRepo, err := GitHTTPDownload(remote, filepath.Join(dir, "branch"), "", "", "trunk", nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if branch, err := gitRepo.BranchName(); err != nil || branch != "refs/heads/trunk" {
+		t.Errorf("BranchName() = %q, %v, want refs/heads/trunk", branch, err)
+	}
+
+	if _, err := GitHTTPDownload(remote, filepath.Join(dir, "missing"), "", "", "missing", nil, nil); err == nil {
+		t.Error("expected an error for an unknown ref")
+	}
+}
+
+func TestCommitAndPush(t *testing.T) {
+	dir, err := ioutil.TempDir("", "push")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	remote := filepath.Join(dir, "remote")
+	repo, err := git.PlainInit(remote, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	commitFile(t, repo, remote, "main.tf", "# main")
+
+	export := func(name, content string) GitRepo {
+		dest := filepath.Join(dir, name)
+		gitRepo, err := GitHTTPDownload(remote, dest, "", "", "master", nil, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := gitRepo.CheckoutBranch(""); err != nil {
+			t.Fatal(err)
+		}
+		if err := gitRepo.CommitAs([]string{"main.tf"}, "no changes", "tfo", "tfo@example.com"); err != ErrNoChanges {
+			t.Errorf("expected ErrNoChanges, got %v", err)
+		}
+		if err := ioutil.WriteFile(filepath.Join(dest, "export.tfvars"), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := gitRepo.CommitAs([]string{"export.tfvars"}, "export", "tfo", "tfo@example.com"); err != nil {
+			t.Fatal(err)
+		}
+		return gitRepo
+	}
+
+	first := export("first", "a = 1")
+	if err := first.Push("refs/heads/export"); err != nil {
+		t.Fatal(err)
+	}
+	ref, err := repo.Reference("refs/heads/export", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	commit, err := repo.CommitObject(ref.Hash())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if commit.Author.Name != "tfo" || commit.Author.Email != "tfo@example.com" || commit.Message != "export" {
+		t.Errorf("unexpected commit %v", commit)
+	}
+
+	// The second export does not build on the first
+	second := export("second", "a = 2")
+	if err := second.Push("refs/heads/export"); err == nil {
+		t.Error("expected a non fast-forward push to fail")
+	}
+	if err := second.ForcePush("refs/heads/export"); err != nil {
+		t.Fatal(err)
+	}
+	ref, err = repo.Reference("refs/heads/export", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := second.HashString(); ref.Hash().String() != got {
+		t.Errorf("expected the export branch at %s, got %s", got, ref.Hash())
+	}
+}
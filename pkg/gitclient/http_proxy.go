@@ -0,0 +1,139 @@
+package gitclient
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	gitauth "gopkg.in/src-d/go-git.v4/plumbing/transport"
+	gitTransportClient "gopkg.in/src-d/go-git.v4/plumbing/transport/client"
+	githttp "gopkg.in/src-d/go-git.v4/plumbing/transport/http"
+)
+
+// go-git has a single http transport per protocol for the whole process.
+// The transport installed here sends a request through the HTTPProxy of its
+// git operation and every other request directly, so a proxy never leaks
+// into the downloads of other resources.
+func init() {
+	direct := http.DefaultTransport.(*http.Transport).Clone()
+	direct.ResponseHeaderTimeout = responseHeaderTimeout
+	client := githttp.NewClient(&http.Client{Transport: proxyRoundTripper{direct: direct}})
+	gitTransportClient.InstallProtocol("http", client)
+	gitTransportClient.InstallProtocol("https", client)
+}
+
+// proxyHeader tags the requests of an operation with its HTTPProxy. go-git
+// replaces the context of some requests, so the tag is a header. It is
+// removed before the request is sent.
+const proxyHeader = "X-Tfo-Http-Proxy"
+
+// responseHeaderTimeout ends a request to a remote that accepted the
+// connection but never answers. go-git does not cancel these requests.
+const responseHeaderTimeout = 30 * time.Second
+
+// httpProxies are the open proxies by id
+var (
+	httpProxies  sync.Map
+	httpProxySeq uint64
+)
+
+// proxyRoundTripper uses the transport of the request's HTTPProxy
+type proxyRoundTripper struct {
+	direct http.RoundTripper
+}
+
+func (t proxyRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	id := req.Header.Get(proxyHeader)
+	if id == "" {
+		return t.direct.RoundTrip(req)
+	}
+	p, ok := httpProxies.Load(id)
+	if !ok {
+		return nil, fmt.Errorf("http proxy %s is closed", id)
+	}
+	req = req.Clone(req.Context())
+	req.Header.Del(proxyHeader)
+	return p.(*HTTPProxy).transport.RoundTrip(req)
+}
+
+// HTTPProxy sends the http(s) requests of git operations through a dial
+// function, eg the connection to an ssh server. Its connections are not
+// shared with other operations.
+type HTTPProxy struct {
+	id        string
+	transport *http.Transport
+}
+
+// NewHTTPProxy returns a proxy that dials with dial. It has to be closed.
+func NewHTTPProxy(dial func(network, address string) (net.Conn, error)) *HTTPProxy {
+	p := &HTTPProxy{
+		id: strconv.FormatUint(atomic.AddUint64(&httpProxySeq, 1), 10),
+		transport: &http.Transport{
+			DialContext: func(ctx context.Context, network, address string) (net.Conn, error) {
+				return dial(network, address)
+			},
+			ForceAttemptHTTP2:     true,
+			ResponseHeaderTimeout: responseHeaderTimeout,
+		},
+	}
+	httpProxies.Store(p.id, p)
+	return p
+}
+
+// Close stops sending requests through the proxy and closes its idle
+// connections. The dial function's connection is closed by its owner.
+func (p *HTTPProxy) Close() {
+	httpProxies.Delete(p.id)
+	p.transport.CloseIdleConnections()
+}
+
+// proxyAuth is the auth method of an operation that uses an HTTPProxy. The
+// auth method is the only thing go-git hands from an operation to each of its
+// requests.
+type proxyAuth struct {
+	auth  githttp.AuthMethod
+	proxy *HTTPProxy
+}
+
+func (a proxyAuth) SetAuth(r *http.Request) {
+	if a.auth != nil {
+		a.auth.SetAuth(r)
+	}
+	r.Header.Set(proxyHeader, a.proxy.id)
+}
+
+func (a proxyAuth) Name() string {
+	if a.auth != nil {
+		return a.auth.Name()
+	}
+	return "http-proxy"
+}
+
+func (a proxyAuth) String() string {
+	if a.auth != nil {
+		return a.auth.String()
+	}
+	return a.Name()
+}
+
+// httpAuthMethod authenticates with the token when it is set and sends the
+// requests through the proxy when it is not nil
+func httpAuthMethod(user, password string, proxy *HTTPProxy) gitauth.AuthMethod {
+	var auth githttp.AuthMethod
+	if password != "" {
+		auth = passwordAuthMethod(user, password).(githttp.AuthMethod)
+	}
+	if proxy != nil {
+		return proxyAuth{auth: auth, proxy: proxy}
+	}
+	if auth == nil {
+		// A nil interface, not a nil *BasicAuth
+		return nil
+	}
+	return auth
+}
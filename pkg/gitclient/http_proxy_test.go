@@ -0,0 +1,48 @@
+package gitclient
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestHTTPProxyIsScopedToItsOperation(t *testing.T) {
+	var tagged int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get(proxyHeader) != "" {
+			atomic.AddInt32(&tagged, 1)
+		}
+		http.NotFound(w, r)
+	}))
+	defer server.Close()
+	url := server.URL + "/repo.git"
+
+	var dials int32
+	proxy := NewHTTPProxy(func(network, address string) (net.Conn, error) {
+		atomic.AddInt32(&dials, 1)
+		return net.Dial(network, address)
+	})
+
+	// The repo does not exist, only the route of the requests matters
+	GitHTTPResolveRef(url, "git", "token", "master", proxy)
+	if dials == 0 {
+		t.Error("expected the request to go through the proxy")
+	}
+	GitHTTPResolveRef(url, "git", "token", "master", nil)
+	GitHTTPResolveRef(url, "", "", "master", nil)
+	if dials != 1 {
+		t.Errorf("expected requests without the proxy to be sent directly, got %d dials", dials)
+	}
+	if tagged != 0 {
+		t.Errorf("the proxy header was sent to the server %d times", tagged)
+	}
+
+	proxy.Close()
+	_, err := GitHTTPResolveRef(url, "", "", "master", proxy)
+	if err == nil || !strings.Contains(err.Error(), "is closed") {
+		t.Errorf("expected an error for a closed proxy, got %v", err)
+	}
+}
@@ -0,0 +1,54 @@
+package gitclient
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// HostKeyCallback returns a callback that verifies host keys against the
+// known_hosts data. A host whose key does not match is always rejected. A
+// host that is not in the data is only rejected when strict is true.
+func HostKeyCallback(knownHosts []byte, strict bool) (ssh.HostKeyCallback, error) {
+	// knownhosts only reads files
+	file, err := ioutil.TempFile("", "known_hosts")
+	if err != nil {
+		return nil, fmt.Errorf("error creating tmpfile: %v", err)
+	}
+	defer os.Remove(file.Name())
+	_, err = file.Write(knownHosts)
+	file.Close()
+	if err != nil {
+		return nil, fmt.Errorf("error writing tmpfile: %v", err)
+	}
+
+	callback, err := knownhosts.New(file.Name())
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse known_hosts: %v", err)
+	}
+	return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		err := callback(hostname, remote, key)
+		var keyErr *knownhosts.KeyError
+		if errors.As(err, &keyErr) && len(keyErr.Want) == 0 {
+			if strict {
+				return fmt.Errorf("host '%s' is not in known_hosts", hostname)
+			}
+			return nil
+		}
+		return err
+	}, nil
+}
+
+// HostKeyCallbackFor verifies host keys as if the connection was made to
+// address. This is used when the connection goes to the local port of a
+// tunnel instead of the host.
+func HostKeyCallbackFor(callback ssh.HostKeyCallback, address string) ssh.HostKeyCallback {
+	return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		return callback(address, remote, key)
+	}
+}
@@ -0,0 +1,63 @@
+package gitclient
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"net"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+func newHostKey(t *testing.T) ssh.PublicKey {
+	pub, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := ssh.NewPublicKey(pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func TestHostKeyCallback(t *testing.T) {
+	known := newHostKey(t)
+	other := newHostKey(t)
+	data := []byte(knownhosts.Line([]string{"github.com"}, known) + "\n")
+	remote := &net.TCPAddr{IP: net.ParseIP("127.0.0.1"), Port: 22}
+
+	for _, strict := range []bool{false, true} {
+		callback, err := HostKeyCallback(data, strict)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := callback("github.com:22", remote, known); err != nil {
+			t.Errorf("strict=%v: known host key rejected: %v", strict, err)
+		}
+		if err := callback("github.com:22", remote, other); err == nil {
+			t.Errorf("strict=%v: changed host key accepted", strict)
+		}
+		err = callback("gitlab.com:22", remote, other)
+		if strict && err == nil {
+			t.Errorf("unknown host accepted in strict mode")
+		}
+		if !strict && err != nil {
+			t.Errorf("unknown host rejected: %v", err)
+		}
+
+		// A tunnel's local port is checked as the host behind it
+		tunnel := HostKeyCallbackFor(callback, "github.com:22")
+		if err := tunnel("127.0.0.1:40022", remote, known); err != nil {
+			t.Errorf("strict=%v: known host key rejected through tunnel: %v", strict, err)
+		}
+		if err := tunnel("127.0.0.1:40022", remote, other); err == nil {
+			t.Errorf("strict=%v: changed host key accepted through tunnel", strict)
+		}
+	}
+
+	if _, err := HostKeyCallback([]byte("not a known_hosts line\n"), true); err == nil {
+		t.Errorf("bad known_hosts data was parsed")
+	}
+}
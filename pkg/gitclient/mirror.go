@@ -0,0 +1,284 @@
+package gitclient
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	"gopkg.in/src-d/go-billy.v4/osfs"
+	git "gopkg.in/src-d/go-git.v4"
+	"gopkg.in/src-d/go-git.v4/config"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/cache"
+	gitauth "gopkg.in/src-d/go-git.v4/plumbing/transport"
+	"gopkg.in/src-d/go-git.v4/storage/filesystem"
+)
+
+// mirrorHEAD is where the remote's default branch is fetched to
+const mirrorHEAD = "refs/remotes/origin/HEAD"
+
+// lastUsedFile is touched in a mirror every time it is used
+const lastUsedFile = "tfo-last-used"
+
+// mirrorFetchTimeout bounds the fetch into a mirror, which holds the lock of
+// the mirror. It is a variable so that tests can shorten it.
+var mirrorFetchTimeout = 30 * time.Second
+
+// MirrorCache keeps a bare copy of each git repo on disk so that downloading
+// a repo again only fetches the objects that are new. Checkouts are written
+// from the mirror into the destination directory. When the mirrors take more
+// than MaxBytes, the least recently used ones are removed.
+type MirrorCache struct {
+	Dir      string
+	MaxBytes int64
+
+	mu    sync.Mutex
+	inUse map[string]int
+	locks map[string]chan struct{}
+}
+
+// NewMirrorCache creates the cache directory. Mirrors left by a previous
+// process are reused.
+func NewMirrorCache(dir string, maxBytes int64) (*MirrorCache, error) {
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create git mirror cache: %v", err)
+	}
+	return &MirrorCache{
+		Dir:      dir,
+		MaxBytes: maxBytes,
+		inUse:    make(map[string]int),
+		locks:    make(map[string]chan struct{}),
+	}, nil
+}
+
+// mirrorPath is the directory of the url's mirror
+func (c *MirrorCache) mirrorPath(url string) string {
+	sum := sha256.Sum256([]byte(url))
+	return filepath.Join(c.Dir, hex.EncodeToString(sum[:])[:16])
+}
+
+// acquire locks the mirror and marks it as in use so it is not evicted. It
+// gives up when the context is done before the lock is free.
+func (c *MirrorCache) acquire(ctx context.Context, path string) (func(), error) {
+	c.mu.Lock()
+	lock, found := c.locks[path]
+	if !found {
+		lock = make(chan struct{}, 1)
+		c.locks[path] = lock
+	}
+	c.inUse[path]++
+	c.mu.Unlock()
+
+	select {
+	case lock <- struct{}{}:
+	case <-ctx.Done():
+		c.unuse(path)
+		return nil, ctx.Err()
+	}
+	return func() {
+		<-lock
+		c.unuse(path)
+	}, nil
+}
+
+// unuse undoes acquire's mark
+func (c *MirrorCache) unuse(path string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.inUse[path]--
+	if c.inUse[path] == 0 {
+		delete(c.inUse, path)
+	}
+}
+
+// Download fetches the url into its mirror and checks out ref into repoDir.
+// The ref can be a branch, a tag or a full or abbreviated commit hash. An
+// empty ref checks out the remote's default branch. When paths is not empty,
+// only the files under paths are checked out.
+func (c *MirrorCache) Download(ctx context.Context, url string, auth gitauth.AuthMethod, ref, repoDir string, paths []string) (GitRepo, error) {
+	path := c.mirrorPath(url)
+	// A download that waits for a hung fetch of the same repo gives up
+	// after as long as a fetch takes
+	lockCtx, cancelLock := context.WithTimeout(ctx, mirrorFetchTimeout)
+	release, err := c.acquire(lockCtx, path)
+	cancelLock()
+	if err != nil {
+		return GitRepo{}, fmt.Errorf("timeout occured waiting for the mirror of %s: %v", url, err)
+	}
+	fetching := false
+	defer func() {
+		if !fetching {
+			release()
+		}
+	}()
+
+	storage := filesystem.NewStorage(osfs.New(path), cache.NewObjectLRUDefault())
+	mirror, err := git.Open(storage, nil)
+	if err == git.ErrRepositoryNotExists {
+		mirror, err = git.Init(storage, nil)
+		if err == nil {
+			_, err = mirror.CreateRemote(&config.RemoteConfig{Name: "origin", URLs: []string{url}})
+		}
+	}
+	if err != nil {
+		return GitRepo{}, fmt.Errorf("unable to open mirror of %s: %v", url, err)
+	}
+
+	// go-git only watches the context once it is connected. A fetch that
+	// hangs before that keeps the lock until it returns, so that no other
+	// download writes to the mirror at the same time. The http transport
+	// bounds how long it waits for the remote.
+	fetchCtx, cancel := context.WithTimeout(ctx, mirrorFetchTimeout)
+	defer cancel()
+	fetched := make(chan error, 1)
+	go func() {
+		fetched <- mirror.FetchContext(fetchCtx, &git.FetchOptions{
+			RemoteName: "origin",
+			Auth:       auth,
+			Force:      true,
+			Tags:       git.AllTags,
+			RefSpecs: []config.RefSpec{
+				"+refs/heads/*:refs/heads/*",
+				"+HEAD:" + mirrorHEAD,
+			},
+		})
+	}()
+	select {
+	case err = <-fetched:
+	case <-fetchCtx.Done():
+		fetching = true
+		go func() {
+			<-fetched
+			release()
+		}()
+		return GitRepo{}, fmt.Errorf("timeout occured fetching %s: %v", url, fetchCtx.Err())
+	}
+	if err != nil && err != git.NoErrAlreadyUpToDate {
+		return GitRepo{}, fmt.Errorf("Could not fetch %s: %v", url, err)
+	}
+	now := time.Now()
+	ioutil.WriteFile(filepath.Join(path, lastUsedFile), []byte(now.Format(time.RFC3339)), 0644)
+
+	hash, err := mirrorResolve(mirror, ref)
+	if err != nil {
+		return GitRepo{}, fmt.Errorf("unable to resolve '%s' in %s: %v", ref, url, err)
+	}
+
+	// The index of the mirror belongs to the previous checkout
+	os.Remove(filepath.Join(path, "index"))
+	repo, err := git.Open(storage, osfs.New(repoDir))
+	if err != nil {
+		return GitRepo{}, fmt.Errorf("unable to open mirror of %s: %v", url, err)
+	}
+	head, err := checkoutCommit(ctx, repo, "", hash, auth, paths)
+	if err != nil {
+		return GitRepo{}, err
+	}
+	return GitRepo{auth: auth, repo: repo, ref: head}, nil
+}
+
+// mirrorResolve returns the commit, or annotated tag, the ref points to in
+// the mirror
+func mirrorResolve(mirror *git.Repository, ref string) (plumbing.Hash, error) {
+	candidates := []plumbing.ReferenceName{mirrorHEAD}
+	if ref != "" {
+		candidates = []plumbing.ReferenceName{
+			plumbing.NewBranchReferenceName(ref),
+			plumbing.NewTagReferenceName(ref),
+			plumbing.ReferenceName(ref),
+		}
+	}
+	for _, name := range candidates {
+		r, err := mirror.Reference(name, true)
+		if err == nil {
+			return r.Hash(), nil
+		}
+	}
+	if isHash(ref) {
+		return findCommit(mirror, ref)
+	}
+	return plumbing.ZeroHash, fmt.Errorf("ref not found")
+}
+
+// Evict removes the least recently used mirrors until the cache takes at
+// most MaxBytes. Mirrors that are in use are kept.
+func (c *MirrorCache) Evict() error {
+	if c.MaxBytes <= 0 {
+		return nil
+	}
+	entries, err := ioutil.ReadDir(c.Dir)
+	if err != nil {
+		return fmt.Errorf("unable to list git mirror cache: %v", err)
+	}
+
+	type mirror struct {
+		path     string
+		size     int64
+		lastUsed time.Time
+	}
+	mirrors := []mirror{}
+	var total int64
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		m := mirror{path: filepath.Join(c.Dir, entry.Name()), lastUsed: entry.ModTime()}
+		if info, err := os.Stat(filepath.Join(m.path, lastUsedFile)); err == nil {
+			m.lastUsed = info.ModTime()
+		}
+		filepath.Walk(m.path, func(_ string, info os.FileInfo, err error) error {
+			if err == nil && !info.IsDir() {
+				m.size += info.Size()
+			}
+			return nil
+		})
+		total += m.size
+		mirrors = append(mirrors, m)
+	}
+	sort.Slice(mirrors, func(i, j int) bool {
+		return mirrors[i].lastUsed.Before(mirrors[j].lastUsed)
+	})
+
+	for _, m := range mirrors {
+		if total <= c.MaxBytes {
+			break
+		}
+		c.mu.Lock()
+		if c.inUse[m.path] > 0 {
+			c.mu.Unlock()
+			continue
+		}
+		err := os.RemoveAll(m.path)
+		delete(c.locks, m.path)
+		c.mu.Unlock()
+		if err != nil {
+			return fmt.Errorf("unable to remove git mirror: %v", err)
+		}
+		total -= m.size
+	}
+	return nil
+}
+
+// MirrorHTTPDownload downloads the repo through the cache with a token. The
+// requests go through proxy when it is not nil.
+func (c *MirrorCache) MirrorHTTPDownload(ctx context.Context, url, repoDir, user, password, ref string, paths []string, proxy *HTTPProxy) (GitRepo, error) {
+	return c.Download(ctx, url, httpAuthMethod(user, password, proxy), ref, repoDir, paths)
+}
+
+// MirrorSSHDownload downloads the repo through the cache with an ssh key
+func (c *MirrorCache) MirrorSSHDownload(ctx context.Context, url, repoDir, sshKeyFilename, ref string, paths []string, hostKeyCallback ssh.HostKeyCallback) (GitRepo, error) {
+	auth, err := sshAuthMethod(sshKeyFilename, hostKeyCallback)
+	if err != nil {
+		return GitRepo{}, err
+	}
+	return c.Download(ctx, url, auth, ref, repoDir, paths)
+}
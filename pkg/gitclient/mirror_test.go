@@ -0,0 +1,183 @@
+package gitclient
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	git "gopkg.in/src-d/go-git.v4"
+	"gopkg.in/src-d/go-git.v4/plumbing/object"
+)
+
+func commitFile(t *testing.T, repo *git.Repository, dir, filename, content string) string {
+	w, err := repo.Worktree()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, filename), []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Add(filename); err != nil {
+		t.Fatal(err)
+	}
+	hash, err := w.Commit("add "+filename, &git.CommitOptions{
+		Author: &object.Signature{Name: "test", Email: "test@example.com", When: time.Now()},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return hash.String()
+}
+
+func TestMirrorCache(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mirror")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	remote := filepath.Join(dir, "remote")
+	repo, err := git.PlainInit(remote, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	first := commitFile(t, repo, remote, "main.tf", "# first")
+
+	c, err := NewMirrorCache(filepath.Join(dir, "cache"), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	checkout := func(ref, want string) {
+		t.Helper()
+		dest, err := ioutil.TempDir(dir, "checkout")
+		if err != nil {
+			t.Fatal(err)
+		}
+		gitRepo, err := c.Download(ctx, remote, nil, ref, dest, nil)
+		if err != nil {
+			t.Fatalf("Download(%q) returned error: %v", ref, err)
+		}
+		if hash, _ := gitRepo.HashString(); hash != want {
+			t.Errorf("Download(%q) checked out %s, want %s", ref, hash, want)
+		}
+		if _, err := os.Stat(filepath.Join(dest, "main.tf")); err != nil {
+			t.Errorf("Download(%q) did not check out main.tf: %v", ref, err)
+		}
+	}
+
+	checkout("", first)
+
+	// The second download fetches the new commit into the existing mirror
+	second := commitFile(t, repo, remote, "vars.tf", "# second")
+	checkout("master", second)
+	checkout(first, first)
+	checkout(first[:7], first)
+	entries, _ := ioutil.ReadDir(c.Dir)
+	if len(entries) != 1 {
+		t.Errorf("cache has %d mirrors, want 1", len(entries))
+	}
+
+	if _, err := c.Download(ctx, remote, nil, "missing", filepath.Join(dir, "missing"), nil); err == nil {
+		t.Error("Download of a missing ref did not return an error")
+	}
+
+	c.MaxBytes = 1
+	if err := c.Evict(); err != nil {
+		t.Fatal(err)
+	}
+	entries, _ = ioutil.ReadDir(c.Dir)
+	if len(entries) != 0 {
+		t.Errorf("cache has %d mirrors after eviction, want 0", len(entries))
+	}
+}
+
+func TestMirrorCacheFetchTimeout(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mirror")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// The remote accepts connections and never answers until they are
+	// hung up
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	conns := make(chan net.Conn, 10)
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			conns <- conn
+		}
+	}()
+	hangUp := func() {
+		for {
+			select {
+			case conn := <-conns:
+				conn.Close()
+			default:
+				return
+			}
+		}
+	}
+	defer hangUp()
+
+	defer func(timeout time.Duration) { mirrorFetchTimeout = timeout }(mirrorFetchTimeout)
+	mirrorFetchTimeout = 100 * time.Millisecond
+
+	c, err := NewMirrorCache(filepath.Join(dir, "cache"), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	url := "http://" + listener.Addr().String() + "/org/repo.git"
+	download := func() error {
+		done := make(chan error, 1)
+		go func() {
+			_, err := c.Download(context.Background(), url, nil, "", filepath.Join(dir, "checkout"), nil)
+			done <- err
+		}()
+		select {
+		case err := <-done:
+			if err == nil {
+				t.Fatal("Download from a hung remote did not return an error")
+			}
+			return err
+		case <-time.After(5 * time.Second):
+			t.Fatal("Download from a hung remote did not time out")
+		}
+		return nil
+	}
+
+	if err := download(); !strings.Contains(err.Error(), "fetching") {
+		t.Fatalf("expected the fetch to time out, got %v", err)
+	}
+	// The abandoned fetch still holds the mirror
+	if err := download(); !strings.Contains(err.Error(), "waiting for the mirror") {
+		t.Fatalf("expected the download to wait for the mirror, got %v", err)
+	}
+	// Once the fetch returns the mirror is free again
+	hangUp()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		err := download()
+		if strings.Contains(err.Error(), "fetching") {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("the mirror was not released after the fetch returned: %v", err)
+		}
+		hangUp()
+	}
+}
@@ -0,0 +1,177 @@
+// Package githubapp mints the installation tokens of a GitHub App. The tokens
+// are cached and replaced shortly before they expire.
+package githubapp
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultAPIURL is the api of github.com
+const DefaultAPIURL = "https://api.github.com"
+
+// RefreshBefore is how long before it expires a cached token is replaced
+const RefreshBefore = 10 * time.Minute
+
+// jwtLifetime is how long the app's JWT is valid. GitHub allows at most 10
+// minutes.
+const jwtLifetime = 9 * time.Minute
+
+// App is a GitHub App installation
+type App struct {
+	ID             int64
+	InstallationID int64
+	// PrivateKey is the PEM encoded RSA key of the app
+	PrivateKey []byte
+	// APIURL is the api of a GitHub Enterprise server. Defaults to
+	// DefaultAPIURL.
+	APIURL string
+}
+
+// Token is an installation token
+type Token struct {
+	Token     string    `json:"token"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// TokenCache mints installation tokens and keeps them until they are about
+// to expire
+type TokenCache struct {
+	mu     sync.Mutex
+	client *http.Client
+	tokens map[string]Token
+	now    func() time.Time
+}
+
+// NewTokenCache returns a cache that mints tokens with the http client
+func NewTokenCache(client *http.Client) *TokenCache {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &TokenCache{
+		client: client,
+		tokens: make(map[string]Token),
+		now:    time.Now,
+	}
+}
+
+func (app App) apiURL() string {
+	if app.APIURL == "" {
+		return DefaultAPIURL
+	}
+	return strings.TrimSuffix(app.APIURL, "/")
+}
+
+func (app App) key() string {
+	return fmt.Sprintf("%s/%d/%d", app.apiURL(), app.ID, app.InstallationID)
+}
+
+// Token returns the installation token of the app. A new token is minted
+// when the cached one expires within RefreshBefore.
+func (c *TokenCache) Token(ctx context.Context, app App) (Token, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := c.now()
+	if token, found := c.tokens[app.key()]; found && token.ExpiresAt.Sub(now) > RefreshBefore {
+		return token, nil
+	}
+	token, err := mintToken(ctx, c.client, app, now)
+	if err != nil {
+		return Token{}, err
+	}
+	c.tokens[app.key()] = token
+	return token, nil
+}
+
+// mintToken exchanges the app's JWT for an installation token
+func mintToken(ctx context.Context, client *http.Client, app App, now time.Time) (Token, error) {
+	jwt, err := app.jwt(now)
+	if err != nil {
+		return Token{}, err
+	}
+	url := fmt.Sprintf("%s/app/installations/%d/access_tokens", app.apiURL(), app.InstallationID)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, nil)
+	if err != nil {
+		return Token{}, err
+	}
+	req.Header.Set("Authorization", "Bearer "+jwt)
+	req.Header.Set("Accept", "application/vnd.github.v3+json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return Token{}, fmt.Errorf("unable to mint installation token: %v", err)
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return Token{}, fmt.Errorf("unable to read installation token: %v", err)
+	}
+	if resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusOK {
+		return Token{}, fmt.Errorf("unable to mint installation token: %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+
+	token := Token{}
+	err = json.Unmarshal(body, &token)
+	if err != nil {
+		return Token{}, fmt.Errorf("unable to parse installation token: %v", err)
+	}
+	if token.Token == "" {
+		return Token{}, fmt.Errorf("installation token is empty")
+	}
+	return token, nil
+}
+
+// jwt signs the RS256 JWT the app authenticates with. It is issued a minute
+// in the past to allow for clock drift.
+func (app App) jwt(now time.Time) (string, error) {
+	key, err := parsePrivateKey(app.PrivateKey)
+	if err != nil {
+		return "", err
+	}
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT"})
+	claims, _ := json.Marshal(map[string]interface{}{
+		"iat": now.Add(-time.Minute).Unix(),
+		"exp": now.Add(jwtLifetime).Unix(),
+		"iss": app.ID,
+	})
+	unsigned := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(claims)
+	sum := sha256.Sum256([]byte(unsigned))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, sum[:])
+	if err != nil {
+		return "", fmt.Errorf("unable to sign jwt: %v", err)
+	}
+	return unsigned + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+// parsePrivateKey reads the PKCS1 key GitHub generates or a PKCS8 key
+func parsePrivateKey(data []byte) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("private key is not PEM encoded")
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse private key: %v", err)
+	}
+	rsaKey, ok := key.(*rsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("private key is not an RSA key")
+	}
+	return rsaKey, nil
+}
@@ -0,0 +1,118 @@
+package githubapp
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// tokenServer is a stub of the access_tokens endpoint that checks the JWT
+// and hands out numbered tokens
+func tokenServer(t *testing.T, key *rsa.PrivateKey, appID int64, expiresIn time.Duration, minted *int) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/app/installations/42/access_tokens" {
+			http.NotFound(w, r)
+			return
+		}
+		jwt := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		parts := strings.Split(jwt, ".")
+		if len(parts) != 3 {
+			http.Error(w, "bad jwt", http.StatusUnauthorized)
+			return
+		}
+		signature, _ := base64.RawURLEncoding.DecodeString(parts[2])
+		sum := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+		if err := rsa.VerifyPKCS1v15(&key.PublicKey, crypto.SHA256, sum[:], signature); err != nil {
+			http.Error(w, "bad signature", http.StatusUnauthorized)
+			return
+		}
+		claims := struct {
+			Iss int64 `json:"iss"`
+		}{}
+		payload, _ := base64.RawURLEncoding.DecodeString(parts[1])
+		if err := json.Unmarshal(payload, &claims); err != nil || claims.Iss != appID {
+			http.Error(w, "bad issuer", http.StatusUnauthorized)
+			return
+		}
+		*minted++
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(Token{
+			Token:     fmt.Sprintf("ghs_%d", *minted),
+			ExpiresAt: time.Now().Add(expiresIn),
+		})
+	}))
+}
+
+func newApp(t *testing.T, apiURL string) (App, *rsa.PrivateKey) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pemKey := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+	return App{ID: 7, InstallationID: 42, PrivateKey: pemKey, APIURL: apiURL}, key
+}
+
+func TestTokenIsCachedUntilItIsAboutToExpire(t *testing.T) {
+	minted := 0
+	app, key := newApp(t, "")
+	server := tokenServer(t, key, app.ID, time.Hour, &minted)
+	defer server.Close()
+	app.APIURL = server.URL
+
+	cache := NewTokenCache(server.Client())
+	token, err := cache.Token(context.TODO(), app)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token.Token != "ghs_1" {
+		t.Errorf("token = %q, want ghs_1", token.Token)
+	}
+	token, err = cache.Token(context.TODO(), app)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token.Token != "ghs_1" || minted != 1 {
+		t.Errorf("expected the cached token, got %q after %d mints", token.Token, minted)
+	}
+
+	// Close to the expiry, a new token replaces the cached one
+	cache.now = func() time.Time { return time.Now().Add(time.Hour - RefreshBefore + time.Minute) }
+	token, err = cache.Token(context.TODO(), app)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token.Token != "ghs_2" {
+		t.Errorf("token = %q, want ghs_2", token.Token)
+	}
+}
+
+func TestTokenReturnsErrorOnBadKey(t *testing.T) {
+	minted := 0
+	app, key := newApp(t, "")
+	server := tokenServer(t, key, app.ID, time.Hour, &minted)
+	defer server.Close()
+
+	// Signed by a key the server does not know
+	other, _ := newApp(t, server.URL)
+	if _, err := NewTokenCache(server.Client()).Token(context.TODO(), other); err == nil {
+		t.Error("expected an error for a token request with the wrong key")
+	}
+
+	app.APIURL = server.URL
+	app.PrivateKey = []byte("not a key")
+	if _, err := NewTokenCache(server.Client()).Token(context.TODO(), app); err == nil {
+		t.Error("expected an error for a bad private key")
+	}
+}
@@ -0,0 +1,263 @@
+// Package gitwebhook receives push events from GitHub, GitLab and Gitea.
+package gitwebhook
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-logr/logr"
+	giturl "github.com/whilp/git-urls"
+)
+
+// maxPayloadSize limits the size of a push event body
+const maxPayloadSize = 25 << 20
+
+// PushEvent is the information from a push that is needed to find affected
+// resources
+type PushEvent struct {
+	// Provider is one of "github", "gitlab" or "gitea"
+	Provider string
+	// Branch is the branch that was pushed to. It is empty when the push was
+	// not to a branch, eg a tag.
+	Branch string
+	// DefaultBranch is the repo's default branch when the provider sends it
+	DefaultBranch string
+	// Commit is the new head of the branch
+	Commit string
+	// RepoURLs are the urls the repo can be cloned from
+	RepoURLs []string
+}
+
+// Handler is an http.Handler for push events. Requests must be signed with
+// the shared secret.
+type Handler struct {
+	Secret []byte
+	OnPush func(PushEvent)
+	Log    logr.Logger
+}
+
+// ServeHTTP verifies and parses the request and calls OnPush for push events.
+// Events other than push events are acknowledged and ignored.
+func (h Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxPayloadSize))
+	if err != nil {
+		http.Error(w, "unable to read body", http.StatusBadRequest)
+		return
+	}
+
+	provider := Provider(r.Header)
+	if provider == "" {
+		http.Error(w, "unknown event source", http.StatusBadRequest)
+		return
+	}
+	if err := Verify(provider, r.Header, body, h.Secret); err != nil {
+		if h.Log != nil {
+			h.Log.Info(fmt.Sprintf("Rejected %s webhook: %v", provider, err))
+		}
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	if !isPush(provider, r.Header) {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	event, err := Parse(provider, body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if h.Log != nil {
+		h.Log.V(1).Info(fmt.Sprintf("Received %s push to '%s' of %v", provider, event.Branch, event.RepoURLs))
+	}
+	if h.OnPush != nil {
+		h.OnPush(event)
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// Provider finds which scm sent the request from the event headers
+func Provider(header http.Header) string {
+	switch {
+	case header.Get("X-Gitea-Event") != "":
+		// Gitea also sends the X-GitHub-Event header, so it is checked first
+		return "gitea"
+	case header.Get("X-GitHub-Event") != "":
+		return "github"
+	case header.Get("X-Gitlab-Event") != "":
+		return "gitlab"
+	}
+	return ""
+}
+
+func isPush(provider string, header http.Header) bool {
+	switch provider {
+	case "github":
+		return header.Get("X-GitHub-Event") == "push"
+	case "gitea":
+		return header.Get("X-Gitea-Event") == "push"
+	case "gitlab":
+		return header.Get("X-Gitlab-Event") == "Push Hook"
+	}
+	return false
+}
+
+// Verify checks the request was sent with the shared secret. GitHub and Gitea
+// sign the body with HMAC-SHA256. GitLab sends the secret as a token.
+func Verify(provider string, header http.Header, body, secret []byte) error {
+	if len(secret) == 0 {
+		return fmt.Errorf("no secret configured")
+	}
+	switch provider {
+	case "github":
+		signature := strings.TrimPrefix(header.Get("X-Hub-Signature-256"), "sha256=")
+		return verifyHMAC(signature, body, secret)
+	case "gitea":
+		return verifyHMAC(header.Get("X-Gitea-Signature"), body, secret)
+	case "gitlab":
+		token := header.Get("X-Gitlab-Token")
+		if subtle.ConstantTimeCompare([]byte(token), secret) != 1 {
+			return fmt.Errorf("token mismatch")
+		}
+		return nil
+	}
+	return fmt.Errorf("unknown provider '%s'", provider)
+}
+
+func verifyHMAC(signature string, body, secret []byte) error {
+	if signature == "" {
+		return fmt.Errorf("missing signature")
+	}
+	got, err := hex.DecodeString(signature)
+	if err != nil {
+		return fmt.Errorf("malformed signature")
+	}
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(body)
+	if !hmac.Equal(got, mac.Sum(nil)) {
+		return fmt.Errorf("signature mismatch")
+	}
+	return nil
+}
+
+type repository struct {
+	CloneURL      string `json:"clone_url"`
+	SSHURL        string `json:"ssh_url"`
+	HTMLURL       string `json:"html_url"`
+	GitHTTPURL    string `json:"git_http_url"`
+	GitSSHURL     string `json:"git_ssh_url"`
+	WebURL        string `json:"web_url"`
+	DefaultBranch string `json:"default_branch"`
+}
+
+type pushPayload struct {
+	Ref         string      `json:"ref"`
+	After       string      `json:"after"`
+	CheckoutSHA string      `json:"checkout_sha"`
+	Repository  repository  `json:"repository"`
+	Project     *repository `json:"project"`
+}
+
+// Parse reads the push event payload of the provider
+func Parse(provider string, body []byte) (PushEvent, error) {
+	var payload pushPayload
+	err := json.Unmarshal(body, &payload)
+	if err != nil {
+		return PushEvent{}, fmt.Errorf("unable to parse %s push event: %v", provider, err)
+	}
+
+	repo := payload.Repository
+	if provider == "gitlab" && payload.Project != nil {
+		repo = *payload.Project
+	}
+
+	event := PushEvent{
+		Provider:      provider,
+		Commit:        payload.After,
+		DefaultBranch: repo.DefaultBranch,
+	}
+	if payload.CheckoutSHA != "" {
+		event.Commit = payload.CheckoutSHA
+	}
+	if strings.HasPrefix(payload.Ref, "refs/heads/") {
+		event.Branch = strings.TrimPrefix(payload.Ref, "refs/heads/")
+	}
+	for _, u := range []string{repo.CloneURL, repo.SSHURL, repo.HTMLURL, repo.GitHTTPURL, repo.GitSSHURL, repo.WebURL} {
+		if u != "" {
+			event.RepoURLs = append(event.RepoURLs, u)
+		}
+	}
+	if len(event.RepoURLs) == 0 {
+		return event, fmt.Errorf("no repository url in %s push event", provider)
+	}
+	return event, nil
+}
+
+// NormalizeURL reduces a git url to "host/path" so that the ssh and https
+// urls of a repo compare equal. The user, port, scheme and ".git" suffix are
+// dropped.
+func NormalizeURL(rawURL string) string {
+	u, err := giturl.Parse(strings.TrimPrefix(rawURL, "git::"))
+	if err != nil {
+		return strings.ToLower(rawURL)
+	}
+	host := u.Hostname()
+	path := strings.Trim(u.Path, "/")
+	path = strings.TrimSuffix(path, ".git")
+	return strings.ToLower(host + "/" + path)
+}
+
+// Matches returns true when the url is one of the event's repo urls
+func (e PushEvent) Matches(rawURL string) bool {
+	want := NormalizeURL(rawURL)
+	for _, u := range e.RepoURLs {
+		if NormalizeURL(u) == want {
+			return true
+		}
+	}
+	return false
+}
+
+// Server serves the Handler until the context is done. It implements the
+// controller-runtime manager.Runnable interface.
+type Server struct {
+	Addr    string
+	Handler http.Handler
+}
+
+// Start listens on Addr and blocks until the context is done
+func (s Server) Start(ctx context.Context) error {
+	mux := http.NewServeMux()
+	mux.Handle("/", s.Handler)
+	srv := &http.Server{
+		Addr:    s.Addr,
+		Handler: mux,
+	}
+
+	errChan := make(chan error, 1)
+	go func() {
+		errChan <- srv.ListenAndServe()
+	}()
+
+	select {
+	case err := <-errChan:
+		return fmt.Errorf("git webhook server stopped: %v", err)
+	case <-ctx.Done():
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		return srv.Shutdown(shutdownCtx)
+	}
+}
@@ -0,0 +1,159 @@
+package gitwebhook
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+const githubPush = `{
+  "ref": "refs/heads/main",
+  "after": "0d1a26e67d8f5eaf1f6ba5c57fc3c7d91ac0fd1c",
+  "repository": {
+    "clone_url": "https://github.com/example/infra.git",
+    "ssh_url": "git@github.com:example/infra.git",
+    "html_url": "https://github.com/example/infra",
+    "default_branch": "main"
+  }
+}`
+
+const gitlabPush = `{
+  "object_kind": "push",
+  "ref": "refs/heads/feature",
+  "checkout_sha": "da1560886d4f094c3e6c9ef40349f7d38b5d27d7",
+  "project": {
+    "git_http_url": "https://gitlab.example.com/group/infra.git",
+    "git_ssh_url": "git@gitlab.example.com:group/infra.git",
+    "default_branch": "master"
+  }
+}`
+
+func sign(secret, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func TestHandler(t *testing.T) {
+	secret := []byte("s3cr3t")
+	tests := []struct {
+		name       string
+		body       string
+		header     map[string]string
+		wantStatus int
+		wantBranch string
+	}{
+		{
+			name: "github push",
+			body: githubPush,
+			header: map[string]string{
+				"X-GitHub-Event":      "push",
+				"X-Hub-Signature-256": "sha256=" + sign(secret, []byte(githubPush)),
+			},
+			wantStatus: http.StatusAccepted,
+			wantBranch: "main",
+		},
+		{
+			name: "github bad signature",
+			body: githubPush,
+			header: map[string]string{
+				"X-GitHub-Event":      "push",
+				"X-Hub-Signature-256": "sha256=" + sign([]byte("wrong"), []byte(githubPush)),
+			},
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name: "github ping",
+			body: `{}`,
+			header: map[string]string{
+				"X-GitHub-Event":      "ping",
+				"X-Hub-Signature-256": "sha256=" + sign(secret, []byte(`{}`)),
+			},
+			wantStatus: http.StatusNoContent,
+		},
+		{
+			name: "gitea push",
+			body: githubPush,
+			header: map[string]string{
+				"X-GitHub-Event":    "push",
+				"X-Gitea-Event":     "push",
+				"X-Gitea-Signature": sign(secret, []byte(githubPush)),
+			},
+			wantStatus: http.StatusAccepted,
+			wantBranch: "main",
+		},
+		{
+			name: "gitlab push",
+			body: gitlabPush,
+			header: map[string]string{
+				"X-Gitlab-Event": "Push Hook",
+				"X-Gitlab-Token": string(secret),
+			},
+			wantStatus: http.StatusAccepted,
+			wantBranch: "feature",
+		},
+		{
+			name: "gitlab bad token",
+			body: gitlabPush,
+			header: map[string]string{
+				"X-Gitlab-Event": "Push Hook",
+				"X-Gitlab-Token": "wrong",
+			},
+			wantStatus: http.StatusUnauthorized,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got *PushEvent
+			h := Handler{Secret: secret, OnPush: func(e PushEvent) { got = &e }}
+			req := httptest.NewRequest(http.MethodPost, "/", bytes.NewBufferString(tt.body))
+			for k, v := range tt.header {
+				req.Header.Set(k, v)
+			}
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+			if tt.wantBranch == "" {
+				if got != nil {
+					t.Errorf("OnPush should not have been called, got %+v", got)
+				}
+				return
+			}
+			if got == nil {
+				t.Fatal("OnPush was not called")
+			}
+			if got.Branch != tt.wantBranch {
+				t.Errorf("branch = %q, want %q", got.Branch, tt.wantBranch)
+			}
+		})
+	}
+}
+
+func TestPushEventMatches(t *testing.T) {
+	event, err := Parse("github", []byte(githubPush))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, u := range []string{
+		"https://github.com/example/infra.git",
+		"git::https://github.com/example/infra",
+		"git@github.com:example/infra.git",
+		"ssh://git@github.com:22/example/infra.git",
+		"https://GitHub.com/example/infra",
+	} {
+		if !event.Matches(u) {
+			t.Errorf("expected %s to match", u)
+		}
+	}
+	if event.Matches("https://github.com/example/other.git") {
+		t.Error("expected a different repo not to match")
+	}
+}
@@ -0,0 +1,99 @@
+package notifier
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"text/template"
+	"time"
+)
+
+// SignatureHeader is the header that holds the HMAC-SHA256 signature of the
+// request body when a signing secret is configured
+const SignatureHeader = "X-TFO-Signature"
+
+// Payload is the data sent to a notification endpoint
+type Payload struct {
+	Event       string    `json:"event"`
+	Name        string    `json:"name"`
+	Namespace   string    `json:"namespace"`
+	Generation  int64     `json:"generation"`
+	PodType     string    `json:"podType"`
+	PodName     string    `json:"podName,omitempty"`
+	State       string    `json:"state"`
+	Reason      string    `json:"reason,omitempty"`
+	PlanSummary string    `json:"planSummary,omitempty"`
+	Log         string    `json:"log,omitempty"`
+	Timestamp   time.Time `json:"timestamp"`
+}
+
+// Endpoint is where and how a payload gets sent
+type Endpoint struct {
+	URL      string
+	Secret   []byte
+	Template string
+}
+
+// Render returns the request body for the payload. When a template is
+// defined it is executed with the payload, otherwise the payload is
+// marshaled as json.
+func Render(tmpl string, payload Payload) ([]byte, error) {
+	if tmpl == "" {
+		return json.Marshal(payload)
+	}
+	t, err := template.New("notification").Parse(tmpl)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse template: %v", err)
+	}
+	var b bytes.Buffer
+	err = t.Execute(&b, payload)
+	if err != nil {
+		return nil, fmt.Errorf("unable to execute template: %v", err)
+	}
+	return b.Bytes(), nil
+}
+
+// Sign returns the hex encoded HMAC-SHA256 of body prefixed by "sha256="
+func Sign(secret, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Send POSTs the rendered payload to the endpoint. A non-2xx response is
+// returned as an error.
+func Send(ctx context.Context, client *http.Client, endpoint Endpoint, payload Payload) error {
+	body, err := Render(endpoint.Template, payload)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, endpoint.URL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("unable to create request: %v", err)
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "terraform-operator")
+	if len(endpoint.Secret) > 0 {
+		req.Header.Set(SignatureHeader, Sign(endpoint.Secret, body))
+	}
+
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("unable to send notification to %s: %v", endpoint.URL, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("notification to %s returned %s", endpoint.URL, resp.Status)
+	}
+	return nil
+}
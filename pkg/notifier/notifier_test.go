@@ -0,0 +1,81 @@
+package notifier
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestSendSignsJSONPayload(t *testing.T) {
+	secret := []byte("s3cr3t")
+	var gotBody []byte
+	var gotSignature string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotBody, _ = ioutil.ReadAll(r.Body)
+		gotSignature = r.Header.Get(SignatureHeader)
+	}))
+	defer server.Close()
+
+	payload := Payload{
+		Event:       "plan-ready",
+		Name:        "my-stack",
+		Namespace:   "default",
+		Generation:  2,
+		PlanSummary: "Plan: 1 to add, 0 to change, 0 to destroy.",
+	}
+	err := Send(context.TODO(), server.Client(), Endpoint{URL: server.URL, Secret: secret}, payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want := Sign(secret, gotBody); gotSignature != want {
+		t.Errorf("signature = %q, want %q", gotSignature, want)
+	}
+	var got Payload
+	if err := json.Unmarshal(gotBody, &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Event != payload.Event || got.PlanSummary != payload.PlanSummary {
+		t.Errorf("got payload %+v, want %+v", got, payload)
+	}
+}
+
+func TestSendRendersTemplate(t *testing.T) {
+	var gotBody []byte
+	var gotSignature string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotBody, _ = ioutil.ReadAll(r.Body)
+		gotSignature = r.Header.Get(SignatureHeader)
+	}))
+	defer server.Close()
+
+	endpoint := Endpoint{
+		URL:      server.URL,
+		Template: `{"text": "{{ .Namespace }}/{{ .Name }} {{ .Event }}"}`,
+	}
+	err := Send(context.TODO(), server.Client(), endpoint, Payload{Event: "apply-failed", Name: "my-stack", Namespace: "default"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `{"text": "default/my-stack apply-failed"}`; string(gotBody) != want {
+		t.Errorf("body = %s, want %s", gotBody, want)
+	}
+	if gotSignature != "" {
+		t.Errorf("expected no signature without a secret, got %q", gotSignature)
+	}
+}
+
+func TestSendReturnsErrorOnBadStatus(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	err := Send(context.TODO(), server.Client(), Endpoint{URL: server.URL}, Payload{Event: "run-started"})
+	if err == nil {
+		t.Fatal("expected an error for a 500 response")
+	}
+}
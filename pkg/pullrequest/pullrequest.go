@@ -0,0 +1,214 @@
+// Package pullrequest opens pull requests, merge requests in GitLab, through
+// the api of a git host. GitHub, GitLab and Gitea are supported.
+package pullrequest
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// The supported providers
+const (
+	GitHub = "github"
+	GitLab = "gitlab"
+	Gitea  = "gitea"
+)
+
+// Request is a pull request from the Head branch into the Base branch
+type Request struct {
+	// Repo is the path of the repo on the host, eg "org/repo"
+	Repo  string
+	Head  string
+	Base  string
+	Title string
+	Body  string
+}
+
+// Client opens pull requests on a git host
+type Client interface {
+	// Open opens the pull request unless one from the same head into the
+	// same base is open. It returns the url of the pull request.
+	Open(ctx context.Context, r Request) (string, error)
+}
+
+// DefaultAPIURL is the api of the provider on the host. GitHub Enterprise
+// and self-hosted GitLab and Gitea serve their api on the git host.
+func DefaultAPIURL(provider, host string) string {
+	switch provider {
+	case GitHub:
+		if host == "github.com" {
+			return "https://api.github.com"
+		}
+		return fmt.Sprintf("https://%s/api/v3", host)
+	case GitLab:
+		return fmt.Sprintf("https://%s/api/v4", host)
+	case Gitea:
+		return fmt.Sprintf("https://%s/api/v1", host)
+	}
+	return ""
+}
+
+// New returns the client of the provider. The apiURL defaults to
+// DefaultAPIURL of the host. The token authenticates the requests.
+func New(provider, host, apiURL, token string, httpClient *http.Client) (Client, error) {
+	if apiURL == "" {
+		apiURL = DefaultAPIURL(provider, host)
+	}
+	if httpClient == nil {
+		httpClient = &http.Client{Timeout: 30 * time.Second}
+	}
+	a := api{url: strings.TrimSuffix(apiURL, "/"), client: httpClient}
+	switch provider {
+	case GitHub:
+		a.header = http.Header{"Authorization": {"token " + token}, "Accept": {"application/vnd.github.v3+json"}}
+		return github{a}, nil
+	case GitLab:
+		a.header = http.Header{"Private-Token": {token}}
+		return gitlab{a}, nil
+	case Gitea:
+		a.header = http.Header{"Authorization": {"token " + token}}
+		return gitea{a}, nil
+	}
+	return nil, fmt.Errorf("unsupported pull request provider '%s'", provider)
+}
+
+// api sends json requests to the api of a provider
+type api struct {
+	url    string
+	header http.Header
+	client *http.Client
+}
+
+// do sends in as the request body when it is not nil and decodes the
+// response into out. A non-2xx response is returned as an error.
+func (a api) do(ctx context.Context, method, path string, in, out interface{}) error {
+	var body []byte
+	if in != nil {
+		var err error
+		body, err = json.Marshal(in)
+		if err != nil {
+			return err
+		}
+	}
+	req, err := http.NewRequestWithContext(ctx, method, a.url+path, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("unable to create request: %v", err)
+	}
+	for k, v := range a.header {
+		req.Header[k] = v
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "terraform-operator")
+
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("unable to reach %s: %v", a.url, err)
+	}
+	defer resp.Body.Close()
+	respBody, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("unable to read response of %s %s: %v", method, path, err)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("%s %s returned %s: %s", method, path, resp.Status, strings.TrimSpace(string(respBody)))
+	}
+	err = json.Unmarshal(respBody, out)
+	if err != nil {
+		return fmt.Errorf("unable to parse response of %s %s: %v", method, path, err)
+	}
+	return nil
+}
+
+type github struct{ api }
+
+func (g github) Open(ctx context.Context, r Request) (string, error) {
+	type pull struct {
+		HTMLURL string `json:"html_url"`
+	}
+	owner := strings.Split(r.Repo, "/")[0]
+	query := url.Values{"state": {"open"}, "head": {owner + ":" + r.Head}, "base": {r.Base}}
+	open := []pull{}
+	err := g.do(ctx, http.MethodGet, fmt.Sprintf("/repos/%s/pulls?%s", r.Repo, query.Encode()), nil, &open)
+	if err != nil {
+		return "", err
+	}
+	if len(open) > 0 {
+		return open[0].HTMLURL, nil
+	}
+
+	created := pull{}
+	err = g.do(ctx, http.MethodPost, fmt.Sprintf("/repos/%s/pulls", r.Repo), map[string]string{
+		"title": r.Title,
+		"body":  r.Body,
+		"head":  r.Head,
+		"base":  r.Base,
+	}, &created)
+	return created.HTMLURL, err
+}
+
+type gitlab struct{ api }
+
+func (g gitlab) Open(ctx context.Context, r Request) (string, error) {
+	type mergeRequest struct {
+		WebURL string `json:"web_url"`
+	}
+	project := url.PathEscape(r.Repo)
+	query := url.Values{"state": {"opened"}, "source_branch": {r.Head}, "target_branch": {r.Base}}
+	open := []mergeRequest{}
+	err := g.do(ctx, http.MethodGet, fmt.Sprintf("/projects/%s/merge_requests?%s", project, query.Encode()), nil, &open)
+	if err != nil {
+		return "", err
+	}
+	if len(open) > 0 {
+		return open[0].WebURL, nil
+	}
+
+	created := mergeRequest{}
+	err = g.do(ctx, http.MethodPost, fmt.Sprintf("/projects/%s/merge_requests", project), map[string]string{
+		"title":         r.Title,
+		"description":   r.Body,
+		"source_branch": r.Head,
+		"target_branch": r.Base,
+	}, &created)
+	return created.WebURL, err
+}
+
+type gitea struct{ api }
+
+func (g gitea) Open(ctx context.Context, r Request) (string, error) {
+	type branch struct {
+		Ref string `json:"ref"`
+	}
+	type pull struct {
+		HTMLURL string `json:"html_url"`
+		Head    branch `json:"head"`
+		Base    branch `json:"base"`
+	}
+	// Gitea does not filter the pulls by branch
+	open := []pull{}
+	err := g.do(ctx, http.MethodGet, fmt.Sprintf("/repos/%s/pulls?state=open&limit=50", r.Repo), nil, &open)
+	if err != nil {
+		return "", err
+	}
+	for _, p := range open {
+		if p.Head.Ref == r.Head && p.Base.Ref == r.Base {
+			return p.HTMLURL, nil
+		}
+	}
+
+	created := pull{}
+	err = g.do(ctx, http.MethodPost, fmt.Sprintf("/repos/%s/pulls", r.Repo), map[string]string{
+		"title": r.Title,
+		"body":  r.Body,
+		"head":  r.Head,
+		"base":  r.Base,
+	}, &created)
+	return created.HTMLURL, err
+}
@@ -0,0 +1,121 @@
+package pullrequest
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// providerServer is a stub of a provider's api. It lists the open pull
+// requests and records the created ones.
+func providerServer(t *testing.T, listPath, createPath, authHeader, auth string, open []map[string]interface{}, created *map[string]string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if got := r.Header.Get(authHeader); got != auth {
+			t.Errorf("expected %s '%s', got '%s'", authHeader, auth, got)
+		}
+		switch {
+		case r.Method == http.MethodGet && r.URL.RequestURI() == listPath:
+			json.NewEncoder(w).Encode(open)
+		case r.Method == http.MethodPost && r.URL.EscapedPath() == createPath:
+			json.NewDecoder(r.Body).Decode(created)
+			w.WriteHeader(http.StatusCreated)
+			w.Write([]byte(`{"html_url": "https://host/pulls/2", "web_url": "https://host/merge_requests/2"}`))
+		default:
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.RequestURI())
+			http.NotFound(w, r)
+		}
+	}))
+}
+
+func TestOpen(t *testing.T) {
+	request := Request{Repo: "org/tfvars", Head: "export", Base: "main", Title: "Update tfvars", Body: "body"}
+	for _, tc := range []struct {
+		provider, listPath, createPath, authHeader, auth, openURL, createdURL string
+		open                                                                  []map[string]interface{}
+	}{
+		{
+			provider:   GitHub,
+			listPath:   "/repos/org/tfvars/pulls?base=main&head=org%3Aexport&state=open",
+			createPath: "/repos/org/tfvars/pulls",
+			authHeader: "Authorization",
+			auth:       "token secret",
+			open:       []map[string]interface{}{{"html_url": "https://host/pulls/1"}},
+			openURL:    "https://host/pulls/1",
+			createdURL: "https://host/pulls/2",
+		},
+		{
+			provider:   GitLab,
+			listPath:   "/projects/org%2Ftfvars/merge_requests?source_branch=export&state=opened&target_branch=main",
+			createPath: "/projects/org%2Ftfvars/merge_requests",
+			authHeader: "Private-Token",
+			auth:       "secret",
+			open:       []map[string]interface{}{{"web_url": "https://host/merge_requests/1"}},
+			openURL:    "https://host/merge_requests/1",
+			createdURL: "https://host/merge_requests/2",
+		},
+		{
+			provider:   Gitea,
+			listPath:   "/repos/org/tfvars/pulls?state=open&limit=50",
+			createPath: "/repos/org/tfvars/pulls",
+			authHeader: "Authorization",
+			auth:       "token secret",
+			open: []map[string]interface{}{
+				{"html_url": "https://host/pulls/0", "head": map[string]string{"ref": "other"}, "base": map[string]string{"ref": "main"}},
+				{"html_url": "https://host/pulls/1", "head": map[string]string{"ref": "export"}, "base": map[string]string{"ref": "main"}},
+			},
+			openURL:    "https://host/pulls/1",
+			createdURL: "https://host/pulls/2",
+		},
+	} {
+		created := map[string]string{}
+		server := providerServer(t, tc.listPath, tc.createPath, tc.authHeader, tc.auth, tc.open, &created)
+		client, err := New(tc.provider, "host", server.URL, "secret", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		url, err := client.Open(context.Background(), request)
+		if err != nil {
+			t.Errorf("%s: %v", tc.provider, err)
+		}
+		if url != tc.openURL || len(created) != 0 {
+			t.Errorf("%s: expected the open pull request %s to be reused, got %s", tc.provider, tc.openURL, url)
+		}
+
+		server.Close()
+		server = providerServer(t, tc.listPath, tc.createPath, tc.authHeader, tc.auth, nil, &created)
+		client, _ = New(tc.provider, "host", server.URL, "secret", nil)
+		url, err = client.Open(context.Background(), request)
+		if err != nil {
+			t.Errorf("%s: %v", tc.provider, err)
+		}
+		if url != tc.createdURL || created["title"] != "Update tfvars" {
+			t.Errorf("%s: expected a new pull request, got %s %v", tc.provider, url, created)
+		}
+		server.Close()
+	}
+}
+
+func TestNew(t *testing.T) {
+	if _, err := New("bitbucket", "host", "", "token", nil); err == nil {
+		t.Error("expected an error for an unsupported provider")
+	}
+	for provider, expected := range map[string]string{
+		GitHub: "https://api.github.com",
+		GitLab: "https://gitlab.com/api/v4",
+		Gitea:  "https://gitlab.com/api/v1",
+	} {
+		host := "gitlab.com"
+		if provider == GitHub {
+			host = "github.com"
+		}
+		if got := DefaultAPIURL(provider, host); got != expected {
+			t.Errorf("%s: expected %s, got %s", provider, expected, got)
+		}
+	}
+	if got := DefaultAPIURL(GitHub, "github.example.com"); got != "https://github.example.com/api/v3" {
+		t.Errorf("expected the GitHub Enterprise api, got %s", got)
+	}
+}
@@ -1,5 +1,13 @@
 #!/bin/bash -e
 
+# https is sent through the sshTunnels with a SOCKS5 proxy for each
+# "address=alias" when the image has ssh. They stop with the container.
+if command -v ssh >/dev/null; then
+  for proxy in $TFO_SOCKS5_PROXIES; do
+    ssh -f -N -o ExitOnForwardFailure=yes -D "${proxy%%=*}" "${proxy#*=}"
+  done
+fi
+
 cd "$TFO_MAIN_MODULE"
 out="$TFO_ROOT_PATH"/generations/$TFO_GENERATION
 mkdir -p "$out"
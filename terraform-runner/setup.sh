@@ -1,21 +1,40 @@
 #!/bin/sh -e
+# The credential helper and url rules of each git host
+rm -f "$TFO_ROOT_PATH"/.gitconfig
+if [[ -f "$TFO_GIT_CONFIG" ]]; then
+    cp -L "$TFO_GIT_CONFIG" "$TFO_ROOT_PATH"/.gitconfig
+fi
+mkdir -p "$TFO_ROOT_PATH"/.ssh/
+if stat "$TFO_SSH"/* >/dev/null 2>/dev/null; then
+  cp -Lr "$TFO_SSH"/* "$TFO_ROOT_PATH"/.ssh/
+  chmod -R 0600 "$TFO_ROOT_PATH"/.ssh/*
+fi
+# https is sent through the sshTunnels with a SOCKS5 proxy for each
+# "address=alias". They stop with the container.
+for proxy in $TFO_SOCKS5_PROXIES; do
+    ssh -f -N -o ExitOnForwardFailure=yes -D "${proxy%%=*}" "${proxy#*=}" || exit $?
+done
 if [[ -d "$TFO_MAIN_MODULE" ]]; then
     rm -rf "$TFO_MAIN_MODULE"
 fi
-MAIN_MODULE_TMP=`mktemp -d`
-git clone "$TFO_MAIN_MODULE_REPO" "$MAIN_MODULE_TMP/stack" || exit $?
-cd "$MAIN_MODULE_TMP/stack"
-git checkout "$TFO_MAIN_MODULE_REPO_REF"
-cp -r "$TFO_MAIN_MODULE_REPO_SUBDIR" "$TFO_MAIN_MODULE"
+if [[ -n "$TFO_MAIN_MODULE_INLINE" ]]; then
+    # The files of an inline module are mounted from its configmap
+    mkdir -p "$TFO_MAIN_MODULE"
+    cp -L "$TFO_MAIN_MODULE_INLINE"/* "$TFO_MAIN_MODULE" || exit $?
+elif [[ -n "$TFO_MAIN_MODULE_ADDR" ]]; then
+    # Archives, s3 buckets and local paths are downloaded with go-getter
+    go-getter "$TFO_MAIN_MODULE_ADDR" "$TFO_MAIN_MODULE" || exit $?
+else
+    MAIN_MODULE_TMP=`mktemp -d`
+    git clone "$TFO_MAIN_MODULE_REPO" "$MAIN_MODULE_TMP/stack" || exit $?
+    cd "$MAIN_MODULE_TMP/stack"
+    git checkout "$TFO_MAIN_MODULE_REPO_REF"
+    cp -r "$TFO_MAIN_MODULE_REPO_SUBDIR" "$TFO_MAIN_MODULE"
+fi
 
 # Get configmap and secret files and drop them in the main module's root path
 # Do not overwrite configmap
 false |  cp -iLr "$TFO_DOWNLOADS"/* "$TFO_MAIN_MODULE" 2>/dev/null
-mkdir -p "$TFO_ROOT_PATH"/.ssh/
-if stat "$TFO_SSH"/* >/dev/null 2>/dev/null; then
-  cp -Lr "$TFO_SSH"/* "$TFO_ROOT_PATH"/.ssh/
-  chmod -R 0600 "$TFO_ROOT_PATH"/.ssh/*
-fi
 
 cd "$TFO_MAIN_MODULE"
 
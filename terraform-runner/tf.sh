@@ -13,6 +13,12 @@ if ! version_gt_or_eq "0.15.0" "$terraform_version"; then
   module="."
 fi
 
+# https is sent through the sshTunnels with a SOCKS5 proxy for each
+# "address=alias". They stop with the container.
+for proxy in $TFO_SOCKS5_PROXIES; do
+  ssh -f -N -o ExitOnForwardFailure=yes -D "${proxy%%=*}" "${proxy#*=}"
+done
+
 cd "$TFO_MAIN_MODULE"
 out="$TFO_ROOT_PATH"/generations/$TFO_GENERATION
 mkdir -p "$out"